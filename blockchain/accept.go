@@ -6,6 +6,8 @@
 package blockchain
 
 import (
+	"fmt"
+
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
 )
@@ -35,6 +37,14 @@ func (b *BlockChain) maybeAcceptBlock(block *provautil.Block, flags BehaviorFlag
 		return false, err
 	}
 
+	// Reject blocks which extend a block that is already known to be
+	// invalid since they can't be valid either.
+	if prevNode != nil && prevNode.status.KnownInvalid() {
+		str := fmt.Sprintf("previous block %v is known to be invalid",
+			prevNode.hash)
+		return false, ruleError(ErrInvalidAncestorBlock, str)
+	}
+
 	// The block must pass all of the validation rules which depend on the
 	// position of the block within the block chain.
 	err = b.checkBlockContext(block, prevNode, flags)
@@ -51,21 +61,27 @@ func (b *BlockChain) maybeAcceptBlock(block *provautil.Block, flags BehaviorFlag
 	// expensive connection logic.  It also has some other nice properties
 	// such as making blocks that never become part of the main chain or
 	// blocks that fail to connect available for further analysis.
+	//
+	// The block node is stored in the block index along with it unless
+	// running in dry run mode.
+	blockHeader := &block.MsgBlock().Header
+	newNode := newBlockNode(blockHeader, block.Hash(), prevNode)
+	newNode.status = statusDataStored
 	err = b.db.Update(func(dbTx database.Tx) error {
-		return dbMaybeStoreBlock(dbTx, block)
+		err := dbMaybeStoreBlock(dbTx, block)
+		if err != nil || dryRun {
+			return err
+		}
+		return dbStoreBlockNode(dbTx, newNode)
 	})
 	if err != nil {
 		return false, err
 	}
 
-	// Create a new block node for the block and add it to the in-memory
-	// block chain (could be either a side chain or the main chain).
-	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, block.Hash())
-	if prevNode != nil {
-		newNode.parent = prevNode
-		newNode.height = blockHeader.Height
-		newNode.workSum.Add(prevNode.workSum, newNode.workSum)
+	// Add the new block node to the memory block index (could be either a
+	// side chain or the main chain).
+	if !dryRun {
+		b.addBlockNode(newNode)
 	}
 
 	// Connect the passed block to the chain while respecting proper chain
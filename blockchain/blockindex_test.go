@@ -0,0 +1,167 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// chainedNodes returns the specified number of nodes constructed such that each
+// subsequent node points to the previous one to create a chain.  The first node
+// will point to the passed parent which can be nil if desired.
+func chainedNodes(parent *blockNode, numNodes int) []*blockNode {
+	nodes := make([]*blockNode, numNodes)
+	tip := parent
+	for i := 0; i < numNodes; i++ {
+		// This is invalid, but all that is needed is enough to get the
+		// synthetic tests to work.
+		header := wire.BlockHeader{Nonce: uint64(i), Bits: 0x207fffff}
+		if tip != nil {
+			header.PrevBlock = *tip.hash
+			header.Height = tip.height + 1
+		}
+		blockHash := header.BlockHash()
+		nodes[i] = newBlockNode(&header, &blockHash, tip)
+		tip = nodes[i]
+	}
+	return nodes
+}
+
+// TestBlockNodeAncestor ensures the ancestors found by following the skip
+// pointers are the same as when walking back one parent at a time, on both the
+// main chain and a side chain.
+func TestBlockNodeAncestor(t *testing.T) {
+	mainNodes := chainedNodes(nil, 1000)
+	sideNodes := chainedNodes(mainNodes[499], 250)
+
+	for _, nodes := range [][]*blockNode{mainNodes, sideNodes} {
+		tip := nodes[len(nodes)-1]
+		for height := uint32(0); height <= tip.height; height++ {
+			want := tip
+			for want.height > height {
+				want = want.parent
+			}
+			if got := tip.Ancestor(height); got != want {
+				t.Fatalf("Ancestor(%d) of %d: got height %d, want "+
+					"height %d", height, tip.height, got.height,
+					want.height)
+			}
+		}
+		if got := tip.Ancestor(tip.height + 1); got != nil {
+			t.Fatalf("Ancestor: got node at height %d for height "+
+				"beyond tip, want nil", got.height)
+		}
+	}
+
+	tip := sideNodes[len(sideNodes)-1]
+	if got := tip.RelativeAncestor(250); got != mainNodes[499] {
+		t.Fatalf("RelativeAncestor: got height %d, want fork point",
+			got.height)
+	}
+	if got := tip.RelativeAncestor(tip.height); got != mainNodes[0] {
+		t.Fatalf("RelativeAncestor: got height %d, want genesis",
+			got.height)
+	}
+	if got := tip.RelativeAncestor(tip.height + 1); got != nil {
+		t.Fatalf("RelativeAncestor: got height %d, want nil", got.height)
+	}
+
+	// The work sum accumulates the work of all ancestors.
+	if tip.workSum.Cmp(mainNodes[999].workSum) >= 0 ||
+		tip.workSum.Cmp(mainNodes[749].workSum) != 0 {
+
+		t.Fatalf("unexpected work sum %v", tip.workSum)
+	}
+}
+
+// TestBlockStatus ensures the validation status flags are interpreted as
+// expected.
+func TestBlockStatus(t *testing.T) {
+	tests := []struct {
+		status       blockStatus
+		haveData     bool
+		knownValid   bool
+		knownInvalid bool
+	}{
+		{statusNone, false, false, false},
+		{statusDataStored, true, false, false},
+		{statusDataStored | statusValid, true, true, false},
+		{statusDataStored | statusValidateFailed, true, false, true},
+		{statusInvalidAncestor, false, false, true},
+	}
+	for i, test := range tests {
+		if test.status.HaveData() != test.haveData ||
+			test.status.KnownValid() != test.knownValid ||
+			test.status.KnownInvalid() != test.knownInvalid {
+
+			t.Errorf("#%d: unexpected flags for status %08b", i,
+				test.status)
+		}
+	}
+}
+
+// TestBlockIndexEntrySerialization ensures serializing and deserializing block
+// index entries works as expected.
+func TestBlockIndexEntrySerialization(t *testing.T) {
+	header := wire.BlockHeader{
+		Version:    4,
+		PrevBlock:  chainhash.Hash{0x01},
+		MerkleRoot: chainhash.Hash{0x02},
+		Timestamp:  time.Unix(1490825340, 0),
+		Bits:       0x207fffff,
+		Height:     12,
+		Size:       326,
+		Nonce:      9,
+	}
+	header.ValidatingPubKey[0] = 0x03
+	header.Signature[0] = 0x04
+	status := statusDataStored | statusValidateFailed
+
+	serialized, err := serializeBlockIndexEntry(&header, status)
+	if err != nil {
+		t.Fatalf("serializeBlockIndexEntry: unexpected error: %v", err)
+	}
+	if len(serialized) != wire.MaxBlockHeaderPayload+1 {
+		t.Fatalf("serializeBlockIndexEntry: got %d bytes, want %d",
+			len(serialized), wire.MaxBlockHeaderPayload+1)
+	}
+	gotHeader, gotStatus, err := deserializeBlockIndexEntry(serialized)
+	if err != nil {
+		t.Fatalf("deserializeBlockIndexEntry: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*gotHeader, header) || gotStatus != status {
+		t.Fatalf("deserializeBlockIndexEntry: got %v (status %v), want "+
+			"%v (status %v)", gotHeader, gotStatus, header, status)
+	}
+
+	// The header reconstructed from a block node must be identical.
+	blockHash := header.BlockHash()
+	node := newBlockNode(&header, &blockHash, nil)
+	if nodeHeader := node.Header(); nodeHeader.BlockHash() != blockHash {
+		t.Fatalf("Header: reconstructed header hash %v, want %v",
+			nodeHeader.BlockHash(), blockHash)
+	}
+
+	// Truncated entries must be reported as deserialization errors.
+	for _, length := range []int{0, wire.MaxBlockHeaderPayload} {
+		_, _, err := deserializeBlockIndexEntry(serialized[:length])
+		if !isDeserializeErr(err) {
+			t.Fatalf("deserializeBlockIndexEntry: length %d: got %v, "+
+				"want deserialize error", length, err)
+		}
+	}
+
+	// Keys must sort by height first.
+	low := blockIndexKey(&chainhash.Hash{0xff}, 1)
+	high := blockIndexKey(&chainhash.Hash{0x00}, 256)
+	if string(low) >= string(high) {
+		t.Fatalf("blockIndexKey: keys do not sort by height")
+	}
+}
@@ -95,7 +95,6 @@ func (b *BlockChain) blockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 	// will be caught in short order anyways and it's also safe to ignore
 	// block locators.
 	_ = b.db.View(func(dbTx database.Tx) error {
-		iterNode := node
 		increment := int32(1)
 		for len(locator) < wire.MaxBlockLocatorsPerMsg-1 {
 			// Once there are 10 locators, exponentially increase
@@ -108,21 +107,13 @@ func (b *BlockChain) blockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 				break
 			}
 
-			// As long as this is still on the side chain, walk
-			// backwards along the side chain nodes to each block
+			// As long as this is still on the side chain, look up
+			// the ancestor of the side chain node at each block
 			// height.
 			if forkHeight != -1 && blockHeight > forkHeight {
-				// Intentionally use parent field instead of the
-				// getPrevNodeFromNode function since we don't
-				// want to dynamically load nodes when building
-				// block locators.  Side chain blocks should
-				// always be in memory already, and if they
-				// aren't for some reason it's ok to skip them.
-				for iterNode != nil && blockHeight > int32(iterNode.height) {
-					iterNode = iterNode.parent
-				}
-				if iterNode != nil && int32(iterNode.height) == blockHeight {
-					locator = append(locator, iterNode.hash)
+				ancestor := node.Ancestor(uint32(blockHeight))
+				if ancestor != nil {
+					locator = append(locator, ancestor.hash)
 				}
 				continue
 			}
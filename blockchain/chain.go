@@ -34,6 +34,11 @@ type blockNode struct {
 	// parent is the parent block for this node.
 	parent *blockNode
 
+	// skip is an ancestor of this node which allows ancestors to be found
+	// in a logarithmic number of steps rather than walking back one
+	// parent at a time.
+	skip *blockNode
+
 	// children contains the child nodes for this node.  Typically there
 	// will only be one, but sometimes there can be more than one and that
 	// is when the best chain selection algorithm is used.
@@ -43,9 +48,8 @@ type blockNode struct {
 	hash *chainhash.Hash
 
 	// parentHash is the double sha 256 of the parent block.  This is kept
-	// here over simply relying on parent.hash directly since block nodes
-	// are sparse and the parent node might not be in memory when its hash
-	// is needed.
+	// here over simply relying on parent.hash directly since the parent
+	// of the genesis block is not in the index.
 	parentHash *chainhash.Hash
 
 	// height is the position in the block chain.
@@ -60,6 +64,10 @@ type blockNode struct {
 	// ancestor when switching chains.
 	inMainChain bool
 
+	// status is a bitfield representing the validation state of the block.
+	// It is stored in the block index bucket along with the header.
+	status blockStatus
+
 	// Some fields from block headers to aid in best chain selection and
 	// reconstructing headers from memory.  These must be treated as
 	// immutable and are intentionally ordered to avoid padding on 64-bit
@@ -76,11 +84,10 @@ type blockNode struct {
 	validatingPubKey wire.BlockValidatingPubKey
 }
 
-// newBlockNode returns a new block node for the given block header.  It is
-// completely disconnected from the chain and the workSum value is just the work
-// for the passed block.  The work sum is updated accordingly when the node is
-// inserted into a chain.
-func newBlockNode(blockHeader *wire.BlockHeader, blockHash *chainhash.Hash) *blockNode {
+// newBlockNode returns a new block node for the given block header and parent
+// node.  The workSum value is calculated from the work sum of the parent and
+// the work of the passed block.  The parent is nil for the genesis block.
+func newBlockNode(blockHeader *wire.BlockHeader, blockHash *chainhash.Hash, parent *blockNode) *blockNode {
 	// Make a copy of the hash so the node doesn't keep a reference to part
 	// of the full block/block header preventing it from being garbage
 	// collected.
@@ -95,8 +102,15 @@ func newBlockNode(blockHeader *wire.BlockHeader, blockHash *chainhash.Hash) *blo
 		nonce:            blockHeader.Nonce,
 		timestamp:        blockHeader.Timestamp.Unix(),
 		merkleRoot:       blockHeader.MerkleRoot,
+		size:             blockHeader.Size,
+		signature:        blockHeader.Signature,
 		validatingPubKey: blockHeader.ValidatingPubKey,
 	}
+	if parent != nil {
+		node.parent = parent
+		node.workSum.Add(parent.workSum, node.workSum)
+		node.buildSkip()
+	}
 	return &node
 }
 
@@ -225,20 +239,14 @@ type BlockChain struct {
 	sigCache            *txscript.SigCache
 	hashCache           *txscript.HashCache
 	indexManager        IndexManager
+	utxoCache           *utxoCache
+	pruneTarget         uint64
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
 	// can't be changed afterwards, so there is no need to protect them with
 	// a separate mutex.
-	//
-	// minMemoryNodes is the minimum number of consecutive nodes needed
-	// in memory in order to perform all necessary validation.  It is used
-	// to determine when it's safe to prune nodes from memory without
-	// causing constant dynamic reloading.  This is typically the same value
-	// as blocksPerRetarget, but it is separated here for tweakability and
-	// testability.
 	blocksPerRetarget int32 // target timespan / target time per block
-	minMemoryNodes    int32
 
 	// chainLock protects concurrent access to the vast majority of the
 	// fields in this struct below this point.
@@ -248,11 +256,10 @@ type BlockChain struct {
 	// runtime.  They are protected by the chain lock.
 	noVerify bool
 
-	// These fields are related to the memory block index.  They are
-	// protected by the chain lock.
+	// These fields are related to the memory block index, which holds the
+	// nodes of all known blocks.  They are protected by the chain lock.
 	bestNode *blockNode
 	index    map[chainhash.Hash]*blockNode
-	depNodes map[chainhash.Hash][]*blockNode
 
 	// These fields are related to the admin state of the chain. They are
 	// protected by the chain lock.
@@ -279,8 +286,8 @@ type BlockChain struct {
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
-	nextCheckpoint  *chaincfg.Checkpoint
-	checkpointBlock *provautil.Block
+	nextCheckpoint *chaincfg.Checkpoint
+	checkpointNode *blockNode
 
 	// The state is used as a fairly efficient way to cache information
 	// about the current best chain state that is returned to callers when
@@ -457,74 +464,11 @@ func (b *BlockChain) addOrphanBlock(block *provautil.Block) {
 	return
 }
 
-// loadBlockNode loads the block identified by hash from the block database,
-// creates a block node from it, and updates the memory block chain accordingly.
-// It is used mainly to dynamically load previous blocks from the database as
-// they are needed to avoid needing to put the entire block chain in memory.
-//
-// This function MUST be called with the chain state lock held (for writes).
-// The database transaction may be read-only.
-func (b *BlockChain) loadBlockNode(dbTx database.Tx, hash *chainhash.Hash) (*blockNode, error) {
-	// Load the block header and height from the db.
-	blockHeader, err := dbFetchHeaderByHash(dbTx, hash)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create the new block node for the block and set the work.
-	node := newBlockNode(blockHeader, hash)
-	node.inMainChain = true
-
-	// Add the node to the chain.
-	// There are a few possibilities here:
-	//  1) This node is a child of an existing block node
-	//  2) This node is the parent of one or more nodes
-	//  3) Neither 1 or 2 is true which implies it's an orphan block and
-	//     therefore is an error to insert into the chain
-	prevHash := &blockHeader.PrevBlock
-	if parentNode, ok := b.index[*prevHash]; ok {
-		// Case 1 -- This node is a child of an existing block node.
-		// Update the node's work sum with the sum of the parent node's
-		// work sum and this node's work, append the node as a child of
-		// the parent node and set this node's parent to the parent
-		// node.
-		node.workSum = node.workSum.Add(parentNode.workSum, node.workSum)
-		parentNode.children = append(parentNode.children, node)
-		node.parent = parentNode
-
-	} else if childNodes, ok := b.depNodes[*hash]; ok {
-		// Case 2 -- This node is the parent of one or more nodes.
-		// Update the node's work sum by subtracting this node's work
-		// from the sum of its first child, and connect the node to all
-		// of its children.
-		node.workSum.Sub(childNodes[0].workSum, node.workSum)
-		for _, childNode := range childNodes {
-			childNode.parent = node
-			node.children = append(node.children, childNode)
-		}
-
-	} else {
-		// Case 3 -- The node doesn't have a parent and is not the
-		// parent of another node.  This means an arbitrary orphan block
-		// is trying to be loaded which is not allowed.
-		str := "loadBlockNode: attempt to insert orphan block %v"
-		return nil, AssertError(fmt.Sprintf(str, hash))
-	}
-
-	// Add the new node to the indices for faster lookups.
-	b.index[*hash] = node
-	b.depNodes[*prevHash] = append(b.depNodes[*prevHash], node)
-
-	return node, nil
-}
-
-// getPrevNodeFromBlock returns a block node for the block previous to the
-// passed block (the passed block's parent).  When it is already in the memory
-// block chain, it simply returns it.  Otherwise, it loads the previous block
-// header from the block database, creates a new block node from it, and returns
-// it.  The returned node will be nil if the genesis block is passed.
+// getPrevNodeFromBlock returns the block node for the block previous to the
+// passed block (the passed block's parent) from the memory block index.  The
+// returned node will be nil if the genesis block is passed.
 //
-// This function MUST be called with the chain state lock held (for writes).
+// This function MUST be called with the chain state lock held (for reads).
 func (b *BlockChain) getPrevNodeFromBlock(block *provautil.Block) (*blockNode, error) {
 	// Genesis block.
 	prevHash := &block.MsgBlock().Header.PrevBlock
@@ -532,96 +476,15 @@ func (b *BlockChain) getPrevNodeFromBlock(block *provautil.Block) (*blockNode, e
 		return nil, nil
 	}
 
-	// Return the existing previous block node if it's already there.
-	if bn, ok := b.index[*prevHash]; ok {
-		return bn, nil
-	}
-
-	// Dynamically load the previous block from the block database, create
-	// a new block node for it, and update the memory chain accordingly.
-	var prevBlockNode *blockNode
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		prevBlockNode, err = b.loadBlockNode(dbTx, prevHash)
-		return err
-	})
-	return prevBlockNode, err
-}
-
-// getPrevNodeFromNode returns a block node for the block previous to the
-// passed block node (the passed block node's parent).  When the node is already
-// connected to a parent, it simply returns it.  Otherwise, it loads the
-// associated block from the database to obtain the previous hash and uses that
-// to dynamically create a new block node and return it.  The memory block
-// chain is updated accordingly.  The returned node will be nil if the genesis
-// block is passed.
-//
-// This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) getPrevNodeFromNode(node *blockNode) (*blockNode, error) {
-	// Return the existing previous block node if it's already there.
-	if node.parent != nil {
-		return node.parent, nil
-	}
-
-	// Genesis block.
-	if node.hash.IsEqual(b.chainParams.GenesisHash) || node.height == 0 {
-		return nil, nil
-	}
-
-	// Dynamically load the previous block from the block database, create
-	// a new block node for it, and update the memory chain accordingly.
-	var prevBlockNode *blockNode
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		prevBlockNode, err = b.loadBlockNode(dbTx, node.parentHash)
-		return err
-	})
-	return prevBlockNode, err
-}
-
-// relativeNode returns the ancestor block a relative 'distance' blocks before
-// the passed anchor block. While iterating backwards through the chain, any
-// block nodes which aren't in the memory chain are loaded in dynamically.
-//
-// This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) relativeNode(anchor *blockNode, distance uint32) (*blockNode, error) {
-	var err error
-	iterNode := anchor
-
-	err = b.db.View(func(dbTx database.Tx) error {
-		// Walk backwards in the chian until we've gone 'distance'
-		// steps back.
-		for i := distance; i > 0; i-- {
-			switch {
-			// If the parent of this node has already been loaded
-			// into memory, then we can follow the link without
-			// hitting the database.
-			case iterNode.parent != nil:
-				iterNode = iterNode.parent
-
-			// If this node is the genesis block, then we can't go
-			// back any further, so we exit immediately.
-			case iterNode.hash.IsEqual(b.chainParams.GenesisHash):
-				return nil
-
-			// Otherwise, load the block node from the database,
-			// pulling it into the memory cache in the processes.
-			default:
-				iterNode, err = b.loadBlockNode(dbTx,
-					iterNode.parentHash)
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	// The block index holds all known blocks, so the previous block must
+	// be in it.
+	prevNode, ok := b.index[*prevHash]
+	if !ok {
+		str := "getPrevNodeFromBlock: no block node for previous " +
+			"block %v of block %v"
+		return nil, AssertError(fmt.Sprintf(str, prevHash, block.Hash()))
 	}
-
-	return iterNode, nil
+	return prevNode, nil
 }
 
 // isMajorityVersion determines if a previous number of blocks in the chain
@@ -638,16 +501,7 @@ func (b *BlockChain) isMajorityVersion(minVer uint32, startNode *blockNode, numR
 			numFound++
 		}
 
-		// Get the previous block node.  This function is used over
-		// simply accessing iterNode.parent directly as it will
-		// dynamically create previous block nodes as needed.  This
-		// helps allow only the pieces of the chain that are needed
-		// to remain in memory.
-		var err error
-		iterNode, err = b.getPrevNodeFromNode(iterNode)
-		if err != nil {
-			break
-		}
+		iterNode = iterNode.parent
 	}
 
 	return numFound >= numRequired
@@ -673,17 +527,7 @@ func (b *BlockChain) calcPastMedianTime(startNode *blockNode) (time.Time, error)
 		timestamps[i] = iterNode.timestamp
 		numNodes++
 
-		// Get the previous block node.  This function is used over
-		// simply accessing iterNode.parent directly as it will
-		// dynamically create previous block nodes as needed.  This
-		// helps allow only the pieces of the chain that are needed
-		// to remain in memory.
-		var err error
-		iterNode, err = b.getPrevNodeFromNode(iterNode)
-		if err != nil {
-			log.Errorf("getPrevNodeFromNode: %v", err)
-			return time.Time{}, err
-		}
+		iterNode = iterNode.parent
 	}
 
 	// Prune the slice to the actual number of available timestamps which
@@ -805,15 +649,11 @@ func (b *BlockChain) calcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
 			// the one which included this referenced output.
 			// TODO: caching should be added to keep this speedy
 			inputDepth := uint32(b.bestNode.height-inputHeight) + 1
-			blockNode, err := b.relativeNode(b.bestNode, inputDepth)
-			if err != nil {
-				return sequenceLock, err
-			}
+			blockNode := b.bestNode.RelativeAncestor(inputDepth)
 
-			// With all the necessary block headers loaded into
-			// memory, we can now finally calculate the MTP of the
-			// block prior to the one which included the output
-			// being spent.
+			// With the block found in the memory block index, we
+			// can now finally calculate the MTP of the block prior
+			// to the one which included the output being spent.
 			medianTime, err := b.calcPastMedianTime(blockNode)
 			if err != nil {
 				return sequenceLock, err
@@ -894,12 +734,6 @@ func (b *BlockChain) getReorganizeNodes(node *blockNode) (*list.List, *list.List
 		attachNodes.PushFront(ancestor)
 	}
 
-	// TODO(davec): Use prevNodeFromNode function in case the requested
-	// node is further back than the what is in memory.  This shouldn't
-	// happen in the normal course of operation, but the ability to fetch
-	// input transactions of arbitrary blocks will likely to be exposed at
-	// some point and that could lead to an issue here.
-
 	// Start from the end of the main chain and work backwards until the
 	// common ancestor adding each block to the list of nodes to detach from
 	// the main chain.
@@ -958,6 +792,9 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 		return err
 	}
 
+	// The block passed all validation checks when it is connected.
+	node.status |= statusValid
+
 	// Generate a new best state snapshot that will be used to update the
 	// database and later memory if all database updates are successful.
 	b.stateLock.RLock()
@@ -982,17 +819,9 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, utxoView)
-		if err != nil {
-			return err
-		}
-
-		// Update the admin key set using the state of the key view.
-		err = dbPutKeySet(dbTx, keyView.Keys(), keyView.KeyIDs(),
-			keyView.ThreadTips(), keyView.LastKeyID(), keyView.TotalSupply())
+		// Store the status of the block, which is now known to be
+		// valid.
+		err = dbStoreBlockNode(dbTx, node)
 		if err != nil {
 			return err
 		}
@@ -1020,15 +849,18 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 		return err
 	}
 
+	// Update the utxo cache using the state of the utxo view, which entails
+	// removing all of the utxos spent and adding the new ones created by
+	// the block, along with the admin state of the key view.  They are
+	// written to the database when the cache is flushed.
+	b.utxoCache.commit(utxoView, keyView, block.Hash())
+
 	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// now that the modifications have been committed to the cache.
 	utxoView.commit()
 
-	// Add the new node to the memory main chain indices for faster
-	// lookups.
+	// Mark the node as being in the main chain.
 	node.inMainChain = true
-	b.index[*node.hash] = node
-	b.depNodes[*prevHash] = append(b.depNodes[*prevHash], node)
 
 	// This node is now the end of the best chain.
 	b.bestNode = node
@@ -1051,6 +883,12 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
 
+	// Flush the utxo cache to the database when it has grown too large or
+	// has not been flushed for a while.
+	if err := b.flushUtxoCache(flushPeriodic); err != nil {
+		return err
+	}
+
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
@@ -1072,16 +910,8 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 			"block at the end of the main chain")
 	}
 
-	// Get the previous block node.  This function is used over simply
-	// accessing node.parent directly as it will dynamically create previous
-	// block nodes as needed.  This helps allow only the pieces of the chain
-	// that are needed to remain in memory.
-	prevNode, err := b.getPrevNodeFromNode(node)
-	if err != nil {
-		return err
-	}
-
 	// Calculate the median time for the previous block.
+	prevNode := node.parent
 	medianTime, err := b.calcPastMedianTime(prevNode)
 	if err != nil {
 		return err
@@ -1109,6 +939,14 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 	state := newBestState(prevNode, blockSize, numTxns, newTotalTxns,
 		medianTime)
 
+	// Flush the utxo cache so the utxo set and the admin key sets in the
+	// database represent the block being disconnected.  They are updated
+	// along with the best chain state below, which ensures the block they
+	// represent never leaves the main chain without them.
+	if err := b.flushUtxoCache(flushRequired); err != nil {
+		return err
+	}
+
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -1137,6 +975,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 		if err != nil {
 			return err
 		}
+		err = dbPutUtxoStateHash(dbTx, prevNode.hash)
+		if err != nil {
+			return err
+		}
 
 		// Update the transaction spend journal by removing the record
 		// that contains all txos spent by the block .
@@ -1161,6 +1003,11 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 		return err
 	}
 
+	// Apply the modifications to the utxo cache, which is in sync with the
+	// database now that they have been committed to it.
+	b.utxoCache.commit(utxoView, keyView, prevNode.hash)
+	b.utxoCache.markFlushed()
+
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	utxoView.commit()
@@ -1214,6 +1061,8 @@ func countSpentOutputs(block *provautil.Block) int {
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags BehaviorFlags) error {
+	dryRun := flags&BFDryRun == BFDryRun
+
 	// All of the blocks to detach and related spend journal entries needed
 	// to unspend transaction outputs in the blocks being disconnected must
 	// be loaded from the database during the reorg check phase below and
@@ -1252,7 +1101,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = utxoView.fetchInputUtxos(b.db, block)
+		err = utxoView.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1324,15 +1173,24 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		// thus will not be generated.  This is done because the state
 		// is not being immediately written to the database, so it is
 		// not needed.
-		err = b.checkConnectBlock(n, block, utxoView, keyView, nil)
+		err = b.checkConnectBlock(n, block, utxoView, keyView, nil,
+			BFNone)
 		if err != nil {
+			// Remember the block and all of its descendants are
+			// invalid unless this is only a dry run, in which case
+			// the last node is not part of the block index.
+			if _, ok := err.(RuleError); ok && !dryRun {
+				if err := b.markBlockInvalid(n); err != nil {
+					return err
+				}
+			}
 			return err
 		}
 	}
 
 	// Skip disconnecting and connecting the blocks when running with the
 	// dry run flag set.
-	if flags&BFDryRun == BFDryRun {
+	if dryRun {
 		return nil
 	}
 
@@ -1351,7 +1209,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := utxoView.fetchInputUtxos(b.db, block)
+		err := utxoView.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1377,7 +1235,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := utxoView.fetchInputUtxos(b.db, block)
+		err := utxoView.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1402,10 +1260,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 	// Log the point where the chain forked.
 	firstAttachNode := attachNodes.Front().Value.(*blockNode)
-	forkNode, err := b.getPrevNodeFromNode(firstAttachNode)
-	if err == nil {
-		log.Infof("REORGANIZE: Chain forks at %v", forkNode.hash)
-	}
+	log.Infof("REORGANIZE: Chain forks at %v", firstAttachNode.parent.hash)
 
 	// Log the old and new best chain heads.
 	firstDetachNode := detachNodes.Front().Value.(*blockNode)
@@ -1458,8 +1313,17 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		keyView.SetKeyIDs(b.aspKeyIdMap)
 		stxos := make([]spentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
-			err := b.checkConnectBlock(node, block, utxoView, keyView, &stxos)
+			err := b.checkConnectBlock(node, block, utxoView,
+				keyView, &stxos, flags)
 			if err != nil {
+				// Remember the block is invalid unless this is
+				// only a dry run, in which case the node is not
+				// part of the block index.
+				if _, ok := err.(RuleError); ok && !dryRun {
+					if err := b.markBlockInvalid(node); err != nil {
+						return false, err
+					}
+				}
 				return false, err
 			}
 		}
@@ -1474,7 +1338,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := utxoView.fetchInputUtxos(b.db, block)
+			err := utxoView.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
@@ -1491,11 +1355,6 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 			return false, err
 		}
 
-		// Connect the parent node to this node.
-		if node.parent != nil {
-			node.parent.children = append(node.parent.children, node)
-		}
-
 		return true, nil
 	}
 	if fastAdd {
@@ -1504,17 +1363,12 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 	}
 
 	// We're extending (or creating) a side chain which may or may not
-	// become the main chain, but in either case the entry is needed in the
-	// index for future processing.
-	b.index[*node.hash] = node
-
-	// Connect the parent node to this node.
-	node.inMainChain = false
-	node.parent.children = append(node.parent.children, node)
-
-	// Disconnect it from the parent node when the function returns when
-	// running in dry run mode.
+	// become the main chain.  The node was already added to the block
+	// index when the block was accepted, unless running in dry run mode.
+	// In that case, temporarily add it to the index and disconnect it from
+	// the parent node when the function returns.
 	if dryRun {
+		b.addBlockNode(node)
 		defer func() {
 			children := node.parent.children
 			children = removeChildNode(children, node)
@@ -1759,6 +1613,21 @@ type Config struct {
 	// This field can be nil if the caller does not wish to make use of an
 	// index manager.
 	IndexManager IndexManager
+
+	// UtxoCacheMaxSize defines the maximum number of bytes of memory the
+	// cache of unspent transaction outputs may use before it is flushed
+	// to the database.
+	//
+	// This field can be zero, in which case the unspent transaction
+	// outputs are written to the database for every block.
+	UtxoCacheMaxSize uint64
+
+	// PruneTarget defines the number of bytes the stored blocks may take
+	// up before the oldest blocks are deleted from the database.  The most
+	// recent PruneDepth blocks of the main chain are always kept.
+	//
+	// This field can be zero, in which case all blocks are kept.
+	PruneTarget uint64
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1801,8 +1670,9 @@ func New(config *Config) (*BlockChain, error) {
 		sigCache:            config.SigCache,
 		hashCache:           config.HashCache,
 		indexManager:        config.IndexManager,
+		utxoCache:           newUtxoCache(config.DB, config.UtxoCacheMaxSize),
+		pruneTarget:         config.PruneTarget,
 		blocksPerRetarget:   int32(config.ChainParams.PowAveragingWindow),
-		minMemoryNodes:      int32(config.ChainParams.PowAveragingWindow),
 		bestNode:            nil,
 		threadTips:          make(map[provautil.ThreadID]*wire.OutPoint),
 		lastKeyID:           btcec.KeyID(0),
@@ -1810,7 +1680,6 @@ func New(config *Config) (*BlockChain, error) {
 		adminKeySets:        make(map[btcec.KeySetType]btcec.PublicKeySet),
 		aspKeyIdMap:         make(map[btcec.KeyID]*btcec.PublicKey),
 		index:               make(map[chainhash.Hash]*blockNode),
-		depNodes:            make(map[chainhash.Hash][]*blockNode),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
 	}
@@ -1822,9 +1691,40 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Bring the utxo set up to date with the best chain in case it was not
+	// flushed before the last shutdown.
+	if err := b.replayUtxoState(); err != nil {
+		return nil, err
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
-	// as needed.
+	// as needed.  They require all blocks, so they can not be used with a
+	// database bootstrapped from a snapshot or one which has been pruned.
 	if config.IndexManager != nil {
+		var snapshotHeight, pruneHeight uint32
+		var isSnapshot, isPruned bool
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			snapshotHeight, isSnapshot, err = dbFetchSnapshotHeight(dbTx)
+			if err != nil {
+				return err
+			}
+			pruneHeight, isPruned, err = dbFetchPruneHeight(dbTx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if isSnapshot {
+			return nil, fmt.Errorf("optional indexes can not be used "+
+				"with a database bootstrapped from the snapshot of "+
+				"block height %d", snapshotHeight)
+		}
+		if isPruned {
+			return nil, fmt.Errorf("optional indexes can not be used "+
+				"with a database which has been pruned up to "+
+				"block height %d", pruneHeight)
+		}
 		if err := config.IndexManager.Init(&b); err != nil {
 			return nil, err
 		}
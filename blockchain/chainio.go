@@ -10,9 +10,11 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 	"math/big"
 	"sort"
@@ -44,6 +46,15 @@ var (
 	// admin key sets.
 	keySetBucketName = []byte("keyset")
 
+	// utxoStateKeyName is the name of the db key used to store the hash of
+	// the block the utxo set and the admin key sets represent.
+	utxoStateKeyName = []byte("utxostate")
+
+	// spendJournalVersionKeyName is the name of the db key used to store the
+	// version of the spend journal serialization.  Databases created before
+	// it was stored use version 1.
+	spendJournalVersionKeyName = []byte("spendjournalversion")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -123,6 +134,11 @@ func isDeserializeErr(err error) bool {
 //   done because that information is only needed when the utxo set no longer
 //   has it.
 //
+//   Version 1 of the spend journal also used a header code of 0 for the final
+//   spend of the genesis coinbase since its height is 0.  Version 2 encodes
+//   the header code and version for it as well, since the outputs of the
+//   genesis coinbase are spendable.
+//
 // Example 1:
 // From block 170 in main blockchain.
 //
@@ -186,8 +202,11 @@ type spentTxOut struct {
 // spentTxOutHeaderCode returns the calculated header code to be used when
 // serializing the provided stxo entry.
 func spentTxOutHeaderCode(stxo *spentTxOut) uint64 {
-	// The header code is 0 when there is no height set for the stxo.
-	if stxo.height == 0 {
+	// The header code is 0 when there is no height set for the stxo.  The
+	// outputs of the genesis coinbase are spendable, so the coinbase flag
+	// is also checked to make sure spending the final output of it encodes
+	// the version.
+	if stxo.height == 0 && !stxo.isCoinBase {
 		return 0
 	}
 
@@ -453,6 +472,173 @@ func dbRemoveSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash) erro
 	return spendBucket.Delete(blockHash[:])
 }
 
+// currentSpendJournalVersion is the current version of the spend journal
+// serialization.
+const currentSpendJournalVersion = 2
+
+// dbPutSpendJournalVersion uses an existing database transaction to store the
+// current version of the spend journal serialization.
+func dbPutSpendJournalVersion(dbTx database.Tx) error {
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], currentSpendJournalVersion)
+	return dbTx.Metadata().Put(spendJournalVersionKeyName, serialized[:])
+}
+
+// genesisSpendScanBatchSize is the number of main chain blocks scanned per
+// database transaction while looking for the final spend of the genesis
+// coinbase.
+const genesisSpendScanBatchSize = 2000
+
+// findGenesisFinalSpend finds the main chain block which spends the final
+// unspent output of the genesis coinbase along with the spent outpoint.  The
+// main chain blocks are scanned in order up to the passed height until every
+// spendable output of the genesis coinbase has been spent.  Since that can
+// take many blocks, they are scanned in batches, each in its own database
+// transaction.  A nil block is returned when the genesis coinbase has not been
+// fully spent or a block spending it is no longer available.
+func findGenesisFinalSpend(db database.DB, params *chaincfg.Params, bestHeight uint32) (*provautil.Block, *wire.OutPoint, error) {
+	genesisCoinbase := params.GenesisBlock.Transactions[0]
+	genesisHash := genesisCoinbase.TxHash()
+	var numUnspent int
+	for _, txOut := range genesisCoinbase.TxOut {
+		if !txscript.IsUnspendable(txOut.PkScript) {
+			numUnspent++
+		}
+	}
+
+	var spendBlock *provautil.Block
+	var spentOutpoint *wire.OutPoint
+	var done bool
+	for height := uint32(1); height <= bestHeight && !done; {
+		err := db.View(func(dbTx database.Tx) error {
+			endHeight := height + genesisSpendScanBatchSize
+			for ; height < endHeight && height <= bestHeight; height++ {
+				block, err := dbFetchBlockByHeight(dbTx, height)
+				dbErr, ok := err.(database.Error)
+				if ok && dbErr.ErrorCode == database.ErrBlockNotFound {
+					done = true
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				for _, tx := range block.MsgBlock().Transactions[1:] {
+					for _, txIn := range tx.TxIn {
+						prevOut := txIn.PreviousOutPoint
+						if prevOut.Hash != genesisHash {
+							continue
+						}
+						numUnspent--
+						if numUnspent == 0 {
+							spendBlock = block
+							spentOutpoint = &prevOut
+							done = true
+							return nil
+						}
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return spendBlock, spentOutpoint, nil
+}
+
+// dbUpdateSpentTxOut uses an existing database transaction to apply the passed
+// function to the spent txout of the passed outpoint in the spend journal
+// entry of the passed block and stores the updated entry.
+//
+// The versions of the transactions containing the spent txouts are not needed
+// to decode the compressed txouts, so the entry is decoded without a utxo
+// view.  The spent txouts which do not encode the version are serialized
+// exactly as they were.
+func dbUpdateSpentTxOut(dbTx database.Tx, block *provautil.Block, outpoint *wire.OutPoint, update func(stxo *spentTxOut)) error {
+	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+	serialized := spendBucket.Get(block.Hash()[:])
+	if serialized == nil {
+		return nil
+	}
+
+	txns := block.MsgBlock().Transactions[1:]
+	view := NewUtxoViewpoint()
+	for _, tx := range txns {
+		for _, txIn := range tx.TxIn {
+			originHash := txIn.PreviousOutPoint.Hash
+			view.entries[originHash] = newUtxoEntry(1, false, 0)
+		}
+	}
+	stxos, err := deserializeSpendJournalEntry(serialized, txns, view)
+	if err != nil {
+		return err
+	}
+
+	stxoIdx := 0
+	for _, tx := range txns {
+		for _, txIn := range tx.TxIn {
+			if txIn.PreviousOutPoint == *outpoint {
+				update(&stxos[stxoIdx])
+			}
+			stxoIdx++
+		}
+	}
+	return dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
+}
+
+// maybeUpgradeSpendJournal upgrades the spend journal of databases created
+// before its serialization was versioned.  The only entry which differs
+// between version 1 and 2 is the one for the final spend of the genesis
+// coinbase, which is rewritten to encode the header code and version so the
+// block containing it can be disconnected.
+func (b *BlockChain) maybeUpgradeSpendJournal() error {
+	var bestHeight uint32
+	var needsUpgrade bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		serializedData := meta.Get(chainStateKeyName)
+		if serializedData == nil ||
+			meta.Get(spendJournalVersionKeyName) != nil {
+
+			return nil
+		}
+		state, err := deserializeBestChainState(serializedData)
+		if err != nil {
+			return err
+		}
+		bestHeight = state.height
+		needsUpgrade = true
+		return nil
+	})
+	if err != nil || !needsUpgrade {
+		return err
+	}
+
+	log.Infof("Upgrading the spend journal to version %d",
+		currentSpendJournalVersion)
+	block, outpoint, err := findGenesisFinalSpend(b.db, b.chainParams,
+		bestHeight)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(dbTx database.Tx) error {
+		if block != nil {
+			version := b.chainParams.GenesisBlock.Transactions[0].Version
+			err := dbUpdateSpentTxOut(dbTx, block, outpoint,
+				func(stxo *spentTxOut) {
+					stxo.version = version
+					stxo.isCoinBase = true
+					stxo.height = 0
+				})
+			if err != nil {
+				return err
+			}
+		}
+		return dbPutSpendJournalVersion(dbTx)
+	})
+}
+
 // -----------------------------------------------------------------------------
 // The unspent transaction output (utxo) set consists of an entry for each
 // transaction which contains a utxo serialized using a format that is highly
@@ -1163,6 +1349,33 @@ func dbPutKeySet(dbTx database.Tx,
 	return dbTx.Metadata().Put(keySetBucketName, serializedData)
 }
 
+// dbPutUtxoStateHash uses an existing database transaction to store the hash of
+// the block the utxo set and the admin key sets in the database represent.
+func dbPutUtxoStateHash(dbTx database.Tx, hash *chainhash.Hash) error {
+	return dbTx.Metadata().Put(utxoStateKeyName, hash[:])
+}
+
+// dbFetchUtxoStateHash uses an existing database transaction to fetch the hash
+// of the block the utxo set and the admin key sets in the database represent.
+// Databases created before the hash was stored do not have it, in which case
+// nil is returned for both the hash and the error.
+func dbFetchUtxoStateHash(dbTx database.Tx) (*chainhash.Hash, error) {
+	serialized := dbTx.Metadata().Get(utxoStateKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	if len(serialized) != chainhash.HashSize {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo state hash",
+		}
+	}
+
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return &hash, nil
+}
+
 // -----------------------------------------------------------------------------
 // The best chain state consists of the best block hash and height, the total
 // number of transactions up to and including those in the best block, and the
@@ -1274,12 +1487,13 @@ func (b *BlockChain) createChainState() error {
 	// Create a new node from the genesis block and set it as the best node.
 	genesisBlock := provautil.NewBlock(b.chainParams.GenesisBlock)
 	header := &genesisBlock.MsgBlock().Header
-	node := newBlockNode(header, genesisBlock.Hash())
+	node := newBlockNode(header, genesisBlock.Hash(), nil)
 	node.inMainChain = true
+	node.status = statusDataStored | statusValid
 	b.bestNode = node
 
 	// Add the new node to the index which is used for faster lookups.
-	b.index[*node.hash] = node
+	b.addBlockNode(node)
 
 	// Initialize the state related to the best block.  Since it is the
 	// genesis block, use its timestamp for the median time.
@@ -1333,11 +1547,22 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Create the bucket that houses the headers and validation
+		// status of all known blocks.
+		_, err = meta.CreateBucket(blockIndexBucketName)
+		if err != nil {
+			return err
+		}
+
 		// Create the bucket that houses the spend journal data.
 		_, err = meta.CreateBucket(spendJournalBucketName)
 		if err != nil {
 			return err
 		}
+		err = dbPutSpendJournalVersion(dbTx)
+		if err != nil {
+			return err
+		}
 
 		// Create the bucket that houses the utxo set.
 		_, err = meta.CreateBucket(utxoSetBucketName)
@@ -1357,6 +1582,12 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Add the genesis block node to the block index.
+		err = dbStoreBlockNode(dbTx, b.bestNode)
+		if err != nil {
+			return err
+		}
+
 		// Store the current best chain state into the database.
 		err = dbPutBestState(dbTx, b.stateSnapshot, b.bestNode.workSum)
 		if err != nil {
@@ -1369,6 +1600,13 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// The utxo set and the admin key sets represent the genesis
+		// block.
+		err = dbPutUtxoStateHash(dbTx, b.bestNode.hash)
+		if err != nil {
+			return err
+		}
+
 		// Store the genesis block into the database.
 		return dbTx.StoreBlock(genesisBlock)
 	})
@@ -1379,6 +1617,18 @@ func (b *BlockChain) createChainState() error {
 // database.  When the db does not yet contain any chain state, both it and the
 // chain state are initialized to the genesis block.
 func (b *BlockChain) initChainState() error {
+	// Create the block index from the main chain if the database was
+	// created before the block index was stored in it.
+	if err := b.maybeCreateBlockIndex(); err != nil {
+		return err
+	}
+
+	// Upgrade the spend journal of databases created before its
+	// serialization was versioned.
+	if err := b.maybeUpgradeSpendJournal(); err != nil {
+		return err
+	}
+
 	// Attempt to load the chain state from the database.
 	var isStateInitialized bool
 	err := b.db.View(func(dbTx database.Tx) error {
@@ -1408,6 +1658,26 @@ func (b *BlockChain) initChainState() error {
 			return err
 		}
 
+		// Load all of the known block nodes into the memory block
+		// index.
+		err = b.loadBlockIndex(dbTx)
+		if err != nil {
+			return err
+		}
+
+		// Set the best node and mark it and all of its ancestors as
+		// being in the main chain.
+		node, ok := b.index[state.hash]
+		if !ok {
+			return AssertError(fmt.Sprintf("initChainState: "+
+				"cannot find chain tip %s in block index",
+				state.hash))
+		}
+		for n := node; n != nil; n = n.parent {
+			n.inMainChain = true
+		}
+		b.bestNode = node
+
 		// Load the raw block bytes for the best block.
 		blockBytes, err := dbTx.FetchBlock(&state.hash)
 		if err != nil {
@@ -1419,15 +1689,6 @@ func (b *BlockChain) initChainState() error {
 			return err
 		}
 
-		// Create a new node and set it as the best node.  The preceding
-		// nodes will be loaded on demand as needed.
-		header := &block.Header
-		header.Height = uint32(state.height)
-		node := newBlockNode(header, &state.hash)
-		node.inMainChain = true
-		node.workSum = state.workSum
-		b.bestNode = node
-
 		// Set the admin state of the chain
 		b.threadTips = threadTips
 		b.lastKeyID = lastKeyID
@@ -1435,11 +1696,6 @@ func (b *BlockChain) initChainState() error {
 		b.adminKeySets = adminKeySets
 		b.aspKeyIdMap = aspKeyIdMap
 
-		// Add the new node to the indices for faster lookups.
-		prevHash := node.parentHash
-		b.index[*node.hash] = node
-		b.depNodes[*prevHash] = append(b.depNodes[*prevHash], node)
-
 		// Calculate the median time for the block.
 		medianTime, err := b.calcPastMedianTime(node)
 		if err != nil {
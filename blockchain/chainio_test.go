@@ -88,6 +88,18 @@ func TestStxoSerialization(t *testing.T) {
 			},
 			serialized: hexToBytes("8b99700186c64700b2fb57eadf61e106a100a7445a8c3f67898841ec"),
 		},
+		// The outputs of the genesis coinbase are admin thread tips.
+		{
+			name: "Spends last output of genesis coinbase",
+			stxo: spentTxOut{
+				amount:     0,
+				pkScript:   hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac"),
+				isCoinBase: true,
+				height:     0,
+				version:    1,
+			},
+			serialized: hexToBytes("010100006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+		},
 		// Adapted from block 100025 in main blockchain.
 		{
 			name: "Does not spend last output",
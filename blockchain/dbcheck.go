@@ -0,0 +1,687 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// DatabaseCheckResult houses the outcome of a consistency check of the chain
+// state stored in a database.
+type DatabaseCheckResult struct {
+	// MainChain houses the hashes of the main chain blocks indexed by their
+	// height as determined by the block index and the best chain state.
+	MainChain []chainhash.Hash
+
+	// NumPruned is the number of blocks which are in the block index, but
+	// whose data is no longer stored because they have been pruned.
+	NumPruned int
+
+	// Discrepancies describes every inconsistency that was found.
+	Discrepancies []string
+
+	// Repairs describes every repair that was made.  It is only populated
+	// when the derived indexes are repaired.
+	Repairs []string
+
+	// Skipped describes the checks which could not be performed along with
+	// the reason why.
+	Skipped []string
+}
+
+// keyIDSorter implements sort.Interface to allow a slice of key ids to be
+// sorted.
+type keyIDSorter []btcec.KeyID
+
+// Len returns the number of key ids in the slice.  It is part of the
+// sort.Interface implementation.
+func (s keyIDSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the key ids at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s keyIDSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the key id with index i should sort before the key id
+// with index j.  It is part of the sort.Interface implementation.
+func (s keyIDSorter) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+// checkIndexEntry houses the contents of an entry of the block index bucket.
+type checkIndexEntry struct {
+	hash   chainhash.Hash
+	height uint32
+	header *wire.BlockHeader
+	status blockStatus
+}
+
+// dbChecker houses the state needed to check the consistency of the chain
+// state stored in a database.
+type dbChecker struct {
+	params  *chaincfg.Params
+	genesis chainhash.Hash
+	result  *DatabaseCheckResult
+	entries []*checkIndexEntry
+	index   map[chainhash.Hash]*checkIndexEntry
+	heights map[chainhash.Hash]uint32
+	pruned  map[chainhash.Hash]struct{}
+	repairs []func(dbTx database.Tx) error
+	descs   []string
+
+	// pruneMode is set when blocks have been pruned from the database, in
+	// which case pruneHeight is the height of the highest pruned block.
+	pruneMode   bool
+	pruneHeight uint32
+}
+
+// discrepancy records an inconsistency found by the check.
+func (c *dbChecker) discrepancy(format string, args ...interface{}) {
+	c.result.Discrepancies = append(c.result.Discrepancies,
+		fmt.Sprintf(format, args...))
+}
+
+// skip records a check which could not be performed.
+func (c *dbChecker) skip(format string, args ...interface{}) {
+	c.result.Skipped = append(c.result.Skipped,
+		fmt.Sprintf(format, args...))
+}
+
+// repair queues the passed function to repair an inconsistency.  The repairs
+// are only applied once all checks have been performed.
+func (c *dbChecker) repair(desc string, fn func(dbTx database.Tx) error) {
+	c.descs = append(c.descs, desc)
+	c.repairs = append(c.repairs, fn)
+}
+
+// bestHeight returns the height of the best block of the main chain.
+func (c *dbChecker) bestHeight() uint32 {
+	return uint32(len(c.result.MainChain) - 1)
+}
+
+// loadBlockIndex loads all entries of the block index bucket and ensures they
+// are consistent with the headers they contain and with each other.
+func (c *dbChecker) loadBlockIndex(dbTx database.Tx) error {
+	bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+	if bucket == nil {
+		return AssertError("block index bucket does not exist")
+	}
+
+	cursor := bucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if len(key) != chainhash.HashSize+4 {
+			c.discrepancy("block index key %x has an unexpected "+
+				"length of %d bytes", key, len(key))
+			continue
+		}
+		header, status, err := deserializeBlockIndexEntry(cursor.Value())
+		if err != nil {
+			c.discrepancy("block index entry %x is corrupt: %v",
+				key, err)
+			continue
+		}
+
+		entry := &checkIndexEntry{
+			hash:   header.BlockHash(),
+			height: binary.BigEndian.Uint32(key[0:4]),
+			header: header,
+			status: status,
+		}
+		if !entry.hash.IsEqual((*chainhash.Hash)(key[4:])) {
+			c.discrepancy("block index entry %x contains the "+
+				"header of block %v", key, entry.hash)
+			continue
+		}
+		c.entries = append(c.entries, entry)
+		c.index[entry.hash] = entry
+	}
+
+	// Ensure every block links to a parent in the index at the previous
+	// height.  The genesis block is the only block without a parent.
+	if _, ok := c.index[c.genesis]; !ok {
+		c.discrepancy("genesis block %v is not in the block index",
+			c.genesis)
+	}
+	for _, entry := range c.entries {
+		if entry.hash == c.genesis {
+			if entry.height != 0 {
+				c.discrepancy("genesis block is at height %d "+
+					"in the block index", entry.height)
+			}
+			continue
+		}
+		parent, ok := c.index[entry.header.PrevBlock]
+		if !ok {
+			c.discrepancy("parent %v of block %v (height %d) is "+
+				"not in the block index", entry.header.PrevBlock,
+				entry.hash, entry.height)
+			continue
+		}
+		if parent.height+1 != entry.height {
+			c.discrepancy("block %v is at height %d in the block "+
+				"index, but its parent %v is at height %d",
+				entry.hash, entry.height, parent.hash,
+				parent.height)
+		}
+	}
+	return nil
+}
+
+// loadMainChain determines the main chain by walking the block index back
+// from the best block of the best chain state.
+func (c *dbChecker) loadMainChain(dbTx database.Tx) error {
+	serializedData := dbTx.Metadata().Get(chainStateKeyName)
+	if serializedData == nil {
+		return AssertError("database does not contain a chain state")
+	}
+	state, err := deserializeBestChainState(serializedData)
+	if err != nil {
+		return err
+	}
+
+	tip, ok := c.index[state.hash]
+	if !ok {
+		return AssertError(fmt.Sprintf("best block %v is not in the "+
+			"block index", state.hash))
+	}
+	if tip.height != state.height {
+		c.discrepancy("best chain state height %d does not match "+
+			"the height %d of best block %v in the block index",
+			state.height, tip.height, state.hash)
+	}
+
+	mainChain := make([]chainhash.Hash, tip.height+1)
+	for entry := tip; ; {
+		mainChain[entry.height] = entry.hash
+		c.heights[entry.hash] = entry.height
+		if entry.status.KnownInvalid() {
+			c.discrepancy("main chain block %v (height %d) is "+
+				"marked invalid in the block index", entry.hash,
+				entry.height)
+		}
+		if entry.height == 0 {
+			break
+		}
+		parent, ok := c.index[entry.header.PrevBlock]
+		if !ok || parent.height+1 != entry.height {
+			return AssertError(fmt.Sprintf("unable to determine "+
+				"the main chain from the block index at block "+
+				"%v (height %d)", entry.hash, entry.height))
+		}
+		entry = parent
+	}
+	if mainChain[0] != c.genesis {
+		return AssertError(fmt.Sprintf("main chain starts at block %v "+
+			"instead of the genesis block %v", mainChain[0],
+			c.genesis))
+	}
+	c.result.MainChain = mainChain
+	return nil
+}
+
+// checkMainChainIndexes ensures the hash to height and height to hash indexes
+// contain exactly the blocks of the main chain.
+func (c *dbChecker) checkMainChainIndexes(dbTx database.Tx) {
+	meta := dbTx.Metadata()
+	hashIndex := meta.Bucket(hashIndexBucketName)
+	heightIndex := meta.Bucket(heightIndexBucketName)
+
+	// Ensure every main chain block is in both indexes.
+	for height := range c.result.MainChain {
+		hash := c.result.MainChain[height]
+		var serializedHeight [4]byte
+		byteOrder.PutUint32(serializedHeight[:], uint32(height))
+
+		var needsPut bool
+		gotHash := heightIndex.Get(serializedHeight[:])
+		switch {
+		case gotHash == nil:
+			c.discrepancy("height index is missing main chain "+
+				"block %v (height %d)", hash, height)
+			needsPut = true
+		case !hash.IsEqual((*chainhash.Hash)(gotHash)):
+			c.discrepancy("height index maps height %d to block "+
+				"%x instead of main chain block %v", height,
+				gotHash, hash)
+			needsPut = true
+		}
+
+		gotHeight := hashIndex.Get(hash[:])
+		switch {
+		case gotHeight == nil:
+			c.discrepancy("hash index is missing main chain block "+
+				"%v (height %d)", hash, height)
+			needsPut = true
+		case len(gotHeight) != 4:
+			c.discrepancy("hash index entry for main chain block "+
+				"%v is corrupt", hash)
+			needsPut = true
+		case byteOrder.Uint32(gotHeight) != uint32(height):
+			c.discrepancy("hash index maps main chain block %v to "+
+				"height %d instead of %d", hash,
+				byteOrder.Uint32(gotHeight), height)
+			needsPut = true
+		}
+
+		if needsPut {
+			height := uint32(height)
+			c.repair(fmt.Sprintf("rebuilt the hash and height index "+
+				"entries for block %v (height %d)", hash, height),
+				func(dbTx database.Tx) error {
+					return dbPutBlockIndex(dbTx, &hash, height)
+				})
+		}
+	}
+
+	// Ensure neither index contains blocks which are not in the main
+	// chain.
+	cursor := heightIndex.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		key := copyBytes(cursor.Key())
+		if len(key) == 4 && byteOrder.Uint32(key) <= c.bestHeight() {
+			continue
+		}
+		c.discrepancy("height index contains entry %x for block %x "+
+			"after the main chain", key, cursor.Value())
+		c.repair(fmt.Sprintf("removed height index entry %x", key),
+			func(dbTx database.Tx) error {
+				bucket := dbTx.Metadata().Bucket(heightIndexBucketName)
+				return bucket.Delete(key)
+			})
+	}
+	cursor = hashIndex.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		key := copyBytes(cursor.Key())
+		if len(key) == chainhash.HashSize {
+			if _, ok := c.heights[*(*chainhash.Hash)(key)]; ok {
+				continue
+			}
+		}
+		c.discrepancy("hash index contains block %x which is not in "+
+			"the main chain", key)
+		c.repair(fmt.Sprintf("removed hash index entry for block %x",
+			key), func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(hashIndexBucketName)
+			return bucket.Delete(key)
+		})
+	}
+}
+
+// fetchBlock loads the block for the passed block index entry from the block
+// store and ensures it matches the entry.  Blocks whose data is not available
+// are recorded as pruned when the database is in prune mode and the block is
+// not higher than the highest pruned block.  Otherwise the absence of a block
+// which is marked as stored is recorded as a discrepancy.  Nil is returned
+// when the block is not available.
+func (c *dbChecker) fetchBlock(dbTx database.Tx, entry *checkIndexEntry) (*provautil.Block, error) {
+	isPruned := c.pruneMode && entry.height <= c.pruneHeight
+	if !entry.status.HaveData() {
+		if isPruned {
+			c.pruned[entry.hash] = struct{}{}
+			c.result.NumPruned++
+		}
+		return nil, nil
+	}
+
+	blockBytes, err := dbTx.FetchBlock(&entry.hash)
+	if err != nil {
+		if !isDbError(err, database.ErrBlockNotFound) {
+			return nil, err
+		}
+		if isPruned {
+			c.pruned[entry.hash] = struct{}{}
+			c.result.NumPruned++
+			return nil, nil
+		}
+		c.discrepancy("block %v (height %d) is marked as stored in the "+
+			"block index, but is missing from the block store",
+			entry.hash, entry.height)
+		return nil, nil
+	}
+
+	block, err := provautil.NewBlockFromBytes(blockBytes)
+	if err != nil {
+		c.discrepancy("stored block %v (height %d) is corrupt: %v",
+			entry.hash, entry.height, err)
+		return nil, nil
+	}
+	if !block.Hash().IsEqual(&entry.hash) {
+		c.discrepancy("stored block %v (height %d) has hash %v",
+			entry.hash, entry.height, block.Hash())
+		return nil, nil
+	}
+	merkles := BuildMerkleTreeStore(block.Transactions())
+	if !entry.header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) {
+		c.discrepancy("stored block %v (height %d) has merkle root "+
+			"%v instead of %v", entry.hash, entry.height,
+			merkles[len(merkles)-1], entry.header.MerkleRoot)
+		return nil, nil
+	}
+	block.SetHeight(entry.height)
+	return block, nil
+}
+
+// checkBlocks ensures the block store contains all blocks the block index
+// claims are stored, that the spend journal contains an entry for every main
+// chain block, and returns the key view recomputed from the genesis block up
+// to the block the stored utxo set and key set represent.  A nil view is
+// returned when it could not be recomputed.
+func (c *dbChecker) checkBlocks(dbTx database.Tx, stateHeight uint32) (*KeyViewpoint, error) {
+	// Check the blocks that are not in the main chain.
+	for _, entry := range c.entries {
+		if _, ok := c.heights[entry.hash]; ok {
+			continue
+		}
+		if _, err := c.fetchBlock(dbTx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize the key view to the admin state of the genesis block just
+	// as it is done when the chain state is created.
+	genesisCoinbase := c.params.GenesisBlock.Transactions[0].TxHash()
+	keyView := NewKeyViewpoint()
+	keyView.SetThreadTips(map[provautil.ThreadID]*wire.OutPoint{
+		provautil.RootThread:      wire.NewOutPoint(&genesisCoinbase, 0),
+		provautil.ProvisionThread: wire.NewOutPoint(&genesisCoinbase, 1),
+		provautil.IssueThread:     wire.NewOutPoint(&genesisCoinbase, 2),
+	})
+	keyView.SetKeys(c.params.AdminKeySets)
+	keyView.SetKeyIDs(c.params.ASPKeyIdMap)
+	var lastKeyID btcec.KeyID
+	for keyID := range c.params.ASPKeyIdMap {
+		if keyID > lastKeyID {
+			lastKeyID = keyID
+		}
+	}
+	keyView.SetLastKeyID(lastKeyID)
+
+	// Check the main chain blocks in order while replaying their admin
+	// transactions.
+	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+	for height, hash := range c.result.MainChain {
+		block, err := c.fetchBlock(dbTx, c.index[hash])
+		if err != nil {
+			return nil, err
+		}
+
+		if block != nil && height > 0 && countSpentOutputs(block) > 0 &&
+			spendBucket.Get(hash[:]) == nil {
+
+			c.discrepancy("spend journal entry for main chain "+
+				"block %v (height %d) is missing", hash, height)
+		}
+
+		if keyView == nil || uint32(height) > stateHeight || height == 0 {
+			continue
+		}
+		if block == nil {
+			c.skip("key set recomputation: block %v (height %d) "+
+				"is not available", hash, height)
+			keyView = nil
+			continue
+		}
+		keyView.connectTransactions(block)
+	}
+	return keyView, nil
+}
+
+// checkSpendJournal ensures the spend journal only contains entries for main
+// chain blocks which have not been pruned.
+func (c *dbChecker) checkSpendJournal(dbTx database.Tx) {
+	cursor := dbTx.Metadata().Bucket(spendJournalBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		key := copyBytes(cursor.Key())
+		if len(key) == chainhash.HashSize {
+			hash := *(*chainhash.Hash)(key)
+			_, inMainChain := c.heights[hash]
+			_, pruned := c.pruned[hash]
+			if inMainChain && !pruned {
+				continue
+			}
+		}
+		c.discrepancy("spend journal contains an entry for block %x "+
+			"which is not a stored main chain block", key)
+		c.repair(fmt.Sprintf("removed spend journal entry for block "+
+			"%x", key), func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+			return bucket.Delete(key)
+		})
+	}
+}
+
+// checkKeySet compares the stored key set with the passed key view which was
+// recomputed from the blocks.
+func (c *dbChecker) checkKeySet(dbTx database.Tx, keyView *KeyViewpoint) {
+	adminKeys, keyIDs, threadTips, lastKeyID, totalSupply, err :=
+		deserializeKeySet(dbTx.Metadata().Get(keySetBucketName))
+	if err != nil {
+		c.discrepancy("stored key set is unreadable: %v", err)
+	} else {
+		for _, threadID := range threadOrder {
+			got, want := threadTips[threadID], keyView.ThreadTips()[threadID]
+			if got == nil || want == nil || *got != *want {
+				c.discrepancy("%v thread tip is %v instead of %v",
+					threadID, got, want)
+			}
+		}
+		if lastKeyID != keyView.LastKeyID() {
+			c.discrepancy("last key id is %d instead of %d",
+				lastKeyID, keyView.LastKeyID())
+		}
+		if totalSupply != keyView.TotalSupply() {
+			c.discrepancy("total supply is %d instead of %d",
+				totalSupply, keyView.TotalSupply())
+		}
+		for _, keySetType := range adminKeysOrder {
+			got, want := adminKeys[keySetType], keyView.Keys()[keySetType]
+			if !got.Equal(want) {
+				c.discrepancy("%v key set is %v instead of %v",
+					keySetType, got.ToStringArray(),
+					want.ToStringArray())
+			}
+		}
+		c.checkKeyIDs(keyIDs, keyView.KeyIDs())
+	}
+}
+
+// checkKeyIDs compares the stored ASP key id map with the recomputed one.
+func (c *dbChecker) checkKeyIDs(got, want btcec.KeyIdMap) {
+	keyIDs := make([]btcec.KeyID, 0, len(want))
+	for keyID := range want {
+		keyIDs = append(keyIDs, keyID)
+	}
+	for keyID := range got {
+		if _, ok := want[keyID]; !ok {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	sort.Sort(keyIDSorter(keyIDs))
+
+	for _, keyID := range keyIDs {
+		gotKey, wantKey := got[keyID], want[keyID]
+		switch {
+		case gotKey == nil:
+			c.discrepancy("ASP key id %d is missing", keyID)
+		case wantKey == nil:
+			c.discrepancy("ASP key id %d is assigned, but should "+
+				"not be", keyID)
+		case !gotKey.IsEqual(wantKey):
+			c.discrepancy("ASP key id %d is assigned to key %x "+
+				"instead of %x", keyID,
+				gotKey.SerializeCompressed(),
+				wantKey.SerializeCompressed())
+		}
+	}
+}
+
+// checkUtxoSet ensures the total amount of all unspent outputs in the utxo set
+// matches the passed total supply.
+func (c *dbChecker) checkUtxoSet(dbTx database.Tx, totalSupply uint64) {
+	var total uint64
+	cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			c.discrepancy("utxo entry for transaction %x is "+
+				"corrupt: %v", cursor.Key(), err)
+			continue
+		}
+		for outputIndex := range entry.sparseOutputs {
+			if !entry.IsOutputSpent(outputIndex) {
+				total += uint64(entry.AmountByIndex(outputIndex))
+			}
+		}
+	}
+	if total != totalSupply {
+		c.discrepancy("utxo set contains a total of %d atoms, but the "+
+			"total supply is %d", total, totalSupply)
+	}
+}
+
+// isDbError returns whether or not the passed error is a database.Error with
+// the passed error code.
+func isDbError(err error, code database.ErrorCode) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == code
+}
+
+// copyBytes returns a copy of the passed byte slice.  Keys returned by cursors
+// are only valid until the cursor is moved, so they have to be copied when
+// they are used later.
+func copyBytes(data []byte) []byte {
+	return append([]byte(nil), data...)
+}
+
+// CheckDatabase checks the consistency of the chain state stored in the passed
+// database.  It ensures the block index is consistent with itself and with the
+// blocks in the block store, that the hash and height indexes and the spend
+// journal agree with the main chain, recomputes the admin state from the
+// genesis block and compares it with the stored key set, and ensures the total
+// amount of the utxo set matches the total supply.  The pruned blocks are
+// taken into account, however the admin state can not be recomputed when the
+// blocks it is derived from are no longer available.
+//
+// Every inconsistency found is described in the returned result.  When repair
+// is set, the indexes derived from the block index and the blocks, which are
+// the hash and height indexes, the spend journal and the key set, are repaired
+// as well.  The utxo set can not be repaired since it can't be recomputed
+// from the spend journal.
+func CheckDatabase(db database.DB, params *chaincfg.Params, repair bool) (*DatabaseCheckResult, error) {
+	c := &dbChecker{
+		params:  params,
+		genesis: params.GenesisBlock.BlockHash(),
+		result:  &DatabaseCheckResult{},
+		index:   make(map[chainhash.Hash]*checkIndexEntry),
+		heights: make(map[chainhash.Hash]uint32),
+		pruned:  make(map[chainhash.Hash]struct{}),
+	}
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		c.pruneHeight, c.pruneMode, err = dbFetchPruneHeight(dbTx)
+		if err != nil {
+			return err
+		}
+		if err := c.loadBlockIndex(dbTx); err != nil {
+			return err
+		}
+		if err := c.loadMainChain(dbTx); err != nil {
+			return err
+		}
+		c.checkMainChainIndexes(dbTx)
+
+		// Determine the block the stored utxo set and key set
+		// represent.  Databases which do not have the state hash yet
+		// always wrote them along with the best chain state.
+		stateHash, err := dbFetchUtxoStateHash(dbTx)
+		if err != nil {
+			return err
+		}
+		stateHeight := c.bestHeight()
+		if stateHash != nil {
+			height, ok := c.heights[*stateHash]
+			if !ok {
+				c.discrepancy("utxo set and key set represent "+
+					"block %v which is not in the main chain",
+					stateHash)
+			}
+			stateHeight = height
+		}
+
+		keyView, err := c.checkBlocks(dbTx, stateHeight)
+		if err != nil {
+			return err
+		}
+		c.checkSpendJournal(dbTx)
+
+		// Compare the stored key set with the recomputed one and
+		// repair it when it differs.
+		if stateHash != nil {
+			if _, ok := c.heights[*stateHash]; !ok {
+				keyView = nil
+			}
+		}
+		if keyView != nil {
+			numDiscrepancies := len(c.result.Discrepancies)
+			c.checkKeySet(dbTx, keyView)
+			if len(c.result.Discrepancies) != numDiscrepancies {
+				c.repair("rewrote the key set", func(dbTx database.Tx) error {
+					return dbPutKeySet(dbTx, keyView.Keys(),
+						keyView.KeyIDs(), keyView.ThreadTips(),
+						keyView.LastKeyID(),
+						keyView.TotalSupply())
+				})
+			}
+		}
+
+		// Use the recomputed total supply when available since the
+		// stored one might be wrong.
+		if keyView != nil {
+			c.checkUtxoSet(dbTx, keyView.TotalSupply())
+			return nil
+		}
+		_, _, _, _, totalSupply, err := deserializeKeySet(
+			dbTx.Metadata().Get(keySetBucketName))
+		if err != nil {
+			c.skip("utxo set total: stored key set is unreadable")
+			return nil
+		}
+		c.checkUtxoSet(dbTx, totalSupply)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !repair || len(c.repairs) == 0 {
+		return c.result, nil
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		for _, fn := range c.repairs {
+			if err := fn(dbTx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.result.Repairs = c.descs
+	return c.result, nil
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestCheckDatabase ensures the database check does not find any discrepancies
+// in a consistent database, that it reports the discrepancies of a corrupted
+// one without changing it, and that the corrupted derived indexes are
+// repaired.
+func TestCheckDatabase(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dbPath := filepath.Join(os.TempDir(), "checkdatabase")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Process all blocks of the tests, which includes reorganizations and
+	// admin transactions, and flush the resulting chain state.
+	params := chaincfg.RegressionNetParams
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			var msgBlock *wire.MsgBlock
+			var height uint32
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				msgBlock, height = item.Block, item.Height
+			case fullblocktests.RejectedBlock:
+				msgBlock, height = item.Block, item.Height
+			case fullblocktests.OrphanOrRejectedBlock:
+				msgBlock, height = item.Block, item.Height
+			default:
+				continue
+			}
+			block := provautil.NewBlock(msgBlock)
+			block.SetHeight(height)
+			chain.ProcessBlock(block, blockchain.BFNone)
+		}
+	}
+	if err := chain.FlushUtxoCache(); err != nil {
+		t.Fatalf("FlushUtxoCache: unexpected error: %v", err)
+	}
+	best := chain.BestSnapshot()
+
+	// check checks the database and ensures the expected number of
+	// discrepancies, repairs and pruned blocks are reported.
+	check := func(name string, repair bool, wantDiscrepancies, wantRepairs, wantPruned int) {
+		result, err := blockchain.CheckDatabase(db, &params, repair)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(result.MainChain) != int(best.Height)+1 ||
+			result.MainChain[best.Height] != *best.Hash {
+			t.Fatalf("%s: unexpected main chain of %d blocks", name,
+				len(result.MainChain))
+		}
+		if len(result.Discrepancies) != wantDiscrepancies {
+			t.Fatalf("%s: got discrepancies %v, want %d", name,
+				result.Discrepancies, wantDiscrepancies)
+		}
+		if len(result.Repairs) != wantRepairs {
+			t.Fatalf("%s: got repairs %v, want %d", name,
+				result.Repairs, wantRepairs)
+		}
+		if len(result.Skipped) != 0 {
+			t.Fatalf("%s: unexpected skipped checks %v", name,
+				result.Skipped)
+		}
+		if result.NumPruned != wantPruned {
+			t.Fatalf("%s: got %d pruned blocks, want %d", name,
+				result.NumPruned, wantPruned)
+		}
+	}
+	check("consistent", false, 0, 0, 0)
+
+	// Corrupt the height index, the hash index, the spend journal and the
+	// total supply of the key set.
+	var keySet []byte
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		var serializedHeight [4]byte
+		serializedHeight[0] = 1
+		err := meta.Bucket([]byte("heightidx")).Delete(serializedHeight[:])
+		if err != nil {
+			return err
+		}
+		staleHash := chainhash.Hash{0x01}
+		err = meta.Bucket([]byte("hashidx")).Put(staleHash[:],
+			serializedHeight[:])
+		if err != nil {
+			return err
+		}
+		err = meta.Bucket([]byte("spendjournal")).Put(staleHash[:],
+			[]byte{0x00})
+		if err != nil {
+			return err
+		}
+
+		keySet = append([]byte(nil), meta.Get([]byte("keyset"))...)
+		corrupted := append([]byte(nil), keySet...)
+		corrupted[3*(chainhash.HashSize+4)+4]++
+		return meta.Put([]byte("keyset"), corrupted)
+	})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+
+	// Ensure the discrepancies are reported without repairing them unless
+	// requested, and that the database is consistent after the repair.
+	check("corrupted", false, 4, 0, 0)
+	check("repair", true, 4, 4, 0)
+	check("repaired", false, 0, 0, 0)
+	err = db.View(func(dbTx database.Tx) error {
+		gotKeySet := dbTx.Metadata().Get([]byte("keyset"))
+		if !reflect.DeepEqual(gotKeySet, keySet) {
+			t.Fatalf("repaired key set %x, want %x", gotKeySet,
+				keySet)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Remove a side chain block from the block store while it remains
+	// marked as stored in the block index, and ensure the missing block is
+	// reported since the database has never been pruned.  The block is
+	// removed by deleting its entry from the internal block index of the
+	// block store.
+	var sideHash *chainhash.Hash
+	var sideHeight uint32
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			item, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			hash := item.Block.BlockHash()
+			isMainChain, err := chain.MainChainHasBlock(&hash)
+			if err != nil {
+				t.Fatalf("MainChainHasBlock: unexpected error: %v",
+					err)
+			}
+			if !isMainChain {
+				sideHash, sideHeight = &hash, item.Height
+			}
+		}
+	}
+	if sideHash == nil {
+		t.Fatal("no side chain block to remove")
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		blockIdx := dbTx.Metadata().Bucket([]byte("ffldb-blockidx"))
+		return blockIdx.Delete(sideHash[:])
+	})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	check("archival missing block", false, 1, 0, 0)
+
+	// Ensure the missing block is treated as pruned once the database is
+	// in prune mode and the block is not higher than the highest pruned
+	// block.
+	err = db.Update(func(dbTx database.Tx) error {
+		var serializedHeight [4]byte
+		binary.LittleEndian.PutUint32(serializedHeight[:], sideHeight)
+		return dbTx.Metadata().Put([]byte("pruneheight"),
+			serializedHeight[:])
+	})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	check("pruned missing block", false, 0, 0, 1)
+}
@@ -183,11 +183,7 @@ func (b *BlockChain) calcNextRequiredDifficulty(lastNode *blockNode) (uint32, er
 	for i := 0; firstNode != nil && i < b.chainParams.PowAveragingWindow; i++ {
 		avgDifficulty.Add(avgDifficulty, CompactToBig(firstNode.bits))
 
-		firstNode, err = b.getPrevNodeFromNode(firstNode)
-
-		if err != nil {
-			return 0, err
-		}
+		firstNode = firstNode.parent
 	}
 
 	// Exit early when there are not enough nodes to fill the window.
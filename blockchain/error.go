@@ -219,6 +219,15 @@ const (
 	// ErrFeeTooHigh indicates a transaction fee exceeds the limit for
 	// fee paid.
 	ErrFeeTooHigh
+
+	// ErrRevokedValidateKey indicates that a block was signed by a validate
+	// key which is no longer in the validate key set, but which signed one
+	// of the recent blocks before it.
+	ErrRevokedValidateKey
+
+	// ErrInvalidAncestorBlock indicates that an ancestor of this block has
+	// already failed validation.
+	ErrInvalidAncestorBlock
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -269,6 +278,8 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidAdminTx:       "ErrInvalidAdminTx",
 	ErrInvalidAdminOp:       "ErrInvalidAdminOp",
 	ErrFeeTooHigh:           "ErrFeeTooHigh",
+	ErrRevokedValidateKey:   "ErrRevokedValidateKey",
+	ErrInvalidAncestorBlock: "ErrInvalidAncestorBlock",
 }
 
 // String returns the ErrorCode as a human-readable name.
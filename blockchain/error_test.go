@@ -60,6 +60,8 @@ func TestErrorCodeStringer(t *testing.T) {
 		{blockchain.ErrInconsistentBlkSize, "ErrInconsistentBlkSize"},
 		{blockchain.ErrInvalidValidateKey, "ErrInvalidValidateKey"},
 		{blockchain.ErrFeeTooHigh, "ErrFeeTooHigh"},
+		{blockchain.ErrRevokedValidateKey, "ErrRevokedValidateKey"},
+		{blockchain.ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
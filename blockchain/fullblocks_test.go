@@ -21,14 +21,98 @@ import (
 // TestFullBlocks ensures all tests generated by the fullblocktests package
 // have the expected result when processed via ProcessBlock.
 func TestFullBlocks(t *testing.T) {
+	testFullBlocks(t, "fullblocktest", blockchain.BFNone)
+}
+
+// TestFullBlocksAssumeValid ensures all tests generated by the fullblocktests
+// package have the expected result when the scripts are not executed because
+// the blocks are assumed to be valid, since all other rules, such as the admin
+// operation and supply rules, must still be enforced.  It also ensures a block
+// with an invalid script is only accepted when it is an ancestor of the block
+// which is assumed to be valid.
+func TestFullBlocksAssumeValid(t *testing.T) {
+	testFullBlocks(t, "fullblocktestassumevalid", blockchain.BFAssumeValid)
+
+	avChain, err := fullblocktests.GenerateAssumeValid()
+	if err != nil {
+		t.Fatalf("failed to generate assumevalid blocks: %v", err)
+	}
+	blocksByHash := make(map[chainhash.Hash]*wire.MsgBlock)
+	for _, block := range append(avChain.Mature, avChain.BadScript,
+		avChain.Child, avChain.Sibling) {
+
+		blocksByHash[block.BlockHash()] = block
+	}
+
+	// processBlocks processes the mature blocks followed by the block with
+	// the invalid script with a new chain instance.  Like the block
+	// manager, the scripts of a block are only skipped when it is an
+	// ancestor of the block which is assumed to be valid.  It returns the
+	// error of the block with the invalid script.
+	processBlocks := func(dbName string, assumeValid *wire.MsgBlock) error {
+		chain, teardownFunc, err := chainSetup(dbName,
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("Failed to setup chain instance: %v", err)
+		}
+		defer teardownFunc()
+
+		flagsFor := func(block *wire.MsgBlock) blockchain.BehaviorFlags {
+			hash := block.BlockHash()
+			node := assumeValid
+			for node != nil {
+				if node.BlockHash() == hash {
+					return blockchain.BFAssumeValid
+				}
+				node = blocksByHash[node.Header.PrevBlock]
+			}
+			return blockchain.BFNone
+		}
+
+		for _, block := range avChain.Mature {
+			_, _, err := chain.ProcessBlock(provautil.NewBlock(block),
+				flagsFor(block))
+			if err != nil {
+				t.Fatalf("mature block %s at height %d should "+
+					"have been accepted: %v", block.BlockHash(),
+					block.Header.Height, err)
+			}
+		}
+		_, _, err = chain.ProcessBlock(provautil.NewBlock(
+			avChain.BadScript), flagsFor(avChain.BadScript))
+		return err
+	}
+
+	// The block with the invalid script is accepted when it is an ancestor
+	// of the block which is assumed to be valid.
+	if err := processBlocks("assumevalidancestor", avChain.Child); err != nil {
+		t.Fatalf("block with invalid script which is an ancestor of "+
+			"the assumed valid block should have been accepted: %v",
+			err)
+	}
+
+	// The same block is rejected when it is not an ancestor of the block
+	// which is assumed to be valid.
+	err = processBlocks("assumevalidnotancestor", avChain.Sibling)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrScriptValidation {
+		t.Fatalf("block with invalid script which is not an ancestor "+
+			"of the assumed valid block should have been rejected "+
+			"with %v, got %v", blockchain.ErrScriptValidation, err)
+	}
+}
 
+// testFullBlocks processes all tests generated by the fullblocktests package
+// with the passed flags via ProcessBlock and ensures they have the expected
+// result.
+func testFullBlocks(t *testing.T, dbName string, flags blockchain.BehaviorFlags) {
 	tests, err := fullblocktests.Generate(false)
 	if err != nil {
 		t.Fatalf("failed to generate tests: %v", err)
 	}
 
 	// Create a new database and chain instance to run tests against.
-	chain, teardownFunc, err := chainSetup("fullblocktest",
+	chain, teardownFunc, err := chainSetup(dbName,
 		&chaincfg.RegressionNetParams)
 	if err != nil {
 		t.Errorf("Failed to setup chain instance: %v", err)
@@ -45,8 +129,17 @@ func TestFullBlocks(t *testing.T) {
 		block.SetHeight(blockHeight)
 		t.Logf("Testing block %s (hash %s, height %d)",
 			item.Name, block.Hash(), blockHeight)
-		isMainChain, isOrphan, err := chain.ProcessBlock(block,
-			blockchain.BFNone)
+
+		// Ensure the checks of the signer done before a block is
+		// processed never reject a block which is accepted.
+		err := chain.CheckBlockHeaderSignature(&item.Block.Header)
+		if err != nil {
+			t.Fatalf("block %q (hash %s, height %d) should have "+
+				"passed the signer checks: %v", item.Name,
+				block.Hash(), blockHeight, err)
+		}
+
+		isMainChain, isOrphan, err := chain.ProcessBlock(block, flags)
 		if err != nil {
 			t.Fatalf("block %q (hash %s, height %d) should "+
 				"have been accepted: %v", item.Name,
@@ -129,7 +222,7 @@ func TestFullBlocks(t *testing.T) {
 		t.Logf("Testing block %s (hash %s, height %d)",
 			item.Name, block.Hash(), blockHeight)
 
-		_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+		_, _, err := chain.ProcessBlock(block, flags)
 		if err == nil {
 			t.Fatalf("block %q (hash %s, height %d) should not "+
 				"have been accepted", item.Name, block.Hash(),
@@ -186,7 +279,7 @@ func TestFullBlocks(t *testing.T) {
 		t.Logf("Testing block %s (hash %s, height %d)",
 			item.Name, block.Hash(), blockHeight)
 
-		_, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
+		_, isOrphan, err := chain.ProcessBlock(block, flags)
 		if err != nil {
 			// Ensure the error code is of the expected type.
 			if _, ok := err.(blockchain.RuleError); !ok {
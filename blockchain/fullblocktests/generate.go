@@ -214,6 +214,9 @@ type testGenerator struct {
 
 	// Common key for any tests which require signed transactions.
 	privKey *btcec.PrivateKey
+
+	// Key used to sign the block headers.
+	signKey *btcec.PrivateKey
 }
 
 // makeTestGenerator returns a test generator instance initialized with the
@@ -231,6 +234,7 @@ func makeTestGenerator(params *chaincfg.Params) (testGenerator, error) {
 		tipName:      "genesis",
 		tipHeight:    0,
 		privKey:      privKey2,
+		signKey:      validatePrivKey,
 	}, nil
 }
 
@@ -666,7 +670,7 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 		block.Header.MerkleRoot = calcMerkleRoot(block.Transactions)
 	}
 	block.Header.Size = uint32(block.SerializeSize())
-	block.Header.Sign(validatePrivKey)
+	block.Header.Sign(g.signKey)
 
 	// Only solve the block if the nonce wasn't manually changed by a munge
 	// function.
@@ -685,6 +689,14 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 	return &block
 }
 
+// nextBlockSignedBy is like nextBlock except the header of the block is signed
+// by the provided key rather than the default validate key.
+func (g *testGenerator) nextBlockSignedBy(blockName string, signKey *btcec.PrivateKey, spend *spendableOut, mungers ...func(*wire.MsgBlock)) *wire.MsgBlock {
+	g.signKey = signKey
+	defer func() { g.signKey = validatePrivKey }()
+	return g.nextBlock(blockName, spend, mungers...)
+}
+
 // setTip changes the tip of the instance to the block with the provided name.
 // This is useful since the tip is used for things such as generating subsequent
 // blocks.
@@ -1157,5 +1169,109 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	g.nextBlock("b31", outs[12], changeCoinbaseValue(1))
 	rejected(blockchain.ErrBadCoinbaseValue)
 
+	// ---------------------------------------------------------------------
+	// Validate key tests.
+	// ---------------------------------------------------------------------
+
+	// Create a block signed by a key which is not in the validate key set.
+	//
+	//   ... -> b27(11)
+	//                 \-> b32()
+	g.setTip("b27")
+	g.nextBlockSignedBy("b32", privKey1, nil)
+	rejected(blockchain.ErrInvalidValidateKey)
+
+	// Create a block which provisions the validate key it is signed by.
+	//
+	//   ... -> b27(11) -> b33()
+	initialValidatePubKeys := lastAdminKeySets[btcec.ValidateKeySet]
+	g.setTip("b27")
+	provThreadOut = makeSpendableOutForTx(aspKeyIdTx, 0)
+	validateKeyAddTx := createAdminTx(&provThreadOut,
+		provautil.ProvisionThread, txscript.AdminOpValidateKeyAdd, pubKey1)
+	provThreadOut = makeSpendableOutForTx(validateKeyAddTx, 0)
+	g.nextBlockSignedBy("b33", privKey1, nil, additionalTx(validateKeyAddTx))
+	assertThreadTip(provautil.ProvisionThread, provThreadOut)
+	assertAdminKeys(btcec.ValidateKeySet, append([]btcec.PublicKey{*pubKey1},
+		initialValidatePubKeys...))
+	accepted()
+
 	return tests, nil
 }
+
+// AssumeValidChain houses the blocks returned by GenerateAssumeValid.
+type AssumeValidChain struct {
+	// Mature are the blocks which build on the genesis block in order to
+	// have mature coinbase outputs to work with.
+	Mature []*wire.MsgBlock
+
+	// BadScript builds on the last mature block and includes a transaction
+	// with an invalid signature.
+	BadScript *wire.MsgBlock
+
+	// Child builds on BadScript.
+	Child *wire.MsgBlock
+
+	// Sibling builds on the last mature block like BadScript, but only
+	// includes valid transactions.
+	Sibling *wire.MsgBlock
+}
+
+// GenerateAssumeValid returns blocks that can be used to exercise skipping the
+// script checks of the ancestors of a block which is assumed to be valid.  The
+// block with the invalid script must only be accepted when it is an ancestor
+// of the block which is assumed to be valid, such as its child, and must be
+// rejected otherwise, such as when its sibling is assumed to be valid.
+func GenerateAssumeValid() (chain *AssumeValidChain, err error) {
+	// Replace any panics of the generation code with the underlying panic
+	// error like Generate.
+	defer func() {
+		if r := recover(); r != nil {
+			chain = nil
+
+			switch rt := r.(type) {
+			case string:
+				err = errors.New(rt)
+			case error:
+				err = rt
+			default:
+				err = errors.New("Unknown panic")
+			}
+		}
+	}()
+
+	g, err := makeTestGenerator(&chaincfg.RegressionNetParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// ---------------------------------------------------------------------
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bm0 -> bm1 -> ... -> bm99
+	// ---------------------------------------------------------------------
+
+	chain = &AssumeValidChain{}
+	coinbaseMaturity := g.params.CoinbaseMaturity
+	for i := uint16(0); i < coinbaseMaturity; i++ {
+		blockName := fmt.Sprintf("bm%d", i)
+		chain.Mature = append(chain.Mature, g.nextBlock(blockName, nil))
+		g.saveTipCoinbaseOut()
+	}
+	out := g.oldestCoinbaseOut()
+
+	// Create a block with a transaction whose lock time is changed after it
+	// was signed, so its signature is invalid, along with a child and a
+	// valid sibling.
+	//
+	//   ... -> bm99 -> bav1(0) -> bav2()
+	//               \-> bav1a(0)
+	chain.BadScript = g.nextBlock("bav1", &out, func(b *wire.MsgBlock) {
+		b.Transactions[1].LockTime++
+	})
+	chain.Child = g.nextBlock("bav2", nil)
+	g.setTip("bm99")
+	chain.Sibling = g.nextBlock("bav1a", &out)
+
+	return chain, nil
+}
@@ -578,6 +578,20 @@ func addrToKey(addr provautil.Address) ([addrKeySize]byte, error) {
 	return [addrKeySize]byte{}, errUnsupportedAddressType
 }
 
+// keyHashToKey converts the passed key hash to the addrindex key of the Prova
+// addresses with the key hash.
+func keyHashToKey(keyHash []byte) ([addrKeySize]byte, error) {
+	if len(keyHash) != addrKeySize-1 {
+		return [addrKeySize]byte{}, fmt.Errorf("key hash must be %d "+
+			"bytes", addrKeySize-1)
+	}
+
+	var result [addrKeySize]byte
+	result[0] = addrKeyTypePubKeyHash
+	copy(result[1:], keyHash)
+	return result, nil
+}
+
 // AddrIndex implements a transaction by address index.  That is to say, it
 // supports querying all transactions that reference a given address because
 // they are either crediting or debiting the address.  The returned transactions
@@ -966,6 +980,28 @@ func (idx *AddrIndex) UnconfirmedTxnsForAddress(addr provautil.Address) []*prova
 		return nil
 	}
 
+	return idx.unconfirmedTxnsForKey(addrKey)
+}
+
+// UnconfirmedTxnsForKeyHash returns all transactions currently in the
+// unconfirmed (memory-only) address index that involve any Prova address with
+// the passed key hash.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnconfirmedTxnsForKeyHash(keyHash []byte) []*provautil.Tx {
+	addrKey, err := keyHashToKey(keyHash)
+	if err != nil {
+		return nil
+	}
+
+	return idx.unconfirmedTxnsForKey(addrKey)
+}
+
+// unconfirmedTxnsForKey returns all transactions currently in the unconfirmed
+// (memory-only) address index that involve the passed address key.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) unconfirmedTxnsForKey(addrKey [addrKeySize]byte) []*provautil.Tx {
 	// Protect concurrent access.
 	idx.unconfirmedLock.RLock()
 	defer idx.unconfirmedLock.RUnlock()
@@ -0,0 +1,510 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// addrUtxoIndexName is the human-readable name for the index.
+	addrUtxoIndexName = "address utxo index"
+
+	// addrOutputKeySize is the number of bytes a key in the address utxo
+	// index consumes.  It consists of the address key + 32 bytes hash + 4
+	// bytes output index.
+	addrOutputKeySize = addrKeySize + chainhash.HashSize + 4
+
+	// addrOutputHeaderSize is the number of bytes the fixed size fields of
+	// a value in the address utxo index consume.  It consists of 4 bytes
+	// height + 4 bytes tx index + 8 bytes amount + 1 byte spent flag + 4
+	// bytes spend height + 4 bytes spend tx index + 32 bytes spend hash +
+	// 4 bytes spend input index.
+	addrOutputHeaderSize = 4 + 4 + 8 + 1 + 4 + 4 + chainhash.HashSize + 4
+)
+
+var (
+	// addrUtxoIndexKey is the key of the address utxo index and the db
+	// bucket used to house it.
+	addrUtxoIndexKey = []byte("utxobyaddridx")
+)
+
+// -----------------------------------------------------------------------------
+// The address utxo index maps addresses referenced in the blockchain to all of
+// the outputs paying to them along with the inputs which spent them, if any.
+// Like the address index, addresses are identified by their address key, so
+// the entries of all Prova addresses which share a key hash are stored next
+// to each other and can be retrieved with a single range scan.
+//
+// When a block is connected, an entry is added for each output paying to an
+// address and the entries of the outputs spent by the block are marked as
+// spent.  Disconnecting a block reverses both, which keeps the index
+// consistent through reorganizations.  As with the address index, the
+// referenced inputs are needed to index a block, so this implementation
+// requires the transaction index in order to catch up old blocks.
+//
+// The serialized key format is:
+//
+//   <addr key><hash><index>
+//
+//   Field           Type             Size
+//   addr key        [21]byte         21 bytes
+//   hash            chainhash.Hash   32 bytes
+//   index           uint32           4 bytes
+//   -----
+//   Total: 57 bytes
+//
+// The serialized value format is:
+//
+//   <height><tx index><amount><spent><spend height><spend tx index>
+//   <spend hash><spend input index><pkscript>
+//
+//   Field              Type             Size
+//   height             uint32           4 bytes
+//   tx index           uint32           4 bytes
+//   amount             int64            8 bytes
+//   spent              bool             1 byte
+//   spend height       uint32           4 bytes
+//   spend tx index     uint32           4 bytes
+//   spend hash         chainhash.Hash   32 bytes
+//   spend input index  uint32           4 bytes
+//   pkscript           []byte           variable
+//
+// The spend fields are zero when the output is unspent.
+// -----------------------------------------------------------------------------
+
+// AddrOutput describes an output in the main chain which pays to an address
+// along with the input which spent it, if any.
+type AddrOutput struct {
+	// OutPoint identifies the output.
+	OutPoint wire.OutPoint
+
+	// PkScript and Amount are the public key script and the amount of the
+	// output.
+	PkScript []byte
+	Amount   int64
+
+	// BlockHeight and TxIndex are the height of the block containing the
+	// transaction of the output and the index of the transaction in it.
+	BlockHeight uint32
+	TxIndex     uint32
+
+	// Spent is whether the output is spent in the main chain.  The
+	// remaining fields identify the spending input and are only set when
+	// it is.
+	Spent        bool
+	SpendHash    chainhash.Hash
+	SpendIndex   uint32
+	SpendHeight  uint32
+	SpendTxIndex uint32
+}
+
+// addrOutputKey returns the key of the output identified by the passed outpoint
+// for the passed address key.
+func addrOutputKey(addrKey [addrKeySize]byte, outPoint *wire.OutPoint) []byte {
+	key := make([]byte, addrOutputKeySize)
+	copy(key, addrKey[:])
+	copy(key[addrKeySize:], outPoint.Hash[:])
+	byteOrder.PutUint32(key[addrKeySize+chainhash.HashSize:], outPoint.Index)
+	return key
+}
+
+// serializeAddrOutput serializes the passed output into the value format
+// described in detail above.
+func serializeAddrOutput(output *AddrOutput) []byte {
+	serialized := make([]byte, addrOutputHeaderSize+len(output.PkScript))
+	byteOrder.PutUint32(serialized, output.BlockHeight)
+	byteOrder.PutUint32(serialized[4:], output.TxIndex)
+	byteOrder.PutUint64(serialized[8:], uint64(output.Amount))
+	if output.Spent {
+		serialized[16] = 1
+		byteOrder.PutUint32(serialized[17:], output.SpendHeight)
+		byteOrder.PutUint32(serialized[21:], output.SpendTxIndex)
+		copy(serialized[25:], output.SpendHash[:])
+		byteOrder.PutUint32(serialized[25+chainhash.HashSize:],
+			output.SpendIndex)
+	}
+	copy(serialized[addrOutputHeaderSize:], output.PkScript)
+	return serialized
+}
+
+// deserializeAddrOutput deserializes the passed key and value of the address
+// utxo index into the passed output.
+func deserializeAddrOutput(key, serialized []byte, output *AddrOutput) error {
+	if len(key) != addrOutputKeySize {
+		return errDeserialize("unexpected address utxo key length")
+	}
+	if len(serialized) < addrOutputHeaderSize {
+		return errDeserialize("unexpected end of data")
+	}
+
+	copy(output.OutPoint.Hash[:], key[addrKeySize:])
+	output.OutPoint.Index = byteOrder.Uint32(key[addrKeySize+chainhash.HashSize:])
+	output.BlockHeight = byteOrder.Uint32(serialized)
+	output.TxIndex = byteOrder.Uint32(serialized[4:])
+	output.Amount = int64(byteOrder.Uint64(serialized[8:]))
+	output.Spent = serialized[16] != 0
+	output.SpendHeight = byteOrder.Uint32(serialized[17:])
+	output.SpendTxIndex = byteOrder.Uint32(serialized[21:])
+	copy(output.SpendHash[:], serialized[25:])
+	output.SpendIndex = byteOrder.Uint32(serialized[25+chainhash.HashSize:])
+	output.PkScript = make([]byte, len(serialized)-addrOutputHeaderSize)
+	copy(output.PkScript, serialized[addrOutputHeaderSize:])
+	return nil
+}
+
+// addrOutputsSorter implements sort.Interface to allow a slice of outputs to be
+// sorted by the order they were created in the main chain.
+type addrOutputsSorter []AddrOutput
+
+// Len returns the number of outputs in the slice.  It is part of the
+// sort.Interface implementation.
+func (s addrOutputsSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the outputs at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s addrOutputsSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the output with index i was created before the output
+// with index j.  It is part of the sort.Interface implementation.
+func (s addrOutputsSorter) Less(i, j int) bool {
+	if s[i].BlockHeight != s[j].BlockHeight {
+		return s[i].BlockHeight < s[j].BlockHeight
+	}
+	if s[i].TxIndex != s[j].TxIndex {
+		return s[i].TxIndex < s[j].TxIndex
+	}
+	return s[i].OutPoint.Index < s[j].OutPoint.Index
+}
+
+// dbFetchAddrOutputs returns all outputs in the passed address utxo index
+// bucket for the passed address key, ordered by the order they were created in
+// the main chain.  Only the outputs with the passed public key script are
+// returned, unless it is nil.
+func dbFetchAddrOutputs(bucket database.Bucket, addrKey [addrKeySize]byte, pkScript []byte) ([]AddrOutput, error) {
+	var outputs []AddrOutput
+	cursor := bucket.Cursor()
+	for ok := cursor.Seek(addrKey[:]); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if !bytes.HasPrefix(key, addrKey[:]) {
+			break
+		}
+
+		var output AddrOutput
+		err := deserializeAddrOutput(key, cursor.Value(), &output)
+		if err != nil {
+			return nil, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt address utxo "+
+					"index entry %x: %v", key, err),
+			}
+		}
+		if pkScript != nil && !bytes.Equal(output.PkScript, pkScript) {
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+
+	sort.Sort(addrOutputsSorter(outputs))
+	return outputs, nil
+}
+
+// AddrUtxoIndex implements an index of the outputs paying to each address
+// along with the inputs which spent them.  That is to say, it supports querying
+// the unspent outputs, the balance and the history of the balance of a given
+// address without loading the transactions which involve it.
+type AddrUtxoIndex struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+}
+
+// Ensure the AddrUtxoIndex type implements the Indexer interface.
+var _ Indexer = (*AddrUtxoIndex)(nil)
+
+// Ensure the AddrUtxoIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*AddrUtxoIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *AddrUtxoIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Key() []byte {
+	return addrUtxoIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Name() string {
+	return addrUtxoIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the address
+// utxo index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(addrUtxoIndexKey)
+	return err
+}
+
+// addrKeys returns the address keys of all supported addresses the passed
+// public key script pays to.
+func (idx *AddrUtxoIndex) addrKeys(pkScript []byte) [][addrKeySize]byte {
+	// Nothing to index if the script is non-standard or otherwise doesn't
+	// contain any addresses.
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		idx.chainParams)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+
+	addrKeys := make([][addrKeySize]byte, 0, len(addrs))
+	for _, addr := range addrs {
+		addrKey, err := addrToKey(addr)
+		if err != nil {
+			// Ignore unsupported address types.
+			continue
+		}
+		addrKeys = append(addrKeys, addrKey)
+	}
+	return addrKeys
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for each output of
+// the block which pays to an address and marks the entries of the outputs the
+// block spends as spent.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+	for txIdx, tx := range block.Transactions() {
+		// Coinbases do not reference any inputs.  Since the block is
+		// required to have already gone through full validation, it has
+		// already been proven on the first transaction in the block is
+		// a coinbase.
+		if txIdx != 0 {
+			for txInIdx, txIn := range tx.MsgTx().TxIn {
+				// The view should always have the input since
+				// the index contract requires it, however, be
+				// safe and simply ignore any missing entries.
+				origin := &txIn.PreviousOutPoint
+				entry := view.LookupEntry(&origin.Hash)
+				if entry == nil {
+					continue
+				}
+
+				pkScript := entry.PkScriptByIndex(origin.Index)
+				for _, addrKey := range idx.addrKeys(pkScript) {
+					key := addrOutputKey(addrKey, origin)
+					serialized := bucket.Get(key)
+					if serialized == nil {
+						continue
+					}
+					var output AddrOutput
+					err := deserializeAddrOutput(key,
+						serialized, &output)
+					if err != nil {
+						return err
+					}
+					output.Spent = true
+					output.SpendHash = *tx.Hash()
+					output.SpendIndex = uint32(txInIdx)
+					output.SpendHeight = block.Height()
+					output.SpendTxIndex = uint32(txIdx)
+					err = bucket.Put(key,
+						serializeAddrOutput(&output))
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			outPoint := wire.OutPoint{
+				Hash:  *tx.Hash(),
+				Index: uint32(txOutIdx),
+			}
+			output := AddrOutput{
+				OutPoint:    outPoint,
+				PkScript:    txOut.PkScript,
+				Amount:      txOut.Value,
+				BlockHeight: block.Height(),
+				TxIndex:     uint32(txIdx),
+			}
+			for _, addrKey := range idx.addrKeys(txOut.PkScript) {
+				err := bucket.Put(addrOutputKey(addrKey, &outPoint),
+					serializeAddrOutput(&output))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entries of the
+// outputs of the block and marks the outputs the block spent as unspent again.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) DisconnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	// Undo the transactions in reverse order so outputs which are both
+	// created and spent by the block are marked unspent before they are
+	// removed.
+	bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+	transactions := block.Transactions()
+	for txIdx := len(transactions) - 1; txIdx >= 0; txIdx-- {
+		tx := transactions[txIdx]
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			outPoint := wire.OutPoint{
+				Hash:  *tx.Hash(),
+				Index: uint32(txOutIdx),
+			}
+			for _, addrKey := range idx.addrKeys(txOut.PkScript) {
+				err := bucket.Delete(addrOutputKey(addrKey,
+					&outPoint))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if txIdx == 0 {
+			continue
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			origin := &txIn.PreviousOutPoint
+			entry := view.LookupEntry(&origin.Hash)
+			if entry == nil {
+				continue
+			}
+
+			pkScript := entry.PkScriptByIndex(origin.Index)
+			for _, addrKey := range idx.addrKeys(pkScript) {
+				key := addrOutputKey(addrKey, origin)
+				serialized := bucket.Get(key)
+				if serialized == nil {
+					continue
+				}
+				var output AddrOutput
+				err := deserializeAddrOutput(key, serialized,
+					&output)
+				if err != nil {
+					return err
+				}
+				output.Spent = false
+				output.SpendHash = chainhash.Hash{}
+				output.SpendIndex = 0
+				output.SpendHeight = 0
+				output.SpendTxIndex = 0
+				err = bucket.Put(key, serializeAddrOutput(&output))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchOutputs returns all outputs for the passed address key which have the
+// passed public key script, unless it is nil.
+func (idx *AddrUtxoIndex) fetchOutputs(addrKey [addrKeySize]byte, pkScript []byte) ([]AddrOutput, error) {
+	var outputs []AddrOutput
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+		outputs, err = dbFetchAddrOutputs(bucket, addrKey, pkScript)
+		return err
+	})
+	return outputs, err
+}
+
+// OutputsForAddress returns all outputs in the main chain which pay to the
+// passed address, including the spent ones, ordered by the order they were
+// created in.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) OutputsForAddress(addr provautil.Address) ([]AddrOutput, error) {
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	return idx.fetchOutputs(addrKey, pkScript)
+}
+
+// OutputsForKeyHash returns all outputs in the main chain which pay to any
+// Prova address with the passed key hash, including the spent ones, ordered by
+// the order they were created in.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) OutputsForKeyHash(keyHash []byte) ([]AddrOutput, error) {
+	addrKey, err := keyHashToKey(keyHash)
+	if err != nil {
+		return nil, err
+	}
+	return idx.fetchOutputs(addrKey, nil)
+}
+
+// NewAddrUtxoIndex returns a new instance of an indexer that is used to create
+// a mapping of all addresses in the blockchain to the outputs paying to them
+// and the inputs spending those outputs.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewAddrUtxoIndex(db database.DB, chainParams *chaincfg.Params) *AddrUtxoIndex {
+	return &AddrUtxoIndex{
+		db:          db,
+		chainParams: chainParams,
+	}
+}
+
+// DropAddrUtxoIndex drops the address utxo index from the provided database if
+// it exists.
+func DropAddrUtxoIndex(db database.DB) error {
+	return dropIndex(db, addrUtxoIndexKey, addrUtxoIndexName)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestAddrOutputSerialization ensures serializing and deserializing the
+// entries of the address utxo index works as expected.
+func TestAddrOutputSerialization(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		output AddrOutput
+	}{
+		{
+			name: "unspent",
+			output: AddrOutput{
+				OutPoint:    wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 2},
+				PkScript:    []byte{0x51},
+				Amount:      5000,
+				BlockHeight: 10,
+				TxIndex:     3,
+			},
+		},
+		{
+			name: "spent",
+			output: AddrOutput{
+				OutPoint:     wire.OutPoint{Hash: chainhash.Hash{0x02}},
+				PkScript:     []byte{0x52, 0x53},
+				Amount:       1,
+				BlockHeight:  11,
+				Spent:        true,
+				SpendHash:    chainhash.Hash{0x03},
+				SpendIndex:   4,
+				SpendHeight:  12,
+				SpendTxIndex: 5,
+			},
+		},
+	}
+
+	var addrKey [addrKeySize]byte
+	for _, test := range tests {
+		key := addrOutputKey(addrKey, &test.output.OutPoint)
+		serialized := serializeAddrOutput(&test.output)
+
+		var output AddrOutput
+		err := deserializeAddrOutput(key, serialized, &output)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("%s: mismatched output - got %+v, want %+v",
+				test.name, output, test.output)
+		}
+
+		// Ensure truncated data is rejected.
+		err = deserializeAddrOutput(key, serialized[:addrOutputHeaderSize-1],
+			&output)
+		if !isDeserializeErr(err) {
+			t.Errorf("%s: unexpected error for truncated data: %v",
+				test.name, err)
+		}
+	}
+}
+
+// TestAddrUtxoIndex ensures the address utxo index tracks the outputs paying to
+// an address as blocks are connected and disconnected.
+func TestAddrUtxoIndex(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "addrutxoindextest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, wire.TestNet)
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	params := &chaincfg.RegressionNetParams
+	idx := NewAddrUtxoIndex(db, params)
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.Create(dbTx)
+	})
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+
+	keyHash := provautil.Hash160([]byte("addrutxoindex"))
+	addr1, err := provautil.NewAddressProva(keyHash, []btcec.KeyID{1, 2},
+		params)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	addr2, err := provautil.NewAddressProva(keyHash, []btcec.KeyID{1, 3},
+		params)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	pkScript1, _ := txscript.PayToAddrScript(addr1)
+	pkScript2, _ := txscript.PayToAddrScript(addr2)
+
+	// The first block pays to both addresses in its coinbase and the
+	// second block spends the output paying to the first address.
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x51, 0x51},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(1000, pkScript1))
+	coinbase.AddTxOut(wire.NewTxOut(2000, pkScript2))
+	block1 := provautil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase},
+	})
+	block1.SetHeight(1)
+
+	coinbase2 := coinbase.Copy()
+	coinbase2.LockTime = 2
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash()},
+	})
+	spend.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	block2 := provautil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase2, spend},
+	})
+	block2.SetHeight(2)
+
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOuts(provautil.NewTx(coinbase), 1)
+
+	connect := func(block *provautil.Block) {
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, view)
+		})
+		if err != nil {
+			t.Fatalf("ConnectBlock: unexpected error: %v", err)
+		}
+	}
+	disconnect := func(block *provautil.Block) {
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.DisconnectBlock(dbTx, block, view)
+		})
+		if err != nil {
+			t.Fatalf("DisconnectBlock: unexpected error: %v", err)
+		}
+	}
+
+	hash1 := coinbase.TxHash()
+	output1 := AddrOutput{
+		OutPoint:    wire.OutPoint{Hash: hash1},
+		PkScript:    pkScript1,
+		Amount:      1000,
+		BlockHeight: 1,
+	}
+	output2 := AddrOutput{
+		OutPoint:    wire.OutPoint{Hash: hash1, Index: 1},
+		PkScript:    pkScript2,
+		Amount:      2000,
+		BlockHeight: 1,
+	}
+	hash2 := coinbase2.TxHash()
+	output3 := AddrOutput{
+		OutPoint:    wire.OutPoint{Hash: hash2},
+		PkScript:    pkScript1,
+		Amount:      1000,
+		BlockHeight: 2,
+	}
+	output4 := AddrOutput{
+		OutPoint:    wire.OutPoint{Hash: hash2, Index: 1},
+		PkScript:    pkScript2,
+		Amount:      2000,
+		BlockHeight: 2,
+	}
+	spentOutput1 := output1
+	spentOutput1.Spent = true
+	spentOutput1.SpendHash = spend.TxHash()
+	spentOutput1.SpendHeight = 2
+	spentOutput1.SpendTxIndex = 1
+
+	check := func(desc string, wantAddr1, wantKeyHash []AddrOutput) {
+		outputs, err := idx.OutputsForAddress(addr1)
+		if err != nil {
+			t.Fatalf("%s: OutputsForAddress: unexpected error: %v",
+				desc, err)
+		}
+		if !reflect.DeepEqual(outputs, wantAddr1) {
+			t.Fatalf("%s: OutputsForAddress: got %+v, want %+v",
+				desc, outputs, wantAddr1)
+		}
+		outputs, err = idx.OutputsForKeyHash(keyHash)
+		if err != nil {
+			t.Fatalf("%s: OutputsForKeyHash: unexpected error: %v",
+				desc, err)
+		}
+		if !reflect.DeepEqual(outputs, wantKeyHash) {
+			t.Fatalf("%s: OutputsForKeyHash: got %+v, want %+v",
+				desc, outputs, wantKeyHash)
+		}
+	}
+
+	check("empty", nil, nil)
+	connect(block1)
+	check("block 1", []AddrOutput{output1},
+		[]AddrOutput{output1, output2})
+	connect(block2)
+	check("block 2", []AddrOutput{spentOutput1, output3},
+		[]AddrOutput{spentOutput1, output2, output3, output4})
+	disconnect(block2)
+	check("disconnect block 2", []AddrOutput{output1},
+		[]AddrOutput{output1, output2})
+	disconnect(block1)
+	check("disconnect block 1", nil, nil)
+}
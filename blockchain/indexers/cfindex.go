@@ -0,0 +1,273 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/gcs/builder"
+)
+
+const (
+	// cfIndexName is the human-readable name for the index.
+	cfIndexName = "committed filter index"
+)
+
+var (
+	// cfIndexKey is the key of the committed filter index and the db
+	// bucket used to house it.
+	cfIndexKey = []byte("cfbyblockhashidx")
+)
+
+// -----------------------------------------------------------------------------
+// The committed filter index consists of an entry for every block in the main
+// chain which houses the regular filter (BIP0158) of the block along with its
+// filter header, which commits to the filter and the filter header of the
+// previous block.
+//
+// The serialized format for keys and values in the index bucket is:
+//   <hash> = <filter header><filter>
+//
+//   Field           Type              Size
+//   hash            chainhash.Hash    32 bytes
+//   filter header   chainhash.Hash    32 bytes
+//   filter          []byte            variable
+// -----------------------------------------------------------------------------
+
+// dbFetchCfIndexEntry uses an existing database transaction to fetch the
+// filter header and the serialized filter of the block with the passed hash.
+// When there is no entry for the hash, nil is returned for both.
+func dbFetchCfIndexEntry(dbTx database.Tx, blockHash *chainhash.Hash) (*chainhash.Hash, []byte, error) {
+	serializedData := dbTx.Metadata().Bucket(cfIndexKey).Get(blockHash[:])
+	if serializedData == nil {
+		return nil, nil, nil
+	}
+	if len(serializedData) < chainhash.HashSize {
+		return nil, nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt committed filter "+
+				"index entry for %s", blockHash),
+		}
+	}
+
+	var header chainhash.Hash
+	copy(header[:], serializedData[:chainhash.HashSize])
+	filter := make([]byte, len(serializedData)-chainhash.HashSize)
+	copy(filter, serializedData[chainhash.HashSize:])
+	return &header, filter, nil
+}
+
+// CfIndex implements a committed filter (BIP0158) index by block hash.
+type CfIndex struct {
+	db database.DB
+}
+
+// Ensure the CfIndex type implements the Indexer interface.
+var _ Indexer = (*CfIndex)(nil)
+
+// Ensure the CfIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*CfIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *CfIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) Key() []byte {
+	return cfIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) Name() string {
+	return cfIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the committed
+// filter index.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(cfIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer builds the regular filter of the
+// block from its outputs and the outputs it spends, and stores it along with
+// its filter header.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	// Gather the scripts of the outputs spent by the block.  Since the
+	// block is required to have already gone through full validation,
+	// the first transaction is the coinbase which does not spend any.
+	var prevOutScripts [][]byte
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			// The view should always have the input since the index
+			// contract requires it, however, be safe and simply
+			// ignore any missing entries.
+			origin := &txIn.PreviousOutPoint
+			entry := view.LookupEntry(&origin.Hash)
+			if entry == nil {
+				continue
+			}
+			pkScript := entry.PkScriptByIndex(origin.Index)
+			prevOutScripts = append(prevOutScripts, pkScript)
+		}
+	}
+
+	filter, err := builder.BuildBasicFilter(block.MsgBlock(),
+		prevOutScripts)
+	if err != nil {
+		return err
+	}
+	filterData, err := filter.NBytes()
+	if err != nil {
+		return err
+	}
+
+	// The filter header of the genesis block commits to a zero previous
+	// filter header.
+	var prevHeader chainhash.Hash
+	if block.Height() > 0 {
+		prevHash := &block.MsgBlock().Header.PrevBlock
+		header, _, err := dbFetchCfIndexEntry(dbTx, prevHash)
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			return AssertError(fmt.Sprintf("no committed filter "+
+				"for block %v which precedes block %v",
+				prevHash, block.Hash()))
+		}
+		prevHeader = *header
+	}
+	header := builder.MakeHeaderForFilterHash(
+		chainhash.DoubleHashH(filterData), prevHeader)
+
+	serializedData := make([]byte, 0, chainhash.HashSize+len(filterData))
+	serializedData = append(serializedData, header[:]...)
+	serializedData = append(serializedData, filterData...)
+	return dbTx.Metadata().Bucket(cfIndexKey).Put(block.Hash()[:],
+		serializedData)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the filter of the
+// block.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) DisconnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	return dbTx.Metadata().Bucket(cfIndexKey).Delete(block.Hash()[:])
+}
+
+// FilterByBlockHash returns the serialized regular filter of the block with
+// the passed hash.  When there is no entry for the hash, nil is returned for
+// both the filter and the error.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterByBlockHash(hash *chainhash.Hash) ([]byte, error) {
+	var filter []byte
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		_, filter, err = dbFetchCfIndexEntry(dbTx, hash)
+		return err
+	})
+	return filter, err
+}
+
+// FiltersByBlockHashes returns the serialized regular filters of the blocks
+// with the passed hashes.  The filter of a block which has no entry is nil.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FiltersByBlockHashes(hashes []chainhash.Hash) ([][]byte, error) {
+	filters := make([][]byte, 0, len(hashes))
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for i := range hashes {
+			_, filter, err := dbFetchCfIndexEntry(dbTx, &hashes[i])
+			if err != nil {
+				return err
+			}
+			filters = append(filters, filter)
+		}
+		return nil
+	})
+	return filters, err
+}
+
+// FilterHeaderByBlockHash returns the filter header of the regular filter of
+// the block with the passed hash.  When there is no entry for the hash, nil is
+// returned for both the header and the error.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHeaderByBlockHash(hash *chainhash.Hash) (*chainhash.Hash, error) {
+	var header *chainhash.Hash
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		header, _, err = dbFetchCfIndexEntry(dbTx, hash)
+		return err
+	})
+	return header, err
+}
+
+// FilterHeadersByBlockHashes returns the filter headers of the regular filters
+// of the blocks with the passed hashes.  The header of a block which has no
+// entry is nil.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHeadersByBlockHashes(hashes []chainhash.Hash) ([]*chainhash.Hash, error) {
+	headers := make([]*chainhash.Hash, 0, len(hashes))
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for i := range hashes {
+			header, _, err := dbFetchCfIndexEntry(dbTx, &hashes[i])
+			if err != nil {
+				return err
+			}
+			headers = append(headers, header)
+		}
+		return nil
+	})
+	return headers, err
+}
+
+// NewCfIndex returns a new instance of an indexer that is used to create a
+// mapping of the hashes of all blocks in the blockchain to their regular
+// committed filters and filter headers.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewCfIndex(db database.DB) *CfIndex {
+	return &CfIndex{db: db}
+}
+
+// DropCfIndex drops the committed filter index from the provided database if
+// it exists.
+func DropCfIndex(db database.DB) error {
+	return dropIndex(db, cfIndexKey, cfIndexName)
+}
@@ -649,3 +649,81 @@ func dropIndex(db database.DB, idxKey []byte, idxName string) error {
 	log.Infof("Dropped %s", idxName)
 	return nil
 }
+
+// checkedIndexes houses the keys and names of all indexes which are checked by
+// CheckIndexTips.
+var checkedIndexes = []struct {
+	key  []byte
+	name string
+}{
+	{txIndexKey, txIndexName},
+	{addrIndexKey, addrIndexName},
+	{addrUtxoIndexKey, addrUtxoIndexName},
+	{cfIndexKey, cfIndexName},
+}
+
+// CheckIndexTips ensures the tip of every index in the passed database is a
+// block of the main chain of the passed database check result and that no
+// drop of an index was interrupted.  Every inconsistency found is added to
+// the result.  When repair is set, the inconsistent indexes are dropped so
+// they are rebuilt from scratch the next time they are enabled.
+func CheckIndexTips(db database.DB, result *blockchain.DatabaseCheckResult, repair bool) error {
+	var needsDrop []int
+	err := db.View(func(dbTx database.Tx) error {
+		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		if indexesBucket == nil {
+			return nil
+		}
+
+		for i, index := range checkedIndexes {
+			if indexesBucket.Get(indexDropKey(index.key)) != nil {
+				result.Discrepancies = append(result.Discrepancies,
+					fmt.Sprintf("drop of the %s was interrupted",
+						index.name))
+				needsDrop = append(needsDrop, i)
+				continue
+			}
+			if indexesBucket.Get(index.key) == nil {
+				continue
+			}
+
+			hash, height, err := dbFetchIndexerTip(dbTx, index.key)
+			if err != nil {
+				result.Discrepancies = append(result.Discrepancies,
+					fmt.Sprintf("%s tip is corrupt: %v",
+						index.name, err))
+				needsDrop = append(needsDrop, i)
+				continue
+			}
+
+			// Indexes without any entries yet have no tip.
+			if height == -1 && *hash == (chainhash.Hash{}) {
+				continue
+			}
+			mainChain := result.MainChain
+			if height < 0 || int(height) >= len(mainChain) ||
+				mainChain[height] != *hash {
+
+				result.Discrepancies = append(result.Discrepancies,
+					fmt.Sprintf("%s tip %v (height %d) is not "+
+						"in the main chain", index.name, hash,
+						height))
+				needsDrop = append(needsDrop, i)
+			}
+		}
+		return nil
+	})
+	if err != nil || !repair {
+		return err
+	}
+
+	for _, i := range needsDrop {
+		index := checkedIndexes[i]
+		if err := dropIndex(db, index.key, index.name); err != nil {
+			return err
+		}
+		result.Repairs = append(result.Repairs,
+			fmt.Sprintf("dropped the %s", index.name))
+	}
+	return nil
+}
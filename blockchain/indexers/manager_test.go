@@ -0,0 +1,105 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/memdb"
+)
+
+// TestCheckIndexTips ensures index tips which are not in the main chain and
+// interrupted drops are reported and that the affected indexes are dropped
+// when repairing them.
+func TestCheckIndexTips(t *testing.T) {
+	t.Parallel()
+
+	db, err := database.Create("memdb")
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer db.Close()
+
+	// Create the index tips of an index at a main chain block, an empty
+	// index, an index at a block which is not in the main chain and an
+	// index whose drop was interrupted.
+	mainChain := []chainhash.Hash{{0x00}, {0x01}, {0x02}}
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if _, err := meta.CreateBucket(indexTipsBucketName); err != nil {
+			return err
+		}
+		tips := []struct {
+			key    []byte
+			hash   chainhash.Hash
+			height int32
+		}{
+			{txIndexKey, mainChain[2], 2},
+			{addrIndexKey, chainhash.Hash{}, -1},
+			{addrUtxoIndexKey, chainhash.Hash{0x03}, 1},
+			{cfIndexKey, mainChain[1], 1},
+		}
+		for _, tip := range tips {
+			bucket, err := meta.CreateBucket(tip.key)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte{0x01}, []byte{0x02}); err != nil {
+				return err
+			}
+			err = dbPutIndexerTip(dbTx, tip.key, &tip.hash, tip.height)
+			if err != nil {
+				return err
+			}
+		}
+		indexesBucket := meta.Bucket(indexTipsBucketName)
+		return indexesBucket.Put(indexDropKey(cfIndexKey), cfIndexKey)
+	})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+
+	// check checks the index tips and ensures the expected number of
+	// discrepancies and repairs are reported.
+	check := func(name string, repair bool, wantDiscrepancies, wantRepairs int) {
+		result := &blockchain.DatabaseCheckResult{MainChain: mainChain}
+		if err := CheckIndexTips(db, result, repair); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(result.Discrepancies) != wantDiscrepancies {
+			t.Fatalf("%s: got discrepancies %v, want %d", name,
+				result.Discrepancies, wantDiscrepancies)
+		}
+		if len(result.Repairs) != wantRepairs {
+			t.Fatalf("%s: got repairs %v, want %d", name,
+				result.Repairs, wantRepairs)
+		}
+	}
+	check("inconsistent", false, 2, 0)
+	check("repair", true, 2, 2)
+	check("repaired", false, 0, 0)
+
+	// Ensure only the inconsistent indexes were dropped.
+	err = db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		for _, key := range [][]byte{txIndexKey, addrIndexKey} {
+			if meta.Bucket(key) == nil {
+				t.Fatalf("index %s was dropped", key)
+			}
+		}
+		for _, key := range [][]byte{addrUtxoIndexKey, cfIndexKey} {
+			if meta.Bucket(key) != nil {
+				t.Fatalf("index %s was not dropped", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+}
@@ -6,6 +6,7 @@
 package indexers
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -19,6 +20,12 @@ import (
 const (
 	// txIndexName is the human-readable name for the index.
 	txIndexName = "transaction index"
+
+	// sigHashIndexMigrationBatchSize is the number of transactions whose
+	// hashes with signatures are added to the hash with signatures index
+	// per database transaction while it is populated for a transaction
+	// index which was created before it was added.
+	sigHashIndexMigrationBatchSize = 10000
 )
 
 var (
@@ -34,6 +41,17 @@ var (
 	// the block hash -> block id index.
 	hashByIDIndexBucketName = []byte("hashbyididx")
 
+	// hashBySigHashIndexBucketName is the name of the db bucket used to
+	// house the transaction hash with signatures -> transaction hash index.
+	hashBySigHashIndexBucketName = []byte("txhashbysighashidx")
+
+	// sigHashIndexMigrationKeyName is the name of the db key used to store
+	// the hash of the last transaction added to the hash with signatures
+	// index while it is populated for a transaction index which was created
+	// before it was added.  The key only exists until the index is fully
+	// populated, which allows an interrupted migration to resume.
+	sigHashIndexMigrationKeyName = []byte("txhashbysighashidxmigration")
+
 	// errNoBlockIDEntry is an error that indicates a requested entry does
 	// not exist in the block ID index.
 	errNoBlockIDEntry = errors.New("no entry in the block ID index")
@@ -48,10 +66,13 @@ var (
 // only 4 bytes versus 32 bytes hashes and thus saves a ton of space in the
 // index.
 //
-// There are three buckets used in total.  The first bucket maps the hash of
+// There are four buckets used in total.  The first bucket maps the hash of
 // each transaction to the specific block location.  The second bucket maps the
 // hash of each block to the unique ID and the third maps that ID back to the
-// block hash.
+// block hash.  The fourth maps the hash of each transaction including its
+// signatures to the hash without them, since outpoints and the first bucket
+// use the latter while the merkle tree commits to both.  Transactions whose
+// hashes are the same either way have no entry in the fourth bucket.
 //
 // NOTE: Although it is technically possible for multiple transactions to have
 // the same hash as long as the previous transaction with the same hash is fully
@@ -90,6 +111,17 @@ var (
 //   tx length       uint32          4 bytes
 //   -----
 //   Total: 44 bytes
+//
+// The serialized format for the keys and values in the tx hash with signatures
+// bucket is:
+//
+//   <txhashwithsig> = <txhash>
+//
+//   Field           Type              Size
+//   txhashwithsig   chainhash.Hash    32 bytes
+//   txhash          chainhash.Hash    32 bytes
+//   -----
+//   Total: 64 bytes
 // -----------------------------------------------------------------------------
 
 // dbPutBlockIDIndexEntry uses an existing database transaction to update or add
@@ -223,6 +255,108 @@ func dbFetchTxIndexEntry(dbTx database.Tx, txHash *chainhash.Hash) (*database.Bl
 	return &region, nil
 }
 
+// dbFetchTxHashBySigHash uses an existing database transaction to fetch the
+// hash of the transaction with the provided hash including signatures.  When
+// there is no entry for the provided hash, nil will be returned for both the
+// hash and the error.
+func dbFetchTxHashBySigHash(dbTx database.Tx, hashWithSig *chainhash.Hash) (*chainhash.Hash, error) {
+	sigHashIndex := dbTx.Metadata().Bucket(hashBySigHashIndexBucketName)
+	serializedHash := sigHashIndex.Get(hashWithSig[:])
+	if len(serializedHash) == 0 {
+		return nil, nil
+	}
+	if len(serializedHash) != chainhash.HashSize {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt transaction hash "+
+				"index entry for %s", hashWithSig),
+		}
+	}
+
+	var txHash chainhash.Hash
+	copy(txHash[:], serializedHash)
+	return &txHash, nil
+}
+
+// dbMigrateSigHashIndex uses an existing database transaction to add the
+// hashes with signatures of the next batch of at most the passed number of
+// transactions in the transaction index to the hash with signatures index.  The
+// transactions are loaded from the block store in the order of their hashes,
+// starting after the one stored under the migration key, which is updated to
+// the last transaction of the batch.  The key is removed once all transactions
+// have been processed.  The number of entries added to the index and whether
+// the migration is complete are returned.
+func dbMigrateSigHashIndex(dbTx database.Tx, batchSize int) (int, bool, error) {
+	meta := dbTx.Metadata()
+	sigHashIndex := meta.Bucket(hashBySigHashIndexBucketName)
+
+	// Load the hashes of the next batch of indexed transactions before
+	// fetching them since the index is modified while they are processed.
+	// The cursor is positioned at the last processed transaction, which is
+	// skipped, unless it was the first batch.
+	lastHash := meta.Get(sigHashIndexMigrationKeyName)
+	cursor := meta.Bucket(txIndexKey).Cursor()
+	ok := cursor.Seek(lastHash)
+	if ok && bytes.Equal(cursor.Key(), lastHash) {
+		ok = cursor.Next()
+	}
+	var txHashes []chainhash.Hash
+	for ; ok && len(txHashes) < batchSize; ok = cursor.Next() {
+		var txHash chainhash.Hash
+		copy(txHash[:], cursor.Key())
+		txHashes = append(txHashes, txHash)
+	}
+
+	regions := make([]database.BlockRegion, len(txHashes))
+	for i := range txHashes {
+		region, err := dbFetchTxIndexEntry(dbTx, &txHashes[i])
+		if err != nil {
+			return 0, false, err
+		}
+		if region == nil {
+			return 0, false, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("empty transaction "+
+					"index entry for %s", txHashes[i]),
+			}
+		}
+		regions[i] = *region
+	}
+	serializedTxns, err := dbTx.FetchBlockRegions(regions)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// Map the hash including signatures of every transaction for which it
+	// differs to the hash.
+	var numAdded int
+	for i, serializedTx := range serializedTxns {
+		tx, err := provautil.NewTxFromBytes(serializedTx)
+		if err != nil {
+			return 0, false, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt transaction %s "+
+					"in transaction index: %v", txHashes[i],
+					err),
+			}
+		}
+		if tx.HashWithSig().IsEqual(&txHashes[i]) {
+			continue
+		}
+		err = sigHashIndex.Put(tx.HashWithSig()[:], txHashes[i][:])
+		if err != nil {
+			return 0, false, err
+		}
+		numAdded++
+	}
+
+	if len(txHashes) < batchSize {
+		return numAdded, true, meta.Delete(sigHashIndexMigrationKeyName)
+	}
+	lastHash = txHashes[len(txHashes)-1][:]
+	return numAdded, false, meta.Put(sigHashIndexMigrationKeyName, lastHash)
+}
+
 // dbAddTxIndexEntries uses an existing database transaction to add a
 // transaction index entry for every transaction in the passed block.
 func dbAddTxIndexEntries(dbTx database.Tx, block *provautil.Block, blockID uint32) error {
@@ -240,6 +374,7 @@ func dbAddTxIndexEntries(dbTx database.Tx, block *provautil.Block, blockID uint3
 	// cuts down on the number of required allocations.
 	offset := 0
 	serializedValues := make([]byte, len(block.Transactions())*txEntrySize)
+	sigHashIndex := dbTx.Metadata().Bucket(hashBySigHashIndexBucketName)
 	for i, tx := range block.Transactions() {
 		putTxIndexEntry(serializedValues[offset:], blockID, txLocs[i])
 		endOffset := offset + txEntrySize
@@ -249,6 +384,14 @@ func dbAddTxIndexEntries(dbTx database.Tx, block *provautil.Block, blockID uint3
 			return err
 		}
 		offset += txEntrySize
+
+		// Map the hash including signatures to the hash.
+		if !tx.HashWithSig().IsEqual(tx.Hash()) {
+			err := sigHashIndex.Put(tx.HashWithSig()[:], tx.Hash()[:])
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -270,11 +413,19 @@ func dbRemoveTxIndexEntry(dbTx database.Tx, txHash *chainhash.Hash) error {
 // dbRemoveTxIndexEntries uses an existing database transaction to remove the
 // latest transaction entry for every transaction in the passed block.
 func dbRemoveTxIndexEntries(dbTx database.Tx, block *provautil.Block) error {
+	sigHashIndex := dbTx.Metadata().Bucket(hashBySigHashIndexBucketName)
 	for _, tx := range block.Transactions() {
 		err := dbRemoveTxIndexEntry(dbTx, tx.Hash())
 		if err != nil {
 			return err
 		}
+
+		// Blocks indexed before the hash with signatures index was
+		// added have no entries in it, so missing entries are not an
+		// error.
+		if err := sigHashIndex.Delete(tx.HashWithSig()[:]); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -349,6 +500,57 @@ func (idx *TxIndex) Init() error {
 		return err
 	}
 
+	// Create the hash with signatures index for transaction indexes which
+	// were created before it was added.  The migration key marks it as
+	// being populated, which starts before the first transaction hash.
+	var migrating bool
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Bucket(hashBySigHashIndexBucketName) == nil {
+			_, err := meta.CreateBucket(hashBySigHashIndexBucketName)
+			if err != nil {
+				return err
+			}
+			var zeroHash chainhash.Hash
+			err = meta.Put(sigHashIndexMigrationKeyName, zeroHash[:])
+			if err != nil {
+				return err
+			}
+		}
+		migrating = meta.Get(sigHashIndexMigrationKeyName) != nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Populate the hash with signatures index from the transactions which
+	// are already indexed.  Since the index can be so large, this is done
+	// in batches, each in its own database transaction, which also allows
+	// the migration to resume where it was interrupted.
+	if migrating {
+		log.Infof("Adding the hash with signatures of the indexed "+
+			"transactions to the %s", txIndexName)
+		var totalAdded int
+		for done := false; !done; {
+			err := idx.db.Update(func(dbTx database.Tx) error {
+				numAdded, complete, err := dbMigrateSigHashIndex(
+					dbTx, sigHashIndexMigrationBatchSize)
+				if err != nil {
+					return err
+				}
+				totalAdded += numAdded
+				done = complete
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		log.Infof("Added %d hashes with signatures to the %s",
+			totalAdded, txIndexName)
+	}
+
 	log.Debugf("Current internal block ID: %d", idx.curBlockID)
 	return nil
 }
@@ -380,6 +582,9 @@ func (idx *TxIndex) Create(dbTx database.Tx) error {
 	if _, err := meta.CreateBucket(hashByIDIndexBucketName); err != nil {
 		return err
 	}
+	if _, err := meta.CreateBucket(hashBySigHashIndexBucketName); err != nil {
+		return err
+	}
 	_, err := meta.CreateBucket(txIndexKey)
 	return err
 }
@@ -443,6 +648,21 @@ func (idx *TxIndex) TxBlockRegion(hash *chainhash.Hash) (*database.BlockRegion,
 	return region, err
 }
 
+// TxHashByHashWithSig returns the hash of the transaction in the transaction
+// index with the provided hash including signatures.  When there is no entry
+// for the provided hash, nil will be returned for both the hash and the error.
+//
+// This function is safe for concurrent access.
+func (idx *TxIndex) TxHashByHashWithSig(hashWithSig *chainhash.Hash) (*chainhash.Hash, error) {
+	var txHash *chainhash.Hash
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		txHash, err = dbFetchTxHashBySigHash(dbTx, hashWithSig)
+		return err
+	})
+	return txHash, err
+}
+
 // NewTxIndex returns a new instance of an indexer that is used to create a
 // mapping of the hashes of all transactions in the blockchain to the respective
 // block, location within the block, and size of the transaction.
@@ -463,17 +683,35 @@ func dropBlockIDIndex(db database.DB) error {
 			return err
 		}
 
-		return meta.DeleteBucket(hashByIDIndexBucketName)
+		err = meta.DeleteBucket(hashByIDIndexBucketName)
+		if err != nil {
+			return err
+		}
+
+		err = meta.Delete(sigHashIndexMigrationKeyName)
+		if err != nil {
+			return err
+		}
+
+		// The hash with signatures index does not exist for
+		// transaction indexes created before it was added.
+		if meta.Bucket(hashBySigHashIndexBucketName) == nil {
+			return nil
+		}
+		return meta.DeleteBucket(hashBySigHashIndexBucketName)
 	})
 }
 
 // DropTxIndex drops the transaction index from the provided database if it
-// exists.  Since the address index relies on it, the address index will also be
-// dropped when it exists.
+// exists.  Since the address and address utxo indexes rely on it, they will
+// also be dropped when they exist.
 func DropTxIndex(db database.DB) error {
 	if err := dropIndex(db, addrIndexKey, addrIndexName); err != nil {
 		return err
 	}
+	if err := dropIndex(db, addrUtxoIndexKey, addrUtxoIndexName); err != nil {
+		return err
+	}
 
 	return dropIndex(db, txIndexKey, txIndexName)
 }
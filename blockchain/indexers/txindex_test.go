@@ -0,0 +1,168 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/memdb"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestTxIndexSigHash ensures transactions can be looked up by their hash
+// including signatures, that the lookups are removed when the block is
+// disconnected, and that the hash with signatures index is populated for
+// transaction indexes created before it was added, including after the
+// migration was interrupted.
+func TestTxIndexSigHash(t *testing.T) {
+	t.Parallel()
+
+	db, err := database.Create("memdb")
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewTxIndex(db)
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.Create(dbTx)
+	})
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: unexpected error: %v", err)
+	}
+
+	// The coinbase has a signature script, so its hash including
+	// signatures differs from its hash, while the other transaction has
+	// none and has the same hash either way.
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x51, 0x51},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	unsigned := wire.NewMsgTx(1)
+	unsigned.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash()},
+	})
+	unsigned.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	block := provautil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, unsigned},
+	})
+	block.SetHeight(1)
+
+	coinbaseHash := coinbase.TxHash()
+	coinbaseHashWithSig := coinbase.TxHashWithSig()
+	if coinbaseHashWithSig == coinbaseHash {
+		t.Fatal("coinbase hash including signatures is its hash")
+	}
+	unsignedHash := unsigned.TxHash()
+	if unsigned.TxHashWithSig() != unsignedHash {
+		t.Fatal("unsigned transaction hash including signatures " +
+			"differs from its hash")
+	}
+
+	// check ensures the lookup of the coinbase by its hash including
+	// signatures returns the expected hash and that there is no entry for
+	// the transaction without signatures.
+	check := func(desc string, want *chainhash.Hash) {
+		txHash, err := idx.TxHashByHashWithSig(&coinbaseHashWithSig)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", desc, err)
+		}
+		if (txHash == nil) != (want == nil) ||
+			(want != nil && !txHash.IsEqual(want)) {
+
+			t.Fatalf("%s: got hash %v, want %v", desc, txHash,
+				want)
+		}
+		txHash, err = idx.TxHashByHashWithSig(&unsignedHash)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", desc, err)
+		}
+		if txHash != nil {
+			t.Fatalf("%s: unexpected hash %v for transaction "+
+				"without signatures", desc, txHash)
+		}
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		if err := dbTx.StoreBlock(block); err != nil {
+			return err
+		}
+		return idx.ConnectBlock(dbTx, block, nil)
+	})
+	if err != nil {
+		t.Fatalf("ConnectBlock: unexpected error: %v", err)
+	}
+	check("connected", &coinbaseHash)
+
+	// Remove the hash with signatures index as it is for transaction
+	// indexes created before it was added and ensure it is populated from
+	// the indexed transactions when the index is initialized.
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().DeleteBucket(hashBySigHashIndexBucketName)
+	})
+	if err != nil {
+		t.Fatalf("DeleteBucket: unexpected error: %v", err)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: unexpected error: %v", err)
+	}
+	check("migrated", &coinbaseHash)
+
+	// Interrupt the migration after its first batch and ensure it resumes
+	// from there when the index is initialized.
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(hashBySigHashIndexBucketName); err != nil {
+			return err
+		}
+		_, err := meta.CreateBucket(hashBySigHashIndexBucketName)
+		if err != nil {
+			return err
+		}
+		var zeroHash chainhash.Hash
+		err = meta.Put(sigHashIndexMigrationKeyName, zeroHash[:])
+		if err != nil {
+			return err
+		}
+		_, done, err := dbMigrateSigHashIndex(dbTx, 1)
+		if err == nil && done {
+			err = errors.New("migration completed in the first batch")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dbMigrateSigHashIndex: unexpected error: %v", err)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: unexpected error: %v", err)
+	}
+	check("resumed", &coinbaseHash)
+	err = db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Get(sigHashIndexMigrationKeyName) != nil {
+			return errors.New("migration key was not removed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, block, nil)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: unexpected error: %v", err)
+	}
+	check("disconnected", nil)
+}
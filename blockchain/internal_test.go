@@ -14,7 +14,11 @@ run.
 package blockchain
 
 import (
+	"errors"
 	"sort"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
 )
 
 // TstSetCoinbaseMaturity makes the ability to set the coinbase maturity
@@ -42,3 +46,44 @@ var TstCheckBlockScripts = checkBlockScripts
 // TstDeserializeUtxoEntry makes the internal deserializeUtxoEntry function
 // available to the test package.
 var TstDeserializeUtxoEntry = deserializeUtxoEntry
+
+// TstUtxoCacheLen returns the number of entries held by the utxo cache of the
+// chain.
+func (b *BlockChain) TstUtxoCacheLen() int {
+	b.utxoCache.mtx.Lock()
+	defer b.utxoCache.mtx.Unlock()
+	return len(b.utxoCache.entries)
+}
+
+// TstDowngradeSpendJournal rewrites the spend journal of the passed database as
+// it was serialized before the serialization was versioned, which is without
+// the header code for the final spend of the genesis coinbase.
+func TstDowngradeSpendJournal(db database.DB, params *chaincfg.Params) error {
+	var state bestChainState
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		serializedData := dbTx.Metadata().Get(chainStateKeyName)
+		state, err = deserializeBestChainState(serializedData)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	block, outpoint, err := findGenesisFinalSpend(db, params, state.height)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return errors.New("the genesis coinbase is not fully spent")
+	}
+	return db.Update(func(dbTx database.Tx) error {
+		err := dbUpdateSpentTxOut(dbTx, block, outpoint,
+			func(stxo *spentTxOut) {
+				stxo.isCoinBase = false
+			})
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(spendJournalVersionKeyName)
+	})
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package lightclient implements block header verification for light clients
+which do not download full blocks.
+
+Every block header is signed by a validate key, and the set of authorized
+validate keys changes through admin transactions in block bodies.  A
+HeaderVerifier starts from the admin key sets of the genesis block and
+replays the admin transactions of each block, which are served along with
+proofs of their inclusion by the getadmintxproofs RPC, through a
+blockchain.KeyViewpoint.  As in the chain, each header must be signed by a
+key which is authorized once the admin transactions of its own block have been
+applied, so a block may be signed by a validate key it adds but not by one it
+revokes.
+
+Inclusion proofs can not show that no admin transaction was left out.  Since
+every admin transaction spends the tip of its admin thread, an omitted
+transaction is detected as soon as a later transaction of the same thread is
+added, but not before.  Clients should therefore request admin transactions
+from more than one source.
+
+The difficulty retargeting and validate key rate limiting rules depend on
+the full history of the chain and are not checked.
+*/
+package lightclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/bloom"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// HeaderVerifier verifies a chain of block headers from the genesis block of
+// a network while tracking the admin key sets which govern it.  It is not
+// safe for concurrent access.
+type HeaderVerifier struct {
+	chainParams *chaincfg.Params
+	keyView     *blockchain.KeyViewpoint
+	tipHash     chainhash.Hash
+	tipHeight   uint32
+
+	// adminTxns houses the admin transactions of blocks whose headers are
+	// not connected yet, keyed by block hash.
+	adminTxns map[chainhash.Hash][]*provautil.Tx
+}
+
+// NewHeaderVerifier returns a header verifier for the network defined by the
+// passed parameters with the genesis block as its tip.
+func NewHeaderVerifier(chainParams *chaincfg.Params) *HeaderVerifier {
+	// Initialize the admin state the same way the chain does for the
+	// genesis block, where the admin threads start at the outputs of the
+	// coinbase.
+	genesisBlock := provautil.NewBlock(chainParams.GenesisBlock)
+	coinbaseHash := genesisBlock.Transactions()[0].Hash()
+	threadTips := map[provautil.ThreadID]*wire.OutPoint{
+		provautil.RootThread:      wire.NewOutPoint(coinbaseHash, 0),
+		provautil.ProvisionThread: wire.NewOutPoint(coinbaseHash, 1),
+		provautil.IssueThread:     wire.NewOutPoint(coinbaseHash, 2),
+	}
+	var lastKeyID btcec.KeyID
+	for keyID := range chainParams.ASPKeyIdMap {
+		if keyID > lastKeyID {
+			lastKeyID = keyID
+		}
+	}
+
+	keyView := blockchain.NewKeyViewpoint()
+	keyView.SetThreadTips(threadTips)
+	keyView.SetLastKeyID(lastKeyID)
+	keyView.SetKeys(chainParams.AdminKeySets)
+	keyView.SetKeyIDs(chainParams.ASPKeyIdMap)
+
+	return &HeaderVerifier{
+		chainParams: chainParams,
+		keyView:     keyView,
+		tipHash:     *genesisBlock.Hash(),
+		tipHeight:   0,
+		adminTxns:   make(map[chainhash.Hash][]*provautil.Tx),
+	}
+}
+
+// Tip returns the hash and height of the last connected header.
+func (v *HeaderVerifier) Tip() (*chainhash.Hash, uint32) {
+	tipHash := v.tipHash
+	return &tipHash, v.tipHeight
+}
+
+// AdminKeySets returns the admin key sets as of the last connected header.
+func (v *HeaderVerifier) AdminKeySets() map[btcec.KeySetType]btcec.PublicKeySet {
+	return btcec.DeepCopy(v.keyView.Keys())
+}
+
+// AddAdminTxns verifies the passed proof and stores the passed admin
+// transactions, which must be the transactions it proves in block order, so
+// they are applied once the header of their block is connected.  The proof
+// must contain every admin transaction in the block.
+func (v *HeaderVerifier) AddAdminTxns(proof *bloom.TxProof, txns []*wire.MsgTx) error {
+	if proof.Header.Height <= v.tipHeight {
+		str := fmt.Sprintf("admin transactions for block at height "+
+			"%d must be added before its header is connected",
+			proof.Header.Height)
+		return errors.New(str)
+	}
+
+	hashes, sigHashes, err := proof.Verify()
+	if err != nil {
+		return err
+	}
+	if len(txns) != len(hashes) {
+		str := fmt.Sprintf("proof contains %d transactions instead "+
+			"of %d", len(hashes), len(txns))
+		return errors.New(str)
+	}
+
+	adminTxns := make([]*provautil.Tx, 0, len(txns))
+	for i, msgTx := range txns {
+		tx := provautil.NewTx(msgTx)
+		if !tx.Hash().IsEqual(hashes[i]) ||
+			!tx.HashWithSig().IsEqual(sigHashes[i]) {
+
+			str := fmt.Sprintf("transaction %v does not match "+
+				"proven transaction %v", tx.Hash(), hashes[i])
+			return errors.New(str)
+		}
+		if err := checkAdminTx(tx); err != nil {
+			return err
+		}
+		adminTxns = append(adminTxns, tx)
+	}
+
+	v.adminTxns[proof.Header.BlockHash()] = adminTxns
+	return nil
+}
+
+// checkAdminTx ensures the passed transaction is an admin transaction whose
+// operations are valid for its thread.
+func checkAdminTx(tx *provautil.Tx) error {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	if threadInt < 0 || blockchain.IsCoinBase(tx) {
+		str := fmt.Sprintf("transaction %v is not an admin transaction",
+			tx.Hash())
+		return errors.New(str)
+	}
+
+	threadID := provautil.ThreadID(threadInt)
+	if threadID == provautil.IssueThread {
+		return nil
+	}
+	if len(adminOutputs) == 0 {
+		str := fmt.Sprintf("admin transaction %v does not contain any "+
+			"operations", tx.Hash())
+		return errors.New(str)
+	}
+	for _, adminOutput := range adminOutputs {
+		if !txscript.IsValidAdminOp(adminOutput, threadID) {
+			str := fmt.Sprintf("admin transaction %v contains an "+
+				"invalid operation for thread %d", tx.Hash(),
+				threadID)
+			return errors.New(str)
+		}
+	}
+	return nil
+}
+
+// copyKeyView returns a deep copy of the passed key view.
+func copyKeyView(keyView *blockchain.KeyViewpoint) *blockchain.KeyViewpoint {
+	viewCopy := blockchain.NewKeyViewpoint()
+	viewCopy.SetThreadTips(keyView.ThreadTips())
+	viewCopy.SetLastKeyID(keyView.LastKeyID())
+	viewCopy.SetTotalSupply(keyView.TotalSupply())
+	viewCopy.SetKeys(keyView.Keys())
+	viewCopy.SetKeyIDs(keyView.KeyIDs())
+	return viewCopy
+}
+
+// checkValidateKey ensures the passed header is signed by a key in the
+// validate key set of the passed key view.  As in the chain, any key is
+// accepted while the set is empty.
+func checkValidateKey(keyView *blockchain.KeyViewpoint, header *wire.BlockHeader) error {
+	pubKey, err := btcec.ParsePubKey(header.ValidatingPubKey[:],
+		btcec.S256())
+	if err != nil {
+		str := fmt.Sprintf("malformed validating public key: %v", err)
+		return blockchain.RuleError{
+			ErrorCode:   blockchain.ErrBadBlockSignature,
+			Description: str,
+		}
+	}
+	validateKeySet := keyView.Keys()[btcec.ValidateKeySet]
+	if len(validateKeySet) == 0 || validateKeySet.Pos(pubKey) != -1 {
+		return nil
+	}
+	str := fmt.Sprintf("invalid validate key %x", pubKey.SerializeCompressed())
+	return blockchain.RuleError{
+		ErrorCode:   blockchain.ErrInvalidValidateKey,
+		Description: str,
+	}
+}
+
+// ConnectHeader verifies the passed header, which must extend the current
+// tip, and makes it the new tip.  The header must have valid proof of work and
+// any admin transactions added for its block must each spend the tip of its
+// admin thread.  As in the chain, the header must be signed by a validate key
+// which is authorized once the admin transactions of its block are applied,
+// so a block may provision the key it is signed by.
+func (v *HeaderVerifier) ConnectHeader(header *wire.BlockHeader) error {
+	if !header.PrevBlock.IsEqual(&v.tipHash) {
+		str := fmt.Sprintf("header does not connect to tip %v",
+			v.tipHash)
+		return errors.New(str)
+	}
+	if header.Height != v.tipHeight+1 {
+		str := fmt.Sprintf("header height %d does not follow tip "+
+			"height %d", header.Height, v.tipHeight)
+		return errors.New(str)
+	}
+	err := blockchain.CheckHeaderSanity(header, v.chainParams.PowLimit)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the admin transactions of the block form a continuation of
+	// the admin threads.
+	blockHash := header.BlockHash()
+	adminTxns := v.adminTxns[blockHash]
+	threadTips := provautil.CopyThreadTips(v.keyView.ThreadTips())
+	for _, tx := range adminTxns {
+		threadInt, _ := txscript.GetAdminDetails(tx)
+		threadID := provautil.ThreadID(threadInt)
+		threadTip := threadTips[threadID]
+		prevOut := tx.MsgTx().TxIn[0].PreviousOutPoint
+		if threadTip == nil || prevOut != *threadTip {
+			str := fmt.Sprintf("admin transaction %v spends %v "+
+				"instead of the tip of thread %d", tx.Hash(),
+				prevOut, threadID)
+			return errors.New(str)
+		}
+		threadTips[threadID] = wire.NewOutPoint(tx.Hash(), 0)
+	}
+
+	// Apply the admin transactions to a copy of the admin state and check
+	// the validate key against it, so a failure leaves the admin state
+	// untouched.
+	keyView := copyKeyView(v.keyView)
+	for _, tx := range adminTxns {
+		keyView.ProcessAdminOuts(tx, header.Height)
+	}
+	if err := checkValidateKey(keyView, header); err != nil {
+		return err
+	}
+
+	v.keyView = keyView
+	delete(v.adminTxns, blockHash)
+	v.tipHash = blockHash
+	v.tipHeight = header.Height
+	return nil
+}
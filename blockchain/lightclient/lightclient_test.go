@@ -0,0 +1,258 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package lightclient_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/lightclient"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/bloom"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// privKeyFromHex returns the private key for the passed hex string.
+func privKeyFromHex(t *testing.T, str string) *btcec.PrivateKey {
+	serialized, err := hex.DecodeString(str)
+	if err != nil {
+		t.Fatalf("unable to decode private key: %v", err)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), serialized)
+	return privKey
+}
+
+// createAdminTx returns an admin transaction which spends the passed thread
+// tip and performs a single operation on the passed key.
+func createAdminTx(t *testing.T, threadTip *wire.OutPoint, threadID provautil.ThreadID, op byte, pubKey *btcec.PublicKey) *wire.MsgTx {
+	threadScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(threadID)).
+		AddOp(txscript.OP_CHECKTHREAD).Script()
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	data := make([]byte, 1+btcec.PubKeyBytesLenCompressed)
+	data[0] = op
+	copy(data[1:], pubKey.SerializeCompressed())
+	adminScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData(data).Script()
+	if err != nil {
+		t.Fatalf("unable to create admin script: %v", err)
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(threadTip, nil))
+	tx.AddTxOut(wire.NewTxOut(0, threadScript))
+	tx.AddTxOut(wire.NewTxOut(0, adminScript))
+	return tx
+}
+
+// createBlock returns a block at the passed height on top of the passed parent
+// which contains a coinbase followed by the passed transactions.  The header is
+// signed by the passed key and solved.
+func createBlock(t *testing.T, params *chaincfg.Params, parent *chainhash.Hash, height uint32, signKey *btcec.PrivateKey, txns ...*wire.MsgTx) *provautil.Block {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), []byte{byte(height), 0x01}))
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+		Version:   1,
+		PrevBlock: *parent,
+		Timestamp: time.Unix(1500000000+int64(height), 0),
+		Bits:      params.PowLimitBits,
+		Height:    height,
+	})
+	msgBlock.AddTransaction(coinbase)
+	for _, tx := range txns {
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		provautil.NewBlock(msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	// The nonce is not covered by the signature, so the header is signed
+	// before it is solved.
+	header := &msgBlock.Header
+	if err := header.Sign(signKey); err != nil {
+		t.Fatalf("unable to sign header: %v", err)
+	}
+	for blockchain.CheckHeaderSanity(header, params.PowLimit) != nil {
+		header.Nonce++
+	}
+	return provautil.NewBlock(msgBlock)
+}
+
+// TestHeaderVerifier ensures headers are only accepted when they are signed by
+// a validate key which is authorized by the admin transactions replayed so far.
+func TestHeaderVerifier(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	validateKey := privKeyFromHex(t, "d36c82406d3c77ebc342aaa16f24a985fbfe63c75e6fd2afeffa1ba69632d252")
+	newKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+
+	verifier := lightclient.NewHeaderVerifier(params)
+	tipHash, tipHeight := verifier.Tip()
+	if !tipHash.IsEqual(params.GenesisHash) || tipHeight != 0 {
+		t.Fatalf("Tip: got %v at height %d, want genesis", tipHash,
+			tipHeight)
+	}
+
+	// A header signed by a key which is not in the validate key set must be
+	// rejected.
+	block1 := createBlock(t, params, tipHash, 1, newKey)
+	err = verifier.ConnectHeader(&block1.MsgBlock().Header)
+	if rerr, ok := err.(blockchain.RuleError); !ok ||
+		rerr.ErrorCode != blockchain.ErrInvalidValidateKey {
+
+		t.Fatalf("ConnectHeader: got %v, want ErrInvalidValidateKey",
+			err)
+	}
+
+	// A header signed by an authorized key must be accepted.
+	block1 = createBlock(t, params, tipHash, 1, validateKey)
+	if err := verifier.ConnectHeader(&block1.MsgBlock().Header); err != nil {
+		t.Fatalf("ConnectHeader: unexpected error: %v", err)
+	}
+
+	// Headers which do not extend the tip must be rejected.
+	if err := verifier.ConnectHeader(&block1.MsgBlock().Header); err == nil {
+		t.Fatalf("ConnectHeader: expected error for header which " +
+			"does not extend the tip")
+	}
+
+	// Block 2 authorizes the new key through the provision thread.
+	genesisCoinbase := params.GenesisBlock.Transactions[0].TxHash()
+	adminTx := createAdminTx(t, wire.NewOutPoint(&genesisCoinbase, 1),
+		provautil.ProvisionThread, txscript.AdminOpValidateKeyAdd,
+		newKey.PubKey())
+	block2 := createBlock(t, params, block1.Hash(), 2, validateKey, adminTx)
+	adminTxHash := adminTx.TxHash()
+	proof, err := bloom.NewTxProof(block2, []*chainhash.Hash{&adminTxHash})
+	if err != nil {
+		t.Fatalf("NewTxProof: unexpected error: %v", err)
+	}
+
+	// Transactions which do not match the proof must be rejected.
+	otherTx := createAdminTx(t, wire.NewOutPoint(&genesisCoinbase, 0),
+		provautil.ProvisionThread, txscript.AdminOpValidateKeyAdd,
+		newKey.PubKey())
+	err = verifier.AddAdminTxns(proof, []*wire.MsgTx{otherTx})
+	if err == nil {
+		t.Fatalf("AddAdminTxns: expected error for mismatched " +
+			"transaction")
+	}
+	if err := verifier.AddAdminTxns(proof, nil); err == nil {
+		t.Fatalf("AddAdminTxns: expected error for missing transaction")
+	}
+
+	err = verifier.AddAdminTxns(proof, []*wire.MsgTx{adminTx})
+	if err != nil {
+		t.Fatalf("AddAdminTxns: unexpected error: %v", err)
+	}
+	if err := verifier.ConnectHeader(&block2.MsgBlock().Header); err != nil {
+		t.Fatalf("ConnectHeader: unexpected error: %v", err)
+	}
+	validateKeySet := verifier.AdminKeySets()[btcec.ValidateKeySet]
+	if validateKeySet.Pos(newKey.PubKey()) == -1 {
+		t.Fatalf("AdminKeySets: new key is not in the validate key set")
+	}
+
+	// The new key is authorized for the next block.
+	block3 := createBlock(t, params, block2.Hash(), 3, newKey)
+	if err := verifier.ConnectHeader(&block3.MsgBlock().Header); err != nil {
+		t.Fatalf("ConnectHeader: unexpected error: %v", err)
+	}
+
+	// An admin transaction which does not spend the tip of its thread
+	// must be rejected without changing the tip.
+	staleTx := createAdminTx(t, wire.NewOutPoint(&genesisCoinbase, 1),
+		provautil.ProvisionThread, txscript.AdminOpValidateKeyAdd,
+		validateKey.PubKey())
+	block4 := createBlock(t, params, block3.Hash(), 4, newKey, staleTx)
+	staleTxHash := staleTx.TxHash()
+	proof, err = bloom.NewTxProof(block4, []*chainhash.Hash{&staleTxHash})
+	if err != nil {
+		t.Fatalf("NewTxProof: unexpected error: %v", err)
+	}
+	err = verifier.AddAdminTxns(proof, []*wire.MsgTx{staleTx})
+	if err != nil {
+		t.Fatalf("AddAdminTxns: unexpected error: %v", err)
+	}
+	if err := verifier.ConnectHeader(&block4.MsgBlock().Header); err == nil {
+		t.Fatalf("ConnectHeader: expected error for admin transaction " +
+			"which does not spend the thread tip")
+	}
+	if tipHash, _ := verifier.Tip(); !tipHash.IsEqual(block3.Hash()) {
+		t.Fatalf("Tip: got %v, want %v", tipHash, block3.Hash())
+	}
+
+	// addAdminTx adds the passed admin transaction for the passed block.
+	addAdminTx := func(block *provautil.Block, tx *wire.MsgTx) {
+		txHash := tx.TxHash()
+		proof, err := bloom.NewTxProof(block, []*chainhash.Hash{&txHash})
+		if err != nil {
+			t.Fatalf("NewTxProof: unexpected error: %v", err)
+		}
+		err = verifier.AddAdminTxns(proof, []*wire.MsgTx{tx})
+		if err != nil {
+			t.Fatalf("AddAdminTxns: unexpected error: %v", err)
+		}
+	}
+
+	// A header signed by a key which is not authorized even after the
+	// admin transactions of its block are applied must be rejected
+	// without applying them.
+	signingKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	provisionTip := wire.NewOutPoint(&adminTxHash, 0)
+	otherKeyTx := createAdminTx(t, provisionTip, provautil.ProvisionThread,
+		txscript.AdminOpValidateKeyAdd, otherKey.PubKey())
+	block4 = createBlock(t, params, block3.Hash(), 4, signingKey, otherKeyTx)
+	addAdminTx(block4, otherKeyTx)
+	err = verifier.ConnectHeader(&block4.MsgBlock().Header)
+	if rerr, ok := err.(blockchain.RuleError); !ok ||
+		rerr.ErrorCode != blockchain.ErrInvalidValidateKey {
+
+		t.Fatalf("ConnectHeader: got %v, want ErrInvalidValidateKey",
+			err)
+	}
+	validateKeySet = verifier.AdminKeySets()[btcec.ValidateKeySet]
+	if validateKeySet.Pos(otherKey.PubKey()) != -1 {
+		t.Fatalf("AdminKeySets: admin transaction of rejected header " +
+			"was applied")
+	}
+
+	// A header signed by a key which is provisioned by an admin
+	// transaction of its own block must be accepted.
+	signingKeyTx := createAdminTx(t, provisionTip, provautil.ProvisionThread,
+		txscript.AdminOpValidateKeyAdd, signingKey.PubKey())
+	block4 = createBlock(t, params, block3.Hash(), 4, signingKey,
+		signingKeyTx)
+	addAdminTx(block4, signingKeyTx)
+	if err := verifier.ConnectHeader(&block4.MsgBlock().Header); err != nil {
+		t.Fatalf("ConnectHeader: unexpected error: %v", err)
+	}
+	validateKeySet = verifier.AdminKeySets()[btcec.ValidateKeySet]
+	if validateKeySet.Pos(signingKey.PubKey()) == -1 {
+		t.Fatalf("AdminKeySets: signing key is not in the validate " +
+			"key set")
+	}
+}
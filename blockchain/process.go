@@ -7,9 +7,9 @@ package blockchain
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
-	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
 )
 
@@ -34,6 +34,13 @@ const (
 	// without modifying the current state.
 	BFDryRun
 
+	// BFAssumeValid may be set to indicate the block is an ancestor of the
+	// block which is assumed to be valid, so the scripts of its
+	// transactions are not executed.  All other checks, which includes
+	// applying admin operations and the key id and supply rules, are still
+	// performed.  This is primarily used for headers-first mode.
+	BFAssumeValid
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -43,19 +50,10 @@ const (
 //
 // This function MUST be called with the chain state lock held (for reads).
 func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
-	// Check memory chain first (could be main chain or side chain blocks).
-	if _, ok := b.index[*hash]; ok {
-		return true, nil
-	}
-
-	// Check in the database.
-	var exists bool
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		exists, err = dbTx.HasBlock(hash)
-		return err
-	})
-	return exists, err
+	// The memory block index holds all known blocks, which includes main
+	// chain and side chain blocks.
+	_, ok := b.index[*hash]
+	return ok, nil
 }
 
 // processOrphans determines if there are any orphans which depend on the passed
@@ -165,14 +163,13 @@ func (b *BlockChain) ProcessBlock(block *provautil.Block, flags BehaviorFlags) (
 	// used to eat memory, and ensuring expected (versus claimed) proof of
 	// work requirements since the previous checkpoint are met.
 	blockHeader := &block.MsgBlock().Header
-	checkpointBlock, err := b.findPreviousCheckpoint()
+	checkpointNode, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return false, false, err
 	}
-	if checkpointBlock != nil {
+	if checkpointNode != nil {
 		// Ensure the block timestamp is after the checkpoint timestamp.
-		checkpointHeader := &checkpointBlock.MsgBlock().Header
-		checkpointTime := checkpointHeader.Timestamp
+		checkpointTime := time.Unix(checkpointNode.timestamp, 0)
 		if blockHeader.Timestamp.Before(checkpointTime) {
 			str := fmt.Sprintf("block %v has timestamp %v before "+
 				"last checkpoint timestamp %v", blockHash,
@@ -188,7 +185,7 @@ func (b *BlockChain) ProcessBlock(block *provautil.Block, flags BehaviorFlags) (
 			// maximum adjustment allowed by the retarget rules.
 			duration := blockHeader.Timestamp.Sub(checkpointTime)
 			requiredTarget := CompactToBig(b.calcEasiestDifficulty(
-				checkpointHeader.Bits, duration))
+				checkpointNode.bits, duration))
 			currentTarget := CompactToBig(blockHeader.Bits)
 			if currentTarget.Cmp(requiredTarget) > 0 {
 				str := fmt.Sprintf("block target difficulty of %064x "+
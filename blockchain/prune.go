@@ -0,0 +1,141 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// PruneDepth is the number of the most recent main chain blocks which are
+// always kept when pruning, which allows reorganizations up to that depth.
+const PruneDepth = 288
+
+// pruneHeightKeyName is the name of the db key used to store the height of
+// the highest block which has been pruned.  The key only exists once blocks
+// have been pruned, which makes it the flag for databases in prune mode.
+var pruneHeightKeyName = []byte("pruneheight")
+
+// dbPutPruneHeight uses an existing database transaction to store the height
+// of the highest pruned block.
+func dbPutPruneHeight(dbTx database.Tx, height uint32) error {
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], height)
+	return dbTx.Metadata().Put(pruneHeightKeyName, serialized[:])
+}
+
+// dbFetchPruneHeight uses an existing database transaction to fetch the height
+// of the highest pruned block.  False is returned when no blocks have ever
+// been pruned.
+func dbFetchPruneHeight(dbTx database.Tx) (uint32, bool, error) {
+	serialized := dbTx.Metadata().Get(pruneHeightKeyName)
+	if serialized == nil {
+		return 0, false, nil
+	}
+	if len(serialized) != 4 {
+		return 0, false, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt prune height",
+		}
+	}
+	return byteOrder.Uint32(serialized), true, nil
+}
+
+// pruneBlocks deletes the oldest blocks from the database once the stored
+// blocks exceed the prune target.  The most recent PruneDepth blocks of the
+// main chain along with every block stored after them are kept.  The spend
+// journal entries of the deleted blocks are removed as well since the blocks
+// can no longer be disconnected.
+//
+// The pruned blocks remain in the block index, but they are no longer marked
+// as having their data stored.  The height of the highest pruned block is
+// stored as well so the database is known to be in prune mode.
+//
+// Only blocks before the last flush of the utxo cache may be pruned since the
+// blocks after it are replayed following an unclean shutdown, which is why
+// this is invoked right after the cache is flushed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) pruneBlocks() error {
+	if b.pruneTarget == 0 || b.bestNode.height <= PruneDepth {
+		return nil
+	}
+
+	keepNode := b.bestNode.RelativeAncestor(PruneDepth)
+	var numPruned int
+	err := b.db.Update(func(dbTx database.Tx) error {
+		pruned, err := dbTx.PruneBlocks(b.pruneTarget, keepNode.hash)
+		if err != nil || len(pruned) == 0 {
+			return err
+		}
+		pruneHeight, _, err := dbFetchPruneHeight(dbTx)
+		if err != nil {
+			return err
+		}
+		for i := range pruned {
+			err := dbRemoveSpendJournalEntry(dbTx, &pruned[i])
+			if err != nil {
+				return err
+			}
+
+			node, ok := b.index[pruned[i]]
+			if !ok {
+				continue
+			}
+			node.status &^= statusDataStored
+			if err := dbStoreBlockNode(dbTx, node); err != nil {
+				return err
+			}
+			if node.height > pruneHeight {
+				pruneHeight = node.height
+			}
+		}
+		numPruned = len(pruned)
+		return dbPutPruneHeight(dbTx, pruneHeight)
+	})
+	if err != nil {
+		return err
+	}
+
+	if numPruned > 0 {
+		log.Infof("Pruned %d blocks before height %d", numPruned,
+			keepNode.height)
+	}
+	return nil
+}
+
+// IsPrunedDB returns whether blocks have ever been pruned from the passed
+// database, in which case it can no longer serve the full block chain.
+func IsPrunedDB(db database.DB) (bool, error) {
+	var isPruned bool
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		_, isPruned, err = dbFetchPruneHeight(dbTx)
+		return err
+	})
+	return isPruned, err
+}
+
+// IsBlockPruned returns whether the block with the given hash was accepted
+// into the block index, but its data is no longer available because it has
+// been pruned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsBlockPruned(hash *chainhash.Hash) (bool, error) {
+	b.chainLock.RLock()
+	_, known := b.index[*hash]
+	b.chainLock.RUnlock()
+	if !known {
+		return false, nil
+	}
+
+	var exists bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		exists, err = dbTx.HasBlock(hash)
+		return err
+	})
+	return !exists, err
+}
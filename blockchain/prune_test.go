@@ -0,0 +1,80 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/indexers"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+)
+
+// TestPrunedDatabase ensures a database is only reported as pruned once blocks
+// have been pruned from it and that optional indexes can't be used with a
+// pruned database even when pruning is no longer enabled.
+func TestPrunedDatabase(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "pruneddatabase")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	params := chaincfg.RegressionNetParams
+	newChain := func(withIndex bool) error {
+		config := blockchain.Config{
+			DB:          db,
+			ChainParams: &params,
+			TimeSource:  blockchain.NewMedianTime(),
+		}
+		if withIndex {
+			config.IndexManager = indexers.NewManager(db,
+				[]indexers.Indexer{indexers.NewTxIndex(db)})
+		}
+		_, err := blockchain.New(&config)
+		return err
+	}
+	if err := newChain(false); err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	isPruned, err := blockchain.IsPrunedDB(db)
+	if err != nil {
+		t.Fatalf("IsPrunedDB: unexpected error: %v", err)
+	}
+	if isPruned {
+		t.Fatal("IsPrunedDB: database reported as pruned before " +
+			"pruning")
+	}
+
+	// Record that blocks have been pruned as the prune mode does.
+	err = db.Update(func(dbTx database.Tx) error {
+		var serialized [4]byte
+		binary.LittleEndian.PutUint32(serialized[:], 1)
+		return dbTx.Metadata().Put([]byte("pruneheight"), serialized[:])
+	})
+	if err != nil {
+		t.Fatalf("failed to store prune height: %v", err)
+	}
+	isPruned, err = blockchain.IsPrunedDB(db)
+	if err != nil {
+		t.Fatalf("IsPrunedDB: unexpected error: %v", err)
+	}
+	if !isPruned {
+		t.Fatal("IsPrunedDB: pruned database not reported as pruned")
+	}
+	if err := newChain(true); err == nil {
+		t.Fatal("New: optional index used with a pruned database")
+	}
+	if err := newChain(false); err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+}
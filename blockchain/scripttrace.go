@@ -0,0 +1,94 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// ScriptTrace houses the step by step execution of the scripts which spend a
+// transaction input.
+type ScriptTrace struct {
+	// PkScript is the public key script which was executed.  The KeyIDs of
+	// Prova scripts and the thread of admin thread scripts are replaced by
+	// key hashes the same way as during validation.
+	PkScript []byte
+
+	// Steps are the executed opcodes and the state of the stacks.
+	Steps []txscript.TraceStep
+
+	// Err is the error the execution of the scripts failed with, if any.
+	Err error
+
+	// keyIDs maps the key hashes which replaced KeyIDs to the KeyIDs.
+	keyIDs map[string]btcec.KeyID
+}
+
+// KeyID returns the KeyID which was replaced by the passed key hash of the
+// executed script, if any.
+func (t *ScriptTrace) KeyID(keyHash []byte) (btcec.KeyID, bool) {
+	keyID, ok := t.keyIDs[string(keyHash)]
+	return keyID, ok
+}
+
+// TraceInput executes the passed public key script along with the signature
+// script of the input of the transaction at the passed index and records each
+// executed opcode.  KeyIDs and admin threads are resolved using the ASP keys
+// and admin key sets of the passed key view.
+//
+// An error is only returned when the scripts cannot be executed at all, while
+// a failed execution is reported by the Err field of the trace.
+func TraceInput(tx *wire.MsgTx, txIdx int, pkScript []byte, inputAmount int64,
+	keyView *KeyViewpoint, flags txscript.ScriptFlags) (*ScriptTrace, error) {
+
+	pops, err := txscript.ParseScript(pkScript)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := ScriptTrace{keyIDs: make(map[string]btcec.KeyID)}
+	switch txscript.TypeOfScript(pops) {
+	case txscript.ProvaTy, txscript.GeneralProvaTy:
+		keyIDs, err := txscript.ExtractKeyIDs(pops)
+		if err != nil {
+			return nil, err
+		}
+		keyIdMap := keyView.LookupKeyIDs(keyIDs)
+		for keyID, keyHash := range keyIdMap {
+			if _, ok := keyView.KeyIDs()[keyID]; ok {
+				trace.keyIDs[string(keyHash)] = keyID
+			}
+		}
+		if err := txscript.ReplaceKeyIDs(pops, keyIdMap); err != nil {
+			return nil, err
+		}
+		pkScript, err = txscript.UnparseScript(pops)
+		if err != nil {
+			return nil, err
+		}
+
+	case txscript.ProvaAdminTy:
+		threadID, err := txscript.ExtractThreadID(pops)
+		if err != nil {
+			return nil, err
+		}
+		keyHashes := keyView.GetAdminKeyHashes(threadID)
+		pkScript, err = txscript.ThreadPkScript(keyHashes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	trace.PkScript = pkScript
+
+	vm, err := txscript.NewEngine(pkScript, tx, txIdx, flags, nil, nil,
+		inputAmount)
+	if err != nil {
+		return nil, err
+	}
+	trace.Steps, trace.Err = vm.Trace()
+	return &trace, nil
+}
@@ -0,0 +1,611 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// snapshotMagic identifies a chain state snapshot file.
+	snapshotMagic uint32 = 0x706e7370
+
+	// snapshotVersion is the current version of the snapshot format.
+	snapshotVersion uint32 = 1
+
+	// snapshotImportBatchSize is the number of utxo entries which are
+	// written to the database per transaction while importing a snapshot.
+	snapshotImportBatchSize = 50000
+
+	// maxSnapshotEntrySize is the maximum size of a serialized utxo entry
+	// or admin state accepted when reading a snapshot.
+	maxSnapshotEntrySize = wire.MaxBlockPayload
+)
+
+// snapshotHeightKeyName is the name of the db key used to store the height of
+// the snapshot block in databases which were bootstrapped from a snapshot.
+var snapshotHeightKeyName = []byte("snapshotheight")
+
+// dbFetchSnapshotHeight uses an existing database transaction to fetch the
+// height of the snapshot block the database was bootstrapped from.  False is
+// returned when the database was not bootstrapped from a snapshot.
+func dbFetchSnapshotHeight(dbTx database.Tx) (uint32, bool, error) {
+	serialized := dbTx.Metadata().Get(snapshotHeightKeyName)
+	if serialized == nil {
+		return 0, false, nil
+	}
+	if len(serialized) != 4 {
+		return 0, false, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt snapshot height",
+		}
+	}
+	return byteOrder.Uint32(serialized), true, nil
+}
+
+// -----------------------------------------------------------------------------
+// A chain state snapshot contains everything needed to start a node from a
+// block on the main chain without downloading and validating the blocks
+// before it.  That is the headers of all blocks up to and including the
+// snapshot block, the snapshot block itself, the admin state and the utxo set
+// as of that block.
+//
+// The serialized format is:
+//
+//   <magic><version><network><num headers><headers><total txns><block length>
+//   <block><admin state length><admin state><utxo entries><content hash>
+//
+//   Field               Type               Size
+//   magic               uint32             4 bytes
+//   version             uint32             4 bytes
+//   network             wire.BitcoinNet    4 bytes
+//   num headers         uint32             4 bytes
+//   headers             []wire.BlockHeader num headers * MaxBlockHeaderPayload
+//   total txns          uint64             8 bytes
+//   block length        uint32             4 bytes
+//   block               wire.MsgBlock      block length
+//   admin state length  uint32             4 bytes
+//   admin state         []byte             admin state length
+//   utxo entries        []utxo entry       variable
+//   content hash        chainhash.Hash     chainhash.HashSize
+//
+// The admin state is serialized in the same format as in the key set bucket.
+// Each utxo entry is serialized as:
+//
+//   <entry length><tx hash><entry>
+//
+//   Field               Type               Size
+//   entry length        VarInt             variable
+//   tx hash             chainhash.Hash     chainhash.HashSize
+//   entry               []byte             entry length
+//
+// where the entry is serialized in the same format as in the utxo set bucket.
+// The entries are sorted by transaction hash and followed by a zero entry
+// length.  The content hash is the sha256 of all of the preceding bytes.
+// -----------------------------------------------------------------------------
+
+// SnapshotInfo describes a chain state snapshot.
+type SnapshotInfo struct {
+	// Hash is the hash of the block the snapshot represents.
+	Hash chainhash.Hash
+
+	// Height is the height of the block the snapshot represents.
+	Height uint32
+
+	// NumUtxos is the number of transactions with unspent outputs in the
+	// snapshot.
+	NumUtxos uint64
+
+	// ContentHash is the sha256 of the serialized snapshot which is used
+	// to verify a snapshot before it is imported.
+	ContentHash chainhash.Hash
+}
+
+// hashSorter implements sort.Interface to allow a slice of hashes to be sorted
+// in the same byte order as the keys of a database bucket.
+type hashSorter []chainhash.Hash
+
+// Len returns the number of hashes in the slice.  It is part of the
+// sort.Interface implementation.
+func (s hashSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the hashes at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s hashSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the hash with index i sorts before the hash with index
+// j.  It is part of the sort.Interface implementation.
+func (s hashSorter) Less(i, j int) bool {
+	return bytes.Compare(s[i][:], s[j][:]) < 0
+}
+
+// snapshotWriter writes the fields of a snapshot while hashing them.
+type snapshotWriter struct {
+	w      *bufio.Writer
+	hasher hash.Hash
+	err    error
+}
+
+// Write writes the passed bytes to the underlying writer and adds them to the
+// content hash.  Once an error has occurred, all further writes are ignored.
+func (sw *snapshotWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	sw.hasher.Write(p)
+	var n int
+	n, sw.err = sw.w.Write(p)
+	return n, sw.err
+}
+
+// writeUint32 writes the passed value in little-endian byte order.
+func (sw *snapshotWriter) writeUint32(val uint32) {
+	var buf [4]byte
+	byteOrder.PutUint32(buf[:], val)
+	sw.Write(buf[:])
+}
+
+// writeUtxoEntry writes the passed serialized utxo entry for the transaction
+// with the passed hash.
+func (sw *snapshotWriter) writeUtxoEntry(txHash []byte, serialized []byte) {
+	wire.WriteVarInt(sw, 0, uint64(len(serialized)))
+	sw.Write(txHash)
+	sw.Write(serialized)
+}
+
+// ExportSnapshot writes a snapshot of the chain state as of the main chain
+// block at the passed height to the passed writer.  The utxo cache is flushed
+// first, and the utxo set and admin state are then rolled back to the
+// requested block in memory using the spend journal, so the chain itself is
+// not modified.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportSnapshot(w io.Writer, height uint32) (*SnapshotInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if height > b.bestNode.height {
+		return nil, fmt.Errorf("snapshot height %d is after the best "+
+			"chain height %d", height, b.bestNode.height)
+	}
+	node := b.bestNode.Ancestor(height)
+
+	// Make sure the utxo set in the database represents the best chain.
+	if err := b.flushUtxoCache(flushRequired); err != nil {
+		return nil, err
+	}
+
+	// Disconnect all of the blocks after the requested one in a view,
+	// which results in the modifications to apply to the utxo set in the
+	// database and the admin state as of the requested block.
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(b.bestNode.hash)
+	keyView := NewKeyViewpoint()
+	keyView.SetThreadTips(b.threadTips)
+	keyView.SetLastKeyID(b.lastKeyID)
+	keyView.SetTotalSupply(b.totalSupply)
+	keyView.SetKeys(b.adminKeySets)
+	keyView.SetKeyIDs(b.aspKeyIdMap)
+	totalTxns := b.stateSnapshot.TotalTxns
+	for n := b.bestNode; n != node; n = n.parent {
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHash(dbTx, n.hash)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = utxoView.fetchInputUtxos(b.utxoCache, block)
+		if err != nil {
+			return nil, err
+		}
+		var stxos []spentTxOut
+		err = b.db.View(func(dbTx database.Tx) error {
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block, utxoView)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = utxoView.disconnectTransactions(block, stxos)
+		if err != nil {
+			return nil, err
+		}
+		err = keyView.disconnectTransactions(block)
+		if err != nil {
+			return nil, err
+		}
+		totalTxns -= uint64(len(block.Transactions()))
+	}
+
+	// Sort the transaction hashes of the view so its entries can be merged
+	// with the ordered entries of the utxo set bucket.
+	viewHashes := make([]chainhash.Hash, 0, len(utxoView.entries))
+	for txHash := range utxoView.entries {
+		viewHashes = append(viewHashes, txHash)
+	}
+	sort.Sort(hashSorter(viewHashes))
+
+	// Collect the headers from the genesis block up to the snapshot block.
+	headers := make([]wire.BlockHeader, node.height+1)
+	for n := node; n != nil; n = n.parent {
+		headers[n.height] = n.Header()
+	}
+
+	info := &SnapshotInfo{Hash: *node.hash, Height: node.height}
+	sw := &snapshotWriter{w: bufio.NewWriter(w), hasher: sha256.New()}
+	err := b.db.View(func(dbTx database.Tx) error {
+		blockBytes, err := dbTx.FetchBlock(node.hash)
+		if err != nil {
+			return err
+		}
+
+		sw.writeUint32(snapshotMagic)
+		sw.writeUint32(snapshotVersion)
+		sw.writeUint32(uint32(b.chainParams.Net))
+		sw.writeUint32(uint32(len(headers)))
+		for i := range headers {
+			if err := headers[i].Serialize(sw); err != nil {
+				return err
+			}
+		}
+		var buf [8]byte
+		byteOrder.PutUint64(buf[:], totalTxns)
+		sw.Write(buf[:])
+		sw.writeUint32(uint32(len(blockBytes)))
+		sw.Write(blockBytes)
+		adminState := serializeKeySet(keyView.Keys(), keyView.KeyIDs(),
+			keyView.ThreadTips(), keyView.LastKeyID(),
+			keyView.TotalSupply())
+		sw.writeUint32(uint32(len(adminState)))
+		sw.Write(adminState)
+
+		// writeViewEntry writes the entry of the view at the passed
+		// index unless it is fully spent.
+		writeViewEntry := func(i int) error {
+			entry := utxoView.entries[viewHashes[i]]
+			if entry == nil {
+				return nil
+			}
+			serialized, err := serializeUtxoEntry(entry)
+			if err != nil || serialized == nil {
+				return err
+			}
+			sw.writeUtxoEntry(viewHashes[i][:], serialized)
+			info.NumUtxos++
+			return nil
+		}
+
+		// Merge the entries of the view with the utxo set bucket, where
+		// the entries of the view replace those in the bucket.
+		viewIdx := 0
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		err = utxoBucket.ForEach(func(k, v []byte) error {
+			for ; viewIdx < len(viewHashes); viewIdx++ {
+				cmp := bytes.Compare(viewHashes[viewIdx][:], k)
+				if cmp > 0 {
+					break
+				}
+				if err := writeViewEntry(viewIdx); err != nil {
+					return err
+				}
+				if cmp == 0 {
+					viewIdx++
+					return nil
+				}
+			}
+			sw.writeUtxoEntry(k, v)
+			info.NumUtxos++
+			return sw.err
+		})
+		if err != nil {
+			return err
+		}
+		for ; viewIdx < len(viewHashes); viewIdx++ {
+			if err := writeViewEntry(viewIdx); err != nil {
+				return err
+			}
+		}
+		return wire.WriteVarInt(sw, 0, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sw.err != nil {
+		return nil, sw.err
+	}
+
+	// Append the content hash.
+	copy(info.ContentHash[:], sw.hasher.Sum(nil))
+	if _, err := sw.w.Write(info.ContentHash[:]); err != nil {
+		return nil, err
+	}
+	if err := sw.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Exported snapshot of block %v (height %d) with %d utxo "+
+		"entries, content hash %v", info.Hash, info.Height,
+		info.NumUtxos, info.ContentHash)
+	return info, nil
+}
+
+// readSnapshotBytes reads a uint32 length followed by that many bytes, which
+// may not exceed maxSnapshotEntrySize, from the passed reader.
+func readSnapshotBytes(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, byteOrder, &length); err != nil {
+		return nil, err
+	}
+	if length > maxSnapshotEntrySize {
+		return nil, fmt.Errorf("snapshot field of %d bytes exceeds the "+
+			"maximum of %d bytes", length, maxSnapshotEntrySize)
+	}
+	serialized := make([]byte, length)
+	if _, err := io.ReadFull(r, serialized); err != nil {
+		return nil, err
+	}
+	return serialized, nil
+}
+
+// ImportSnapshot initializes the passed uninitialized database with the chain
+// state snapshot read from the passed reader, which must have been exported for
+// the network of the passed chain parameters.  When expectedHash is not nil,
+// the content hash of the snapshot must match it.
+//
+// The chain state is only written once the entire snapshot has been read and
+// its content hash verified, however the utxo set is written in batches before
+// that, so a database for which the import failed must be removed.
+//
+// Blocks before the snapshot block are not stored, so the chain can not be
+// reorganized to a block before it and those blocks can not be served to
+// peers.  Optional indexes require all blocks and therefore can not be used
+// with an imported snapshot, which is why the height of the snapshot block is
+// stored along with the chain state.
+func ImportSnapshot(db database.DB, params *chaincfg.Params, r io.Reader, expectedHash *chainhash.Hash) (*SnapshotInfo, error) {
+	// Create the buckets of the chain state, making sure the database has
+	// not been initialized yet.
+	err := db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Get(chainStateKeyName) != nil {
+			return fmt.Errorf("the database already contains a chain")
+		}
+		for _, bucketName := range [][]byte{hashIndexBucketName,
+			heightIndexBucketName, blockIndexBucketName,
+			spendJournalBucketName, utxoSetBucketName} {
+
+			if _, err := meta.CreateBucket(bucketName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the snapshot through the hasher, except for the content hash at
+	// the end.
+	br := bufio.NewReader(r)
+	hasher := sha256.New()
+	tr := io.TeeReader(br, hasher)
+	var magic, version, net, numHeaders uint32
+	for _, field := range []*uint32{&magic, &version, &net, &numHeaders} {
+		if err := binary.Read(tr, byteOrder, field); err != nil {
+			return nil, err
+		}
+	}
+	if magic != snapshotMagic {
+		return nil, fmt.Errorf("not a snapshot file")
+	}
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	if net != uint32(params.Net) {
+		return nil, fmt.Errorf("snapshot is for network %v, not %v",
+			wire.BitcoinNet(net), params.Net)
+	}
+	if numHeaders == 0 {
+		return nil, fmt.Errorf("snapshot does not contain any headers")
+	}
+
+	// Read the headers and make sure they form a chain which starts at the
+	// genesis block.
+	var nodes []*blockNode
+	var parent *blockNode
+	genesisHash := params.GenesisBlock.BlockHash()
+	for height := uint32(0); height < numHeaders; height++ {
+		var header wire.BlockHeader
+		if err := header.Deserialize(tr); err != nil {
+			return nil, err
+		}
+		blockHash := header.BlockHash()
+		if height == 0 && blockHash != genesisHash {
+			return nil, fmt.Errorf("snapshot does not start with the "+
+				"genesis block %v", genesisHash)
+		}
+		if parent != nil && header.PrevBlock != *parent.hash {
+			return nil, fmt.Errorf("snapshot header %v does not "+
+				"connect to the previous header", blockHash)
+		}
+		if header.Height != height {
+			return nil, fmt.Errorf("snapshot header %v has height "+
+				"%d, expected %d", blockHash, header.Height, height)
+		}
+		node := newBlockNode(&header, &blockHash, parent)
+		node.status = statusValid
+		node.inMainChain = true
+		nodes = append(nodes, node)
+		parent = node
+	}
+	tip := parent
+	tip.status |= statusDataStored
+
+	// Read the snapshot block and make sure it matches the last header.
+	var totalTxns uint64
+	if err := binary.Read(tr, byteOrder, &totalTxns); err != nil {
+		return nil, err
+	}
+	blockBytes, err := readSnapshotBytes(tr)
+	if err != nil {
+		return nil, err
+	}
+	block, err := provautil.NewBlockFromBytes(blockBytes)
+	if err != nil {
+		return nil, err
+	}
+	block.SetHeight(tip.height)
+	merkles := BuildMerkleTreeStore(block.Transactions())
+	if *block.Hash() != *tip.hash ||
+		*merkles[len(merkles)-1] != block.MsgBlock().Header.MerkleRoot {
+
+		return nil, fmt.Errorf("snapshot block does not match the "+
+			"header %v", tip.hash)
+	}
+
+	// Read the admin state and make sure it can be deserialized.
+	adminState, err := readSnapshotBytes(tr)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, _, _, err = deserializeKeySet(adminState)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the utxo entries and write them to the utxo set in batches.
+	info := &SnapshotInfo{Hash: *tip.hash, Height: tip.height}
+	var lastHash chainhash.Hash
+	done := false
+	for !done {
+		err := db.Update(func(dbTx database.Tx) error {
+			utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+			for i := 0; i < snapshotImportBatchSize; i++ {
+				length, err := wire.ReadVarInt(tr, 0)
+				if err != nil {
+					return err
+				}
+				if length == 0 {
+					done = true
+					return nil
+				}
+				if length > maxSnapshotEntrySize {
+					return fmt.Errorf("snapshot utxo entry of "+
+						"%d bytes exceeds the maximum of %d "+
+						"bytes", length, maxSnapshotEntrySize)
+				}
+				var txHash chainhash.Hash
+				if _, err := io.ReadFull(tr, txHash[:]); err != nil {
+					return err
+				}
+				if info.NumUtxos > 0 &&
+					bytes.Compare(txHash[:], lastHash[:]) <= 0 {
+
+					return fmt.Errorf("snapshot utxo entries " +
+						"are not sorted")
+				}
+				serialized := make([]byte, length)
+				if _, err := io.ReadFull(tr, serialized); err != nil {
+					return err
+				}
+				if _, err := deserializeUtxoEntry(serialized); err != nil {
+					return fmt.Errorf("invalid snapshot utxo "+
+						"entry for %v: %v", txHash, err)
+				}
+				if err := utxoBucket.Put(txHash[:], serialized); err != nil {
+					return err
+				}
+				lastHash = txHash
+				info.NumUtxos++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Verify the content hash.
+	copy(info.ContentHash[:], hasher.Sum(nil))
+	var contentHash chainhash.Hash
+	if _, err := io.ReadFull(br, contentHash[:]); err != nil {
+		return nil, err
+	}
+	if contentHash != info.ContentHash {
+		return nil, fmt.Errorf("snapshot content hash %v does not match "+
+			"the stored hash %v", info.ContentHash, contentHash)
+	}
+	if expectedHash != nil && *expectedHash != info.ContentHash {
+		return nil, fmt.Errorf("snapshot content hash %v does not match "+
+			"the expected hash %v", info.ContentHash, expectedHash)
+	}
+
+	// Store the block index, the snapshot block and the chain state.
+	err = db.Update(func(dbTx database.Tx) error {
+		for _, node := range nodes {
+			err := dbPutBlockIndex(dbTx, node.hash, node.height)
+			if err != nil {
+				return err
+			}
+			if err := dbStoreBlockNode(dbTx, node); err != nil {
+				return err
+			}
+		}
+		if err := dbTx.StoreBlock(block); err != nil {
+			return err
+		}
+
+		serializedState := serializeBestChainState(bestChainState{
+			hash:      *tip.hash,
+			height:    tip.height,
+			totalTxns: totalTxns,
+			workSum:   tip.workSum,
+		})
+		meta := dbTx.Metadata()
+		if err := meta.Put(chainStateKeyName, serializedState); err != nil {
+			return err
+		}
+		if err := meta.Put(keySetBucketName, adminState); err != nil {
+			return err
+		}
+		var serializedHeight [4]byte
+		byteOrder.PutUint32(serializedHeight[:], tip.height)
+		err := meta.Put(snapshotHeightKeyName, serializedHeight[:])
+		if err != nil {
+			return err
+		}
+		if err := dbPutSpendJournalVersion(dbTx); err != nil {
+			return err
+		}
+		return dbPutUtxoStateHash(dbTx, tip.hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Imported snapshot of block %v (height %d) with %d utxo "+
+		"entries, content hash %v", info.Hash, info.Height,
+		info.NumUtxos, info.ContentHash)
+	return info, nil
+}
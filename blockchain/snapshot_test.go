@@ -0,0 +1,232 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/blockchain/indexers"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestSnapshot ensures a chain state snapshot exported at the tip and at an
+// earlier block of the main chain can be imported into a new database, that
+// the imported chain state is identical to that of a chain which processed all
+// of the blocks, that the imported chain is able to connect the blocks after
+// the snapshot, and that optional indexes can't be used with it.  It also
+// ensures the spend journal of databases created before it was versioned is
+// upgraded so all blocks can be disconnected.
+func TestSnapshot(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	// createDB creates a new database which is closed and removed when the
+	// test finishes.
+	var dbPaths []string
+	var dbs []database.DB
+	defer func() {
+		for i, db := range dbs {
+			db.Close()
+			os.RemoveAll(dbPaths[i])
+		}
+	}()
+	createDB := func(dbName string) database.DB {
+		dbPath := filepath.Join(os.TempDir(), dbName)
+		_ = os.RemoveAll(dbPath)
+		db, err := database.Create(testDbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("error creating db: %v", err)
+		}
+		dbPaths = append(dbPaths, dbPath)
+		dbs = append(dbs, db)
+		return db
+	}
+
+	params := chaincfg.RegressionNetParams
+	newChain := func(db database.DB) *blockchain.BlockChain {
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:          db,
+			ChainParams: &params,
+			TimeSource:  blockchain.NewMedianTime(),
+		})
+		if err != nil {
+			t.Fatalf("failed to create chain instance: %v", err)
+		}
+		return chain
+	}
+
+	// Process all blocks of the tests, which includes reorganizations and
+	// admin transactions.
+	chain := newChain(createDB("snapshotsource"))
+	var txns []*wire.MsgTx
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			var msgBlock *wire.MsgBlock
+			var height uint32
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				msgBlock, height = item.Block, item.Height
+			case fullblocktests.RejectedBlock:
+				msgBlock, height = item.Block, item.Height
+			case fullblocktests.OrphanOrRejectedBlock:
+				msgBlock, height = item.Block, item.Height
+			default:
+				continue
+			}
+			block := provautil.NewBlock(msgBlock)
+			block.SetHeight(height)
+			chain.ProcessBlock(block, blockchain.BFNone)
+			txns = append(txns, msgBlock.Transactions...)
+		}
+	}
+	txns = append(txns, params.GenesisBlock.Transactions[0])
+	best := chain.BestSnapshot()
+
+	// Exporting a snapshot of the genesis block disconnects every block,
+	// which fails for the block which spends the final output of the
+	// genesis coinbase when the spend journal entry for it was written
+	// before the spend journal was versioned, until the database is
+	// upgraded by loading it.
+	err = blockchain.TstDowngradeSpendJournal(dbs[0], &params)
+	if err != nil {
+		t.Fatalf("TstDowngradeSpendJournal: unexpected error: %v", err)
+	}
+	if _, err := chain.ExportSnapshot(ioutil.Discard, 0); err == nil {
+		t.Fatal("ExportSnapshot: disconnected the final spend of the " +
+			"genesis coinbase with a version 1 spend journal")
+	}
+	upgraded := newChain(dbs[0])
+	if _, err := upgraded.ExportSnapshot(ioutil.Discard, 0); err != nil {
+		t.Fatalf("ExportSnapshot: unexpected error: %v", err)
+	}
+
+	// importSnapshot imports the passed snapshot into a new database and
+	// returns the resulting chain.
+	importSnapshot := func(dbName string, snapshot []byte, info *blockchain.SnapshotInfo) *blockchain.BlockChain {
+		db := createDB(dbName)
+		gotInfo, err := blockchain.ImportSnapshot(db, &params,
+			bytes.NewReader(snapshot), &info.ContentHash)
+		if err != nil {
+			t.Fatalf("ImportSnapshot: unexpected error: %v", err)
+		}
+		if *gotInfo != *info {
+			t.Fatalf("ImportSnapshot: got info %+v, want %+v", gotInfo,
+				info)
+		}
+		return newChain(db)
+	}
+
+	// Export and import a snapshot of the tip.
+	var snapshot bytes.Buffer
+	info, err := chain.ExportSnapshot(&snapshot, best.Height)
+	if err != nil {
+		t.Fatalf("ExportSnapshot: unexpected error: %v", err)
+	}
+	if info.Hash != *best.Hash || info.Height != best.Height {
+		t.Fatalf("ExportSnapshot: got block %v (%d), want %v (%d)",
+			info.Hash, info.Height, best.Hash, best.Height)
+	}
+	imported := importSnapshot("snapshottip", snapshot.Bytes(), info)
+	compareChainState(t, "tip", chain, imported, txns)
+	if imported.BestSnapshot().TotalTxns != best.TotalTxns {
+		t.Fatalf("tip: total txns -- got %d, want %d",
+			imported.BestSnapshot().TotalTxns, best.TotalTxns)
+	}
+
+	// Optional indexes require all blocks and can't be used with a
+	// database bootstrapped from a snapshot.
+	db := createDB("snapshotindex")
+	_, err = blockchain.ImportSnapshot(db, &params,
+		bytes.NewReader(snapshot.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("ImportSnapshot: unexpected error: %v", err)
+	}
+	_, err = blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		IndexManager: indexers.NewManager(db,
+			[]indexers.Indexer{indexers.NewTxIndex(db)}),
+	})
+	if err == nil {
+		t.Fatal("New: optional index used with a snapshot")
+	}
+
+	// Build a reference chain which only processed the main chain blocks
+	// up to an earlier height.
+	midHeight := best.Height / 2
+	ref := newChain(createDB("snapshotref"))
+	for height := uint32(1); height <= midHeight; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		if _, _, err := ref.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+
+	// A snapshot exported at the earlier height must be identical to the
+	// one exported by the reference chain at its tip.
+	snapshot.Reset()
+	info, err = chain.ExportSnapshot(&snapshot, midHeight)
+	if err != nil {
+		t.Fatalf("ExportSnapshot: unexpected error: %v", err)
+	}
+	var refSnapshot bytes.Buffer
+	refInfo, err := ref.ExportSnapshot(&refSnapshot, midHeight)
+	if err != nil {
+		t.Fatalf("ExportSnapshot: unexpected error: %v", err)
+	}
+	if *refInfo != *info || !bytes.Equal(refSnapshot.Bytes(), snapshot.Bytes()) {
+		t.Fatalf("ExportSnapshot: snapshot of height %d differs from the "+
+			"reference (content hash %v, want %v)", midHeight,
+			info.ContentHash, refInfo.ContentHash)
+	}
+
+	// Import the snapshot and ensure it is identical to the reference chain
+	// and connects the remaining blocks of the main chain.
+	imported = importSnapshot("snapshotmid", snapshot.Bytes(), info)
+	compareChainState(t, "mid", ref, imported, txns)
+	for height := midHeight + 1; height <= best.Height; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		_, _, err = imported.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	compareChainState(t, "synced", chain, imported, txns)
+
+	// A corrupted snapshot or one with a different content hash must be
+	// rejected.
+	corrupted := append([]byte(nil), snapshot.Bytes()...)
+	corrupted[len(corrupted)-chainhash.HashSize-2] ^= 0x01
+	_, err = blockchain.ImportSnapshot(createDB("snapshotbad"), &params,
+		bytes.NewReader(corrupted), nil)
+	if err == nil {
+		t.Fatalf("ImportSnapshot: corrupted snapshot was imported")
+	}
+	_, err = blockchain.ImportSnapshot(createDB("snapshotbad2"), &params,
+		bytes.NewReader(snapshot.Bytes()), &chainhash.Hash{0x01})
+	if err == nil {
+		t.Fatalf("ImportSnapshot: snapshot with unexpected content hash " +
+			"was imported")
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+const (
+	// utxoFlushPeriodicInterval is the maximum amount of time the utxo
+	// cache is kept without being flushed to the database while blocks
+	// are being connected.
+	utxoFlushPeriodicInterval = 5 * time.Minute
+
+	// entryOverheadSize is the approximate number of bytes of memory used
+	// by a cached utxo entry besides its outputs, which includes the
+	// transaction hash key and the map bookkeeping.
+	entryOverheadSize = chainhash.HashSize + 96
+
+	// outputOverheadSize is the approximate number of bytes of memory used
+	// by an output of a cached utxo entry besides its public key script.
+	outputOverheadSize = 64
+)
+
+// flushMode defines the conditions under which the utxo cache is flushed to
+// the database.
+type flushMode uint8
+
+const (
+	// flushRequired always flushes the cache.
+	flushRequired flushMode = iota
+
+	// flushPeriodic flushes the cache when it exceeds its maximum size or
+	// when utxoFlushPeriodicInterval has elapsed since the last flush.
+	flushPeriodic
+
+	// flushIfNeeded only flushes the cache when it exceeds its maximum
+	// size.
+	flushIfNeeded
+)
+
+// entryMemoryUsage returns the approximate number of bytes of memory used by
+// the passed utxo entry while it is cached.
+func entryMemoryUsage(entry *UtxoEntry) uint64 {
+	size := uint64(entryOverheadSize)
+	for _, output := range entry.sparseOutputs {
+		size += outputOverheadSize + uint64(len(output.pkScript))
+	}
+	return size
+}
+
+// utxoCache is a size-limited cache of utxo entries in front of the utxo set
+// in the database.  Entries which are modified by connecting and disconnecting
+// blocks are kept in memory and only written to the database when the cache
+// is flushed, which avoids loading and writing the same entries for every
+// block.
+//
+// The cache also houses the admin state of the chain as of the same block,
+// which is written along with the utxo set so the two are always consistent
+// in the database.  The hash of that block is stored alongside them, which
+// allows the blocks connected after the last flush to be replayed on start up
+// following an unclean shutdown.
+//
+// Entries handed out by the cache are copies, so views are free to modify
+// them.  The changes only become visible to other callers once the view is
+// committed to the cache.
+type utxoCache struct {
+	db           database.DB
+	maxTotalSize uint64
+
+	// mtx protects the fields below.  The cache is only modified with the
+	// chain lock held for writes, but the mutex keeps the cache safe for
+	// concurrent access on its own.
+	mtx           sync.Mutex
+	entries       map[chainhash.Hash]*UtxoEntry
+	totalSize     uint64
+	keyView       *KeyViewpoint
+	bestHash      chainhash.Hash
+	lastFlushHash chainhash.Hash
+	lastFlushTime time.Time
+}
+
+// newUtxoCache returns a new utxo cache in front of the utxo set in the passed
+// database which flushes once its entries use more than the passed number of
+// bytes.
+func newUtxoCache(db database.DB, maxTotalSize uint64) *utxoCache {
+	return &utxoCache{
+		db:            db,
+		maxTotalSize:  maxTotalSize,
+		entries:       make(map[chainhash.Hash]*UtxoEntry),
+		lastFlushTime: time.Now(),
+	}
+}
+
+// setBestHash sets the hash of the block the cache and the persisted utxo set
+// represent, which is used when the cache is created at start up.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) setBestHash(hash *chainhash.Hash) {
+	c.mtx.Lock()
+	c.bestHash = *hash
+	c.lastFlushHash = *hash
+	c.mtx.Unlock()
+}
+
+// fetchEntries returns copies of the entries for the passed set of
+// transactions from the cache, loading the entries which are not yet cached
+// from the database.  Fully spent transactions, or those which otherwise don't
+// exist, result in a nil entry.
+//
+// The loaded entries are only added to the cache when addToCache is set.  It
+// must only be set for entries which are about to be modified by connecting
+// or disconnecting blocks, since the cache is only trimmed to its maximum
+// size when it is flushed, which requires blocks to be connected.  Read-only
+// lookups, such as those of the memory pool and the RPC server, would
+// otherwise grow the cache without bound while no blocks are connected.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) fetchEntries(txSet map[chainhash.Hash]struct{}, addToCache bool) (map[chainhash.Hash]*UtxoEntry, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entries := make(map[chainhash.Hash]*UtxoEntry, len(txSet))
+	var missing []chainhash.Hash
+	for hash := range txSet {
+		entry, ok := c.entries[hash]
+		if !ok {
+			missing = append(missing, hash)
+			continue
+		}
+
+		// Fully spent entries are only kept until they are removed from
+		// the database by the next flush.
+		if entry.IsFullySpent() {
+			entries[hash] = nil
+			continue
+		}
+		entries[hash] = entry.Clone()
+	}
+	if len(missing) == 0 {
+		return entries, nil
+	}
+
+	err := c.db.View(func(dbTx database.Tx) error {
+		for i := range missing {
+			hash := &missing[i]
+			entry, err := dbFetchUtxoEntry(dbTx, hash)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				entries[*hash] = nil
+				continue
+			}
+			if !addToCache {
+				entries[*hash] = entry
+				continue
+			}
+
+			c.entries[*hash] = entry
+			c.totalSize += entryMemoryUsage(entry)
+			entries[*hash] = entry.Clone()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// commit applies the modified entries of the passed view to the cache along
+// with the passed admin state, which both represent the chain as of the block
+// with the passed hash.  The view itself is not changed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) commit(view *UtxoViewpoint, keyView *KeyViewpoint, bestHash *chainhash.Hash) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for hash, viewEntry := range view.entries {
+		if viewEntry == nil || !viewEntry.modified {
+			continue
+		}
+
+		// Replace the cached entry with a copy of the view entry which
+		// only contains the unspent outputs, since the view might be
+		// modified further by the caller.
+		entry := viewEntry.Clone()
+		for outputIndex, output := range entry.sparseOutputs {
+			if output.spent {
+				delete(entry.sparseOutputs, outputIndex)
+			}
+		}
+		entry.modified = true
+
+		if cachedEntry, ok := c.entries[hash]; ok {
+			c.totalSize -= entryMemoryUsage(cachedEntry)
+		}
+		c.entries[hash] = entry
+		c.totalSize += entryMemoryUsage(entry)
+	}
+
+	c.keyView = keyView
+	c.bestHash = *bestHash
+}
+
+// dbPutState uses an existing database transaction to write the modified
+// entries of the cache and its admin state to the database along with the
+// hash of the block they represent.  The cache itself is not changed, so
+// markFlushed must be called once the transaction has been committed.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) dbPutState(dbTx database.Tx) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	for hashIter, entry := range c.entries {
+		if !entry.modified {
+			continue
+		}
+
+		// Remove the entry when it is fully spent, otherwise store its
+		// serialization.
+		hash := hashIter
+		serialized, err := serializeUtxoEntry(entry)
+		if err != nil {
+			return err
+		}
+		if serialized == nil {
+			if err := utxoBucket.Delete(hash[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := utxoBucket.Put(hash[:], serialized); err != nil {
+			return err
+		}
+	}
+
+	if c.keyView != nil {
+		err := dbPutKeySet(dbTx, c.keyView.Keys(), c.keyView.KeyIDs(),
+			c.keyView.ThreadTips(), c.keyView.LastKeyID(),
+			c.keyView.TotalSupply())
+		if err != nil {
+			return err
+		}
+	}
+	return dbPutUtxoStateHash(dbTx, &c.bestHash)
+}
+
+// markFlushed marks all entries of the cache unmodified after they have been
+// written to the database and removes the fully spent ones.  When the cache
+// still exceeds its maximum size, all entries are evicted.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) markFlushed() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.totalSize > c.maxTotalSize {
+		c.entries = make(map[chainhash.Hash]*UtxoEntry)
+		c.totalSize = 0
+	} else {
+		for hash, entry := range c.entries {
+			if entry.IsFullySpent() {
+				c.totalSize -= entryMemoryUsage(entry)
+				delete(c.entries, hash)
+				continue
+			}
+			entry.modified = false
+		}
+	}
+
+	c.keyView = nil
+	c.lastFlushHash = c.bestHash
+	c.lastFlushTime = time.Now()
+}
+
+// needsFlush returns whether the cache must be flushed according to the passed
+// mode.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (c *utxoCache) needsFlush(mode flushMode) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// There is nothing to flush when no blocks have been committed since
+	// the last flush.
+	if c.bestHash == c.lastFlushHash {
+		return false
+	}
+
+	switch mode {
+	case flushRequired:
+		return true
+	case flushPeriodic:
+		if time.Since(c.lastFlushTime) > utxoFlushPeriodicInterval {
+			return true
+		}
+	}
+	return c.totalSize > c.maxTotalSize
+}
+
+// flushUtxoCache writes the modified entries of the utxo cache and the admin
+// state to the database when required by the passed mode.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) flushUtxoCache(mode flushMode) error {
+	if !b.utxoCache.needsFlush(mode) {
+		return nil
+	}
+
+	log.Debugf("Flushing utxo cache to the database")
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return b.utxoCache.dbPutState(dbTx)
+	})
+	if err != nil {
+		return err
+	}
+	b.utxoCache.markFlushed()
+
+	// The blocks before the flushed state are no longer needed to recover
+	// it, so the old ones may be pruned now.
+	return b.pruneBlocks()
+}
+
+// FlushUtxoCache writes all unspent transaction outputs and admin state which
+// are only held in memory to the database.  It should be called before the
+// database is closed, although the state is recovered on the next start up
+// when it is not.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.flushUtxoCache(flushRequired)
+}
+
+// replayUtxoState brings the utxo set and the admin state up to date with the
+// best chain when the node was not shut down cleanly.  The blocks which were
+// connected after the last flush of the utxo cache, along with their spend
+// journal entries, are in the database, so their transactions are connected
+// again starting from the persisted state.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) replayUtxoState() error {
+	var stateHash *chainhash.Hash
+	var stateHeight uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		stateHash, err = dbFetchUtxoStateHash(dbTx)
+		if err != nil || stateHash == nil {
+			return err
+		}
+		stateHeight, err = dbFetchHeightByHash(dbTx, stateHash)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Databases which do not have the state hash yet always wrote the utxo
+	// set along with the best chain state.
+	if stateHash == nil {
+		stateHash = b.bestNode.hash
+		stateHeight = b.bestNode.height
+	}
+	b.utxoCache.setBestHash(stateHash)
+	if stateHeight == b.bestNode.height {
+		return nil
+	}
+	if stateHeight > b.bestNode.height {
+		return AssertError("utxo set is ahead of the best chain")
+	}
+
+	log.Infof("Replaying %d blocks to recover the utxo set from an unclean "+
+		"shutdown", b.bestNode.height-stateHeight)
+	keyView := NewKeyViewpoint()
+	keyView.SetThreadTips(b.threadTips)
+	keyView.SetLastKeyID(b.lastKeyID)
+	keyView.SetTotalSupply(b.totalSupply)
+	keyView.SetKeys(b.adminKeySets)
+	keyView.SetKeyIDs(b.aspKeyIdMap)
+	for height := stateHeight + 1; height <= b.bestNode.height; height++ {
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHeight(dbTx, height)
+			if err != nil {
+				return err
+			}
+
+			// Make sure the block was connected completely, which
+			// is the case when its spend journal entry exists.
+			serialized := dbTx.Metadata().Bucket(
+				spendJournalBucketName).Get(block.Hash()[:])
+			if serialized == nil && countSpentOutputs(block) > 0 {
+				return AssertError(fmt.Sprintf("missing spend "+
+					"journal entry for block %v", block.Hash()))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		utxoView := NewUtxoViewpoint()
+		err = utxoView.fetchInputUtxos(b.utxoCache, block)
+		if err != nil {
+			return err
+		}
+		err = utxoView.connectTransactions(block, nil)
+		if err != nil {
+			return err
+		}
+		keyView.connectTransactions(block)
+		b.utxoCache.commit(utxoView, keyView, block.Hash())
+
+		if err := b.flushUtxoCache(flushIfNeeded); err != nil {
+			return err
+		}
+	}
+
+	// This is now the admin state of the best chain.
+	b.stateLock.Lock()
+	b.threadTips = keyView.ThreadTips()
+	b.totalSupply = keyView.TotalSupply()
+	b.lastKeyID = keyView.LastKeyID()
+	b.adminKeySets = keyView.Keys()
+	b.aspKeyIdMap = keyView.KeyIDs()
+	b.stateLock.Unlock()
+
+	return b.flushUtxoCache(flushRequired)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// compareChainState ensures the passed chain instances agree on the best
+// chain, the admin state and the unspent outputs of the passed transactions.
+func compareChainState(t *testing.T, name string, want, got *blockchain.BlockChain, txns []*wire.MsgTx) {
+	wantBest, gotBest := want.BestSnapshot(), got.BestSnapshot()
+	if *wantBest.Hash != *gotBest.Hash || wantBest.Height != gotBest.Height {
+		t.Fatalf("%s: best block -- got %v (%d), want %v (%d)", name,
+			gotBest.Hash, gotBest.Height, wantBest.Hash,
+			wantBest.Height)
+	}
+
+	for threadID, tip := range want.ThreadTips() {
+		if got.ThreadTips()[threadID].String() != tip.String() {
+			t.Fatalf("%s: thread %d tip -- got %v, want %v", name,
+				threadID, got.ThreadTips()[threadID], tip)
+		}
+	}
+	if got.TotalSupply() != want.TotalSupply() {
+		t.Fatalf("%s: total supply -- got %d, want %d", name,
+			got.TotalSupply(), want.TotalSupply())
+	}
+	if got.LastKeyID() != want.LastKeyID() {
+		t.Fatalf("%s: last key id -- got %d, want %d", name,
+			got.LastKeyID(), want.LastKeyID())
+	}
+	for keySetType, keySet := range want.AdminKeySets() {
+		if !keySet.Equal(got.AdminKeySets()[keySetType]) {
+			t.Fatalf("%s: key set %d -- got %v, want %v", name,
+				keySetType, got.AdminKeySets()[keySetType].ToStringArray(),
+				keySet.ToStringArray())
+		}
+	}
+	if !want.KeyIDs().Equal(got.KeyIDs()) {
+		t.Fatalf("%s: key ids -- got %v, want %v", name, got.KeyIDs(),
+			want.KeyIDs())
+	}
+
+	for _, tx := range txns {
+		txHash := tx.TxHash()
+		wantEntry, err := want.FetchUtxoEntry(&txHash)
+		if err != nil {
+			t.Fatalf("%s: FetchUtxoEntry: unexpected error: %v", name,
+				err)
+		}
+		gotEntry, err := got.FetchUtxoEntry(&txHash)
+		if err != nil {
+			t.Fatalf("%s: FetchUtxoEntry: unexpected error: %v", name,
+				err)
+		}
+		if (wantEntry == nil) != (gotEntry == nil) {
+			t.Fatalf("%s: utxo entry for %v -- got %v, want %v",
+				name, txHash, gotEntry != nil, wantEntry != nil)
+		}
+		if wantEntry == nil {
+			continue
+		}
+		for i := range tx.TxOut {
+			index := uint32(i)
+			if gotEntry.IsOutputSpent(index) != wantEntry.IsOutputSpent(index) ||
+				gotEntry.AmountByIndex(index) != wantEntry.AmountByIndex(index) {
+
+				t.Fatalf("%s: output %v:%d differs", name,
+					txHash, index)
+			}
+		}
+	}
+}
+
+// TestUtxoCacheRecovery ensures the utxo set and the admin state are recovered
+// from the database when the utxo cache was not flushed before the chain was
+// closed, and that they are identical after a flush.
+func TestUtxoCacheRecovery(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dbPath := filepath.Join(os.TempDir(), "utxocacherecovery")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	params := chaincfg.RegressionNetParams
+	newChain := func() *blockchain.BlockChain {
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:               db,
+			ChainParams:      &params,
+			TimeSource:       blockchain.NewMedianTime(),
+			UtxoCacheMaxSize: 100 * 1024 * 1024,
+		})
+		if err != nil {
+			t.Fatalf("failed to create chain instance: %v", err)
+		}
+		return chain
+	}
+
+	// Process all blocks of the tests, which includes reorganizations and
+	// admin transactions, while keeping the utxo set in the cache.
+	chain := newChain()
+	var txns []*wire.MsgTx
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			var msgBlock *wire.MsgBlock
+			var height uint32
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				msgBlock, height = item.Block, item.Height
+			case fullblocktests.RejectedBlock:
+				msgBlock, height = item.Block, item.Height
+			case fullblocktests.OrphanOrRejectedBlock:
+				msgBlock, height = item.Block, item.Height
+			default:
+				continue
+			}
+			block := provautil.NewBlock(msgBlock)
+			block.SetHeight(height)
+			_, _, err := chain.ProcessBlock(block, blockchain.BFNone)
+			if _, ok := item.(fullblocktests.AcceptedBlock); ok && err != nil {
+				t.Fatalf("block %v should have been accepted: %v",
+					block.Hash(), err)
+			}
+			txns = append(txns, msgBlock.Transactions...)
+		}
+	}
+	genesisTx := params.GenesisBlock.Transactions[0]
+	txns = append(txns, genesisTx)
+
+	// Sanity check the tests spend the admin thread tips of the genesis
+	// block, so the recovered state must differ from the genesis state.
+	genesisHash := genesisTx.TxHash()
+	if *chain.ThreadTips()[provautil.RootThread] == *wire.NewOutPoint(&genesisHash, 0) {
+		t.Fatalf("root thread tip was not changed by the tests")
+	}
+	if len(chain.AdminKeySets()[btcec.ValidateKeySet]) == 0 {
+		t.Fatalf("no validate keys")
+	}
+
+	// Open the chain again without flushing the cache, which simulates an
+	// unclean shutdown, and ensure the state is recovered.
+	recovered := newChain()
+	compareChainState(t, "recovered", chain, recovered, txns)
+
+	// Flush the cache and ensure the state is identical when opening the
+	// chain again.
+	if err := chain.FlushUtxoCache(); err != nil {
+		t.Fatalf("FlushUtxoCache: unexpected error: %v", err)
+	}
+	flushed := newChain()
+	cacheLen := flushed.TstUtxoCacheLen()
+	compareChainState(t, "flushed", chain, flushed, txns)
+
+	// The entries loaded by read-only lookups must not be added to the
+	// cache, since it is only trimmed when blocks are connected.
+	for _, tx := range txns {
+		_, err := flushed.FetchUtxoView(provautil.NewTx(tx))
+		if err != nil {
+			t.Fatalf("FetchUtxoView: unexpected error: %v", err)
+		}
+	}
+	if got := flushed.TstUtxoCacheLen(); got != cacheLen {
+		t.Fatalf("utxo cache holds %d entries after lookups, want %d",
+			got, cacheLen)
+	}
+
+	// Ensure a missing entry is reported as such.
+	entry, err := flushed.FetchUtxoEntry(&chainhash.Hash{0x01})
+	if err != nil || entry != nil {
+		t.Fatalf("FetchUtxoEntry: got %v (err %v), want no entry",
+			entry, err)
+	}
+}
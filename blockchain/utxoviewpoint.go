@@ -8,7 +8,6 @@ package blockchain
 import (
 	"fmt"
 	"github.com/bitgo/prova/chaincfg/chainhash"
-	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 )
@@ -464,7 +463,7 @@ func (view *UtxoViewpoint) commit() {
 // Upon completion of this function, the view will contain an entry for each
 // requested transaction.  Fully spent transactions, or those which otherwise
 // don't exist, will result in a nil entry in the view.
-func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, txSet map[chainhash.Hash]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxosMain(cache *utxoCache, txSet map[chainhash.Hash]struct{}) error {
 	// Nothing to do if there are no requested hashes.
 	if len(txSet) == 0 {
 		return nil
@@ -478,25 +477,20 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, txSet map[chainhash.Ha
 	// since other code uses the presence of an entry in the store as a way
 	// to optimize spend and unspend updates to apply only to the specific
 	// utxos that the caller needs access to.
-	return db.View(func(dbTx database.Tx) error {
-		for hash := range txSet {
-			hashCopy := hash
-			entry, err := dbFetchUtxoEntry(dbTx, &hashCopy)
-			if err != nil {
-				return err
-			}
-
-			view.entries[hash] = entry
-		}
-
-		return nil
-	})
+	entries, err := cache.fetchEntries(txSet, true)
+	if err != nil {
+		return err
+	}
+	for hash, entry := range entries {
+		view.entries[hash] = entry
+	}
+	return nil
 }
 
 // fetchUtxos loads utxo details about provided set of transaction hashes into
 // the view from the database as needed unless they already exist in the view in
 // which case they are ignored.
-func (view *UtxoViewpoint) fetchUtxos(db database.DB, txSet map[chainhash.Hash]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxos(cache *utxoCache, txSet map[chainhash.Hash]struct{}) error {
 	// Nothing to do if there are no requested hashes.
 	if len(txSet) == 0 {
 		return nil
@@ -513,15 +507,15 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, txSet map[chainhash.Hash]s
 		txNeededSet[hash] = struct{}{}
 	}
 
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, txNeededSet)
+	// Request the input utxos from the cache.
+	return view.fetchUtxosMain(cache, txNeededSet)
 }
 
 // fetchInputUtxos loads utxo details about the input transactions referenced
 // by the transactions in the given block into the view from the database as
 // needed.  In particular, referenced entries that are earlier in the block are
 // added to the view and entries that are already in the view are not modified.
-func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *provautil.Block) error {
+func (view *UtxoViewpoint) fetchInputUtxos(cache *utxoCache, block *provautil.Block) error {
 	// Build a map of in-flight transactions because some of the inputs in
 	// this block could be referencing other transactions earlier in this
 	// block which are not yet in the chain.
@@ -567,8 +561,8 @@ func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *provautil.Bloc
 		}
 	}
 
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, txNeededSet)
+	// Request the input utxos from the cache.
+	return view.fetchUtxosMain(cache, txNeededSet)
 }
 
 // NewUtxoViewpoint returns a new empty unspent transaction output view.
@@ -601,10 +595,17 @@ func (b *BlockChain) FetchUtxoView(tx *provautil.Tx) (*UtxoViewpoint, error) {
 	}
 
 	// Request the utxos from the point of view of the end of the main
-	// chain.
+	// chain.  They are not added to the utxo cache since the view is not
+	// used to connect a block.
+	entries, err := b.utxoCache.fetchEntries(txNeededSet, false)
+	if err != nil {
+		return nil, err
+	}
 	view := NewUtxoViewpoint()
-	err := view.fetchUtxosMain(b.db, txNeededSet)
-	return view, err
+	for hash, entry := range entries {
+		view.entries[hash] = entry
+	}
+	return view, nil
 }
 
 // FetchUtxoEntry loads and returns the unspent transaction output entry for the
@@ -621,15 +622,12 @@ func (b *BlockChain) FetchUtxoEntry(txHash *chainhash.Hash) (*UtxoEntry, error)
 	b.chainLock.RLock()
 	defer b.chainLock.RUnlock()
 
-	var entry *UtxoEntry
-	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		entry, err = dbFetchUtxoEntry(dbTx, txHash)
-		return err
-	})
+	entries, err := b.utxoCache.fetchEntries(map[chainhash.Hash]struct{}{
+		*txHash: {},
+	}, false)
 	if err != nil {
 		return nil, err
 	}
 
-	return entry, nil
+	return entries[*txHash], nil
 }
@@ -742,14 +742,14 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	// chain before it.  This prevents storage of new, otherwise valid,
 	// blocks which build off of old blocks that are likely at a much easier
 	// difficulty and therefore could be used to waste cache and disk space.
-	checkpointBlock, err := b.findPreviousCheckpoint()
+	checkpointNode, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return err
 	}
-	if checkpointBlock != nil && blockHeight < checkpointBlock.Height() {
+	if checkpointNode != nil && blockHeight < checkpointNode.height {
 		str := fmt.Sprintf("block at height %d forks the main chain "+
 			"before the previous checkpoint at height %d",
-			blockHeight, checkpointBlock.Height())
+			blockHeight, checkpointNode.height)
 		return ruleError(ErrForkTooOld, str)
 	}
 
@@ -851,7 +851,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *provautil.Block, view
 	for _, tx := range block.Transactions() {
 		fetchSet[*tx.Hash()] = struct{}{}
 	}
-	err := view.fetchUtxos(b.db, fetchSet)
+	err := view.fetchUtxos(b.utxoCache, fetchSet)
 	if err != nil {
 		return err
 	}
@@ -1202,6 +1202,162 @@ func CheckTransactionOutputs(tx *provautil.Tx, keyView *KeyViewpoint, chainParam
 	return nil
 }
 
+// checkValidateKey ensures the passed validate key is in the passed validate
+// key set.  A key which is not in the set, but which signed one of the blocks
+// in the rate limiting window ending at prevNode, was authorized until recently
+// and is reported as revoked rather than invalid.
+func (b *BlockChain) checkValidateKey(prevNode *blockNode, validateKeySet btcec.PublicKeySet, validatePubKey wire.BlockValidatingPubKey) error {
+	pubKey, err := btcec.ParsePubKey(validatePubKey[:], btcec.S256())
+	if err != nil {
+		return err
+	}
+	if len(validateKeySet) == 0 || validateKeySet.Pos(pubKey) != -1 {
+		return nil
+	}
+
+	iterNode := prevNode
+	for i := 0; iterNode != nil && i < b.chainParams.PowAveragingWindow; i++ {
+		if iterNode.validatingPubKey == validatePubKey {
+			str := fmt.Sprintf("revoked validate key %x",
+				pubKey.SerializeCompressed())
+			return ruleError(ErrRevokedValidateKey, str)
+		}
+		iterNode = iterNode.parent
+	}
+	str := fmt.Sprintf("invalid validate key %x", pubKey.SerializeCompressed())
+	return ruleError(ErrInvalidValidateKey, str)
+}
+
+// checkHeaderSignature ensures the passed block header is signed by its
+// validating public key.
+func checkHeaderSignature(header *wire.BlockHeader) error {
+	pubKey, err := btcec.ParsePubKey(header.ValidatingPubKey[:], btcec.S256())
+	if err != nil {
+		str := fmt.Sprintf("malformed validating public key: %v", err)
+		return ruleError(ErrBadBlockSignature, str)
+	}
+	if !header.Verify(pubKey) {
+		return ruleError(ErrBadBlockSignature, "unable to validate block signature")
+	}
+	return nil
+}
+
+// CheckHeaderSanity performs the context-free checks of a block header which
+// can be done before its block is downloaded, such as during headers-first
+// synchronization.  It ensures the proof of work is valid and the header is
+// signed by its validating public key.
+//
+// Whether the validating public key is authorized can not be determined until
+// the admin state as of the parent block is known.
+func CheckHeaderSanity(header *wire.BlockHeader, powLimit *big.Int) error {
+	err := checkProofOfWork(header, powLimit, BFNone)
+	if err != nil {
+		return err
+	}
+	return checkHeaderSignature(header)
+}
+
+// HeaderContextWindow returns the number of previous headers needed by
+// CheckHeaderContext when the first of them does not connect to a known
+// block.  That is the number of headers the difficulty is averaged over along
+// with the headers the median time of the first of them is calculated from.
+func (b *BlockChain) HeaderContextWindow() int {
+	return b.chainParams.PowAveragingWindow + medianTimeBlocks
+}
+
+// CheckHeaderContext performs the checks of a block header which depend on the
+// headers before it and can be done before the blocks are downloaded, such as
+// during headers-first synchronization.  It ensures the difficulty of the
+// header is the one required by the difficulty retarget rules and that its
+// timestamp is after the median time of the previous headers.
+//
+// The previous headers are ordered from oldest to newest, and the last of them
+// is the parent of the header.  The ancestors of the first of them, or of the
+// header itself when there are none, are taken from the block index when it
+// connects to a known block.  Otherwise, there must be at least
+// HeaderContextWindow previous headers.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckHeaderContext(prevHeaders []wire.BlockHeader, header *wire.BlockHeader) error {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	firstPrevHash := header.PrevBlock
+	if len(prevHeaders) > 0 {
+		firstPrevHash = prevHeaders[0].PrevBlock
+	}
+	prevNode := b.index[firstPrevHash]
+	if prevNode == nil && len(prevHeaders) < b.HeaderContextWindow() {
+		return fmt.Errorf("header %v does not connect to a known block "+
+			"and only %d previous headers are known",
+			header.BlockHash(), len(prevHeaders))
+	}
+
+	// Link nodes for the previous headers which are not part of the block
+	// index, so the calculations can walk them like any other blocks.
+	for i := range prevHeaders {
+		hash := prevHeaders[i].BlockHash()
+		prevNode = newBlockNode(&prevHeaders[i], &hash, prevNode)
+	}
+
+	expectedDifficulty, err := b.calcNextRequiredDifficulty(prevNode)
+	if err != nil {
+		return err
+	}
+	if header.Bits != expectedDifficulty {
+		str := fmt.Sprintf("block difficulty of %d is not the expected "+
+			"value of %d", header.Bits, expectedDifficulty)
+		return ruleError(ErrUnexpectedDifficulty, str)
+	}
+
+	medianTime, err := b.calcPastMedianTime(prevNode)
+	if err != nil {
+		return err
+	}
+	if !header.Timestamp.After(medianTime) {
+		str := fmt.Sprintf("block timestamp of %v is not after "+
+			"expected %v", header.Timestamp, medianTime)
+		return ruleError(ErrTimeTooOld, str)
+	}
+	return nil
+}
+
+// CheckBlockHeaderSignature performs the inexpensive checks of the signer of
+// the passed block header, so blocks from unauthorized signers can be rejected
+// before they are downloaded or fully validated.  It ensures the header is
+// signed by its validating public key and, when the header extends the current
+// best chain, that the key is not rate limited.
+//
+// Only what the state as of the parent block decides is checked.  In
+// particular, whether the validating public key is in the validate key set is
+// left to the full validation of the block since the block may provision the
+// key itself with an admin transaction.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckBlockHeaderSignature(header *wire.BlockHeader) error {
+	err := checkHeaderSignature(header)
+	if err != nil {
+		return err
+	}
+
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if !header.PrevBlock.IsEqual(b.bestNode.hash) {
+		return nil
+	}
+
+	isRateLimited, err := b.isValidateKeyRateLimited(b.bestNode, header.ValidatingPubKey, true)
+	if err != nil {
+		return err
+	}
+	if isRateLimited {
+		str := fmt.Sprintf("Validate key rate limited %v", header.ValidatingPubKey)
+		return ruleError(ErrExcessiveChainShare, str)
+	}
+	return nil
+}
+
 // IsValidateKeyRateLimited determines whether using a specific pubkey in a
 // future possible chain extension would create a validate rate limit error.
 func (b *BlockChain) IsValidateKeyRateLimited(validatePubKey wire.BlockValidatingPubKey) (bool, error) {
@@ -1231,12 +1387,7 @@ func (b *BlockChain) isValidateKeyRateLimited(node *blockNode, validatePubKey wi
 		window -= 1
 	}
 	for i := 0; iterNode != nil && i < window; i++ {
-		var err error
-		iterNode, err = b.getPrevNodeFromNode(iterNode)
-		if err != nil {
-			log.Errorf("getPrevNodeFromNode: %v", err)
-			return false, err
-		}
+		iterNode = iterNode.parent
 		if iterNode != nil {
 			prevPubKeys = append(prevPubKeys, iterNode.validatingPubKey)
 		}
@@ -1260,8 +1411,11 @@ func (b *BlockChain) isValidateKeyRateLimited(node *blockNode, validatePubKey wi
 // See the comments for CheckConnectBlock for some examples of the type of
 // checks performed by this function.
 //
+// The flags modify the behavior of this function as follows:
+//  - BFAssumeValid: The transaction scripts are not executed.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, stxos *[]spentTxOut) error {
+func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, stxos *[]spentTxOut, flags BehaviorFlags) error {
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -1295,7 +1449,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err = utxoView.fetchInputUtxos(b.db, block)
+	err = utxoView.fetchInputUtxos(b.utxoCache, block)
 	if err != nil {
 		return err
 	}
@@ -1416,16 +1570,15 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		runScripts = false
 	}
 
-	// Get the previous block node.  This function is used over simply
-	// accessing node.parent directly as it will dynamically create previous
-	// block nodes as needed.  This helps allow only the pieces of the chain
-	// that are needed to remain in memory.
-	prevNode, err := b.getPrevNodeFromNode(node)
-	if err != nil {
-		log.Errorf("getPrevNodeFromNode: %v", err)
-		return err
+	// Likewise, don't run scripts when the block is known to be an
+	// ancestor of the block which is assumed to be valid.
+	if flags&BFAssumeValid == BFAssumeValid {
+		runScripts = false
 	}
 
+	// Get the previous block node.
+	prevNode := node.parent
+
 	// Blocks created after the BIP0016 activation time need to have the
 	// pay-to-script-hash checks enabled.
 	var scriptFlags txscript.ScriptFlags
@@ -1446,14 +1599,10 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 	// Check that the validate key used to sign the block is represented in
 	// the current admin keyset state.
 	validateKeySet := keyView.Keys()[btcec.ValidateKeySet]
-	pubKey, err := btcec.ParsePubKey(blockHeader.ValidatingPubKey[:], btcec.S256())
+	err = b.checkValidateKey(prevNode, validateKeySet, blockHeader.ValidatingPubKey)
 	if err != nil {
 		return err
 	}
-	if len(validateKeySet) > 0 && validateKeySet.Pos(pubKey) == -1 {
-		str := fmt.Sprintf("invalid validate key %x", pubKey.SerializeCompressed())
-		return ruleError(ErrInvalidValidateKey, str)
-	}
 
 	// Enforce CHECKLOCKTIMEVERIFY for block versions 4+ once the majority
 	// of the network has upgraded to the enforcement threshold.  This is
@@ -1506,9 +1655,7 @@ func (b *BlockChain) CheckConnectBlock(block *provautil.Block) error {
 	defer b.chainLock.Unlock()
 
 	prevNode := b.bestNode
-	newNode := newBlockNode(&block.MsgBlock().Header, block.Hash())
-	newNode.parent = prevNode
-	newNode.workSum.Add(prevNode.workSum, newNode.workSum)
+	newNode := newBlockNode(&block.MsgBlock().Header, block.Hash(), prevNode)
 
 	// Leave the spent txouts entry nil in the state since the information
 	// is not needed and thus extra work can be avoided.
@@ -1527,5 +1674,5 @@ func (b *BlockChain) CheckConnectBlock(block *provautil.Block) error {
 	keyView.SetTotalSupply(b.totalSupply)
 	keyView.SetKeys(b.adminKeySets)
 	keyView.SetKeyIDs(b.aspKeyIdMap)
-	return b.checkConnectBlock(newNode, block, utxoView, keyView, nil)
+	return b.checkConnectBlock(newNode, block, utxoView, keyView, nil, BFNone)
 }
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -97,6 +98,178 @@ func TestCheckConnectBlock(t *testing.T) {
 	}
 }
 
+// TestCheckBlockHeaderSignature tests the CheckBlockHeaderSignature function to
+// ensure headers with invalid signatures are rejected while headers signed by
+// keys which are not in the validate key set yet are left to full validation.
+func TestCheckBlockHeaderSignature(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("checkblockheadersignature",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Errorf("Failed to setup chain instance: %v", err)
+		return
+	}
+	defer teardownFunc()
+
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	signedHeader := func(prevBlock *chainhash.Hash) *wire.BlockHeader {
+		header := SomeBlock.Header
+		header.PrevBlock = *prevBlock
+		if err := header.Sign(key); err != nil {
+			t.Fatalf("Sign: unexpected error: %v", err)
+		}
+		return &header
+	}
+
+	// A header extending the best chain which is signed by a key that is
+	// not in the validate key set must not be rejected since its block may
+	// provision the key itself.
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	header := signedHeader(genesisHash)
+	if err := chain.CheckBlockHeaderSignature(header); err != nil {
+		t.Errorf("CheckBlockHeaderSignature: unexpected error: %v", err)
+	}
+
+	// A header with a signature that does not match its validating public
+	// key must be rejected.
+	header.MerkleRoot[0] ^= 0xff
+	err = chain.CheckBlockHeaderSignature(header)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrBadBlockSignature {
+		t.Errorf("CheckBlockHeaderSignature: got %v, want %v", err,
+			blockchain.ErrBadBlockSignature)
+	}
+
+	// Only the signature of a header which does not extend the best chain
+	// can be checked.
+	header = signedHeader(&chainhash.Hash{0x01})
+	if err := chain.CheckBlockHeaderSignature(header); err != nil {
+		t.Errorf("CheckBlockHeaderSignature: unexpected error: %v", err)
+	}
+}
+
+// TestCheckHeaderSanity ensures the context-free header checks done before a
+// block is downloaded work as expected.
+func TestCheckHeaderSanity(t *testing.T) {
+	powLimit := chaincfg.RegressionNetParams.PowLimit
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	header := SomeBlock.Header
+	if err := header.Sign(key); err != nil {
+		t.Fatalf("Sign: unexpected error: %v", err)
+	}
+	if err := blockchain.CheckHeaderSanity(&header, powLimit); err != nil {
+		t.Errorf("CheckHeaderSanity: unexpected error: %v", err)
+	}
+
+	// A header with a signature that does not match its validating public
+	// key must be rejected.
+	tampered := header
+	tampered.MerkleRoot[0] ^= 0xff
+	err = blockchain.CheckHeaderSanity(&tampered, powLimit)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrBadBlockSignature {
+		t.Errorf("CheckHeaderSanity: got %v, want %v", err,
+			blockchain.ErrBadBlockSignature)
+	}
+
+	// A header with a target difficulty above the proof of work limit must
+	// be rejected.
+	tampered = header
+	tampered.Bits = 0x2100ffff
+	err = blockchain.CheckHeaderSanity(&tampered, powLimit)
+	rerr, ok = err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrUnexpectedDifficulty {
+		t.Errorf("CheckHeaderSanity: got %v, want %v", err,
+			blockchain.ErrUnexpectedDifficulty)
+	}
+}
+
+// TestCheckHeaderContext ensures the difficulty and timestamp checks of headers
+// done before their blocks are downloaded work as expected, both for headers
+// which connect to known blocks and for headers which do not.
+func TestCheckHeaderContext(t *testing.T) {
+	avChain, err := fullblocktests.GenerateAssumeValid()
+	if err != nil {
+		t.Fatalf("failed to generate blocks: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup("checkheadercontext",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Only the first ten blocks are known to the chain.
+	mature := avChain.Mature
+	for _, block := range mature[:10] {
+		_, _, err := chain.ProcessBlock(provautil.NewBlock(block),
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	headers := func(blocks []*wire.MsgBlock) []wire.BlockHeader {
+		headers := make([]wire.BlockHeader, 0, len(blocks))
+		for _, block := range blocks {
+			headers = append(headers, block.Header)
+		}
+		return headers
+	}
+
+	window := chain.HeaderContextWindow()
+	tests := []struct {
+		name        string
+		prevHeaders []wire.BlockHeader
+		header      wire.BlockHeader
+	}{
+		{"connects to the tip", nil, mature[10].Header},
+		{"previous headers connect to the tip", headers(mature[10:60]),
+			mature[60].Header},
+		{"full window of previous headers", headers(mature[20 : 20+window]),
+			mature[20+window].Header},
+	}
+	for _, test := range tests {
+		err := chain.CheckHeaderContext(test.prevHeaders, &test.header)
+		if err != nil {
+			t.Errorf("CheckHeaderContext (%s): unexpected error: %v",
+				test.name, err)
+		}
+	}
+
+	// Previous headers which do not connect to a known block must fill the
+	// window.
+	err = chain.CheckHeaderContext(headers(mature[20:19+window]),
+		&mature[19+window].Header)
+	if err == nil {
+		t.Errorf("CheckHeaderContext: accepted header without enough " +
+			"previous headers")
+	}
+
+	// Headers with an unexpected difficulty or a timestamp which is not
+	// after the median time must be rejected.
+	tampered := mature[10].Header
+	tampered.Bits = 0x1f00ffff
+	err = chain.CheckHeaderContext(nil, &tampered)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrUnexpectedDifficulty {
+		t.Errorf("CheckHeaderContext: got %v, want %v", err,
+			blockchain.ErrUnexpectedDifficulty)
+	}
+	tampered = mature[10].Header
+	tampered.Timestamp = mature[0].Header.Timestamp
+	err = chain.CheckHeaderContext(nil, &tampered)
+	rerr, ok = err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrTimeTooOld {
+		t.Errorf("CheckHeaderContext: got %v, want %v", err,
+			blockchain.ErrTimeTooOld)
+	}
+}
+
 // TestCheckBlockSanity tests the CheckBlockSanity function to ensure it works
 // as expected.
 func TestCheckBlockSanity(t *testing.T) {
@@ -7,6 +7,7 @@ package main
 
 import (
 	"container/list"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -17,9 +18,11 @@ import (
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/connmgr"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/mempool"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -40,6 +43,27 @@ const (
 	// maxRequestedTxns is the maximum number of requested transactions
 	// hashes to store in memory.
 	maxRequestedTxns = wire.MaxInvPerMsg
+
+	// maxOffendingBlocks is the maximum number of blocks rejected because
+	// of their signer to store in memory.
+	maxOffendingBlocks = 1000
+
+	// maxInFlightBlocksPerPeer is the maximum number of blocks requested
+	// from a single peer at a time during headers-first synchronization.
+	maxInFlightBlocksPerPeer = 16
+
+	// maxBlocksAhead is the maximum number of blocks beyond the end of the
+	// best chain which are requested during headers-first synchronization.
+	// Since blocks are downloaded from several peers they arrive out of
+	// order and are held as orphans until their parents arrive, so this
+	// must stay below the maximum number of orphan blocks.
+	maxBlocksAhead = 512
+
+	// maxHeaderListLen is the maximum number of downloaded headers whose
+	// blocks are not yet connected which are kept during headers-first
+	// synchronization.  More headers are only requested once enough of
+	// the blocks have been connected.
+	maxHeaderListLen = 50000
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -64,6 +88,48 @@ type invMsg struct {
 	peer *serverPeer
 }
 
+// headersMsg packages a bitcoin headers message and the peer it came from
+// together so the block handler has access to that information.
+type headersMsg struct {
+	headers *wire.MsgHeaders
+	peer    *serverPeer
+}
+
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came from
+// together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *serverPeer
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *serverPeer
+}
+
+// pendingCmpctBlock houses a block announced with a cmpctblock message whose
+// missing transactions have been requested from the peer that announced it.
+type pendingCmpctBlock struct {
+	partial *partialBlock
+	peer    *serverPeer
+}
+
+// offendingBlock records a block which was rejected because of its signer
+// along with the peer which first relayed it.
+type offendingBlock struct {
+	relayedBy string
+	err       blockchain.RuleError
+}
+
+// headerNode is used as a node in a list of headers that are linked together
+// between checkpoints.
+type headerNode struct {
+	height uint32
+	hash   *chainhash.Hash
+}
+
 // donePeerMsg signifies a newly disconnected peer to the block handler.
 type donePeerMsg struct {
 	peer *serverPeer
@@ -125,11 +191,73 @@ type blockManager struct {
 	rejectedTxns    map[chainhash.Hash]struct{}
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+	offendingBlocks map[chainhash.Hash]offendingBlock
+	pendingBlocks   map[chainhash.Hash]pendingCmpctBlock
 	progressLogger  *blockProgressLogger
 	syncPeer        *serverPeer
+	candidatePeers  *list.List
 	msgChan         chan interface{}
 	wg              sync.WaitGroup
 	quit            chan struct{}
+
+	// The following fields are used for headers-first mode.
+	headersFirstMode bool
+	headersSynced    bool
+	headerList       *list.List
+	headerNodes      map[chainhash.Hash]*list.Element
+	lastHeader       *headerNode
+	checkpointHeight uint32
+	nextCheckpoint   *chaincfg.Checkpoint
+
+	// recentHeaders holds the most recently downloaded headers the
+	// difficulty and timestamp of the next header are checked against,
+	// and headersPaused is set when no more headers are requested since
+	// the header list is full.
+	recentHeaders []wire.BlockHeader
+	headersPaused bool
+
+	// assumeValidHeight is the height of the block which is assumed to be
+	// valid once its header was downloaded.  The blocks of the headers
+	// before it are its ancestors.
+	assumeValidHeight uint32
+}
+
+// resetHeaderState sets the headers-first mode state to values appropriate for
+// syncing from a new peer.
+func (b *blockManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight uint32) {
+	b.headersFirstMode = false
+	b.headersSynced = false
+	b.headerList.Init()
+	b.headerNodes = make(map[chainhash.Hash]*list.Element)
+	b.lastHeader = &headerNode{height: newestHeight, hash: newestHash}
+	b.checkpointHeight = 0
+	b.nextCheckpoint = b.findNextHeaderCheckpoint(newestHeight)
+	b.recentHeaders = nil
+	b.headersPaused = false
+	b.assumeValidHeight = 0
+}
+
+// findNextHeaderCheckpoint returns the next checkpoint after the passed height.
+// It returns nil when there is not one either because the height is already
+// later than the final checkpoint or there are no checkpoints.
+func (b *blockManager) findNextHeaderCheckpoint(height uint32) *chaincfg.Checkpoint {
+	checkpoints := b.chain.Checkpoints()
+	for i := range checkpoints {
+		if checkpoints[i].Height > height {
+			return &checkpoints[i]
+		}
+	}
+	return nil
+}
+
+// headerStopHash returns the stop hash to use when requesting headers during
+// headers-first mode.  Headers are requested up to the next checkpoint, when
+// there is one, so the header chain can be verified against it.
+func (b *blockManager) headerStopHash() *chainhash.Hash {
+	if b.nextCheckpoint != nil {
+		return b.nextCheckpoint.Hash
+	}
+	return &zeroHash
 }
 
 // startSync will choose the best peer among the available candidate peers to
@@ -181,7 +309,24 @@ func (b *blockManager) startSync(peers *list.List) {
 
 		bmgrLog.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
-		bestPeer.PushGetBlocksMsg(locator, &zeroHash)
+
+		// Download the headers first when the peer supports
+		// getheaders, so every header can be checked before any block
+		// is downloaded, and the blocks can then be downloaded from
+		// several peers in parallel.  The regression test tool is not
+		// a full node, so it only supports the legacy getblocks flow.
+		b.resetHeaderState(best.Hash, best.Height)
+		if bestPeer.ProtocolVersion() >= wire.SendHeadersVersion &&
+			!cfg.RegressionTest {
+
+			bestPeer.PushGetHeadersMsg(locator, b.headerStopHash())
+			b.headersFirstMode = true
+			bmgrLog.Infof("Downloading headers for blocks %d to %d "+
+				"from peer %s", best.Height+1,
+				bestPeer.LastBlock(), bestPeer.Addr())
+		} else {
+			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
+		}
 		b.syncPeer = bestPeer
 	} else {
 		bmgrLog.Warnf("No sync peer candidates available")
@@ -227,6 +372,22 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, sp *serverPeer) {
 
 	bmgrLog.Infof("New valid peer %s (%s)", sp, sp.UserAgent())
 
+	// Ask the peer to announce new blocks with their headers so the signer
+	// of each block can be checked before it is downloaded.
+	if sp.ProtocolVersion() >= wire.SendHeadersVersion {
+		sp.QueueMessage(wire.NewMsgSendHeaders(), nil)
+	}
+
+	// Negotiate compact blocks.  Only validators are asked to announce new
+	// blocks with cmpctblock messages since they are the peers which need
+	// blocks to propagate as quickly as possible.  Other peers keep
+	// announcing blocks with headers, which are then requested as compact
+	// blocks.
+	if sp.ProtocolVersion() >= wire.CompactBlocksVersion {
+		sp.QueueMessage(wire.NewMsgSendCmpct(sp.isValidatorPeer(),
+			wire.CmpctBlockVersion), nil)
+	}
+
 	// Ignore the peer if it's not a sync candidate.
 	if !b.isSyncCandidate(sp) {
 		return
@@ -235,8 +396,13 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, sp *serverPeer) {
 	// Add the peer as a candidate to sync from.
 	peers.PushBack(sp)
 
-	// Start syncing by choosing the best candidate if needed.
+	// Start syncing by choosing the best candidate if needed.  When
+	// already syncing headers-first, the new peer can immediately help
+	// download blocks.
 	b.startSync(peers)
+	if b.headersFirstMode {
+		b.fetchHeaderBlocks()
+	}
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -268,12 +434,26 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, sp *serverPeer) {
 		delete(b.requestedBlocks, k)
 	}
 
+	// Forget the blocks that were being reconstructed from compact blocks
+	// announced by the peer.
+	for k, pending := range b.pendingBlocks {
+		if pending.peer == sp {
+			delete(b.pendingBlocks, k)
+		}
+	}
+
 	// Attempt to find a new peer to sync from if the quitting peer is the
 	// sync peer.
 	if b.syncPeer != nil && b.syncPeer == sp {
 		b.syncPeer = nil
 		b.startSync(peers)
 	}
+
+	// Request the blocks which were requested from the peer from the
+	// remaining peers.
+	if b.headersFirstMode {
+		b.fetchHeaderBlocks()
+	}
 }
 
 // handleTxMsg handles transaction messages from all peers.
@@ -378,7 +558,22 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// Blocks on the header chain up to the latest checkpoint were already
+	// checked against their headers and the checkpoint, so several
+	// expensive checks can be avoided.  Likewise, the scripts of blocks on
+	// the header chain up to the block which is assumed to be valid are not
+	// executed.
 	behaviorFlags := blockchain.BFNone
+	if b.headersFirstMode {
+		if e, exists := b.headerNodes[*blockHash]; exists {
+			height := e.Value.(*headerNode).height
+			if height <= b.checkpointHeight {
+				behaviorFlags |= blockchain.BFFastAdd
+			} else if height <= b.assumeValidHeight {
+				behaviorFlags |= blockchain.BFAssumeValid
+			}
+		}
+	}
 
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
@@ -386,9 +581,14 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	delete(bmsg.peer.requestedBlocks, *blockHash)
 	delete(b.requestedBlocks, *blockHash)
 
-	// Process the block to include validation, best chain selection, orphan
-	// handling, etc.
-	_, isOrphan, err := b.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	// Check the signer of the block before spending any effort on fully
+	// validating it.  Then process the block to include validation, best
+	// chain selection, orphan handling, etc.
+	var isOrphan bool
+	err := b.chain.CheckBlockHeaderSignature(&bmsg.block.MsgBlock().Header)
+	if err == nil {
+		_, isOrphan, err = b.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	}
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -411,6 +611,12 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		code, reason := mempool.ErrToRejectErr(err)
 		bmsg.peer.PushRejectMsg(wire.CmdBlock, code, reason,
 			blockHash, false)
+
+		// Penalize the peer when the block was rejected because of
+		// its signer.
+		if rerr, ok := err.(blockchain.RuleError); ok {
+			b.penalizeBlockRelay(bmsg.peer, blockHash, rerr)
+		}
 		return
 	}
 
@@ -437,13 +643,18 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		heightUpdate := header.Height
 		bmgrLog.Debugf("Extracted height of %v from orphan block", heightUpdate)
 
-		orphanRoot := b.chain.GetOrphanRoot(blockHash)
-		locator, err := b.chain.LatestBlockLocator()
-		if err != nil {
-			bmgrLog.Warnf("Failed to get block locator for the "+
-				"latest block: %v", err)
-		} else {
-			bmsg.peer.PushGetBlocksMsg(locator, orphanRoot)
+		// Blocks commonly arrive out of order during headers-first
+		// mode since they are downloaded from several peers, and the
+		// parents have already been requested.
+		if !b.headersFirstMode {
+			orphanRoot := b.chain.GetOrphanRoot(blockHash)
+			locator, err := b.chain.LatestBlockLocator()
+			if err != nil {
+				bmgrLog.Warnf("Failed to get block locator for "+
+					"the latest block: %v", err)
+			} else {
+				bmsg.peer.PushGetBlocksMsg(locator, orphanRoot)
+			}
 		}
 	} else {
 		// When the block is not an orphan, log information about it and
@@ -478,6 +689,488 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 			go b.server.UpdatePeerHeights(blkHashUpdate, heightUpdate, bmsg.peer)
 		}
 	}
+
+	// Request more blocks using the header list in headers-first mode.
+	if b.headersFirstMode {
+		b.trimHeaderList()
+		b.fetchHeaderBlocks()
+	}
+}
+
+// trimHeaderList removes the headers of blocks which are now part of the best
+// chain from the header list.  It resumes the header download when it was
+// paused because the header list was full, and leaves headers-first mode once
+// all of the headers have been downloaded and all of their blocks connected.
+func (b *blockManager) trimHeaderList() {
+	best := b.chain.BestSnapshot()
+	for e := b.headerList.Front(); e != nil; e = b.headerList.Front() {
+		node := e.Value.(*headerNode)
+		if node.height > best.Height {
+			break
+		}
+		b.headerList.Remove(e)
+		delete(b.headerNodes, *node.hash)
+	}
+
+	// Resume the paused header download once there is room for the
+	// headers of a full response.
+	if b.headersPaused && b.syncPeer != nil &&
+		b.headerList.Len() <= maxHeaderListLen-wire.MaxBlockHeadersPerMsg {
+
+		b.headersPaused = false
+		b.requestMoreHeaders(b.syncPeer)
+	}
+	if !b.headersSynced || b.headerList.Len() != 0 {
+		return
+	}
+
+	// All blocks of the downloaded headers are connected, so leave
+	// headers-first mode and request any blocks announced since.
+	bmgrLog.Infof("Finished headers-first synchronization at height %d",
+		best.Height)
+	b.resetHeaderState(best.Hash, best.Height)
+	if b.syncPeer != nil {
+		locator, err := b.chain.LatestBlockLocator()
+		if err != nil {
+			bmgrLog.Errorf("Failed to get block locator for the "+
+				"latest block: %v", err)
+			return
+		}
+		b.syncPeer.PushGetBlocksMsg(locator, &zeroHash)
+	}
+}
+
+// fetchHeaderBlocks requests the blocks of the downloaded headers which are not
+// known or already requested.  The requests are spread over all sync candidate
+// peers which claim to have the blocks, limited to maxInFlightBlocksPerPeer
+// outstanding blocks per peer and maxBlocksAhead blocks beyond the end of the
+// best chain.
+func (b *blockManager) fetchHeaderBlocks() {
+	peers := make([]*serverPeer, 0, b.candidatePeers.Len())
+	for e := b.candidatePeers.Front(); e != nil; e = e.Next() {
+		peers = append(peers, e.Value.(*serverPeer))
+	}
+	if len(peers) == 0 {
+		return
+	}
+
+	best := b.chain.BestSnapshot()
+	maxHeight := best.Height + maxBlocksAhead
+	requests := make(map[*serverPeer]*wire.MsgGetData)
+	nextPeer := 0
+	for e := b.headerList.Front(); e != nil; e = e.Next() {
+		node := e.Value.(*headerNode)
+		if node.height > maxHeight {
+			break
+		}
+		if _, exists := b.requestedBlocks[*node.hash]; exists {
+			continue
+		}
+		haveBlock, err := b.chain.HaveBlock(node.hash)
+		if err != nil {
+			bmgrLog.Warnf("Unexpected failure when checking for "+
+				"existing block %v: %v", node.hash, err)
+			continue
+		}
+		if haveBlock {
+			continue
+		}
+
+		// Choose the next peer in turn which has the block and room
+		// for more requests.  Later blocks can not be requested either
+		// when there is no such peer.
+		var sp *serverPeer
+		for i := 0; i < len(peers); i++ {
+			candidate := peers[(nextPeer+i)%len(peers)]
+			if len(candidate.requestedBlocks) < maxInFlightBlocksPerPeer &&
+				candidate.LastBlock() >= node.height {
+
+				sp = candidate
+				nextPeer = (nextPeer + i + 1) % len(peers)
+				break
+			}
+		}
+		if sp == nil {
+			break
+		}
+
+		b.markBlockRequested(sp, node.hash)
+		gdmsg, exists := requests[sp]
+		if !exists {
+			gdmsg = wire.NewMsgGetData()
+			requests[sp] = gdmsg
+		}
+		gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, node.hash))
+	}
+
+	for sp, gdmsg := range requests {
+		sp.QueueMessage(gdmsg, nil)
+	}
+}
+
+// markBlockRequested records that the block with the passed hash is expected
+// from the passed peer.
+func (b *blockManager) markBlockRequested(sp *serverPeer, blockHash *chainhash.Hash) {
+	b.requestedBlocks[*blockHash] = struct{}{}
+	b.limitMap(b.requestedBlocks, maxRequestedBlocks)
+	sp.requestedBlocks[*blockHash] = struct{}{}
+}
+
+// requestFullBlock requests the block with the passed hash from the passed
+// peer as a full block.  It is used when a block can not be reconstructed from
+// a compact block.
+func (b *blockManager) requestFullBlock(sp *serverPeer, blockHash *chainhash.Hash) {
+	b.markBlockRequested(sp, blockHash)
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, blockHash))
+	sp.QueueMessage(gdmsg, nil)
+}
+
+// completePartialBlock processes a block which has been fully reconstructed
+// from a compact block.  The full block is requested instead when the
+// reconstructed transactions do not match the header.
+func (b *blockManager) completePartialBlock(sp *serverPeer, blockHash *chainhash.Hash, partial *partialBlock) {
+	block, err := partial.block()
+	if err != nil {
+		bmgrLog.Debugf("Unable to reconstruct block %v from %s: %v -- "+
+			"requesting full block", blockHash, sp, err)
+		b.requestFullBlock(sp, blockHash)
+		return
+	}
+
+	b.markBlockRequested(sp, blockHash)
+	b.handleBlockMsg(&blockMsg{block: block, peer: sp})
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The signer
+// of the block is checked before the block is reconstructed from the
+// transactions in the memory pool.  Transactions which are not in the memory
+// pool are requested from the peer with a getblocktxn message.
+func (b *blockManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	msg := cmsg.cmpctBlock
+	sp := cmsg.peer
+	blockHash := msg.BlockHash()
+	sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeBlock, &blockHash))
+
+	if offending, exists := b.offendingBlocks[blockHash]; exists {
+		b.penalizeBlockRelay(sp, &blockHash, offending.err)
+		return
+	}
+
+	// Ignore blocks which are already known or being reconstructed.
+	if _, exists := b.pendingBlocks[blockHash]; exists {
+		return
+	}
+	haveBlock, err := b.chain.HaveBlock(&blockHash)
+	if err != nil {
+		bmgrLog.Warnf("Unexpected failure when checking for existing "+
+			"block %v: %v", blockHash, err)
+		return
+	}
+	if haveBlock {
+		return
+	}
+
+	// The memory pool is of little use for reconstructing blocks while
+	// syncing, so treat the compact block as a header announcement.
+	if !b.current() {
+		headers := wire.NewMsgHeaders()
+		headers.AddBlockHeader(&msg.Header)
+		b.handleHeaderAnnouncements(&headersMsg{headers: headers,
+			peer: sp})
+		return
+	}
+
+	err = b.chain.CheckBlockHeaderSignature(&msg.Header)
+	if err != nil {
+		bmgrLog.Infof("Rejected cmpctblock %v from %s: %v", blockHash,
+			sp, err)
+		if rerr, ok := err.(blockchain.RuleError); ok {
+			b.penalizeBlockRelay(sp, &blockHash, rerr)
+		}
+		return
+	}
+
+	partial, err := newPartialBlock(msg, b.server.txMemPool.TxDescs())
+	if err == errShortIDCollision {
+		bmgrLog.Debugf("Unable to reconstruct block %v from %s: %v -- "+
+			"requesting full block", blockHash, sp, err)
+		b.requestFullBlock(sp, &blockHash)
+		return
+	}
+	if err != nil {
+		bmgrLog.Warnf("Invalid cmpctblock %v from %s: %v -- "+
+			"disconnecting", blockHash, sp, err)
+		sp.Disconnect()
+		return
+	}
+
+	if len(partial.missing) == 0 {
+		b.completePartialBlock(sp, &blockHash, partial)
+		return
+	}
+
+	bmgrLog.Debugf("Requesting %d of %d transactions of block %v from %s",
+		len(partial.missing), msg.TxCount(), blockHash, sp)
+	b.markBlockRequested(sp, &blockHash)
+	b.pendingBlocks[blockHash] = pendingCmpctBlock{partial: partial, peer: sp}
+	sp.QueueMessage(wire.NewMsgGetBlockTxn(&blockHash, partial.missing), nil)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers.  The
+// transactions complete a block previously announced by the peer with a
+// cmpctblock message.
+func (b *blockManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	msg := bmsg.blockTxn
+	sp := bmsg.peer
+	blockHash := msg.BlockHash
+
+	// If we didn't ask for the transactions then the peer is misbehaving.
+	pending, exists := b.pendingBlocks[blockHash]
+	if !exists || pending.peer != sp {
+		bmgrLog.Warnf("Got unrequested blocktxn for block %v from %s "+
+			"-- disconnecting", blockHash, sp)
+		sp.Disconnect()
+		return
+	}
+	delete(b.pendingBlocks, blockHash)
+
+	if err := pending.partial.fill(msg.Transactions); err != nil {
+		bmgrLog.Warnf("Invalid blocktxn for block %v from %s: %v -- "+
+			"disconnecting", blockHash, sp, err)
+		sp.Disconnect()
+		return
+	}
+	b.completePartialBlock(sp, &blockHash, pending.partial)
+}
+
+// signerBanScore returns the persistent ban score increase for relaying a block
+// which was rejected with the passed rule error.  It returns zero when the
+// error is not caused by the signer of the block.
+func signerBanScore(err blockchain.RuleError) uint32 {
+	switch err.ErrorCode {
+	case blockchain.ErrBadBlockSignature:
+		return connmgr.BanScoreInvalidBlockSignature
+	case blockchain.ErrInvalidValidateKey:
+		return connmgr.BanScoreUnauthorizedValidateKey
+	case blockchain.ErrRevokedValidateKey:
+		return connmgr.BanScoreRevokedValidateKey
+	case blockchain.ErrExcessiveChainShare:
+		return connmgr.BanScoreRateLimitedValidateKey
+	}
+	return 0
+}
+
+// penalizeBlockRelay increases the ban score of a peer which relayed the block
+// with the passed hash when the block was rejected because of its signer.  The
+// first peer to relay each such block is recorded so the block is not requested
+// again and later relays of it are penalized as well.
+func (b *blockManager) penalizeBlockRelay(sp *serverPeer, blockHash *chainhash.Hash, err blockchain.RuleError) {
+	score := signerBanScore(err)
+	if score == 0 {
+		return
+	}
+
+	offending, exists := b.offendingBlocks[*blockHash]
+	if !exists {
+		// Evict a random entry if adding a new one would exceed the
+		// limit.  See limitMap for why random eviction is fine.
+		if len(b.offendingBlocks)+1 > maxOffendingBlocks {
+			for hash := range b.offendingBlocks {
+				delete(b.offendingBlocks, hash)
+				break
+			}
+		}
+		offending = offendingBlock{relayedBy: sp.Addr(), err: err}
+		b.offendingBlocks[*blockHash] = offending
+		bmgrLog.Warnf("Block %v rejected because of its signer was "+
+			"first relayed by %s: %v", blockHash, sp, err)
+	}
+
+	reason := fmt.Sprintf("relayed block %v (first relayed by %s): %v",
+		blockHash, offending.relayedBy, err.ErrorCode)
+	sp.addBanScore(score, 0, reason)
+}
+
+// handleHeadersMsg handles headers messages from all peers.  Headers from the
+// sync peer which extend the downloaded headers are handled as part of
+// headers-first mode.  Otherwise they are announcements of new blocks.
+func (b *blockManager) handleHeadersMsg(hmsg *headersMsg) {
+	headers := hmsg.headers.Headers
+	if b.headersFirstMode && hmsg.peer == b.syncPeer && (len(headers) == 0 ||
+		headers[0].PrevBlock.IsEqual(b.lastHeader.hash)) {
+
+		b.handleSyncHeadersMsg(hmsg)
+		return
+	}
+	b.handleHeaderAnnouncements(hmsg)
+}
+
+// handleSyncHeadersMsg handles headers messages sent by the sync peer in
+// response to getheaders messages during headers-first mode.  Every header
+// must connect to the previous one, have the next height, valid proof of work
+// at the required difficulty, a timestamp after the median time of the
+// previous headers and be signed by its validating public key, and must match
+// the next checkpoint when it is at its height.  Whether the validating public
+// keys are authorized is only known once the blocks are connected.
+func (b *blockManager) handleSyncHeadersMsg(hmsg *headersMsg) {
+	// No more headers are requested once the header list is full, so the
+	// peer is misbehaving when it sends them anyway.
+	if b.headerList.Len() >= maxHeaderListLen {
+		bmgrLog.Warnf("Received unrequested headers from peer %s "+
+			"-- disconnecting", hmsg.peer)
+		hmsg.peer.Disconnect()
+		return
+	}
+
+	headers := hmsg.headers.Headers
+	powLimit := b.server.chainParams.PowLimit
+	window := b.chain.HeaderContextWindow()
+	reachedCheckpoint := false
+	for _, header := range headers {
+		blockHash := header.BlockHash()
+		if !header.PrevBlock.IsEqual(b.lastHeader.hash) {
+			bmgrLog.Warnf("Received block header %v from peer %s "+
+				"that does not connect to the previous header "+
+				"-- disconnecting", blockHash, hmsg.peer)
+			hmsg.peer.Disconnect()
+			return
+		}
+		if header.Height != b.lastHeader.height+1 {
+			bmgrLog.Warnf("Received block header %v from peer %s "+
+				"with height %d instead of %d -- disconnecting",
+				blockHash, hmsg.peer, header.Height,
+				b.lastHeader.height+1)
+			hmsg.peer.Disconnect()
+			return
+		}
+		if err := blockchain.CheckHeaderSanity(header, powLimit); err != nil {
+			bmgrLog.Warnf("Rejected block header %v from peer %s: %v "+
+				"-- disconnecting", blockHash, hmsg.peer, err)
+			if rerr, ok := err.(blockchain.RuleError); ok {
+				b.penalizeBlockRelay(hmsg.peer, &blockHash, rerr)
+			}
+			hmsg.peer.Disconnect()
+			return
+		}
+		err := b.chain.CheckHeaderContext(b.recentHeaders, header)
+		if err != nil {
+			bmgrLog.Warnf("Rejected block header %v from peer %s: %v "+
+				"-- disconnecting", blockHash, hmsg.peer, err)
+			if rerr, ok := err.(blockchain.RuleError); ok {
+				b.penalizeBlockRelay(hmsg.peer, &blockHash, rerr)
+			}
+			hmsg.peer.Disconnect()
+			return
+		}
+
+		// Verify the header at the next checkpoint height matches.
+		node := &headerNode{height: header.Height, hash: &blockHash}
+		if b.nextCheckpoint != nil &&
+			node.height == b.nextCheckpoint.Height {
+
+			if !node.hash.IsEqual(b.nextCheckpoint.Hash) {
+				bmgrLog.Warnf("Block header at height %d/hash "+
+					"%s from peer %s does NOT match expected "+
+					"checkpoint hash of %s -- disconnecting",
+					node.height, node.hash, hmsg.peer,
+					b.nextCheckpoint.Hash)
+				hmsg.peer.Disconnect()
+				return
+			}
+			bmgrLog.Infof("Verified downloaded block header against "+
+				"checkpoint at height %d/hash %s", node.height,
+				node.hash)
+			b.checkpointHeight = node.height
+			b.nextCheckpoint = b.findNextHeaderCheckpoint(node.height)
+			reachedCheckpoint = true
+		}
+
+		// The blocks of this header and all of the headers before it
+		// are assumed to be valid when it is the configured block.
+		if cfg.assumeValid != nil && node.hash.IsEqual(cfg.assumeValid) {
+			bmgrLog.Infof("Skipping script verification of blocks up "+
+				"to assumed valid block %s at height %d",
+				node.hash, node.height)
+			b.assumeValidHeight = node.height
+		}
+
+		b.headerNodes[blockHash] = b.headerList.PushBack(node)
+		b.lastHeader = node
+		b.recentHeaders = append(b.recentHeaders, *header)
+		if len(b.recentHeaders) > window {
+			b.recentHeaders = append(b.recentHeaders[:0],
+				b.recentHeaders[1:]...)
+		}
+	}
+
+	// Start downloading the blocks of the new headers while requesting
+	// more headers.  A response with less than the maximum number of
+	// headers which did not stop at a checkpoint means all headers known to
+	// the peer were received.
+	b.fetchHeaderBlocks()
+	if len(headers) < wire.MaxBlockHeadersPerMsg && !reachedCheckpoint {
+		bmgrLog.Infof("Downloaded headers up to height %d from peer %s",
+			b.lastHeader.height, hmsg.peer)
+		b.headersSynced = true
+		b.trimHeaderList()
+		return
+	}
+	if b.headerList.Len() >= maxHeaderListLen {
+		bmgrLog.Debugf("Pausing header download at height %d until "+
+			"more blocks are connected", b.lastHeader.height)
+		b.headersPaused = true
+		return
+	}
+	b.requestMoreHeaders(hmsg.peer)
+}
+
+// requestMoreHeaders requests the headers after the last downloaded header from
+// the passed peer during headers-first mode.
+func (b *blockManager) requestMoreHeaders(sp *serverPeer) {
+	locator := blockchain.BlockLocator([]*chainhash.Hash{b.lastHeader.hash})
+	err := sp.PushGetHeadersMsg(locator, b.headerStopHash())
+	if err != nil {
+		bmgrLog.Warnf("Failed to send getheaders message to peer %s: %v",
+			sp, err)
+	}
+}
+
+// handleHeaderAnnouncements handles headers messages which announce new blocks.
+// Peers announce new blocks with headers messages after being sent a
+// sendheaders message.  The signer of every announced block is checked before
+// the block is requested so blocks with invalid signatures or from rate limited
+// signers are never downloaded.
+func (b *blockManager) handleHeaderAnnouncements(hmsg *headersMsg) {
+	inv := wire.NewMsgInvSizeHint(uint(len(hmsg.headers.Headers)))
+	for _, header := range hmsg.headers.Headers {
+		blockHash := header.BlockHash()
+		if offending, exists := b.offendingBlocks[blockHash]; exists {
+			b.penalizeBlockRelay(hmsg.peer, &blockHash, offending.err)
+			return
+		}
+
+		err := b.chain.CheckBlockHeaderSignature(header)
+		if err != nil {
+			bmgrLog.Infof("Rejected header %v from %s: %v",
+				blockHash, hmsg.peer, err)
+			if rerr, ok := err.(blockchain.RuleError); ok {
+				b.penalizeBlockRelay(hmsg.peer, &blockHash, rerr)
+			}
+			return
+		}
+
+		iv := wire.NewInvVect(wire.InvTypeBlock, &blockHash)
+		if err := inv.AddInvVect(iv); err != nil {
+			break
+		}
+	}
+
+	// Request the announced blocks the same way as blocks announced with
+	// an inv message.
+	if len(inv.InvList) > 0 {
+		b.handleInvMsg(&invMsg{inv: inv, peer: hmsg.peer})
+	}
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -542,6 +1235,11 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 		return
 	}
 
+	// Blocks are requested using the header list in headers-first mode.
+	if b.headersFirstMode {
+		return
+	}
+
 	// If our chain is current and a peer announces a block we already
 	// know of, then update their current block height.
 	if lastBlock != -1 && b.current() {
@@ -582,6 +1280,18 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 				}
 			}
 
+			// Skip the block if it has already been rejected
+			// because of its signer and penalize the peer for
+			// relaying it.
+			if iv.Type == wire.InvTypeBlock {
+				offending, exists := b.offendingBlocks[iv.Hash]
+				if exists {
+					b.penalizeBlockRelay(imsg.peer, &iv.Hash,
+						offending.err)
+					continue
+				}
+			}
+
 			// Add it to the request queue.
 			imsg.peer.requestQueue = append(imsg.peer.requestQueue, iv)
 			continue
@@ -631,6 +1341,7 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 	// Request as much as possible at once.  Anything that won't fit into
 	// the request will be requested on the next inv message.
 	numRequested := 0
+	current := b.current()
 	gdmsg := wire.NewMsgGetData()
 	requestQueue := imsg.peer.requestQueue
 	for len(requestQueue) != 0 {
@@ -641,11 +1352,14 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 		switch iv.Type {
 		case wire.InvTypeBlock:
 			// Request the block if there is not already a pending
-			// request.
+			// request.  New blocks are requested as compact blocks
+			// once the chain is current and the peer supports them.
 			if _, exists := b.requestedBlocks[iv.Hash]; !exists {
-				b.requestedBlocks[iv.Hash] = struct{}{}
-				b.limitMap(b.requestedBlocks, maxRequestedBlocks)
-				imsg.peer.requestedBlocks[iv.Hash] = struct{}{}
+				b.markBlockRequested(imsg.peer, &iv.Hash)
+				if current && imsg.peer.SupportsCmpctBlocks() {
+					iv = wire.NewInvVect(
+						wire.InvTypeCmpctBlock, &iv.Hash)
+				}
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -697,7 +1411,7 @@ func (b *blockManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 // important because the block manager controls which blocks are needed and how
 // the fetching should proceed.
 func (b *blockManager) blockHandler() {
-	candidatePeers := list.New()
+	candidatePeers := b.candidatePeers
 out:
 	for {
 		select {
@@ -717,6 +1431,17 @@ out:
 			case *invMsg:
 				b.handleInvMsg(msg)
 
+			case *headersMsg:
+				b.handleHeadersMsg(msg)
+
+			case *cmpctBlockMsg:
+				b.handleCmpctBlockMsg(msg)
+				msg.peer.blockProcessed <- struct{}{}
+
+			case *blockTxnMsg:
+				b.handleBlockTxnMsg(msg)
+				msg.peer.blockProcessed <- struct{}{}
+
 			case *donePeerMsg:
 				b.handleDonePeerMsg(candidatePeers, msg.peer)
 
@@ -788,7 +1513,7 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 
 		// Generate the inventory vector and relay it.
 		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
-		b.server.RelayInventory(iv, block.MsgBlock().Header)
+		b.server.RelayInventory(iv, block)
 
 	// A block has been connected to the main block chain.
 	case blockchain.NTBlockConnected:
@@ -805,7 +1530,13 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		// no longer an orphan. Transactions which depend on a confirmed
 		// transaction are NOT removed recursively because they are still
 		// valid.
+		//
+		// A transaction in the pool which only differs from the confirmed
+		// one by its signatures is reported before it is removed.
 		for _, tx := range block.Transactions()[1:] {
+			if poolTx := b.server.txMemPool.SigVariant(tx); poolTx != nil {
+				b.server.notifySigVariant(poolTx, tx, block)
+			}
 			b.server.txMemPool.RemoveTransaction(tx, false)
 			b.server.txMemPool.RemoveDoubleSpends(tx)
 			b.server.txMemPool.RemoveOrphan(tx)
@@ -826,6 +1557,12 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			r.ntfnMgr.NotifyBlockConnected(block)
 		}
 
+		// Admin transactions may revoke the validate keys peers
+		// authenticated with.
+		if cfg.PeerAuthValidateKeys && containsAdminTx(block) {
+			b.server.ReauthorizePeers()
+		}
+
 	// A block has been disconnected from the main block chain.
 	case blockchain.NTBlockDisconnected:
 		block, ok := notification.Data.(*provautil.Block)
@@ -851,7 +1588,24 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		if r := b.server.rpcServer; r != nil {
 			r.ntfnMgr.NotifyBlockDisconnected(block)
 		}
+
+		// Undoing admin transactions may remove the validate keys
+		// peers authenticated with.
+		if cfg.PeerAuthValidateKeys && containsAdminTx(block) {
+			b.server.ReauthorizePeers()
+		}
+	}
+}
+
+// containsAdminTx returns whether the passed block contains an admin
+// transaction.
+func containsAdminTx(block *provautil.Block) bool {
+	for _, tx := range block.Transactions()[1:] {
+		if threadInt, _ := txscript.GetAdminDetails(tx); threadInt >= 0 {
+			return true
+		}
 	}
+	return false
 }
 
 // NewPeer informs the block manager of a newly active peer.
@@ -897,6 +1651,42 @@ func (b *blockManager) QueueInv(inv *wire.MsgInv, sp *serverPeer) {
 	b.msgChan <- &invMsg{inv: inv, peer: sp}
 }
 
+// QueueHeaders adds the passed headers message and peer to the block handling
+// queue.
+func (b *blockManager) QueueHeaders(headers *wire.MsgHeaders, sp *serverPeer) {
+	// No channel handling here because peers do not need to block on
+	// headers messages.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- &headersMsg{headers: headers, peer: sp}
+}
+
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.
+func (b *blockManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, sp *serverPeer) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.blockProcessed <- struct{}{}
+		return
+	}
+
+	b.msgChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: sp}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue.
+func (b *blockManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, sp *serverPeer) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.blockProcessed <- struct{}{}
+		return
+	}
+
+	b.msgChan <- &blockTxnMsg{blockTxn: blockTxn, peer: sp}
+}
+
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (b *blockManager) DonePeer(sp *serverPeer) {
 	// Ignore if we are shutting down.
@@ -931,6 +1721,12 @@ func (b *blockManager) Stop() error {
 	bmgrLog.Infof("Block manager shutting down")
 	close(b.quit)
 	b.wg.Wait()
+
+	// Write any unflushed utxo set changes to the database now that no
+	// more blocks are being processed.
+	if err := b.chain.FlushUtxoCache(); err != nil {
+		bmgrLog.Errorf("Unable to flush the utxo cache: %v", err)
+	}
 	return nil
 }
 
@@ -1030,7 +1826,11 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockMan
 		rejectedTxns:    make(map[chainhash.Hash]struct{}),
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		offendingBlocks: make(map[chainhash.Hash]offendingBlock),
+		pendingBlocks:   make(map[chainhash.Hash]pendingCmpctBlock),
 		progressLogger:  newBlockProgressLogger("Processed", bmgrLog),
+		candidatePeers:  list.New(),
+		headerList:      list.New(),
 		msgChan:         make(chan interface{}, cfg.MaxPeers*3),
 		quit:            make(chan struct{}),
 	}
@@ -1042,17 +1842,21 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockMan
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
 	bm.chain, err = blockchain.New(&blockchain.Config{
-		DB:            s.db,
-		ChainParams:   s.chainParams,
-		Checkpoints:   checkpoints,
-		TimeSource:    s.timeSource,
-		Notifications: bm.handleNotifyMsg,
-		SigCache:      s.sigCache,
-		IndexManager:  indexManager,
+		DB:               s.db,
+		ChainParams:      s.chainParams,
+		Checkpoints:      checkpoints,
+		TimeSource:       s.timeSource,
+		Notifications:    bm.handleNotifyMsg,
+		SigCache:         s.sigCache,
+		IndexManager:     indexManager,
+		UtxoCacheMaxSize: uint64(cfg.UtxoCacheMaxSizeMiB) * 1024 * 1024,
+		PruneTarget:      uint64(cfg.Prune) * 1024 * 1024,
 	})
 	if err != nil {
 		return nil, err
 	}
+	best := bm.chain.BestSnapshot()
+	bm.resetHeaderState(best.Hash, best.Height)
 
 	return &bm, nil
 }
@@ -1157,7 +1961,8 @@ func loadBlockDB() (database.DB, error) {
 	removeRegressionDB(dbPath)
 
 	btcdLog.Infof("Loading block database from '%s'", dbPath)
-	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net,
+		cfg.CompressBlocks)
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -1172,7 +1977,8 @@ func loadBlockDB() (database.DB, error) {
 		if err != nil {
 			return nil, err
 		}
-		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		db, err = database.Create(cfg.DbType, dbPath,
+			activeNetParams.Net, cfg.CompressBlocks)
 		if err != nil {
 			return nil, err
 		}
@@ -106,6 +106,18 @@ func btcdMain(serverChan chan<- *server) error {
 			btcdLog.Errorf("%v", err)
 			return err
 		}
+		if err := indexers.DropAddrUtxoIndex(db); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropCfIndex {
+		if err := indexers.DropCfIndex(db); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
 
 		return nil
 	}
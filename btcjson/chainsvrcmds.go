@@ -126,6 +126,21 @@ func NewGetAdminInfoCmd() *GetAdminInfoCmd {
 	return &GetAdminInfoCmd{}
 }
 
+// GetAdminTxProofsCmd defines the getadmintxproofs JSON-RPC command.
+type GetAdminTxProofsCmd struct {
+	StartHeight uint32
+	EndHeight   uint32
+}
+
+// NewGetAdminTxProofsCmd returns a new instance which can be used to issue a
+// getadmintxproofs JSON-RPC command.
+func NewGetAdminTxProofsCmd(startHeight, endHeight uint32) *GetAdminTxProofsCmd {
+	return &GetAdminTxProofsCmd{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+	}
+}
+
 // GetBestBlockHashCmd defines the getbestblockhash JSON-RPC command.
 type GetBestBlockHashCmd struct{}
 
@@ -234,6 +249,12 @@ type AddressTxRequest struct {
 	End       uint32   `json:"end,omitempty"`
 }
 
+// AddressRequest is a request object for the address commands as defined by
+// bitcore.  (https://bitcore.io/guides/bitcoin/)
+type AddressRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
 // convertTemplateRequestField potentially converts the provided value as
 // needed.
 func convertTemplateRequestField(fieldName string, iface interface{}) (interface{}, error) {
@@ -297,6 +318,42 @@ func NewGetBlockTemplateCmd(request *TemplateRequest) *GetBlockTemplateCmd {
 	}
 }
 
+// GetCFilterCmd defines the getcfilter JSON-RPC command.
+type GetCFilterCmd struct {
+	Hash       string
+	FilterType *uint8 `jsonrpcdefault:"0"`
+}
+
+// NewGetCFilterCmd returns a new instance which can be used to issue a
+// getcfilter JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetCFilterCmd(hash string, filterType *uint8) *GetCFilterCmd {
+	return &GetCFilterCmd{
+		Hash:       hash,
+		FilterType: filterType,
+	}
+}
+
+// GetCFilterHeaderCmd defines the getcfilterheader JSON-RPC command.
+type GetCFilterHeaderCmd struct {
+	Hash       string
+	FilterType *uint8 `jsonrpcdefault:"0"`
+}
+
+// NewGetCFilterHeaderCmd returns a new instance which can be used to issue a
+// getcfilterheader JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetCFilterHeaderCmd(hash string, filterType *uint8) *GetCFilterHeaderCmd {
+	return &GetCFilterHeaderCmd{
+		Hash:       hash,
+		FilterType: filterType,
+	}
+}
+
 // GetChainTipsCmd defines the getchaintips JSON-RPC command.
 type GetChainTipsCmd struct{}
 
@@ -511,6 +568,19 @@ func NewGetTxOutSetInfoCmd() *GetTxOutSetInfoCmd {
 	return &GetTxOutSetInfoCmd{}
 }
 
+// GetTxStatusCmd defines the gettxstatus JSON-RPC command.
+type GetTxStatusCmd struct {
+	Txid string
+}
+
+// NewGetTxStatusCmd returns a new instance which can be used to issue a
+// gettxstatus JSON-RPC command.
+func NewGetTxStatusCmd(txHash string) *GetTxStatusCmd {
+	return &GetTxStatusCmd{
+		Txid: txHash,
+	}
+}
+
 // GetWorkCmd defines the getwork JSON-RPC command.
 type GetWorkCmd struct {
 	Data *string
@@ -596,6 +666,62 @@ type GetAddressTxIdsCmd struct {
 	Request *AddressTxRequest
 }
 
+// GetAddressBalanceCmd defines the getaddressbalance JSON-RPC command.
+type GetAddressBalanceCmd struct {
+	Request *AddressRequest
+}
+
+// NewGetAddressBalanceCmd returns a new instance which can be used to issue a
+// getaddressbalance JSON-RPC command.
+func NewGetAddressBalanceCmd(addresses []string) *GetAddressBalanceCmd {
+	return &GetAddressBalanceCmd{
+		Request: &AddressRequest{Addresses: addresses},
+	}
+}
+
+// GetAddressDeltasCmd defines the getaddressdeltas JSON-RPC command.
+type GetAddressDeltasCmd struct {
+	Request *AddressTxRequest
+}
+
+// NewGetAddressDeltasCmd returns a new instance which can be used to issue a
+// getaddressdeltas JSON-RPC command.
+func NewGetAddressDeltasCmd(addresses []string, start, end uint32) *GetAddressDeltasCmd {
+	return &GetAddressDeltasCmd{
+		Request: &AddressTxRequest{
+			Addresses: addresses,
+			Start:     start,
+			End:       end,
+		},
+	}
+}
+
+// GetAddressMempoolCmd defines the getaddressmempool JSON-RPC command.
+type GetAddressMempoolCmd struct {
+	Request *AddressRequest
+}
+
+// NewGetAddressMempoolCmd returns a new instance which can be used to issue a
+// getaddressmempool JSON-RPC command.
+func NewGetAddressMempoolCmd(addresses []string) *GetAddressMempoolCmd {
+	return &GetAddressMempoolCmd{
+		Request: &AddressRequest{Addresses: addresses},
+	}
+}
+
+// GetAddressUtxosCmd defines the getaddressutxos JSON-RPC command.
+type GetAddressUtxosCmd struct {
+	Request *AddressRequest
+}
+
+// NewGetAddressUtxosCmd returns a new instance which can be used to issue a
+// getaddressutxos JSON-RPC command.
+func NewGetAddressUtxosCmd(addresses []string) *GetAddressUtxosCmd {
+	return &GetAddressUtxosCmd{
+		Request: &AddressRequest{Addresses: addresses},
+	}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -694,6 +820,41 @@ func NewSubmitBlockCmd(hexBlock string, options *SubmitBlockOptions) *SubmitBloc
 	}
 }
 
+// TestMempoolAcceptCmd defines the testmempoolaccept JSON-RPC command.
+type TestMempoolAcceptCmd struct {
+	RawTxns []string
+}
+
+// NewTestMempoolAcceptCmd returns a new instance which can be used to issue a
+// testmempoolaccept JSON-RPC command.
+func NewTestMempoolAcceptCmd(rawTxns []string) *TestMempoolAcceptCmd {
+	return &TestMempoolAcceptCmd{
+		RawTxns: rawTxns,
+	}
+}
+
+// TraceTxInputCmd defines the tracetxinput JSON-RPC command.
+type TraceTxInputCmd struct {
+	HexTx      string
+	Index      uint32
+	PrevScript *string
+	Amount     *float64
+}
+
+// NewTraceTxInputCmd returns a new instance which can be used to issue a
+// tracetxinput JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewTraceTxInputCmd(hexTx string, index uint32, prevScript *string, amount *float64) *TraceTxInputCmd {
+	return &TraceTxInputCmd{
+		HexTx:      hexTx,
+		Index:      index,
+		PrevScript: prevScript,
+		Amount:     amount,
+	}
+}
+
 // ValidateAddressCmd defines the validateaddress JSON-RPC command.
 type ValidateAddressCmd struct {
 	Address string
@@ -763,9 +924,14 @@ func init() {
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
+	MustRegisterCmd("getaddressbalance", (*GetAddressBalanceCmd)(nil), flags)
+	MustRegisterCmd("getaddressdeltas", (*GetAddressDeltasCmd)(nil), flags)
+	MustRegisterCmd("getaddressmempool", (*GetAddressMempoolCmd)(nil), flags)
 	MustRegisterCmd("getaddresstxids", (*GetAddressTxIdsCmd)(nil), flags)
+	MustRegisterCmd("getaddressutxos", (*GetAddressUtxosCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getadmininfo", (*GetAdminInfoCmd)(nil), flags)
+	MustRegisterCmd("getadmintxproofs", (*GetAdminTxProofsCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
 	MustRegisterCmd("getblockchaininfo", (*GetBlockChainInfoCmd)(nil), flags)
@@ -773,6 +939,8 @@ func init() {
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
+	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
+	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
@@ -791,6 +959,7 @@ func init() {
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
+	MustRegisterCmd("gettxstatus", (*GetTxStatusCmd)(nil), flags)
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
@@ -802,6 +971,8 @@ func init() {
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
+	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
+	MustRegisterCmd("tracetxinput", (*TraceTxInputCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
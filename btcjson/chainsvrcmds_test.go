@@ -127,6 +127,70 @@ func TestChainSvrCmds(t *testing.T) {
 				Node: btcjson.String("127.0.0.1"),
 			},
 		},
+		{
+			name: "getaddressbalance",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressbalance",
+					&btcjson.AddressRequest{Addresses: []string{"addr"}})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressBalanceCmd([]string{"addr"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressbalance","params":[{"addresses":["addr"]}],"id":1}`,
+			unmarshalled: &btcjson.GetAddressBalanceCmd{
+				Request: &btcjson.AddressRequest{Addresses: []string{"addr"}},
+			},
+		},
+		{
+			name: "getaddressdeltas",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressdeltas",
+					&btcjson.AddressTxRequest{
+						Addresses: []string{"addr"},
+						Start:     1,
+						End:       2,
+					})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressDeltasCmd([]string{"addr"}, 1, 2)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressdeltas","params":[{"addresses":["addr"],"start":1,"end":2}],"id":1}`,
+			unmarshalled: &btcjson.GetAddressDeltasCmd{
+				Request: &btcjson.AddressTxRequest{
+					Addresses: []string{"addr"},
+					Start:     1,
+					End:       2,
+				},
+			},
+		},
+		{
+			name: "getaddressmempool",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressmempool",
+					&btcjson.AddressRequest{Addresses: []string{"addr"}})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressMempoolCmd([]string{"addr"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressmempool","params":[{"addresses":["addr"]}],"id":1}`,
+			unmarshalled: &btcjson.GetAddressMempoolCmd{
+				Request: &btcjson.AddressRequest{Addresses: []string{"addr"}},
+			},
+		},
+		{
+			name: "getaddressutxos",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressutxos",
+					&btcjson.AddressRequest{Addresses: []string{"addr"}})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressUtxosCmd([]string{"addr"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressutxos","params":[{"addresses":["addr"]}],"id":1}`,
+			unmarshalled: &btcjson.GetAddressUtxosCmd{
+				Request: &btcjson.AddressRequest{Addresses: []string{"addr"}},
+			},
+		},
 		{
 			name: "getadmininfo",
 			newCmd: func() (interface{}, error) {
@@ -138,6 +202,20 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getadmininfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetAdminInfoCmd{},
 		},
+		{
+			name: "getadmintxproofs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getadmintxproofs", 1, 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAdminTxProofsCmd(1, 100)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getadmintxproofs","params":[1,100],"id":1}`,
+			unmarshalled: &btcjson.GetAdminTxProofsCmd{
+				StartHeight: 1,
+				EndHeight:   100,
+			},
+		},
 		{
 			name: "getbestblockhash",
 			newCmd: func() (interface{}, error) {
@@ -328,6 +406,48 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "getcfilter",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcfilter", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCFilterCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getcfilter","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetCFilterCmd{
+				Hash:       "123",
+				FilterType: btcjson.Uint8(0),
+			},
+		},
+		{
+			name: "getcfilter optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcfilter", "123", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCFilterCmd("123", btcjson.Uint8(1))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getcfilter","params":["123",1],"id":1}`,
+			unmarshalled: &btcjson.GetCFilterCmd{
+				Hash:       "123",
+				FilterType: btcjson.Uint8(1),
+			},
+		},
+		{
+			name: "getcfilterheader",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcfilterheader", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCFilterHeaderCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getcfilterheader","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetCFilterHeaderCmd{
+				Hash:       "123",
+				FilterType: btcjson.Uint8(0),
+			},
+		},
 		{
 			name: "getchaintips",
 			newCmd: func() (interface{}, error) {
@@ -629,6 +749,19 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetTxOutSetInfoCmd{},
 		},
+		{
+			name: "gettxstatus",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxstatus", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetTxStatusCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxstatus","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetTxStatusCmd{
+				Txid: "123",
+			},
+		},
 		{
 			name: "getwork",
 			newCmd: func() (interface{}, error) {
@@ -970,6 +1103,50 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "testmempoolaccept",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("testmempoolaccept", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTestMempoolAcceptCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &btcjson.TestMempoolAcceptCmd{
+				RawTxns: []string{"1122", "3344"},
+			},
+		},
+		{
+			name: "tracetxinput",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("tracetxinput", "0102", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTraceTxInputCmd("0102", 1, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"tracetxinput","params":["0102",1],"id":1}`,
+			unmarshalled: &btcjson.TraceTxInputCmd{
+				HexTx: "0102",
+				Index: 1,
+			},
+		},
+		{
+			name: "tracetxinput optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("tracetxinput", "0102", 1, "51", 0.5)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTraceTxInputCmd("0102", 1,
+					btcjson.String("51"), btcjson.Float64(0.5))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"tracetxinput","params":["0102",1,"51",0.5],"id":1}`,
+			unmarshalled: &btcjson.TraceTxInputCmd{
+				HexTx:      "0102",
+				Index:      1,
+				PrevScript: btcjson.String("51"),
+				Amount:     btcjson.Float64(0.5),
+			},
+		},
 		{
 			name: "validateaddress",
 			newCmd: func() (interface{}, error) {
@@ -57,11 +57,23 @@ type CreateMultiSigResult struct {
 
 // DecodeScriptResult models the data returned from the decodescript command.
 type DecodeScriptResult struct {
-	Asm       string   `json:"asm"`
-	ReqSigs   int32    `json:"reqSigs,omitempty"`
-	Type      string   `json:"type"`
-	Addresses []string `json:"addresses,omitempty"`
-	P2sh      string   `json:"p2sh"`
+	Asm          string        `json:"asm"`
+	ReqSigs      int32         `json:"reqSigs,omitempty"`
+	Type         string        `json:"type"`
+	Addresses    []string      `json:"addresses,omitempty"`
+	P2sh         string        `json:"p2sh"`
+	Thread       string        `json:"thread,omitempty"`
+	PubKeyHashes []string      `json:"pubkeyhashes,omitempty"`
+	KeyIDs       []KeyIDResult `json:"keyids,omitempty"`
+	AdminOp      string        `json:"adminOp,omitempty"`
+}
+
+// KeyIDResult models the data of the KeyIDs portion of the DecodeScriptResult.
+// The public key is empty if the KeyID is unregistered or has been revoked.
+type KeyIDResult struct {
+	KeyID  uint32 `json:"keyid"`
+	PubKey string `json:"pubkey,omitempty"`
+	Status string `json:"status"`
 }
 
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
@@ -78,6 +90,46 @@ type GetAddedNodeInfoResult struct {
 	Addresses *[]GetAddedNodeInfoResultAddr `json:"addresses,omitempty"`
 }
 
+// GetAddressBalanceResult models the data from the getaddressbalance command.
+type GetAddressBalanceResult struct {
+	Balance  int64 `json:"balance"`
+	Received int64 `json:"received"`
+}
+
+// AddressDeltaResult models a change of the balance of an address returned
+// from the getaddressdeltas command.
+type AddressDeltaResult struct {
+	Atoms      int64  `json:"atoms"`
+	Txid       string `json:"txid"`
+	Index      uint32 `json:"index"`
+	BlockIndex uint32 `json:"blockindex"`
+	Height     uint32 `json:"height"`
+	Address    string `json:"address"`
+}
+
+// AddressMempoolDeltaResult models an unconfirmed change of the balance of an
+// address returned from the getaddressmempool command.
+type AddressMempoolDeltaResult struct {
+	Address   string  `json:"address"`
+	Txid      string  `json:"txid"`
+	Index     uint32  `json:"index"`
+	Atoms     int64   `json:"atoms"`
+	Timestamp int64   `json:"timestamp"`
+	PrevTxid  string  `json:"prevtxid,omitempty"`
+	PrevOut   *uint32 `json:"prevout,omitempty"`
+}
+
+// AddressUtxoResult models an unspent output of an address returned from the
+// getaddressutxos command.
+type AddressUtxoResult struct {
+	Address     string `json:"address"`
+	Txid        string `json:"txid"`
+	OutputIndex uint32 `json:"outputIndex"`
+	Script      string `json:"script"`
+	Atoms       int64  `json:"atoms"`
+	Height      uint32 `json:"height"`
+}
+
 // ASPKeyIdResult models the data of the ASPKeys portion of the
 // GetAdminInfoResult command.
 type ASPKeyIdResult struct {
@@ -106,6 +158,15 @@ type GetAdminInfoResult struct {
 	ASPKeys       []ASPKeyIdResult  `json:"aspkeys,omitempty"`
 }
 
+// GetAdminTxProofsResult models the data of a block with admin transactions
+// returned from the getadmintxproofs command.
+type GetAdminTxProofsResult struct {
+	Height       uint32   `json:"height"`
+	Hash         string   `json:"hash"`
+	Proof        string   `json:"proof"`
+	Transactions []string `json:"transactions"`
+}
+
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
@@ -269,6 +330,29 @@ type GetTxOutResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// GetTxStatusResult models the data from the gettxstatus command.  The status
+// is one of "mempool", "orphan", "rejected", "confirmed" or "unknown" and
+// determines which of the remaining fields are set.
+type GetTxStatusResult struct {
+	Txid           string   `json:"txid"`
+	HashWithSig    string   `json:"hashwithsig,omitempty"`
+	Status         string   `json:"status"`
+	MissingParents []string `json:"missingparents,omitempty"`
+	RejectCode     uint8    `json:"rejectcode,omitempty"`
+	RejectReason   string   `json:"rejectreason,omitempty"`
+	RejectTime     int64    `json:"rejecttime,omitempty"`
+	BlockHash      string   `json:"blockhash,omitempty"`
+	BlockHeight    uint32   `json:"blockheight,omitempty"`
+	Confirmations  int64    `json:"confirmations,omitempty"`
+}
+
+// VerifyTxOutProofResult models the data of each transaction returned from the
+// verifytxoutproof command.
+type VerifyTxOutProofResult struct {
+	Txid        string `json:"txid"`
+	HashWithSig string `json:"hashwithsig"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
 	TotalBytesRecv uint64 `json:"totalbytesrecv"`
@@ -442,6 +526,7 @@ type NetworksResult struct {
 type TxRawResult struct {
 	Hex           string `json:"hex"`
 	Txid          string `json:"txid"`
+	HashWithSig   string `json:"hashwithsig"`
 	Version       int32  `json:"version"`
 	LockTime      uint32 `json:"locktime"`
 	Vin           []Vin  `json:"vin"`
@@ -457,6 +542,7 @@ type TxRawResult struct {
 type SearchRawTransactionsResult struct {
 	Hex           string       `json:"hex,omitempty"`
 	Txid          string       `json:"txid"`
+	HashWithSig   string       `json:"hashwithsig"`
 	Version       int32        `json:"version"`
 	LockTime      uint32       `json:"locktime"`
 	Vin           []VinPrevOut `json:"vin"`
@@ -469,11 +555,56 @@ type SearchRawTransactionsResult struct {
 
 // TxRawDecodeResult models the data from the decoderawtransaction command.
 type TxRawDecodeResult struct {
-	Txid     string `json:"txid"`
-	Version  int32  `json:"version"`
-	Locktime uint32 `json:"locktime"`
-	Vin      []Vin  `json:"vin"`
-	Vout     []Vout `json:"vout"`
+	Txid        string `json:"txid"`
+	HashWithSig string `json:"hashwithsig"`
+	Version     int32  `json:"version"`
+	Locktime    uint32 `json:"locktime"`
+	Vin         []Vin  `json:"vin"`
+	Vout        []Vout `json:"vout"`
+}
+
+// TestMempoolAcceptResult models the data of a transaction returned from the
+// testmempoolaccept command.
+type TestMempoolAcceptResult struct {
+	Txid         string  `json:"txid"`
+	HashWithSig  string  `json:"hashwithsig"`
+	Allowed      bool    `json:"allowed"`
+	RejectCode   uint8   `json:"rejectcode,omitempty"`
+	RejectReason string  `json:"rejectreason,omitempty"`
+	Fee          float64 `json:"fee,omitempty"`
+	VSize        int64   `json:"vsize,omitempty"`
+}
+
+// TraceSigMatchResult models the data of a signature checked by an
+// OP_CHECKSAFEMULTISIG or OP_CHECKTHREAD of the tracetxinput command.
+type TraceSigMatchResult struct {
+	PubKey  string  `json:"pubkey"`
+	KeyHash string  `json:"keyhash,omitempty"`
+	KeyID   *uint32 `json:"keyid,omitempty"`
+	Valid   bool    `json:"valid"`
+}
+
+// TraceStepResult models the data of a single executed opcode of the
+// tracetxinput command.
+type TraceStepResult struct {
+	Script        int                   `json:"script"`
+	Offset        int                   `json:"offset"`
+	Opcode        string                `json:"opcode"`
+	Stack         []string              `json:"stack"`
+	AltStack      []string              `json:"altstack"`
+	StackAfter    []string              `json:"stackafter"`
+	AltStackAfter []string              `json:"altstackafter"`
+	SigMatches    []TraceSigMatchResult `json:"sigmatches,omitempty"`
+}
+
+// TraceTxInputResult models the data returned from the tracetxinput command.
+type TraceTxInputResult struct {
+	ScriptSig string            `json:"scriptsig"`
+	PkScript  string            `json:"pkscript"`
+	Executed  string            `json:"executed"`
+	Steps     []TraceStepResult `json:"steps"`
+	Valid     bool              `json:"valid"`
+	Error     string            `json:"error,omitempty"`
 }
 
 // ValidateAddressChainResult models the data returned by the chain server
@@ -75,6 +75,11 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// TxSigVariantNtfnMethod is the method used for notifications from the
+	// chain server that a transaction which only differs from one in the
+	// memory pool by its signatures has been received or confirmed.
+	TxSigVariantNtfnMethod = "txsigvariant"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +290,26 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// TxSigVariantNtfn defines the txsigvariant JSON-RPC notification.  The block
+// hash is only set when the variant was confirmed by a block.
+type TxSigVariantNtfn struct {
+	TxID            string
+	PoolHashWithSig string
+	HashWithSig     string
+	BlockHash       *string
+}
+
+// NewTxSigVariantNtfn returns a new instance which can be used to issue a
+// txsigvariant JSON-RPC notification.
+func NewTxSigVariantNtfn(txHash, poolHashWithSig, hashWithSig string, blockHash *string) *TxSigVariantNtfn {
+	return &TxSigVariantNtfn{
+		TxID:            txHash,
+		PoolHashWithSig: poolHashWithSig,
+		HashWithSig:     hashWithSig,
+		BlockHash:       blockHash,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +326,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(TxSigVariantNtfnMethod, (*TxSigVariantNtfn)(nil), flags)
 }
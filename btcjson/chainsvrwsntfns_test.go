@@ -185,12 +185,13 @@ func TestChainSvrWsNtfns(t *testing.T) {
 		{
 			name: "txacceptedverbose",
 			newNtfn: func() (interface{}, error) {
-				return btcjson.NewCmd("txacceptedverbose", `{"hex":"001122","txid":"123","version":1,"locktime":4294967295,"vin":null,"vout":null,"confirmations":0}`)
+				return btcjson.NewCmd("txacceptedverbose", `{"hex":"001122","txid":"123","hashwithsig":"456","version":1,"locktime":4294967295,"vin":null,"vout":null,"confirmations":0}`)
 			},
 			staticNtfn: func() interface{} {
 				txResult := btcjson.TxRawResult{
 					Hex:           "001122",
 					Txid:          "123",
+					HashWithSig:   "456",
 					Version:       1,
 					LockTime:      4294967295,
 					Vin:           nil,
@@ -199,11 +200,12 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				}
 				return btcjson.NewTxAcceptedVerboseNtfn(txResult)
 			},
-			marshalled: `{"jsonrpc":"1.0","method":"txacceptedverbose","params":[{"hex":"001122","txid":"123","version":1,"locktime":4294967295,"vin":null,"vout":null}],"id":null}`,
+			marshalled: `{"jsonrpc":"1.0","method":"txacceptedverbose","params":[{"hex":"001122","txid":"123","hashwithsig":"456","version":1,"locktime":4294967295,"vin":null,"vout":null}],"id":null}`,
 			unmarshalled: &btcjson.TxAcceptedVerboseNtfn{
 				RawTx: btcjson.TxRawResult{
 					Hex:           "001122",
 					Txid:          "123",
+					HashWithSig:   "456",
 					Version:       1,
 					LockTime:      4294967295,
 					Vin:           nil,
@@ -212,6 +214,39 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "txsigvariant",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txsigvariant", "123", "456", "789")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxSigVariantNtfn("123", "456", "789", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txsigvariant","params":["123","456","789"],"id":null}`,
+			unmarshalled: &btcjson.TxSigVariantNtfn{
+				TxID:            "123",
+				PoolHashWithSig: "456",
+				HashWithSig:     "789",
+				BlockHash:       nil,
+			},
+		},
+		{
+			name: "txsigvariant block",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txsigvariant", "123", "456", "789", "abc")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxSigVariantNtfn("123", "456", "789",
+					btcjson.String("abc"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txsigvariant","params":["123","456","789","abc"],"id":null}`,
+			unmarshalled: &btcjson.TxSigVariantNtfn{
+				TxID:            "123",
+				PoolHashWithSig: "456",
+				HashWithSig:     "789",
+				BlockHash:       btcjson.String("abc"),
+			},
+		},
 		{
 			name: "relevanttxaccepted",
 			newNtfn: func() (interface{}, error) {
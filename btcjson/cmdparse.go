@@ -67,6 +67,28 @@ func MarshalCmd(id interface{}, cmd interface{}) ([]byte, error) {
 	return json.Marshal(rawCmd)
 }
 
+// MarshalBatchCmd marshals the passed commands to a single JSON-RPC batch
+// request byte slice that is suitable for transmission to an RPC server.  The
+// ids and commands are paired by index, so both slices must be the same length.
+// Each provided command type must be a registered type.
+func MarshalBatchCmd(ids []interface{}, cmds []interface{}) ([]byte, error) {
+	if len(ids) != len(cmds) {
+		str := fmt.Sprintf("mismatched number of ids (%d) and commands "+
+			"(%d)", len(ids), len(cmds))
+		return nil, makeError(ErrInvalidType, str)
+	}
+
+	rawCmds := make([]json.RawMessage, 0, len(cmds))
+	for i, cmd := range cmds {
+		rawCmd, err := MarshalCmd(ids[i], cmd)
+		if err != nil {
+			return nil, err
+		}
+		rawCmds = append(rawCmds, rawCmd)
+	}
+	return json.Marshal(rawCmds)
+}
+
 // checkNumParams ensures the supplied number of params is at least the minimum
 // required number for the command and less than the maximum allowed.
 func checkNumParams(numParams int, info *methodInfo) error {
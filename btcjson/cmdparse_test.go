@@ -450,6 +450,72 @@ func TestMarshalCmdErrors(t *testing.T) {
 	}
 }
 
+// TestMarshalBatchCmd tests the MarshalBatchCmd function including its error
+// paths.
+func TestMarshalBatchCmd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		ids      []interface{}
+		cmds     []interface{}
+		expected string
+		err      error
+	}{
+		{
+			name:     "empty batch",
+			ids:      []interface{}{},
+			cmds:     []interface{}{},
+			expected: `[]`,
+		},
+		{
+			name: "two commands",
+			ids:  []interface{}{1, "two"},
+			cmds: []interface{}{
+				btcjson.NewGetBlockHashCmd(123),
+				btcjson.NewGetBlockCountCmd(),
+			},
+			expected: `[{"jsonrpc":"1.0","method":"getblockhash","params":[123],"id":1},` +
+				`{"jsonrpc":"1.0","method":"getblockcount","params":[],"id":"two"}]`,
+		},
+		{
+			name: "mismatched ids and commands",
+			ids:  []interface{}{1},
+			cmds: []interface{}{},
+			err:  btcjson.Error{ErrorCode: btcjson.ErrInvalidType},
+		},
+		{
+			name: "unregistered type",
+			ids:  []interface{}{1},
+			cmds: []interface{}{(*int)(nil)},
+			err:  btcjson.Error{ErrorCode: btcjson.ErrUnregisteredMethod},
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		marshalled, err := btcjson.MarshalBatchCmd(test.ids, test.cmds)
+		if test.err != nil {
+			jerr, ok := err.(btcjson.Error)
+			if !ok || jerr.ErrorCode != test.err.(btcjson.Error).ErrorCode {
+				t.Errorf("Test #%d (%s) wrong error - got %v, "+
+					"want %v", i, test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test #%d (%s) unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+		if string(marshalled) != test.expected {
+			t.Errorf("Test #%d (%s) mismatched result - got %s, "+
+				"want %s", i, test.name, marshalled,
+				test.expected)
+		}
+	}
+}
+
 // TestUnmarshalCmdErrors  tests the error paths of the UnmarshalCmd function.
 func TestUnmarshalCmdErrors(t *testing.T) {
 	t.Parallel()
@@ -52,6 +52,16 @@ func TestHelpers(t *testing.T) {
 				return &val
 			}(),
 		},
+		{
+			name: "uint8",
+			f: func() interface{} {
+				return btcjson.Uint8(5)
+			},
+			expected: func() interface{} {
+				val := uint8(5)
+				return &val
+			}(),
+		},
 		{
 			name: "int32",
 			f: func() interface{} {
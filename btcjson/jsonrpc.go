@@ -6,6 +6,7 @@
 package btcjson
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -149,3 +150,46 @@ func MarshalResponse(id interface{}, result interface{}, rpcErr *RPCError) ([]by
 	}
 	return json.Marshal(&response)
 }
+
+// IsBatchRequest returns whether the passed raw JSON-RPC message is a batch of
+// requests, which is encoded as a JSON array instead of a single JSON object.
+func IsBatchRequest(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '['
+}
+
+// MarshalBatchResponse combines the passed individually marshalled JSON-RPC
+// responses into a single JSON-RPC batch response byte slice.  Nil entries,
+// such as those for notifications which must not be responded to, are skipped.
+// A nil slice is returned when there are no responses to send.
+func MarshalBatchResponse(responses [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, response := range responses {
+		if response == nil {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(response)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// UnmarshalBatchResponse unmarshals the passed JSON-RPC batch response byte
+// slice into the individual responses it contains.  Note that servers are free
+// to return the responses in any order, so callers must match them to their
+// requests by ID.
+func UnmarshalBatchResponse(data []byte) ([]Response, error) {
+	var responses []Response
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
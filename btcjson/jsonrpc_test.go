@@ -99,6 +99,72 @@ func TestMarshalResponse(t *testing.T) {
 	}
 }
 
+// TestBatchResponse ensures the batch request and response helpers work as
+// expected.
+func TestBatchResponse(t *testing.T) {
+	t.Parallel()
+
+	isBatchTests := []struct {
+		data    string
+		isBatch bool
+	}{
+		{`[{"method":"getblockcount"}]`, true},
+		{" \r\n\t[]", true},
+		{`{"method":"getblockcount"}`, false},
+		{``, false},
+	}
+	for i, test := range isBatchTests {
+		if btcjson.IsBatchRequest([]byte(test.data)) != test.isBatch {
+			t.Errorf("IsBatchRequest #%d (%q) mismatched result - "+
+				"want %v", i, test.data, test.isBatch)
+		}
+	}
+
+	// Nil responses, as used for notifications, must be skipped.
+	first, err := btcjson.MarshalResponse(1, true, nil)
+	if err != nil {
+		t.Fatalf("MarshalResponse: unexpected error: %v", err)
+	}
+	second, err := btcjson.MarshalResponse("two", nil,
+		btcjson.ErrRPCMethodNotFound)
+	if err != nil {
+		t.Fatalf("MarshalResponse: unexpected error: %v", err)
+	}
+	batch := btcjson.MarshalBatchResponse([][]byte{first, nil, second})
+	want := `[{"result":true,"error":null,"id":1},` +
+		`{"result":null,"error":{"code":-32601,"message":"Method not found"},"id":"two"}]`
+	if string(batch) != want {
+		t.Fatalf("MarshalBatchResponse: mismatched result - got %s, "+
+			"want %s", batch, want)
+	}
+	if got := btcjson.MarshalBatchResponse([][]byte{nil}); got != nil {
+		t.Fatalf("MarshalBatchResponse: got %s for notification only "+
+			"batch, want nil", got)
+	}
+
+	responses, err := btcjson.UnmarshalBatchResponse(batch)
+	if err != nil {
+		t.Fatalf("UnmarshalBatchResponse: unexpected error: %v", err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("UnmarshalBatchResponse: got %d responses, want 2",
+			len(responses))
+	}
+	if string(responses[0].Result) != "true" || responses[0].Error != nil {
+		t.Errorf("UnmarshalBatchResponse: mismatched first response "+
+			"%+v", responses[0])
+	}
+	if responses[1].Error == nil ||
+		responses[1].Error.Code != btcjson.ErrRPCMethodNotFound.Code {
+		t.Errorf("UnmarshalBatchResponse: mismatched second response "+
+			"%+v", responses[1])
+	}
+	if _, err := btcjson.UnmarshalBatchResponse([]byte(`{}`)); err == nil {
+		t.Errorf("UnmarshalBatchResponse: did not receive error for " +
+			"non-batch response")
+	}
+}
+
 // TestMiscErrors tests a few error conditions not covered elsewhere.
 func TestMiscErrors(t *testing.T) {
 	t.Parallel()
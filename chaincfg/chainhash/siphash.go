@@ -0,0 +1,69 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainhash
+
+import "encoding/binary"
+
+// rotl64 rotates x left by n bits.
+func rotl64(x uint64, n uint) uint64 {
+	return x<<n | x>>(64-n)
+}
+
+// sipRound performs a single SipHash round on the passed state.
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = rotl64(v1, 13)
+	v1 ^= v0
+	v0 = rotl64(v0, 32)
+	v2 += v3
+	v3 = rotl64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = rotl64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = rotl64(v1, 17)
+	v1 ^= v2
+	v2 = rotl64(v2, 32)
+	return v0, v1, v2, v3
+}
+
+// SipHash24 returns the SipHash-2-4 of the passed data using the 128-bit key
+// made up of k0 and k1.  It is used by BIP0152 to calculate short transaction
+// ids and by BIP0158 to map items to the values in a filter.
+func SipHash24(k0, k1 uint64, data []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	// Compress every full 8-byte word.
+	last := uint64(len(data)) << 56
+	for len(data) >= 8 {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+		data = data[8:]
+	}
+
+	// Compress the final word which holds the remaining bytes along with
+	// the length of the data.
+	for i, b := range data {
+		last |= uint64(b) << (8 * uint(i))
+	}
+	v3 ^= last
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= last
+
+	// Finalize.
+	v2 ^= 0xff
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	return v0 ^ v1 ^ v2 ^ v3
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainhash
+
+import "testing"
+
+// TestSipHash24 ensures the SipHash-2-4 implementation matches the reference
+// test vectors.
+func TestSipHash24(t *testing.T) {
+	k0 := uint64(0x0706050403020100)
+	k1 := uint64(0x0f0e0d0c0b0a0908)
+	data := make([]byte, 16)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	tests := []struct {
+		len  int
+		want uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{8, 0x93f5f5799a932462},
+		{15, 0xa129ca6149be45e5},
+	}
+
+	for _, test := range tests {
+		got := SipHash24(k0, k1, data[:test.len])
+		if got != test.want {
+			t.Errorf("SipHash24 of %d bytes: got %x, want %x",
+				test.len, got, test.want)
+		}
+	}
+}
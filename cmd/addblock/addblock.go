@@ -92,6 +92,19 @@ func realMain() error {
 	}
 	defer fi.Close()
 
+	// Verify the checksum of the file before importing any blocks from it.
+	hasChecksum, err := verifyChecksum(fi)
+	if err != nil {
+		log.Errorf("Failed to verify file %v: %v", cfg.InFile, err)
+		return err
+	}
+	if hasChecksum {
+		log.Info("Verified the checksum of the block file")
+	} else {
+		log.Warnf("The block file %v does not contain a checksum",
+			cfg.InFile)
+	}
+
 	// Create a block importer for the database and input file and start it.
 	// The done channel returned from start will contain an error if
 	// anything went wrong.
@@ -6,9 +6,12 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"runtime"
 	"sync"
 	"time"
 
@@ -22,6 +25,15 @@ import (
 
 var zeroHash = chainhash.Hash{}
 
+// queuedBlock houses a block read from the import file which is deserialized
+// by one of the deserialize workers while the blocks before it are processed.
+type queuedBlock struct {
+	serializedBlock []byte
+	block           *provautil.Block
+	err             error
+	done            chan struct{}
+}
+
 // importResults houses the stats and result as an import operation.
 type importResults struct {
 	blocksProcessed int64
@@ -35,13 +47,15 @@ type blockImporter struct {
 	db                database.DB
 	chain             *blockchain.BlockChain
 	r                 io.ReadSeeker
-	processQueue      chan []byte
+	deserializeQueue  chan *queuedBlock
+	processQueue      chan *queuedBlock
 	doneChan          chan bool
 	errChan           chan error
 	quit              chan struct{}
 	wg                sync.WaitGroup
 	blocksProcessed   int64
 	blocksImported    int64
+	blocksSkipped     int64
 	receivedLogBlocks int64
 	receivedLogTx     int64
 	lastHeight        int64
@@ -49,59 +63,153 @@ type blockImporter struct {
 	lastLogTime       time.Time
 }
 
-// readBlock reads the next block from the input file.
-func (bi *blockImporter) readBlock() ([]byte, error) {
-	// The block file format is:
-	//  <network> <block length> <serialized block>
-	var net uint32
-	err := binary.Read(bi.r, binary.LittleEndian, &net)
-	if err != nil {
-		if err != io.EOF {
-			return nil, err
+// verifyChecksum verifies the checksum record which terminates the files
+// written by the exportblocks command of dbtool against the contents of the
+// passed import file before seeking back to its start.  It returns whether the
+// file has a checksum record since older files do not have one.
+//
+// The checksum record consists of the network, a zero block length, and the
+// sha256 checksum of all of the block records, which excludes the header of
+// the checksum record itself.  It must be the last record of the file.
+func verifyChecksum(r io.ReadSeeker) (bool, error) {
+	hasher := sha256.New()
+	var record [8]byte
+	for {
+		if _, err := io.ReadFull(r, record[:]); err != nil {
+			if err != io.EOF {
+				return false, err
+			}
+
+			// The end of the file was reached without finding a
+			// checksum record.
+			_, err := r.Seek(0, io.SeekStart)
+			return false, err
 		}
 
-		// No block and no error means there are no more blocks to read.
-		return nil, nil
-	}
-	if net != uint32(activeNetParams.Net) {
-		return nil, fmt.Errorf("network mismatch -- got %x, want %x",
-			net, uint32(activeNetParams.Net))
-	}
+		blockLen := binary.LittleEndian.Uint32(record[4:8])
+		if blockLen != 0 {
+			hasher.Write(record[:])
+			if blockLen > wire.MaxBlockPayload {
+				return false, fmt.Errorf("block payload of %d "+
+					"bytes is larger than the max allowed "+
+					"%d bytes", blockLen, wire.MaxBlockPayload)
+			}
+			_, err := io.CopyN(hasher, r, int64(blockLen))
+			if err == io.EOF {
+				return false, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
 
-	// Read the block length and ensure it is sane.
-	var blockLen uint32
-	if err := binary.Read(bi.r, binary.LittleEndian, &blockLen); err != nil {
-		return nil, err
-	}
-	if blockLen > wire.MaxBlockPayload {
-		return nil, fmt.Errorf("block payload of %d bytes is larger "+
-			"than the max allowed %d bytes", blockLen,
-			wire.MaxBlockPayload)
+		var checksum [sha256.Size]byte
+		if _, err := io.ReadFull(r, checksum[:]); err != nil {
+			return false, err
+		}
+		if !bytes.Equal(checksum[:], hasher.Sum(nil)) {
+			return false, fmt.Errorf("checksum mismatch -- got %x, "+
+				"want %x", hasher.Sum(nil), checksum)
+		}
+		if _, err := r.Read(record[:1]); err != io.EOF {
+			return false, fmt.Errorf("unexpected data after the " +
+				"checksum record")
+		}
+		_, err := r.Seek(0, io.SeekStart)
+		return true, err
 	}
+}
 
-	serializedBlock := make([]byte, blockLen)
-	if _, err := io.ReadFull(bi.r, serializedBlock); err != nil {
-		return nil, err
-	}
+// readBlock reads the next block from the input file.  Blocks which are
+// already known are skipped by only reading their header, which allows an
+// interrupted import to resume from the current chain tip without processing
+// all of the blocks before it again.
+func (bi *blockImporter) readBlock() ([]byte, error) {
+	for {
+		// The block file format is:
+		//  <network> <block length> <serialized block>
+		var net uint32
+		err := binary.Read(bi.r, binary.LittleEndian, &net)
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+
+			// No block and no error means there are no more blocks
+			// to read.
+			return nil, nil
+		}
+		if net != uint32(activeNetParams.Net) {
+			return nil, fmt.Errorf("network mismatch -- got %x, "+
+				"want %x", net, uint32(activeNetParams.Net))
+		}
+
+		// Read the block length and ensure it is sane.  A zero block
+		// length marks the checksum record at the end of the file,
+		// which has already been verified.
+		var blockLen uint32
+		err = binary.Read(bi.r, binary.LittleEndian, &blockLen)
+		if err != nil {
+			return nil, err
+		}
+		if blockLen == 0 {
+			return nil, nil
+		}
+		if blockLen > wire.MaxBlockPayload {
+			return nil, fmt.Errorf("block payload of %d bytes is "+
+				"larger than the max allowed %d bytes",
+				blockLen, wire.MaxBlockPayload)
+		}
+		if blockLen < wire.MaxBlockHeaderPayload {
+			return nil, fmt.Errorf("block payload of %d bytes is "+
+				"smaller than a block header", blockLen)
+		}
 
-	return serializedBlock, nil
+		// Skip the rest of the block when it is already known.
+		serializedBlock := make([]byte, blockLen)
+		headerBytes := serializedBlock[:wire.MaxBlockHeaderPayload]
+		if _, err := io.ReadFull(bi.r, headerBytes); err != nil {
+			return nil, err
+		}
+		var header wire.BlockHeader
+		err = header.Deserialize(bytes.NewReader(headerBytes))
+		if err != nil {
+			return nil, err
+		}
+		blockHash := header.BlockHash()
+		exists, err := bi.chain.HaveBlock(&blockHash)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			remaining := int64(blockLen - wire.MaxBlockHeaderPayload)
+			_, err := bi.r.Seek(remaining, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			bi.blocksSkipped++
+			continue
+		}
+
+		_, err = io.ReadFull(bi.r, serializedBlock[len(headerBytes):])
+		if err != nil {
+			return nil, err
+		}
+		return serializedBlock, nil
+	}
 }
 
-// processBlock potentially imports the block into the database.  It first
-// deserializes the raw block while checking for errors.  Already known blocks
-// are skipped and orphan blocks are considered errors.  Finally, it runs the
+// processBlock potentially imports the passed block, which was deserialized
+// by a deserialize worker, into the database.  Already known blocks are
+// skipped and orphan blocks are considered errors.  Finally, it runs the
 // block through the chain rules to ensure it follows all rules and matches
 // up to the known checkpoint.  Returns whether the block was imported along
 // with any potential errors.
-func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
-	// Deserialize the block which includes checks for malformed blocks.
-	block, err := provautil.NewBlockFromBytes(serializedBlock)
-	if err != nil {
-		return false, err
-	}
-
+func (bi *blockImporter) processBlock(block *provautil.Block) (bool, error) {
 	// update progress statistics
 	bi.lastBlockTime = block.MsgBlock().Header.Timestamp
+	bi.lastHeight = int64(block.MsgBlock().Header.Height)
 	bi.receivedLogTx += int64(len(block.MsgBlock().Transactions))
 
 	// Skip blocks that already exist.
@@ -149,7 +257,9 @@ func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
 
 // readHandler is the main handler for reading blocks from the import file.
 // This allows block processing to take place in parallel with block reads.
-// It must be run as a goroutine.
+// Each block is queued for deserialization and for processing, which ensures
+// the blocks are processed in the order of the file while they are
+// deserialized in parallel.  It must be run as a goroutine.
 func (bi *blockImporter) readHandler() {
 out:
 	for {
@@ -167,20 +277,48 @@ out:
 			break out
 		}
 
-		// Send the block or quit if we've been signalled to exit by
+		// Queue the block or quit if we've been signalled to exit by
 		// the status handler due to an error elsewhere.
+		qb := &queuedBlock{
+			serializedBlock: serializedBlock,
+			done:            make(chan struct{}),
+		}
+		select {
+		case bi.processQueue <- qb:
+		case <-bi.quit:
+			break out
+		}
 		select {
-		case bi.processQueue <- serializedBlock:
+		case bi.deserializeQueue <- qb:
 		case <-bi.quit:
 			break out
 		}
 	}
 
-	// Close the processing channel to signal no more blocks are coming.
+	// Close the queues to signal no more blocks are coming.
+	close(bi.deserializeQueue)
 	close(bi.processQueue)
 	bi.wg.Done()
 }
 
+// deserializeHandler deserializes the queued blocks, which includes checks for
+// malformed blocks and calculating the hashes of their transactions, so that
+// this work is not done while processing the blocks.  Multiple handlers run in
+// parallel.  It must be run as a goroutine.
+func (bi *blockImporter) deserializeHandler() {
+	for qb := range bi.deserializeQueue {
+		qb.block, qb.err = provautil.NewBlockFromBytes(qb.serializedBlock)
+		if qb.err == nil {
+			for _, tx := range qb.block.Transactions() {
+				tx.Hash()
+			}
+		}
+		qb.serializedBlock = nil
+		close(qb.done)
+	}
+	bi.wg.Done()
+}
+
 // logProgress logs block progress as an information message.  In order to
 // prevent spam, it limits logging to one message every cfg.Progress seconds
 // with duration and totals included.
@@ -222,15 +360,25 @@ func (bi *blockImporter) processHandler() {
 out:
 	for {
 		select {
-		case serializedBlock, ok := <-bi.processQueue:
+		case qb, ok := <-bi.processQueue:
 			// We're done when the channel is closed.
 			if !ok {
 				break out
 			}
 
+			// Wait for the block to be deserialized.
+			select {
+			case <-qb.done:
+			case <-bi.quit:
+				break out
+			}
+			if qb.err != nil {
+				bi.errChan <- qb.err
+				break out
+			}
+
 			bi.blocksProcessed++
-			bi.lastHeight++
-			imported, err := bi.processBlock(serializedBlock)
+			imported, err := bi.processBlock(qb.block)
 			if err != nil {
 				bi.errChan <- err
 				break out
@@ -258,7 +406,7 @@ func (bi *blockImporter) statusHandler(resultsChan chan *importResults) {
 	// caller with the error and signal all goroutines to quit.
 	case err := <-bi.errChan:
 		resultsChan <- &importResults{
-			blocksProcessed: bi.blocksProcessed,
+			blocksProcessed: bi.blocksProcessed + bi.blocksSkipped,
 			blocksImported:  bi.blocksImported,
 			err:             err,
 		}
@@ -267,7 +415,7 @@ func (bi *blockImporter) statusHandler(resultsChan chan *importResults) {
 	// The import finished normally.
 	case <-bi.doneChan:
 		resultsChan <- &importResults{
-			blocksProcessed: bi.blocksProcessed,
+			blocksProcessed: bi.blocksProcessed + bi.blocksSkipped,
 			blocksImported:  bi.blocksImported,
 			err:             nil,
 		}
@@ -278,10 +426,15 @@ func (bi *blockImporter) statusHandler(resultsChan chan *importResults) {
 // associated with the block importer to the database.  It returns a channel
 // on which the results will be returned when the operation has completed.
 func (bi *blockImporter) Import() chan *importResults {
-	// Start up the read and process handling goroutines.  This setup allows
-	// blocks to be read from disk in parallel while being processed.
-	bi.wg.Add(2)
+	// Start up the read, deserialize and process handling goroutines.  This
+	// setup allows blocks to be read from disk and deserialized in parallel
+	// while being processed.
+	numWorkers := runtime.NumCPU()
+	bi.wg.Add(numWorkers + 2)
 	go bi.readHandler()
+	for i := 0; i < numWorkers; i++ {
+		go bi.deserializeHandler()
+	}
 	go bi.processHandler()
 
 	// Wait for the import to finish in a separate goroutine and signal
@@ -322,7 +475,8 @@ func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
 	}
 	if cfg.AddrIndex {
 		log.Info("Address index is enabled")
-		indexes = append(indexes, indexers.NewAddrIndex(db, activeNetParams))
+		indexes = append(indexes, indexers.NewAddrIndex(db, activeNetParams),
+			indexers.NewAddrUtxoIndex(db, activeNetParams))
 	}
 
 	// Create an index manager if any of the optional indexes are enabled.
@@ -341,14 +495,24 @@ func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
 		return nil, err
 	}
 
+	// Log where the import resumes when the chain already contains blocks
+	// since the known blocks of the import file are skipped.
+	best := chain.BestSnapshot()
+	if best.Height > 0 {
+		log.Infof("Resuming import after block %v (height %d)",
+			best.Hash, best.Height)
+	}
+
+	queueSize := 2 * runtime.NumCPU()
 	return &blockImporter{
-		db:           db,
-		r:            r,
-		processQueue: make(chan []byte, 2),
-		doneChan:     make(chan bool),
-		errChan:      make(chan error),
-		quit:         make(chan struct{}),
-		chain:        chain,
-		lastLogTime:  time.Now(),
+		db:               db,
+		r:                r,
+		deserializeQueue: make(chan *queuedBlock, queueSize),
+		processQueue:     make(chan *queuedBlock, queueSize),
+		doneChan:         make(chan bool),
+		errChan:          make(chan error),
+		quit:             make(chan struct{}),
+		chain:            chain,
+		lastLogTime:      time.Now(),
 	}, nil
 }
@@ -0,0 +1,182 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+	flags "github.com/btcsuite/go-flags"
+)
+
+// config defines the configuration options for tracetxinput.
+type config struct {
+	Tx            string   `long:"tx" description:"Serialized, hex-encoded transaction" required:"true"`
+	Index         uint32   `short:"i" long:"index" description:"The index of the input to trace"`
+	PrevScript    string   `long:"prevscript" description:"Hex-encoded public key script of the output spent by the input" required:"true"`
+	Amount        float64  `long:"amount" description:"Amount of the output spent by the input in RMG"`
+	KeyIDs        []string `long:"keyid" description:"ASP key registered for a KeyID in the form <keyid>:<hex pubkey>"`
+	RootKeys      []string `long:"rootkey" description:"Hex-encoded public key of the root thread"`
+	ProvisionKeys []string `long:"provisionkey" description:"Hex-encoded public key of the provision thread"`
+	IssueKeys     []string `long:"issuekey" description:"Hex-encoded public key of the issue thread"`
+}
+
+// loadKeyView returns a key view with the ASP keys and admin keys provided
+// on the command line.
+func loadKeyView(cfg *config) (*blockchain.KeyViewpoint, error) {
+	keyIdMap := make(btcec.KeyIdMap)
+	for _, keyIDStr := range cfg.KeyIDs {
+		parts := strings.SplitN(keyIDStr, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed keyid %q", keyIDStr)
+		}
+		keyID, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed keyid %q: %v",
+				keyIDStr, err)
+		}
+		keySet, err := btcec.ParsePubKeySet(btcec.S256(), parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed keyid %q: %v",
+				keyIDStr, err)
+		}
+		keyIdMap[btcec.KeyID(keyID)] = &keySet[0]
+	}
+
+	adminKeySets := make(map[btcec.KeySetType]btcec.PublicKeySet)
+	for keySetType, pubKeys := range map[btcec.KeySetType][]string{
+		btcec.RootKeySet:      cfg.RootKeys,
+		btcec.ProvisionKeySet: cfg.ProvisionKeys,
+		btcec.IssueKeySet:     cfg.IssueKeys,
+	} {
+		keySet, err := btcec.ParsePubKeySet(btcec.S256(), pubKeys...)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %v key: %v",
+				keySetType, err)
+		}
+		adminKeySets[keySetType] = keySet
+	}
+
+	keyView := blockchain.NewKeyViewpoint()
+	keyView.SetKeyIDs(keyIdMap)
+	keyView.SetKeys(adminKeySets)
+	return keyView, nil
+}
+
+// encodeStack returns the hex-encoded items of the passed stack.
+func encodeStack(stack [][]byte) []string {
+	items := make([]string, len(stack))
+	for i, item := range stack {
+		items[i] = hex.EncodeToString(item)
+	}
+	return items
+}
+
+// traceTxInput executes the scripts of the configured transaction input and
+// returns the trace in the same form as the tracetxinput RPC.
+func traceTxInput(cfg *config) (*btcjson.TraceTxInputResult, error) {
+	serializedTx, err := hex.DecodeString(cfg.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("malformed transaction: %v", err)
+	}
+	var mtx wire.MsgTx
+	if err := mtx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, fmt.Errorf("malformed transaction: %v", err)
+	}
+	if int(cfg.Index) >= len(mtx.TxIn) {
+		return nil, fmt.Errorf("input index %d does not exist for "+
+			"transaction with %d inputs", cfg.Index, len(mtx.TxIn))
+	}
+	pkScript, err := hex.DecodeString(cfg.PrevScript)
+	if err != nil {
+		return nil, fmt.Errorf("malformed previous script: %v", err)
+	}
+	amount, err := provautil.NewAmount(cfg.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount: %v", err)
+	}
+	keyView, err := loadKeyView(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, err := blockchain.TraceInput(&mtx, int(cfg.Index), pkScript,
+		int64(amount), keyView, txscript.StandardVerifyFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &btcjson.TraceTxInputResult{
+		ScriptSig: hex.EncodeToString(mtx.TxIn[cfg.Index].SignatureScript),
+		PkScript:  hex.EncodeToString(pkScript),
+		Executed:  hex.EncodeToString(trace.PkScript),
+		Steps:     make([]btcjson.TraceStepResult, len(trace.Steps)),
+		Valid:     trace.Err == nil,
+	}
+	if trace.Err != nil {
+		result.Error = trace.Err.Error()
+	}
+	for i, step := range trace.Steps {
+		stepResult := btcjson.TraceStepResult{
+			Script:        step.ScriptIdx,
+			Offset:        step.ScriptOff,
+			Opcode:        step.Opcode,
+			Stack:         encodeStack(step.Stack),
+			AltStack:      encodeStack(step.AltStack),
+			StackAfter:    encodeStack(step.StackAfter),
+			AltStackAfter: encodeStack(step.AltStackAfter),
+		}
+		for _, match := range step.SigMatches {
+			matchResult := btcjson.TraceSigMatchResult{
+				PubKey:  hex.EncodeToString(match.PubKey),
+				KeyHash: hex.EncodeToString(match.KeyHash),
+				Valid:   match.Valid,
+			}
+			if keyID, ok := trace.KeyID(match.KeyHash); ok {
+				id := uint32(keyID)
+				matchResult.KeyID = &id
+			}
+			stepResult.SigMatches = append(stepResult.SigMatches,
+				matchResult)
+		}
+		result.Steps[i] = stepResult
+	}
+	return result, nil
+}
+
+func main() {
+	var cfg config
+	parser := flags.NewParser(&cfg, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		os.Exit(1)
+	}
+
+	result, err := traceTxInput(&cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(output))
+}
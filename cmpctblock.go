@@ -0,0 +1,145 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// errShortIDCollision is returned when a compact block can not be
+// reconstructed because two of its transactions, or two candidate
+// transactions, share a short id.  The full block must be requested instead.
+var errShortIDCollision = errors.New("short transaction id collision")
+
+// partialBlock houses a block which is being reconstructed from a cmpctblock
+// message along with the indexes of the transactions which are still missing.
+type partialBlock struct {
+	header  wire.BlockHeader
+	txns    []*wire.MsgTx
+	missing []uint32
+}
+
+// newPartialBlock starts reconstructing the block announced by the passed
+// cmpctblock message.  The prefilled transactions are placed at their indexes
+// and every other transaction is looked up by its short id among the passed
+// transactions, which are typically the contents of the memory pool.
+//
+// Since short ids are calculated from the hash of each transaction including
+// its signatures, a transaction in the memory pool which only differs from
+// the one in the block by its signatures is never matched.
+func newPartialBlock(msg *wire.MsgCmpctBlock, txDescs []*mempool.TxDesc) (*partialBlock, error) {
+	numTxns := msg.TxCount()
+	if numTxns == 0 {
+		return nil, errors.New("cmpctblock does not contain any " +
+			"transactions")
+	}
+
+	// Place the prefilled transactions.
+	txns := make([]*wire.MsgTx, numTxns)
+	for _, prefilled := range msg.PrefilledTxns {
+		if int(prefilled.Index) >= numTxns {
+			str := fmt.Sprintf("prefilled transaction index %d "+
+				"exceeds transaction count %d", prefilled.Index,
+				numTxns)
+			return nil, errors.New(str)
+		}
+		txns[prefilled.Index] = prefilled.Tx
+	}
+
+	// Map the remaining indexes by short id.  Two transactions in the block
+	// with the same short id can not be told apart.
+	shortIDIndexes := make(map[uint64]uint32, len(msg.ShortIDs))
+	shortIDs := msg.ShortIDs
+	for i := range txns {
+		if txns[i] != nil {
+			continue
+		}
+		shortID := shortIDs[0]
+		shortIDs = shortIDs[1:]
+		if _, exists := shortIDIndexes[shortID]; exists {
+			return nil, errShortIDCollision
+		}
+		shortIDIndexes[shortID] = uint32(i)
+	}
+
+	// Fill in the transactions which match a short id.  A short id which
+	// matches more than one candidate is ambiguous.
+	matched := make(map[uint64]struct{}, len(shortIDIndexes))
+	for _, txD := range txDescs {
+		shortID := msg.ShortTxID(txD.Tx.HashWithSig())
+		index, ok := shortIDIndexes[shortID]
+		if !ok {
+			continue
+		}
+		if _, exists := matched[shortID]; exists {
+			return nil, errShortIDCollision
+		}
+		matched[shortID] = struct{}{}
+		txns[index] = txD.Tx.MsgTx()
+	}
+
+	var missing []uint32
+	for i, tx := range txns {
+		if tx == nil {
+			missing = append(missing, uint32(i))
+		}
+	}
+
+	return &partialBlock{
+		header:  msg.Header,
+		txns:    txns,
+		missing: missing,
+	}, nil
+}
+
+// fill places the passed transactions, which must be sent in response to a
+// getblocktxn message for the missing indexes, into the block.
+func (pb *partialBlock) fill(txns []*wire.MsgTx) error {
+	if len(txns) != len(pb.missing) {
+		str := fmt.Sprintf("blocktxn contains %d transactions instead "+
+			"of the %d requested", len(txns), len(pb.missing))
+		return errors.New(str)
+	}
+	for i, index := range pb.missing {
+		pb.txns[index] = txns[i]
+	}
+	pb.missing = nil
+	return nil
+}
+
+// block returns the reconstructed block.  An error is returned when any
+// transactions are still missing or when the transactions do not match the
+// merkle root in the header, which happens when a short id matched the wrong
+// transaction.  Since the merkle root commits to the hashes of the
+// transactions both with and without signatures, a transaction with different
+// signatures is detected as well.
+func (pb *partialBlock) block() (*provautil.Block, error) {
+	if len(pb.missing) != 0 {
+		str := fmt.Sprintf("block is missing %d transactions",
+			len(pb.missing))
+		return nil, errors.New(str)
+	}
+
+	msgBlock := wire.NewMsgBlock(&pb.header)
+	for _, tx := range pb.txns {
+		if err := msgBlock.AddTransaction(tx); err != nil {
+			return nil, err
+		}
+	}
+	block := provautil.NewBlock(msgBlock)
+
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions())
+	calculatedMerkleRoot := merkles[len(merkles)-1]
+	if !pb.header.MerkleRoot.IsEqual(calculatedMerkleRoot) {
+		return nil, errShortIDCollision
+	}
+	return block, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// cmpctTestTx returns a transaction which spends the passed output with the
+// passed signature script.
+func cmpctTestTx(index uint32, sigScript []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	prevOut := wire.NewOutPoint(&chainhash.Hash{0x01}, index)
+	tx.AddTxIn(wire.NewTxIn(prevOut, sigScript))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	return tx
+}
+
+// cmpctTestDescs returns memory pool descriptors for the passed transactions.
+func cmpctTestDescs(txns ...*wire.MsgTx) []*mempool.TxDesc {
+	descs := make([]*mempool.TxDesc, 0, len(txns))
+	for _, tx := range txns {
+		descs = append(descs, &mempool.TxDesc{
+			TxDesc: mining.TxDesc{Tx: provautil.NewTx(tx)},
+		})
+	}
+	return descs
+}
+
+// TestPartialBlock ensures blocks are reconstructed from cmpctblock messages
+// and the memory pool as expected, including when the memory pool holds a
+// transaction which only differs from the one in the block by its signatures.
+func TestPartialBlock(t *testing.T) {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), []byte{0x01, 0x02}))
+	coinbase.AddTxOut(wire.NewTxOut(5000, []byte{0x51}))
+	tx1 := cmpctTestTx(0, []byte{0x01})
+	tx2 := cmpctTestTx(1, []byte{0x02})
+	tx2Variant := cmpctTestTx(1, []byte{0x03})
+	if tx2.TxHash() != tx2Variant.TxHash() {
+		t.Fatalf("signature variant has a different hash")
+	}
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{Version: 1})
+	for _, tx := range []*wire.MsgTx{coinbase, tx1, tx2} {
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		provautil.NewBlock(msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	cmpctBlock := wire.NewMsgCmpctBlock(msgBlock, 0x0102030405060708)
+	wantHash := msgBlock.BlockHash()
+
+	// All transactions are in the memory pool.
+	partial, err := newPartialBlock(cmpctBlock, cmpctTestDescs(tx2, tx1))
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if len(partial.missing) != 0 {
+		t.Fatalf("newPartialBlock: unexpected missing indexes %v",
+			partial.missing)
+	}
+	block, err := partial.block()
+	if err != nil {
+		t.Fatalf("block: unexpected error: %v", err)
+	}
+	if *block.Hash() != wantHash {
+		t.Fatalf("block: got hash %v, want %v", block.Hash(), wantHash)
+	}
+
+	// The memory pool only holds a signature variant of the second
+	// transaction, so it must be requested.
+	partial, err = newPartialBlock(cmpctBlock,
+		cmpctTestDescs(tx1, tx2Variant))
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if len(partial.missing) != 1 || partial.missing[0] != 2 {
+		t.Fatalf("newPartialBlock: got missing indexes %v, want [2]",
+			partial.missing)
+	}
+	if _, err := partial.block(); err == nil {
+		t.Fatalf("block: expected error for missing transactions")
+	}
+	if err := partial.fill(nil); err == nil {
+		t.Fatalf("fill: expected error for wrong transaction count")
+	}
+	if err := partial.fill([]*wire.MsgTx{tx2}); err != nil {
+		t.Fatalf("fill: unexpected error: %v", err)
+	}
+	block, err = partial.block()
+	if err != nil {
+		t.Fatalf("block: unexpected error: %v", err)
+	}
+	if *block.Hash() != wantHash {
+		t.Fatalf("block: got hash %v, want %v", block.Hash(), wantHash)
+	}
+
+	// A peer responding with the signature variant produces a block which
+	// does not match the merkle root.
+	partial, err = newPartialBlock(cmpctBlock, cmpctTestDescs(tx1))
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if err := partial.fill([]*wire.MsgTx{tx2Variant}); err != nil {
+		t.Fatalf("fill: unexpected error: %v", err)
+	}
+	if _, err := partial.block(); err != errShortIDCollision {
+		t.Fatalf("block: got error %v, want %v", err,
+			errShortIDCollision)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -21,11 +22,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/connmgr"
 	"github.com/bitgo/prova/database"
 	_ "github.com/bitgo/prova/database/ffldb"
+	_ "github.com/bitgo/prova/database/memdb"
 	"github.com/bitgo/prova/mempool"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
@@ -56,9 +59,11 @@ const (
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = mempool.MaxStandardTxSize
 	defaultSigCacheMaxSize       = 100000
+	defaultUtxoCacheMaxSizeMiB   = 250
 	sampleConfigFilename         = "sample-prova.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
+	minPruneTargetMiB            = 1024
 )
 
 var (
@@ -100,10 +105,17 @@ type config struct {
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	PeerEncryption       bool          `long:"peerencryption" description:"Encrypt connections to peers which also support the encrypted transport -- NOTE: Support is advertised in the unauthenticated version message, so an attacker on the network path can silently downgrade connections to plaintext unless --requireencryption or peer key authentication is used"`
+	PeerKey              string        `long:"peerkey" default-mask:"-" description:"Hex-encoded private key used to authenticate to peers over the encrypted transport -- NOTE: Implies --peerencryption"`
+	PeerAuthKeys         []string      `long:"peerauthkey" description:"Only keep connections to peers which authenticate with one of the specified hex-encoded public keys -- NOTE: Implies --peerencryption"`
+	PeerAuthValidateKeys bool          `long:"peerauthvalidatekeys" description:"Only keep connections to peers which authenticate with a key in the current validate key set, or one of the --peerauthkey keys, and disconnect peers whose key is removed from the set -- NOTE: Implies --peerencryption"`
+	RequireEncryption    bool          `long:"requireencryption" description:"Only keep connections to peers which negotiate the encrypted transport -- NOTE: Implies --peerencryption"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
+	RPCAuthUsers         []string      `long:"rpcauthuser" default-mask:"-" description:"Add an RPC user that may only call the listed methods in the form user:pass:method[,method...] -- Methods may use * and ? wildcards, for example get*"`
+	RPCAuthTokens        []string      `long:"rpcauthtoken" default-mask:"-" description:"Add an RPC API token, sent as an HTTP Bearer token, that may only call the listed methods in the form name:token:method[,method...] -- Methods may use * and ? wildcards, for example get*"`
 	RPCListeners         []string      `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
@@ -111,7 +123,7 @@ type config struct {
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
-	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
+	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass, rpclimituser/rpclimitpass, rpcauthuser or rpcauthtoken is specified"`
 	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
@@ -127,6 +139,7 @@ type config struct {
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
+	AssumeValid          string        `long:"assumevalid" description:"Skip script and signature verification of the ancestors of this block hash during the initial sync"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
@@ -143,11 +156,16 @@ type config struct {
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
+	UtxoCacheMaxSizeMiB  uint          `long:"utxocachemaxsize" description:"The maximum size in MiB of the UTXO cache"`
+	Prune                uint          `long:"prune" description:"Delete the oldest blocks once the stored blocks exceed the specified size in MiB while always keeping the most recent 288 blocks (0 to disable, minimum 1024) -- Not compatible with --txindex, --addrindex and --cfindex"`
+	CompressBlocks       bool          `long:"compressblocks" description:"Store new blocks compressed to reduce the disk space used by the block database -- Blocks stored before remain readable"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
-	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
-	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction and output index which makes the searchrawtransactions and address RPCs available"`
+	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction and output indexes from the database on start up and then exits."`
+	CfIndex              bool          `long:"cfindex" description:"Maintain an index of committed filters (BIP0158) which are served to peers and made available via the getcfilter RPC"`
+	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the committed filter index from the database on start up and then exits."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	EnableExternalRPC    bool          `long:"enableexternalrpc" description:"Allow external listening of the RPC API. This also requires that TLS is not disabled."`
@@ -155,8 +173,12 @@ type config struct {
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
 	miningAddrs          []provautil.Address
 	minRelayTxFee        provautil.Amount
+	rpcAuthUsers         []*rpcAuthUser
+	peerKey              *btcec.PrivateKey
+	peerAuthKeys         []*btcec.PublicKey
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -410,6 +432,7 @@ func loadConfig() (*config, []string, error) {
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		UtxoCacheMaxSizeMiB:  defaultUtxoCacheMaxSizeMiB,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
@@ -672,9 +695,21 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the additional RPC users and API tokens.
+	cfg.rpcAuthUsers, err = parseRPCAuthUsers(cfg.RPCAuthUsers,
+		cfg.RPCAuthTokens, cfg.RPCUser, cfg.RPCLimitUser)
+	if err != nil {
+		str := "%s: Error parsing --rpcauthuser or --rpcauthtoken: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// The RPC server is disabled if no username or password is provided.
 	if (cfg.RPCUser == "" || cfg.RPCPass == "") &&
-		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") {
+		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") &&
+		len(cfg.rpcAuthUsers) == 0 {
 		cfg.DisableRPC = true
 	}
 
@@ -760,6 +795,48 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --cfindex and --dropcfindex do not mix.
+	if cfg.CfIndex && cfg.DropCfIndex {
+		err := fmt.Errorf("%s: the --cfindex and --dropcfindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --cfindex and --droptxindex do not mix.
+	if cfg.CfIndex && cfg.DropTxIndex {
+		err := fmt.Errorf("%s: the --cfindex and --droptxindex "+
+			"options may not be activated at the same time "+
+			"because the committed filter index relies on the "+
+			"transaction index",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune requires a target of at least two block files.
+	if cfg.Prune != 0 && cfg.Prune < minPruneTargetMiB {
+		str := "%s: the --prune option must be 0 or at least %d MiB"
+		err := fmt.Errorf(str, funcName, minPruneTargetMiB)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --txindex, --addrindex or --cfindex do not mix.
+	if cfg.Prune != 0 && (cfg.TxIndex || cfg.AddrIndex || cfg.CfIndex) {
+		err := fmt.Errorf("%s: the --prune option may not be "+
+			"activated at the same time as the --txindex, "+
+			"--addrindex or --cfindex options because the indexes "+
+			"rely on all blocks being available", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]provautil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -792,6 +869,43 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the peer transport keys.
+	if cfg.PeerKey != "" {
+		keyBytes, err := hex.DecodeString(cfg.PeerKey)
+		if err != nil || len(keyBytes) != btcec.PrivKeyBytesLen {
+			str := "%s: --peerkey must be a hex-encoded %d byte " +
+				"private key"
+			err := fmt.Errorf(str, funcName, btcec.PrivKeyBytesLen)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.peerKey, _ = btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	}
+	cfg.peerAuthKeys = make([]*btcec.PublicKey, 0, len(cfg.PeerAuthKeys))
+	for _, strKey := range cfg.PeerAuthKeys {
+		keyBytes, err := hex.DecodeString(strKey)
+		var pubKey *btcec.PublicKey
+		if err == nil {
+			pubKey, err = btcec.ParsePubKey(keyBytes, btcec.S256())
+		}
+		if err != nil {
+			str := "%s: peer auth key '%s' failed to decode: %v"
+			err := fmt.Errorf(str, funcName, strKey, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.peerAuthKeys = append(cfg.peerAuthKeys, pubKey)
+	}
+
+	// Authenticating to or requiring authentication from peers is done over
+	// the encrypted transport.
+	if cfg.peerKey != nil || len(cfg.peerAuthKeys) > 0 ||
+		cfg.PeerAuthValidateKeys || cfg.RequireEncryption {
+		cfg.PeerEncryption = true
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
@@ -866,6 +980,18 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Check the assumed valid block hash for syntax errors.
+	if cfg.AssumeValid != "" {
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid block hash: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
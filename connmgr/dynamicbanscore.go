@@ -29,6 +29,33 @@ const (
 	precomputedLen = 64
 )
 
+// Persistent ban score increases for peers which relay blocks whose signer is
+// not allowed to sign them.  With the default ban threshold of 100, a single
+// block with an invalid signature or from an unauthorized validate key gets the
+// relaying peer banned.  Blocks from revoked or rate limited validate keys are
+// penalized less since they may have been valid on the chain the relaying peer
+// was following when it accepted them.
+const (
+	// BanScoreInvalidBlockSignature is the ban score increase for relaying
+	// a block whose header is not signed by its validating public key.
+	BanScoreInvalidBlockSignature = 100
+
+	// BanScoreUnauthorizedValidateKey is the ban score increase for
+	// relaying a block signed by a key which is not in the validate key
+	// set.
+	BanScoreUnauthorizedValidateKey = 100
+
+	// BanScoreRevokedValidateKey is the ban score increase for relaying a
+	// block signed by a validate key which was recently removed from the
+	// validate key set.
+	BanScoreRevokedValidateKey = 50
+
+	// BanScoreRateLimitedValidateKey is the ban score increase for
+	// relaying a block signed by a validate key which exceeded its allowed
+	// share of recent blocks.
+	BanScoreRateLimitedValidateKey = 20
+)
+
 // precomputedFactor stores precomputed exponential decay factors for the first
 // 'precomputedLen' seconds starting from t == 0.
 var precomputedFactor [precomputedLen]float64
@@ -0,0 +1,92 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/indexers"
+	"github.com/bitgo/prova/database"
+)
+
+// checkCmd defines the configuration options for the check command.
+type checkCmd struct {
+	Repair bool `long:"repair" description:"Repair the hash and height indexes, spend journal and key set when they are inconsistent and drop indexes with an invalid tip"`
+}
+
+var (
+	// checkCfg defines the configuration options for the command.
+	checkCfg = checkCmd{}
+)
+
+// checkDatabase checks the consistency of the chain state and the index tips
+// of the passed database and logs the results.
+func checkDatabase(db database.DB, repair bool) (*blockchain.DatabaseCheckResult, error) {
+	result, err := blockchain.CheckDatabase(db, activeNetParams, repair)
+	if err != nil {
+		return nil, err
+	}
+	if err := indexers.CheckIndexTips(db, result, repair); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Checked %d main chain blocks (%d pruned blocks)",
+		len(result.MainChain), result.NumPruned)
+	for _, desc := range result.Skipped {
+		log.Warnf("Skipped %s", desc)
+	}
+	for _, desc := range result.Discrepancies {
+		log.Errorf("Discrepancy: %s", desc)
+	}
+	for _, desc := range result.Repairs {
+		log.Infof("Repaired: %s", desc)
+	}
+	return result, nil
+}
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *checkCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	// Ensure the block database exists rather than creating a new one.
+	dbPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+	if !fileExists(dbPath) {
+		str := "The block database [%v] does not exist"
+		return fmt.Errorf(str, dbPath)
+	}
+
+	db, err := loadBlockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := checkDatabase(db, cmd.Repair)
+	if err != nil {
+		return err
+	}
+
+	// Check the database again after repairing it to report the
+	// discrepancies which could not be repaired.
+	if len(result.Repairs) > 0 {
+		log.Info("Checking the repaired database")
+		result, err = checkDatabase(db, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(result.Discrepancies) > 0 {
+		return fmt.Errorf("found %d discrepancies",
+			len(result.Discrepancies))
+	}
+	log.Info("No discrepancies found")
+	return nil
+}
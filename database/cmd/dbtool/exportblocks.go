@@ -0,0 +1,158 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+)
+
+// exportBlocksCmd defines the configuration options for the exportblocks
+// command.
+type exportBlocksCmd struct {
+	OutFile     string `short:"o" long:"outfile" description:"File to write the blocks to"`
+	StartHeight uint32 `long:"start" description:"Height of the first main chain block to export"`
+	EndHeight   int64  `long:"end" description:"Height of the last main chain block to export -- Use -1 for the best block"`
+	Progress    int    `short:"p" long:"progress" description:"Show a progress message each time this number of seconds have passed -- Use 0 to disable progress announcements"`
+}
+
+var (
+	// exportBlocksCfg defines the configuration options for the command.
+	exportBlocksCfg = exportBlocksCmd{
+		OutFile:   "bootstrap.dat",
+		EndHeight: -1,
+		Progress:  10,
+	}
+)
+
+// writeBlocks writes the main chain blocks in the passed height range to the
+// passed writer in the format of bootstrap files, which is the format the
+// addblock utility and the insecureimport command read, and terminates them
+// with a checksum record.  Each block record consists of the network, the
+// block length and the serialized block.  The checksum record consists of the
+// network, a zero block length, and the sha256 checksum of all of the block
+// records, which excludes the header of the checksum record itself.
+func writeBlocks(w io.Writer, chain *blockchain.BlockChain, startHeight, endHeight uint32, progress int) error {
+	hasher := sha256.New()
+	mw := io.MultiWriter(w, hasher)
+
+	var record [8]byte
+	binary.LittleEndian.PutUint32(record[0:4], uint32(activeNetParams.Net))
+	lastLogTime := time.Now()
+	for height := startHeight; height <= endHeight; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			return fmt.Errorf("unable to load block at height %d: "+
+				"%v", height, err)
+		}
+		serializedBlock, err := block.Bytes()
+		if err != nil {
+			return err
+		}
+
+		binary.LittleEndian.PutUint32(record[4:8],
+			uint32(len(serializedBlock)))
+		if _, err := mw.Write(record[:]); err != nil {
+			return err
+		}
+		if _, err := mw.Write(serializedBlock); err != nil {
+			return err
+		}
+
+		if progress > 0 && time.Since(lastLogTime) >=
+			time.Second*time.Duration(progress) {
+
+			log.Infof("Exported blocks up to height %d of %d",
+				height, endHeight)
+			lastLogTime = time.Now()
+		}
+	}
+
+	binary.LittleEndian.PutUint32(record[4:8], 0)
+	if _, err := w.Write(record[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(hasher.Sum(nil))
+	return err
+}
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *exportBlocksCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	// Ensure the block database exists rather than creating a new one.
+	dbPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+	if !fileExists(dbPath) {
+		str := "The block database [%v] does not exist"
+		return fmt.Errorf(str, dbPath)
+	}
+	if fileExists(cmd.OutFile) {
+		str := "The specified block file [%v] already exists"
+		return fmt.Errorf(str, cmd.OutFile)
+	}
+
+	// Load the block database and the chain state.
+	db, err := loadBlockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: activeNetParams,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	endHeight := chain.BestSnapshot().Height
+	if cmd.EndHeight >= 0 {
+		if cmd.EndHeight > int64(endHeight) {
+			return errors.New("the specified end height is after " +
+				"the best block")
+		}
+		endHeight = uint32(cmd.EndHeight)
+	}
+	if cmd.StartHeight > endHeight {
+		return errors.New("the specified start height is after the " +
+			"end height")
+	}
+
+	fo, err := os.Create(cmd.OutFile)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(fo)
+	err = writeBlocks(bw, chain, cmd.StartHeight, endHeight, cmd.Progress)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = fo.Close()
+	} else {
+		fo.Close()
+	}
+	if err != nil {
+		os.Remove(cmd.OutFile)
+		return err
+	}
+
+	log.Infof("Exported blocks %d through %d to %s", cmd.StartHeight,
+		endHeight, cmd.OutFile)
+	return nil
+}
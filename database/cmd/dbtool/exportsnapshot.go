@@ -0,0 +1,92 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitgo/prova/blockchain"
+)
+
+// exportSnapshotCmd defines the configuration options for the exportsnapshot
+// command.
+type exportSnapshotCmd struct {
+	OutFile string `short:"o" long:"outfile" description:"File to write the snapshot to"`
+	Height  int64  `long:"height" description:"Height of the main chain block to export the snapshot at -- Use -1 for the best block"`
+}
+
+var (
+	// exportSnapshotCfg defines the configuration options for the command.
+	exportSnapshotCfg = exportSnapshotCmd{
+		OutFile: "snapshot.dat",
+		Height:  -1,
+	}
+)
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *exportSnapshotCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	// Ensure the block database exists rather than creating a new one.
+	dbPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+	if !fileExists(dbPath) {
+		str := "The block database [%v] does not exist"
+		return fmt.Errorf(str, dbPath)
+	}
+	if fileExists(cmd.OutFile) {
+		str := "The specified snapshot file [%v] already exists"
+		return fmt.Errorf(str, cmd.OutFile)
+	}
+
+	// Load the block database and the chain state.
+	db, err := loadBlockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: activeNetParams,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	height := chain.BestSnapshot().Height
+	if cmd.Height >= 0 {
+		if cmd.Height > int64(height) {
+			return errors.New("the specified height is after the " +
+				"best block")
+		}
+		height = uint32(cmd.Height)
+	}
+
+	fo, err := os.Create(cmd.OutFile)
+	if err != nil {
+		return err
+	}
+	info, err := chain.ExportSnapshot(fo, height)
+	if err == nil {
+		err = fo.Close()
+	} else {
+		fo.Close()
+	}
+	if err != nil {
+		os.Remove(cmd.OutFile)
+		return err
+	}
+
+	log.Infof("Snapshot of block %v (height %d) written to %s", info.Hash,
+		info.Height, cmd.OutFile)
+	log.Infof("Snapshot content hash: %v", info.ContentHash)
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// importSnapshotCmd defines the configuration options for the importsnapshot
+// command.
+type importSnapshotCmd struct {
+	InFile      string `short:"i" long:"infile" description:"File containing the snapshot"`
+	ContentHash string `long:"contenthash" description:"Expected content hash of the snapshot, as reported when it was exported"`
+}
+
+var (
+	// importSnapshotCfg defines the configuration options for the command.
+	importSnapshotCfg = importSnapshotCmd{
+		InFile: "snapshot.dat",
+	}
+)
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *importSnapshotCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	// Ensure the specified snapshot file exists.
+	if !fileExists(cmd.InFile) {
+		str := "The specified snapshot file [%v] does not exist"
+		return fmt.Errorf(str, cmd.InFile)
+	}
+	var expectedHash *chainhash.Hash
+	if cmd.ContentHash != "" {
+		var err error
+		expectedHash, err = chainhash.NewHashFromStr(cmd.ContentHash)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Warnf("No content hash specified -- the snapshot is only " +
+			"checked for corruption and not against a trusted hash")
+	}
+
+	// The snapshot can only be imported into a new block database.
+	dbPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+	if fileExists(dbPath) {
+		str := "The block database [%v] already exists"
+		return fmt.Errorf(str, dbPath)
+	}
+	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
+		return err
+	}
+	db, err := database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Open(cmd.InFile)
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbPath)
+		return err
+	}
+	defer fi.Close()
+
+	// Remove the partially imported database when the import fails.
+	log.Infof("Importing snapshot into '%s'", dbPath)
+	info, err := blockchain.ImportSnapshot(db, activeNetParams, fi,
+		expectedHash)
+	db.Close()
+	if err != nil {
+		os.RemoveAll(dbPath)
+		return err
+	}
+
+	log.Infof("Imported snapshot of block %v (height %d) with %d utxo "+
+		"entries", info.Hash, info.Height, info.NumUtxos)
+	log.Infof("Snapshot content hash: %v", info.ContentHash)
+	return nil
+}
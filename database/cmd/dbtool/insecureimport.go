@@ -93,6 +93,13 @@ func (bi *blockImporter) readBlock() ([]byte, error) {
 			wire.MaxBlockPayload)
 	}
 
+	// A zero block length marks the checksum record which terminates the
+	// files written by the exportblocks command.  The checksum is verified
+	// by the addblock utility, so it is simply skipped here.
+	if blockLen == 0 {
+		return nil, nil
+	}
+
 	serializedBlock := make([]byte, blockLen)
 	if _, err := io.ReadFull(bi.r, serializedBlock); err != nil {
 		return nil, err
@@ -11,6 +11,8 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/indexers"
 	"github.com/bitgo/prova/database"
 	"github.com/btcsuite/btclog"
 	flags "github.com/btcsuite/go-flags"
@@ -68,6 +70,12 @@ func realMain() error {
 	dbLog := btclog.NewSubsystemLogger(backendLogger, "BCDB: ")
 	dbLog.SetLevel(btclog.DebugLvl)
 	database.UseLogger(dbLog)
+	chainLog := btclog.NewSubsystemLogger(backendLogger, "CHAN: ")
+	chainLog.SetLevel(btclog.InfoLvl)
+	blockchain.UseLogger(chainLog)
+	indxLog := btclog.NewSubsystemLogger(backendLogger, "INDX: ")
+	indxLog.SetLevel(btclog.InfoLvl)
+	indexers.UseLogger(indxLog)
 
 	// Setup the parser options and commands.
 	appName := filepath.Base(os.Args[0])
@@ -90,6 +98,37 @@ func realMain() error {
 	parser.AddCommand("fetchblockregion",
 		"Fetch the specified block region from the database", "",
 		&blockRegionCfg)
+	parser.AddCommand("exportsnapshot",
+		"Export the utxo set and admin state to a snapshot file",
+		"Export the utxo set and admin state as of a block of the "+
+			"main chain, along with the headers up to that block, "+
+			"to a snapshot file.  The content hash of the "+
+			"snapshot is reported so it can be verified when it "+
+			"is imported.", &exportSnapshotCfg)
+	parser.AddCommand("importsnapshot",
+		"Create a new block database from a snapshot file",
+		"Create a new block database from a snapshot file, so the "+
+			"node only has to download and validate the blocks "+
+			"after the snapshot block.  The blocks before it are "+
+			"not validated, so only import snapshots with a "+
+			"content hash from a trusted source.", &importSnapshotCfg)
+	parser.AddCommand("exportblocks",
+		"Export main chain blocks to a bootstrap file",
+		"Export the main chain blocks in a height range to a "+
+			"bootstrap file which can be imported with the "+
+			"addblock utility.  The file ends with a checksum of "+
+			"its contents which is verified by the import.",
+		&exportBlocksCfg)
+	parser.AddCommand("check",
+		"Check the consistency of the chain state in the database",
+		"Check that the block index agrees with the stored blocks, "+
+			"that the hash and height indexes and the spend "+
+			"journal agree with the main chain, that the key set "+
+			"matches the admin state recomputed from the genesis "+
+			"block, that the utxo set total matches the total "+
+			"supply, and that the index tips are in the main "+
+			"chain.  The discrepancies found are reported and the "+
+			"derived indexes are optionally repaired.", &checkCfg)
 
 	// Parse command line and invoke the Execute function for the specified
 	// command.
@@ -17,6 +17,9 @@ The default backend, ffldb, has a strong focus on speed, efficiency, and
 robustness.  It makes use leveldb for the metadata, flat files for block
 storage, and strict checksums in key areas to ensure data integrity.
 
+The memdb backend keeps both the metadata and the blocks in memory.  Nothing
+is written to disk, which makes it useful for tests and throwaway nodes.
+
 A quick overview of the features database provides are as follows:
 
  - Key/value metadata store
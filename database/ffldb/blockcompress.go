@@ -0,0 +1,127 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file contains the functions for compressing the blocks stored in the
+// flat files along with the cache of decompressed blocks used when reading
+// regions of compressed blocks.
+
+package ffldb
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/wire"
+	"github.com/btcsuite/snappy-go"
+)
+
+const (
+	// maxDecompressedCacheSize is the maximum number of bytes of
+	// decompressed blocks held by the decompressed block cache.
+	maxDecompressedCacheSize = 16 * 1024 * 1024 // 16 MiB
+)
+
+// compressBlock returns the snappy compressed form of the passed serialized
+// block.
+func compressBlock(rawBlock []byte) ([]byte, error) {
+	compressed, err := snappy.Encode(nil, rawBlock)
+	if err != nil {
+		str := fmt.Sprintf("failed to compress block: %v", err)
+		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	return compressed, nil
+}
+
+// decompressBlock returns the serialized block of the passed snappy compressed
+// block data.
+//
+// Returns ErrCorruption if the data can not be decompressed or decompresses to
+// more than the max allowed block size.
+func decompressBlock(hash *chainhash.Hash, compressed []byte) ([]byte, error) {
+	blockLen, err := snappy.DecodedLen(compressed)
+	if err == nil && blockLen > wire.MaxBlockPayload {
+		err = fmt.Errorf("decompressed length of %d bytes is larger "+
+			"than the max allowed %d bytes", blockLen,
+			wire.MaxBlockPayload)
+	}
+	var rawBlock []byte
+	if err == nil {
+		rawBlock, err = snappy.Decode(nil, compressed)
+	}
+	if err != nil {
+		str := fmt.Sprintf("failed to decompress block %s: %v", hash,
+			err)
+		return nil, makeDbErr(database.ErrCorruption, str, err)
+	}
+	return rawBlock, nil
+}
+
+// cachedBlock is a decompressed block held by the decompressed block cache.
+type cachedBlock struct {
+	hash     chainhash.Hash
+	rawBlock []byte
+}
+
+// blockCache is a least recently used cache of decompressed blocks which is
+// limited by the total size of the blocks it holds.  It is safe for concurrent
+// access.
+type blockCache struct {
+	mtx     sync.Mutex
+	maxSize int
+	size    int
+	lru     *list.List // Contains *cachedBlock.
+	blocks  map[chainhash.Hash]*list.Element
+}
+
+// lookup returns the decompressed block for the passed hash and marks it as the
+// most recently used one, or nil when the block is not cached.
+func (c *blockCache) lookup(hash *chainhash.Hash) []byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.blocks[*hash]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cachedBlock).rawBlock
+}
+
+// add adds the passed decompressed block to the cache and evicts the least
+// recently used blocks as needed to stay within the max size.  Blocks larger
+// than the max size of the cache are not cached.
+func (c *blockCache) add(hash *chainhash.Hash, rawBlock []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if len(rawBlock) > c.maxSize {
+		return
+	}
+	if elem, ok := c.blocks[*hash]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.blocks[*hash] = c.lru.PushFront(&cachedBlock{*hash, rawBlock})
+	c.size += len(rawBlock)
+	for c.size > c.maxSize {
+		elem := c.lru.Back()
+		block := c.lru.Remove(elem).(*cachedBlock)
+		delete(c.blocks, block.hash)
+		c.size -= len(block.rawBlock)
+	}
+}
+
+// newBlockCache returns a new empty decompressed block cache which holds at
+// most the passed number of bytes of decompressed blocks.
+func newBlockCache(maxSize int) *blockCache {
+	return &blockCache{
+		maxSize: maxSize,
+		lru:     list.New(),
+		blocks:  make(map[chainhash.Hash]*list.Element),
+	}
+}
@@ -16,6 +16,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -56,7 +58,16 @@ const (
 	//  [0:4]  Block file (4 bytes)
 	//  [4:8]  File offset (4 bytes)
 	//  [8:12] Block length (4 bytes)
+	//
+	// The high bit of the block length is set for blocks which are stored
+	// compressed.
 	blockLocSize = 12
+
+	// compressedBlockFlag is the bit of the serialized block length, both
+	// in the block location and in the block record of the flat files,
+	// which marks a block that is stored compressed.  The length itself
+	// can never reach it since it is limited by the max file size.
+	compressedBlockFlag uint32 = 1 << 31
 )
 
 var (
@@ -169,6 +180,16 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
+	// compressBlocks specifies whether new blocks are compressed before
+	// they are written to the flat files.  Blocks which are stored
+	// compressed are readable regardless of this setting.
+	compressBlocks bool
+
+	// decompressed houses the most recently decompressed blocks so reading
+	// several regions of the same compressed block, which is the typical
+	// access pattern, only decompresses it once.
+	decompressed *blockCache
+
 	// These functions are set to openFile, openWriteFile, and deleteFile by
 	// default, but are exposed here to allow the whitebox tests to replace
 	// them when working with mock files.
@@ -177,11 +198,14 @@ type blockStore struct {
 	deleteFileFunc    func(fileNum uint32) error
 }
 
-// blockLocation identifies a particular block file and location.
+// blockLocation identifies a particular block file and location.  The block
+// length is the length of the full block record, and the compressed flag
+// specifies whether the block in the record is compressed.
 type blockLocation struct {
 	blockFileNum uint32
 	fileOffset   uint32
 	blockLen     uint32
+	compressed   bool
 }
 
 // deserializeBlockLoc deserializes the passed serialized block location
@@ -196,10 +220,12 @@ func deserializeBlockLoc(serializedLoc []byte) blockLocation {
 	//  [0:4]  Block file (4 bytes)
 	//  [4:8]  File offset (4 bytes)
 	//  [8:12] Block length (4 bytes)
+	blockLen := byteOrder.Uint32(serializedLoc[8:12])
 	return blockLocation{
 		blockFileNum: byteOrder.Uint32(serializedLoc[0:4]),
 		fileOffset:   byteOrder.Uint32(serializedLoc[4:8]),
-		blockLen:     byteOrder.Uint32(serializedLoc[8:12]),
+		blockLen:     blockLen &^ compressedBlockFlag,
+		compressed:   blockLen&compressedBlockFlag != 0,
 	}
 }
 
@@ -211,10 +237,14 @@ func serializeBlockLoc(loc blockLocation) []byte {
 	//  [0:4]  Block file (4 bytes)
 	//  [4:8]  File offset (4 bytes)
 	//  [8:12] Block length (4 bytes)
+	blockLen := loc.blockLen
+	if loc.compressed {
+		blockLen |= compressedBlockFlag
+	}
 	var serializedData [12]byte
 	byteOrder.PutUint32(serializedData[0:4], loc.blockFileNum)
 	byteOrder.PutUint32(serializedData[4:8], loc.fileOffset)
-	byteOrder.PutUint32(serializedData[8:12], loc.blockLen)
+	byteOrder.PutUint32(serializedData[8:12], blockLen)
 	return serializedData[:]
 }
 
@@ -308,6 +338,31 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// closeFile closes the read-only file handle for the passed flat file number if
+// it is open.  It is used before a file is pruned.
+func (s *blockStore) closeFile(fileNum uint32) {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+
+	blockFile, ok := s.openBlockFiles[fileNum]
+	if !ok {
+		return
+	}
+
+	// Close the file under the write lock for the file in case any
+	// readers are currently reading from it so it's not closed out from
+	// under them.
+	s.lruMutex.Lock()
+	s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+	delete(s.fileNumToLRUElem, fileNum)
+	s.lruMutex.Unlock()
+
+	blockFile.Lock()
+	_ = blockFile.file.Close()
+	blockFile.Unlock()
+	delete(s.openBlockFiles, fileNum)
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -396,11 +451,27 @@ func (s *blockStore) writeData(data []byte, fieldName string) error {
 // file, create the next file, update the write cursor, and write the block to
 // the new file.
 //
+// The block is compressed when the store is configured to compress blocks and
+// doing so actually reduces its size.  The high bit of the block length in the
+// record is set for compressed blocks.
+//
 // The write cursor will also be advanced the number of bytes actually written
 // in the event of failure.
 //
 // Format: <network><block length><serialized block><checksum>
 func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
+	var compressed bool
+	if s.compressBlocks {
+		compressedBlock, err := compressBlock(rawBlock)
+		if err != nil {
+			return blockLocation{}, err
+		}
+		if len(compressedBlock) < len(rawBlock) {
+			rawBlock = compressedBlock
+			compressed = true
+		}
+	}
+
 	// Compute how many bytes will be written.
 	// 4 bytes each for block network + 4 bytes for block length +
 	// length of raw block + 4 bytes for checksum.
@@ -468,7 +539,11 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	_, _ = hasher.Write(scratch[:])
 
 	// Block length.
-	byteOrder.PutUint32(scratch[:], blockLen)
+	if compressed {
+		byteOrder.PutUint32(scratch[:], blockLen|compressedBlockFlag)
+	} else {
+		byteOrder.PutUint32(scratch[:], blockLen)
+	}
 	if err := s.writeData(scratch[:], "block length"); err != nil {
 		return blockLocation{}, err
 	}
@@ -489,6 +564,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		blockFileNum: wc.curFileNum,
 		fileOffset:   origOffset,
 		blockLen:     fullLen,
+		compressed:   compressed,
 	}
 	return loc, nil
 }
@@ -551,7 +627,30 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 
 	// The raw block excludes the network, length of the block, and
 	// checksum.
-	return serializedData[8 : n-4], nil
+	rawBlock := serializedData[8 : n-4]
+	if loc.compressed {
+		return decompressBlock(hash, rawBlock)
+	}
+	return rawBlock, nil
+}
+
+// readDecompressedBlock returns the serialized block of the compressed block
+// at the provided location from the cache of decompressed blocks, reading and
+// decompressing it and adding it to the cache when needed.
+//
+// The returned data is shared with the cache and therefore MUST NOT be
+// modified.
+func (s *blockStore) readDecompressedBlock(hash *chainhash.Hash, loc blockLocation) ([]byte, error) {
+	if rawBlock := s.decompressed.lookup(hash); rawBlock != nil {
+		return rawBlock, nil
+	}
+
+	rawBlock, err := s.readBlock(hash, loc)
+	if err != nil {
+		return nil, err
+	}
+	s.decompressed.add(hash, rawBlock)
+	return rawBlock, nil
 }
 
 // readBlockRegion reads the specified amount of data at the provided offset for
@@ -561,8 +660,34 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 // closing files as necessary to stay within the maximum allowed open files
 // limit.
 //
-// Returns ErrDriverSpecific if the data fails to read for any reason.
-func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32) ([]byte, error) {
+// Compressed blocks are transparently decompressed.  Since the offsets of the
+// region do not correspond to the data in the file in that case, the whole
+// block is read and decompressed, and it is cached to serve further regions.
+//
+// Returns ErrDriverSpecific if the data fails to read for any reason and
+// ErrBlockRegionInvalid if the region exceeds the bounds of a compressed block.
+func (s *blockStore) readBlockRegion(hash *chainhash.Hash, loc blockLocation, offset, numBytes uint32) ([]byte, error) {
+	if loc.compressed {
+		rawBlock, err := s.readDecompressedBlock(hash, loc)
+		if err != nil {
+			return nil, err
+		}
+
+		blockLen := uint32(len(rawBlock))
+		endOffset := offset + numBytes
+		if endOffset < offset || endOffset > blockLen {
+			str := fmt.Sprintf("block %s region offset %d, length "+
+				"%d exceeds block length of %d", hash, offset,
+				numBytes, blockLen)
+			return nil, makeDbErr(database.ErrBlockRegionInvalid,
+				str, nil)
+		}
+
+		regionBytes := make([]byte, numBytes)
+		copy(regionBytes, rawBlock[offset:endOffset])
+		return regionBytes, nil
+	}
+
 	// Get the referenced block file handle opening the file as needed.  The
 	// function also handles closing files as needed to avoid going over the
 	// max allowed open files.
@@ -714,15 +839,102 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	return
 }
 
+// prunePoint returns the number of the oldest flat block file to keep so the
+// block files take up no more than the passed target size in bytes.  The file
+// with the passed number and all newer files are always kept.
+func (s *blockStore) prunePoint(targetSize uint64, keepFileNum uint32) (uint32, error) {
+	firstFileNum, ok := firstBlockFile(s.basePath)
+	if !ok {
+		return 0, nil
+	}
+	wc := s.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+
+	var totalSize uint64
+	fileSizes := make(map[uint32]uint64)
+	for fileNum := firstFileNum; fileNum <= curFileNum; fileNum++ {
+		filePath := blockFilePath(s.basePath, fileNum)
+		st, err := os.Stat(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			str := fmt.Sprintf("failed to stat file %q: %v",
+				filePath, err)
+			return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		fileSizes[fileNum] = uint64(st.Size())
+		totalSize += uint64(st.Size())
+	}
+
+	pruneFileNum := firstFileNum
+	for pruneFileNum < keepFileNum && totalSize > targetSize {
+		totalSize -= fileSizes[pruneFileNum]
+		pruneFileNum++
+	}
+	return pruneFileNum, nil
+}
+
+// pruneFiles closes and deletes all flat block files older than the passed
+// file number.  The blocks they house must already have been removed from the
+// block index.  Files which no longer exist, such as those deleted by a prune
+// whose metadata was not yet synced before an unclean shutdown, are skipped.
+func (s *blockStore) pruneFiles(keepFileNum uint32) error {
+	firstFileNum, ok := firstBlockFile(s.basePath)
+	if !ok {
+		return nil
+	}
+
+	for fileNum := firstFileNum; fileNum < keepFileNum; fileNum++ {
+		_, err := os.Stat(blockFilePath(s.basePath, fileNum))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		s.closeFile(fileNum)
+		if err := s.deleteFileFunc(fileNum); err != nil {
+			return err
+		}
+		log.Debugf("Pruned block file %d", fileNum)
+	}
+
+	return nil
+}
+
+// firstBlockFile returns the number of the oldest flat block file in the
+// database directory, which is only greater than zero once older files have
+// been pruned.  It returns false when there are no block files.
+func firstBlockFile(dbPath string) (uint32, bool) {
+	// The zero-padded file names sort in the same order as the file
+	// numbers.
+	filePaths, err := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	if err != nil {
+		return 0, false
+	}
+	for _, filePath := range filePaths {
+		fileName := strings.TrimSuffix(filepath.Base(filePath), ".fdb")
+		fileNum, err := strconv.ParseUint(fileName, 10, 32)
+		if err == nil {
+			return uint32(fileNum), true
+		}
+	}
+	return 0, false
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
 // find the end of the most recent file.  This position is considered the
 // current write cursor which is also stored in the metadata.  Thus, it is used
 // to detect unexpected shutdowns in the middle of writes so the block files
 // can be reconciled.
 func scanBlockFiles(dbPath string) (int, uint32) {
+	// Start at the oldest file since the files before it may have been
+	// pruned.
+	firstFile, _ := firstBlockFile(dbPath)
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	for i := int(firstFile); ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -739,8 +951,9 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 }
 
 // newBlockStore returns a new block store with the current block file number
-// and offset set and all fields initialized.
-func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
+// and offset set and all fields initialized.  The compress flag specifies
+// whether new blocks are stored compressed.
+func newBlockStore(basePath string, network wire.BitcoinNet, compress bool) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
@@ -763,6 +976,8 @@ func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
 			curFileNum: uint32(fileNum),
 			curOffset:  fileOff,
 		},
+		compressBlocks: compress,
+		decompressed:   newBlockCache(maxDecompressedCacheSize),
 	}
 	store.openFileFunc = store.openFile
 	store.openWriteFileFunc = store.openWriteFile
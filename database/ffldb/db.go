@@ -44,6 +44,12 @@ const (
 	// The serialized block index row format is:
 	//   <blocklocation><blockheader>
 	blockHdrOffset = blockLocSize
+
+	// latestDbVersion is the latest version of the database.  Version 2
+	// introduced blocks which are stored compressed in the flat files.
+	// Older databases are left untouched until they are opened with block
+	// compression enabled, at which point they are upgraded.
+	latestDbVersion = 2
 )
 
 var (
@@ -75,6 +81,11 @@ var (
 	// writeLocKeyName is the key used to store the current write file
 	// location.
 	writeLocKeyName = []byte("ffldb-writeloc")
+
+	// versionKeyName is the key used to store the version of the database.
+	// Databases created before the version was introduced do not have it
+	// and are version 1.
+	versionKeyName = []byte("ffldb-version")
 )
 
 // Common error strings.
@@ -967,6 +978,10 @@ type transaction struct {
 	pendingBlocks    map[chainhash.Hash]int
 	pendingBlockData []pendingBlock
 
+	// The flat block files older than this file number are deleted on
+	// commit when blocks have been pruned.
+	pruneFileNum uint32
+
 	// Keys that need to be stored or deleted on commit.
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
@@ -1500,9 +1515,13 @@ func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, e
 	}
 	location := deserializeBlockLoc(blockRow)
 
-	// Ensure the region is within the bounds of the block.
+	// Ensure the region is within the bounds of the block.  The bounds of
+	// compressed blocks are only known once they are decompressed, so
+	// they are checked when the region is read.
 	endOffset := region.Offset + region.Len
-	if endOffset < region.Offset || endOffset > location.blockLen {
+	if endOffset < region.Offset || (!location.compressed &&
+		endOffset > location.blockLen) {
+
 		str := fmt.Sprintf("block %s region offset %d, length %d "+
 			"exceeds block length of %d", region.Hash,
 			region.Offset, region.Len, location.blockLen)
@@ -1511,8 +1530,8 @@ func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, e
 	}
 
 	// Read the region from the appropriate disk block file.
-	regionBytes, err := tx.db.store.readBlockRegion(location, region.Offset,
-		region.Len)
+	regionBytes, err := tx.db.store.readBlockRegion(region.Hash, location,
+		region.Offset, region.Len)
 	if err != nil {
 		return nil, err
 	}
@@ -1598,9 +1617,13 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 		}
 		location := deserializeBlockLoc(blockRow)
 
-		// Ensure the region is within the bounds of the block.
+		// Ensure the region is within the bounds of the block.  The
+		// bounds of compressed blocks are checked when the region is
+		// read.
 		endOffset := region.Offset + region.Len
-		if endOffset < region.Offset || endOffset > location.blockLen {
+		if endOffset < region.Offset || (!location.compressed &&
+			endOffset > location.blockLen) {
+
 			str := fmt.Sprintf("block %s region offset %d, length "+
 				"%d exceeds block length of %d", region.Hash,
 				region.Offset, region.Len, location.blockLen)
@@ -1617,8 +1640,8 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 		ri := fetchData.replyIndex
 		region := &regions[ri]
 		location := fetchData.blockLocation
-		regionBytes, err := tx.db.store.readBlockRegion(*location,
-			region.Offset, region.Len)
+		regionBytes, err := tx.db.store.readBlockRegion(region.Hash,
+			*location, region.Offset, region.Len)
 		if err != nil {
 			return nil, err
 		}
@@ -1628,6 +1651,76 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 	return blockRegions, nil
 }
 
+// PruneBlocks deletes the flat block files which house the oldest blocks until
+// the block files take up no more than the provided target size in bytes and
+// returns the hashes of the deleted blocks.  Only whole files are deleted, and
+// neither the file which houses the block identified by the given hash nor any
+// newer file is deleted.
+//
+// The blocks are removed from the block index right away while the files are
+// deleted once the transaction is committed.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the block to keep does not exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, oldestKeep *chainhash.Hash) ([]chainhash.Hash, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Nothing can be pruned when the block to keep is pending since every
+	// block file would have to be kept.
+	if _, exists := tx.pendingBlocks[*oldestKeep]; exists {
+		return nil, nil
+	}
+	blockRow, err := tx.fetchBlockRow(oldestKeep)
+	if err != nil {
+		return nil, err
+	}
+	keepLoc := deserializeBlockLoc(blockRow)
+	firstFileNum, _ := firstBlockFile(tx.db.store.basePath)
+	pruneFileNum, err := tx.db.store.prunePoint(targetSize,
+		keepLoc.blockFileNum)
+	if err != nil {
+		return nil, err
+	}
+	if pruneFileNum <= firstFileNum || pruneFileNum <= tx.pruneFileNum {
+		return nil, nil
+	}
+
+	// Remove all blocks housed in the files to delete from the block
+	// index.  This also removes any blocks left over in files which were
+	// deleted by a previous prune that did not make it to disk.
+	var pruned []chainhash.Hash
+	cursor := tx.blockIdxBucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		loc := deserializeBlockLoc(cursor.Value())
+		if loc.blockFileNum >= pruneFileNum {
+			continue
+		}
+
+		var hash chainhash.Hash
+		copy(hash[:], cursor.Key())
+		if err := cursor.Delete(); err != nil {
+			return nil, err
+		}
+		pruned = append(pruned, hash)
+	}
+	tx.pruneFileNum = pruneFileNum
+
+	return pruned, nil
+}
+
 // close marks the transaction closed then releases any pending data, the
 // underlying snapshot, the transaction read lock, and the write lock when the
 // transaction is writable.
@@ -1673,7 +1766,8 @@ func serializeBlockRow(blockLoc blockLocation, blockHdr []byte) []byte {
 // writePendingAndCommit writes pending block data to the flat block files,
 // updates the metadata with their locations as well as the new current write
 // location, and commits the metadata to the memory database cache.  It also
-// properly handles rollback in the case of failures.
+// properly handles rollback in the case of failures.  Finally, the block files
+// of pruned blocks are deleted.
 //
 // This function MUST only be called when there is pending data to be written.
 func (tx *transaction) writePendingAndCommit() error {
@@ -1725,7 +1819,16 @@ func (tx *transaction) writePendingAndCommit() error {
 
 	// Atomically update the database cache.  The cache automatically
 	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		return err
+	}
+
+	// Delete the block files of the pruned blocks now that the blocks
+	// have been removed from the block index.
+	if tx.pruneFileNum != 0 {
+		return tx.db.store.pruneFiles(tx.pruneFileNum)
+	}
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
@@ -2018,6 +2121,8 @@ func initDB(ldb *leveldb.DB) error {
 	batch := new(leveldb.Batch)
 	batch.Put(bucketizedKey(metadataBucketID, writeLocKeyName),
 		serializeWriteRow(0, 0))
+	batch.Put(bucketizedKey(metadataBucketID, versionKeyName),
+		serializeVersion(latestDbVersion))
 
 	// Create block index bucket and set the current bucket id.
 	//
@@ -2039,9 +2144,55 @@ func initDB(ldb *leveldb.DB) error {
 	return nil
 }
 
+// serializeVersion returns the serialization of the passed database version.
+func serializeVersion(version uint32) []byte {
+	var serializedVersion [4]byte
+	byteOrder.PutUint32(serializedVersion[:], version)
+	return serializedVersion[:]
+}
+
+// checkDBVersion ensures the version of the passed database is supported and
+// upgrades it to the latest version when blocks are going to be stored
+// compressed.
+func checkDBVersion(pdb *db) error {
+	version := uint32(1)
+	err := pdb.View(func(tx database.Tx) error {
+		serializedVersion := tx.Metadata().Get(versionKeyName)
+		if serializedVersion == nil {
+			return nil
+		}
+		if len(serializedVersion) != 4 {
+			str := "database version is corrupt"
+			return makeDbErr(database.ErrCorruption, str, nil)
+		}
+		version = byteOrder.Uint32(serializedVersion)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if version > latestDbVersion {
+		str := fmt.Sprintf("database version %d is newer than the "+
+			"latest supported version %d", version, latestDbVersion)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+	if version == latestDbVersion || !pdb.store.compressBlocks {
+		return nil
+	}
+
+	log.Infof("Upgrading database from version %d to version %d to "+
+		"store compressed blocks", version, latestDbVersion)
+	return pdb.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put(versionKeyName,
+			serializeVersion(latestDbVersion))
+	})
+}
+
 // openDB opens the database at the provided path.  database.ErrDbDoesNotExist
 // is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+// The compress flag specifies whether new blocks are stored compressed.
+func openDB(dbPath string, network wire.BitcoinNet, create, compress bool) (database.DB, error) {
 	// Error if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -2075,11 +2226,21 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// according to the data that is actually on disk.  Also create the
 	// database cache which wraps the underlying leveldb database to provide
 	// write caching.
-	store := newBlockStore(dbPath, network)
+	store := newBlockStore(dbPath, network, compress)
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
 	pdb := &db{store: store, cache: cache}
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
-	return reconcileDB(pdb, create)
+	if _, err := reconcileDB(pdb, create); err != nil {
+		return nil, err
+	}
+
+	// Ensure the database version is supported and upgrade it if needed.
+	if err := checkDBVersion(pdb); err != nil {
+		_ = pdb.Close()
+		return nil, err
+	}
+
+	return pdb, nil
 }
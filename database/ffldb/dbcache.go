@@ -527,8 +527,8 @@ func (c *dbCache) flush() error {
 // needsFlush returns whether or not the database cache needs to be flushed to
 // persistent storage based on its current size, whether or not adding all of
 // the entries in the passed database transaction would cause it to exceed the
-// configured limit, and how much time has elapsed since the last time the cache
-// was flushed.
+// configured limit, how much time has elapsed since the last time the cache
+// was flushed, and whether or not the transaction pruned blocks.
 //
 // This function MUST be called with the database write lock held.
 func (c *dbCache) needsFlush(tx *transaction) bool {
@@ -538,6 +538,15 @@ func (c *dbCache) needsFlush(tx *transaction) bool {
 		return true
 	}
 
+	// A flush is needed when the transaction pruned blocks since their
+	// block files are deleted right after the commit.  The removal of the
+	// pruned blocks from the block index along with all other cached
+	// metadata must be persisted first, otherwise an unclean shutdown
+	// would leave metadata that refers to deleted block files.
+	if tx.pruneFileNum != 0 {
+		return true
+	}
+
 	// A flush is needed when the size of the database cache exceeds the
 	// specified max cache size.  The total calculated size is multiplied by
 	// 1.5 here to account for additional memory consumption that will be
@@ -26,5 +26,15 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+An optional third parameter specifies whether new blocks are compressed before
+they are stored in the flat files.  Blocks which are stored compressed are read
+transparently regardless of the parameter, and databases which predate block
+compression are upgraded once they are opened with it enabled:
+
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet, true)
+	if err != nil {
+		// Handle error
+	}
 */
 package ffldb
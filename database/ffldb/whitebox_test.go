@@ -9,6 +9,7 @@
 package ffldb
 
 import (
+	"bytes"
 	"compress/bzip2"
 	"encoding/binary"
 	"fmt"
@@ -19,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
@@ -180,7 +182,7 @@ func TestCornerCases(t *testing.T) {
 	// directory is needed.
 	testName := "openDB: fail due to file at target location"
 	wantErrCode := database.ErrDriverSpecific
-	idb, err := openDB(dbPath, blockDataNet, true)
+	idb, err := openDB(dbPath, blockDataNet, true, false)
 	if !checkDbError(t, testName, err, wantErrCode) {
 		if err == nil {
 			idb.Close()
@@ -192,7 +194,7 @@ func TestCornerCases(t *testing.T) {
 	// Remove the file and create the database to run tests against.  It
 	// should be successful this time.
 	_ = os.RemoveAll(dbPath)
-	idb, err = openDB(dbPath, blockDataNet, true)
+	idb, err = openDB(dbPath, blockDataNet, true, false)
 	if err != nil {
 		t.Errorf("openDB: unexpected error: %v", err)
 		return
@@ -453,7 +455,7 @@ func testBlockFileErrors(tc *testContext) bool {
 		return false
 	}
 	testName = "readBlockRegion invalid file number"
-	_, err = store.readBlockRegion(invalidLoc, 0, 80)
+	_, err = store.readBlockRegion(block0Hash, invalidLoc, 0, 80)
 	if !checkDbError(tc.t, testName, err, database.ErrDriverSpecific) {
 		return false
 	}
@@ -705,3 +707,372 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// TestPruneBlocks ensures pruning deletes the oldest block files along with the
+// blocks they house while keeping the requested block and all newer ones, and
+// that the database can be reopened afterwards.
+func TestPruneBlocks(t *testing.T) {
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-pruneblocks")
+	_ = os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer func() {
+		idb.Close()
+	}()
+
+	// Change the maximum file size to a small value to force multiple flat
+	// files with the test data set.
+	idb.(*db).store.maxBlockFileSize = 1024 // 1KiB
+
+	// Create a chain of blocks which are large enough for a few of them to
+	// fill a block file.
+	blocks := make([]*provautil.Block, 32)
+	prevHash := chaincfg.RegressionNetParams.GenesisHash
+	for i := range blocks {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxOut(wire.NewTxOut(int64(i), make([]byte, 256)))
+		msgBlock := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				PrevBlock: *prevHash,
+				Height:    uint32(i + 1),
+			},
+			Transactions: []*wire.MsgTx{tx},
+		}
+		blocks[i] = provautil.NewBlock(msgBlock)
+		prevHash = blocks[i].Hash()
+	}
+	for _, block := range blocks {
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: Unexpected error: %v", err)
+		}
+	}
+
+	// Determine which blocks are expected to be pruned when keeping a
+	// block from the middle of the test data.
+	keepIdx := len(blocks) / 2
+	blockFiles := make([]uint32, len(blocks))
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			blockRow, err := tx.(*transaction).fetchBlockRow(block.Hash())
+			if err != nil {
+				return err
+			}
+			blockFiles[i] = deserializeBlockLoc(blockRow).blockFileNum
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fetchBlockRow: Unexpected error: %v", err)
+	}
+	keepFileNum := blockFiles[keepIdx]
+	if keepFileNum == 0 {
+		t.Fatalf("block %d is in the first block file", keepIdx)
+	}
+
+	// Ensure pruning requires a writable transaction and an existing
+	// block to keep.
+	err = idb.View(func(tx database.Tx) error {
+		_, err := tx.PruneBlocks(0, blocks[keepIdx].Hash())
+		return err
+	})
+	if !checkDbError(t, "PruneBlocks read-only", err,
+		database.ErrTxNotWritable) {
+		return
+	}
+	err = idb.Update(func(tx database.Tx) error {
+		_, err := tx.PruneBlocks(0, &chainhash.Hash{})
+		return err
+	})
+	if !checkDbError(t, "PruneBlocks unknown block", err,
+		database.ErrBlockNotFound) {
+		return
+	}
+
+	// Prune as much as possible and ensure exactly the blocks in the
+	// files before the one of the block to keep are pruned.
+	var pruned []chainhash.Hash
+	err = idb.Update(func(tx database.Tx) error {
+		var err error
+		pruned, err = tx.PruneBlocks(0, blocks[keepIdx].Hash())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("PruneBlocks: Unexpected error: %v", err)
+	}
+	prunedSet := make(map[chainhash.Hash]struct{})
+	for _, hash := range pruned {
+		prunedSet[hash] = struct{}{}
+	}
+	if len(prunedSet) != len(pruned) {
+		t.Fatalf("PruneBlocks: duplicate pruned blocks %v", pruned)
+	}
+	for i, block := range blocks {
+		_, isPruned := prunedSet[*block.Hash()]
+		if wantPruned := blockFiles[i] < keepFileNum; isPruned != wantPruned {
+			t.Fatalf("PruneBlocks: block %d pruned %v, want %v", i,
+				isPruned, wantPruned)
+		}
+	}
+	// Ensure the removal of the pruned blocks from the block index was
+	// flushed to leveldb before their block files were deleted.
+	cache := idb.(*db).cache
+	if cache.cachedKeys.Len() != 0 || cache.cachedRemove.Len() != 0 {
+		t.Fatalf("PruneBlocks: database cache was not flushed")
+	}
+	for _, hash := range pruned {
+		key := bucketizedKey(blockIdxBucketID, hash[:])
+		if _, err := cache.ldb.Get(key, nil); err != leveldb.ErrNotFound {
+			t.Fatalf("PruneBlocks: block %v is still in the "+
+				"persisted block index (err %v)", hash, err)
+		}
+	}
+	for fileNum := uint32(0); fileNum < keepFileNum; fileNum++ {
+		if fileExists(blockFilePath(dbPath, fileNum)) {
+			t.Fatalf("PruneBlocks: block file %d was not deleted",
+				fileNum)
+		}
+	}
+	if !fileExists(blockFilePath(dbPath, keepFileNum)) {
+		t.Fatalf("PruneBlocks: block file %d was deleted", keepFileNum)
+	}
+
+	// Pruning again has no effect.
+	err = idb.Update(func(tx database.Tx) error {
+		var err error
+		pruned, err = tx.PruneBlocks(0, blocks[keepIdx].Hash())
+		return err
+	})
+	if err != nil || len(pruned) != 0 {
+		t.Fatalf("PruneBlocks: unexpected second prune %v (err %v)",
+			pruned, err)
+	}
+
+	// Ensure the database can be reopened with the oldest block files
+	// missing and both the pruned and the kept blocks are reported
+	// correctly.
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: Unexpected error: %v", err)
+	}
+	idb, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Open: Unexpected error: %v", err)
+	}
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			_, err := tx.FetchBlock(block.Hash())
+			if blockFiles[i] < keepFileNum {
+				if !checkDbError(t, "FetchBlock pruned", err,
+					database.ErrBlockNotFound) {
+					return fmt.Errorf("block %d", i)
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock: Unexpected error: %v", err)
+	}
+}
+
+// TestCompressedBlocks ensures blocks are stored compressed once a database is
+// opened with block compression enabled, that the database version is upgraded
+// accordingly, and that both the compressed and the previously stored
+// uncompressed blocks and their regions are readable regardless of the setting.
+func TestCompressedBlocks(t *testing.T) {
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-compressedblocks")
+	_ = os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer func() {
+		idb.Close()
+	}()
+
+	// Create a chain of blocks with a few transactions each which compress
+	// well.
+	blocks := make([]*provautil.Block, 8)
+	prevHash := chaincfg.RegressionNetParams.GenesisHash
+	for i := range blocks {
+		msgBlock := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				PrevBlock: *prevHash,
+				Height:    uint32(i + 1),
+			},
+		}
+		for j := 0; j < 3; j++ {
+			tx := wire.NewMsgTx(1)
+			tx.AddTxOut(wire.NewTxOut(int64(i*3+j), make([]byte, 256)))
+			msgBlock.AddTransaction(tx)
+		}
+		blocks[i] = provautil.NewBlock(msgBlock)
+		prevHash = blocks[i].Hash()
+	}
+	storeBlocks := func(blocks []*provautil.Block) {
+		for _, block := range blocks {
+			err := idb.Update(func(tx database.Tx) error {
+				return tx.StoreBlock(block)
+			})
+			if err != nil {
+				t.Fatalf("StoreBlock: Unexpected error: %v", err)
+			}
+		}
+	}
+	setVersion := func(version uint32) {
+		err := idb.Update(func(tx database.Tx) error {
+			if version == 1 {
+				return tx.Metadata().Delete(versionKeyName)
+			}
+			return tx.Metadata().Put(versionKeyName,
+				serializeVersion(version))
+		})
+		if err != nil {
+			t.Fatalf("setVersion: Unexpected error: %v", err)
+		}
+	}
+	reopen := func(compress bool) {
+		if err := idb.Close(); err != nil {
+			t.Fatalf("Close: Unexpected error: %v", err)
+		}
+		idb, err = database.Open(dbType, dbPath, blockDataNet, compress)
+		if err != nil {
+			t.Fatalf("Open: Unexpected error: %v", err)
+		}
+	}
+
+	// Store the first half of the blocks uncompressed in a database which
+	// predates the version key and reopen it with compression enabled to
+	// store the rest.
+	half := len(blocks) / 2
+	storeBlocks(blocks[:half])
+	setVersion(1)
+	reopen(true)
+	storeBlocks(blocks[half:])
+
+	// checkBlocks ensures the database has been upgraded, only the blocks
+	// stored with compression enabled are compressed, and all blocks and
+	// regions of them are fetched as stored.
+	checkBlocks := func(name string) {
+		err := idb.View(func(tx database.Tx) error {
+			serializedVersion := tx.Metadata().Get(versionKeyName)
+			if serializedVersion == nil || byteOrder.Uint32(
+				serializedVersion) != latestDbVersion {
+
+				return fmt.Errorf("unexpected version %x",
+					serializedVersion)
+			}
+
+			for i, block := range blocks {
+				blockRow, err := tx.(*transaction).fetchBlockRow(
+					block.Hash())
+				if err != nil {
+					return err
+				}
+				loc := deserializeBlockLoc(blockRow)
+				if loc.compressed != (i >= half) {
+					return fmt.Errorf("block %d compressed "+
+						"%v", i, loc.compressed)
+				}
+
+				wantBytes, err := block.Bytes()
+				if err != nil {
+					return err
+				}
+				gotBytes, err := tx.FetchBlock(block.Hash())
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(gotBytes, wantBytes) {
+					return fmt.Errorf("block %d mismatch", i)
+				}
+
+				txLocs, err := block.TxLoc()
+				if err != nil {
+					return err
+				}
+				regions := make([]database.BlockRegion, len(txLocs))
+				for j, txLoc := range txLocs {
+					regions[j] = database.BlockRegion{
+						Hash:   block.Hash(),
+						Offset: uint32(txLoc.TxStart),
+						Len:    uint32(txLoc.TxLen),
+					}
+				}
+				gotRegions, err := tx.FetchBlockRegions(regions)
+				if err != nil {
+					return err
+				}
+				for j, region := range regions {
+					end := region.Offset + region.Len
+					want := wantBytes[region.Offset:end]
+					got, err := tx.FetchBlockRegion(&region)
+					if err != nil {
+						return err
+					}
+					if !bytes.Equal(got, want) ||
+						!bytes.Equal(gotRegions[j], want) {
+
+						return fmt.Errorf("block %d region "+
+							"%d mismatch", i, j)
+					}
+				}
+
+				// Ensure regions exceeding the bounds of
+				// compressed blocks are rejected.
+				if !loc.compressed {
+					continue
+				}
+				region := database.BlockRegion{
+					Hash:   block.Hash(),
+					Offset: uint32(len(wantBytes)) - 1,
+					Len:    2,
+				}
+				_, err = tx.FetchBlockRegion(&region)
+				if !checkDbError(t, "FetchBlockRegion", err,
+					database.ErrBlockRegionInvalid) {
+					return errSubTestFail
+				}
+				_, err = tx.FetchBlockRegions(
+					[]database.BlockRegion{region})
+				if !checkDbError(t, "FetchBlockRegions", err,
+					database.ErrBlockRegionInvalid) {
+					return errSubTestFail
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	checkBlocks("compression enabled")
+
+	// Ensure the blocks are still readable when compression is disabled.
+	reopen(false)
+	checkBlocks("compression disabled")
+
+	// Ensure databases with a newer version than the latest supported one
+	// are refused.
+	setVersion(latestDbVersion + 1)
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: Unexpected error: %v", err)
+	}
+	_, err = database.Open(dbType, dbPath, blockDataNet)
+	if !checkDbError(t, "Open newer version", err,
+		database.ErrDriverSpecific) {
+		return
+	}
+}
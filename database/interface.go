@@ -390,6 +390,25 @@ type Tx interface {
 	// implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
 
+	// PruneBlocks deletes the oldest blocks until the stored blocks take up
+	// no more than the provided target size in bytes and returns the hashes
+	// of the deleted blocks.  The block identified by the given hash along
+	// with every block stored after it is always kept, even when that
+	// means the target size is exceeded.  Implementations which store
+	// several blocks per file only delete whole files.
+	//
+	// The deleted blocks no longer exist for the transaction, and the
+	// storage they used is released once the transaction is committed.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the block to keep does not exist
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// Other errors are possible depending on the implementation.
+	PruneBlocks(targetSize uint64, oldestKeep *chainhash.Hash) ([]chainhash.Hash, error)
+
 	// ******************************************************************
 	// Methods related to both atomic metadata storage and block storage.
 	// ******************************************************************
@@ -0,0 +1,32 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package memdb implements a driver for the database package that keeps both the
+metadata and the blocks in memory.
+
+Nothing is ever written to disk, so all of the data is lost when the database
+is closed.  This makes the driver well suited for tests and for throwaway nodes
+such as those used for simulation testing, but it must not be used for any
+data that needs to survive a restart.
+
+Transactions provide the same semantics as the ffldb driver.  Each transaction
+operates on an immutable snapshot of the database taken when it was started,
+and the changes made by a read-write transaction only become visible to new
+transactions once it is committed.
+
+Usage
+
+This package is a driver to the database package and provides the database type
+of "memdb".  The Create function does not take any parameters:
+
+	db, err := database.Create("memdb")
+	if err != nil {
+		// Handle error
+	}
+
+Since the data does not outlive the database instance, calling the Open
+function always returns an error with the database.ErrDbDoesNotExist code.
+*/
+package memdb
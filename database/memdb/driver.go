@@ -0,0 +1,71 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/database"
+	"github.com/btcsuite/btclog"
+)
+
+var log = btclog.Disabled
+
+const (
+	dbType = "memdb"
+)
+
+// parseArgs parses the arguments from the database Open/Create methods.
+func parseArgs(funcName string, args ...interface{}) error {
+	if len(args) != 0 {
+		return fmt.Errorf("invalid arguments to %s.%s -- expected no "+
+			"arguments", dbType, funcName)
+	}
+
+	return nil
+}
+
+// openDBDriver is the callback provided during driver registration that opens
+// an existing database for use.  Since the data only lives as long as the
+// database instance that created it, there is never an existing database to
+// open.
+func openDBDriver(args ...interface{}) (database.DB, error) {
+	if err := parseArgs("Open", args...); err != nil {
+		return nil, err
+	}
+
+	str := "in-memory databases do not persist and must be created"
+	return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
+}
+
+// createDBDriver is the callback provided during driver registration that
+// creates, initializes, and opens a database for use.
+func createDBDriver(args ...interface{}) (database.DB, error) {
+	if err := parseArgs("Create", args...); err != nil {
+		return nil, err
+	}
+
+	return newDB(), nil
+}
+
+// useLogger is the callback provided during driver registration that sets the
+// current logger to the provided one.
+func useLogger(logger btclog.Logger) {
+	log = logger
+}
+
+func init() {
+	// Register the driver.
+	driver := database.Driver{
+		DbType:    dbType,
+		Create:    createDBDriver,
+		Open:      openDBDriver,
+		UseLogger: useLogger,
+	}
+	if err := database.RegisterDriver(driver); err != nil {
+		panic(fmt.Sprintf("Failed to regiser database driver '%s': %v",
+			dbType, err))
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb_test
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/memdb"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "memdb"
+
+// TestCreateOpenFail ensures that errors related to creating and opening a
+// database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	t.Parallel()
+
+	// Ensure that attempting to open a database returns the expected error
+	// since in-memory databases can't be reopened.
+	wantErrCode := database.ErrDbDoesNotExist
+	_, err := database.Open(dbType)
+	if !checkDbError(t, "Open", err, wantErrCode) {
+		return
+	}
+
+	// Ensure that attempting to open a database with the wrong number of
+	// parameters returns the expected error.
+	wantErr := fmt.Errorf("invalid arguments to %s.Open -- expected no "+
+		"arguments", dbType)
+	_, err = database.Open(dbType, "noexist", blockDataNet)
+	if err.Error() != wantErr.Error() {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to create a database with the wrong number of
+	// parameters returns the expected error.
+	wantErr = fmt.Errorf("invalid arguments to %s.Create -- expected no "+
+		"arguments", dbType)
+	_, err = database.Create(dbType, "noexist", blockDataNet)
+	if err.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure operations against a closed database return the expected
+	// error.
+	db, err := database.Create(dbType)
+	if err != nil {
+		t.Errorf("Create: unexpected error: %v", err)
+		return
+	}
+	db.Close()
+
+	wantErrCode = database.ErrDbNotOpen
+	err = db.View(func(tx database.Tx) error {
+		return nil
+	})
+	if !checkDbError(t, "View", err, wantErrCode) {
+		return
+	}
+
+	wantErrCode = database.ErrDbNotOpen
+	err = db.Update(func(tx database.Tx) error {
+		return nil
+	})
+	if !checkDbError(t, "Update", err, wantErrCode) {
+		return
+	}
+
+	wantErrCode = database.ErrDbNotOpen
+	_, err = db.Begin(false)
+	if !checkDbError(t, "Begin(false)", err, wantErrCode) {
+		return
+	}
+
+	wantErrCode = database.ErrDbNotOpen
+	_, err = db.Begin(true)
+	if !checkDbError(t, "Begin(true)", err, wantErrCode) {
+		return
+	}
+
+	wantErrCode = database.ErrDbNotOpen
+	err = db.Close()
+	if !checkDbError(t, "Close", err, wantErrCode) {
+		return
+	}
+}
+
+// TestPruneBlocks ensures pruning deletes the oldest blocks until the target
+// size is reached without affecting transactions which were already open.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+
+	db, err := database.Create(dbType)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer db.Close()
+
+	// Create and store a chain of blocks.
+	blocks := make([]*provautil.Block, 32)
+	prevHash := chaincfg.RegressionNetParams.GenesisHash
+	var totalSize uint64
+	for i := range blocks {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxOut(wire.NewTxOut(int64(i), make([]byte, 256)))
+		msgBlock := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				PrevBlock: *prevHash,
+				Height:    uint32(i + 1),
+			},
+			Transactions: []*wire.MsgTx{tx},
+		}
+		blocks[i] = provautil.NewBlock(msgBlock)
+		prevHash = blocks[i].Hash()
+		totalSize += uint64(msgBlock.SerializeSize())
+	}
+	for _, block := range blocks {
+		err := db.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: Unexpected error: %v", err)
+		}
+	}
+	blockSize := totalSize / uint64(len(blocks))
+	keepIdx := len(blocks) / 2
+
+	// Ensure pruning requires a writable transaction and an existing
+	// block to keep.
+	err = db.View(func(tx database.Tx) error {
+		_, err := tx.PruneBlocks(0, blocks[keepIdx].Hash())
+		return err
+	})
+	if !checkDbError(t, "PruneBlocks read-only", err,
+		database.ErrTxNotWritable) {
+		return
+	}
+	err = db.Update(func(tx database.Tx) error {
+		_, err := tx.PruneBlocks(0, &chainhash.Hash{})
+		return err
+	})
+	if !checkDbError(t, "PruneBlocks unknown block", err,
+		database.ErrBlockNotFound) {
+		return
+	}
+
+	// Start a transaction before pruning to ensure it still has access to
+	// the pruned blocks.
+	oldTx, err := db.Begin(false)
+	if err != nil {
+		t.Fatalf("Begin: Unexpected error: %v", err)
+	}
+	defer oldTx.Rollback()
+
+	// prune prunes the blocks with the provided target size and ensures
+	// the expected blocks were pruned.
+	prune := func(targetSize uint64, wantPruned []*provautil.Block) {
+		var pruned []chainhash.Hash
+		err := db.Update(func(tx database.Tx) error {
+			var err error
+			pruned, err = tx.PruneBlocks(targetSize,
+				blocks[keepIdx].Hash())
+			return err
+		})
+		if err != nil {
+			t.Fatalf("PruneBlocks: Unexpected error: %v", err)
+		}
+		var wantHashes []chainhash.Hash
+		for _, block := range wantPruned {
+			wantHashes = append(wantHashes, *block.Hash())
+		}
+		if !reflect.DeepEqual(pruned, wantHashes) {
+			t.Fatalf("PruneBlocks: pruned %v, want %v", pruned,
+				wantHashes)
+		}
+	}
+
+	// Prune just enough to be under the target size and ensure only the
+	// oldest blocks are pruned, then prune as much as possible and ensure
+	// every block before the one to keep is pruned.  Pruning again has no
+	// effect.
+	prune(totalSize-blockSize-1, blocks[:2])
+	prune(0, blocks[2:keepIdx])
+	prune(0, nil)
+
+	err = db.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			hasBlock, err := tx.HasBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if wantHasBlock := i >= keepIdx; hasBlock != wantHasBlock {
+				t.Fatalf("HasBlock: block %d exists %v, want %v",
+					i, hasBlock, wantHasBlock)
+			}
+		}
+		_, err := tx.FetchBlock(blocks[0].Hash())
+		if !checkDbError(t, "FetchBlock pruned", err,
+			database.ErrBlockNotFound) {
+			t.FailNow()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: Unexpected error: %v", err)
+	}
+
+	// Ensure the transaction started before pruning still sees all of the
+	// blocks.
+	for i, block := range blocks {
+		hasBlock, err := oldTx.HasBlock(block.Hash())
+		if err != nil {
+			t.Fatalf("HasBlock: Unexpected error: %v", err)
+		}
+		if !hasBlock {
+			t.Fatalf("HasBlock: block %d does not exist in the "+
+				"transaction started before pruning", i)
+		}
+	}
+}
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	db, err := database.Create(dbType)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer db.Close()
+
+	// Ensure the driver type is the expected value.
+	gotDbType := db.Type()
+	if gotDbType != dbType {
+		t.Errorf("Type: unepxected driver type - got %v, want %v",
+			gotDbType, dbType)
+		return
+	}
+
+	// Run all of the interface tests against the database.
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	testInterface(t, db)
+}
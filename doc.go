@@ -40,10 +40,39 @@ Application Options:
                             banning misbehaving peers.
       --banduration=        How long to ban misbehaving peers.  Valid time units
                             are {s, m, h}.  Minimum 1 second (24h0m0s)
+      --peerencryption      Encrypt connections to peers which also support the
+                            encrypted transport -- NOTE: Support is advertised
+                            in the unauthenticated version message, so an
+                            attacker on the network path can silently downgrade
+                            connections to plaintext unless --requireencryption
+                            or peer key authentication is used
+      --peerkey=            Hex-encoded private key used to authenticate to
+                            peers over the encrypted transport -- NOTE: Implies
+                            --peerencryption
+      --peerauthkey=        Only keep connections to peers which authenticate
+                            with one of the specified hex-encoded public keys
+                            -- NOTE: Implies --peerencryption
+      --peerauthvalidatekeys
+                            Only keep connections to peers which authenticate
+                            with a key in the current validate key set, or one
+                            of the --peerauthkey keys, and disconnect peers
+                            whose key is removed from the set -- NOTE: Implies
+                            --peerencryption
+      --requireencryption   Only keep connections to peers which negotiate the
+                            encrypted transport -- NOTE: Implies
+                            --peerencryption
   -u, --rpcuser=            Username for RPC connections
   -P, --rpcpass=            Password for RPC connections
       --rpclimituser=       Username for limited RPC connections
       --rpclimitpass=       Password for limited RPC connections
+      --rpcauthuser=        Add an RPC user that may only call the listed
+                            methods in the form user:pass:method[,method...]
+                            -- Methods may use * and ? wildcards, for example
+                            get*
+      --rpcauthtoken=       Add an RPC API token, sent as an HTTP Bearer token,
+                            that may only call the listed methods in the form
+                            name:token:method[,method...] -- Methods may use *
+                            and ? wildcards, for example get*
       --rpclisten=          Add an interface/port to listen for RPC connections
                             (default port: 8334, testnet: 18334)
       --rpccert=            File containing the certificate file
@@ -55,8 +84,9 @@ Application Options:
                             Discouraged unless interoperability issues need to
                             be worked around
       --norpc               Disable built-in RPC server -- NOTE: The RPC server
-                            is disabled by default if no rpcuser/rpcpass or
-                            rpclimituser/rpclimitpass is specified
+                            is disabled by default if no rpcuser/rpcpass,
+                            rpclimituser/rpclimitpass, rpcauthuser or
+                            rpcauthtoken is specified
       --notls               Disable TLS for the RPC server -- NOTE: This is only
                             allowed if the RPC server is bound to localhost
       --nodnsseed           Disable DNS seeding for peers
@@ -78,6 +108,9 @@ Application Options:
       --addcheckpoint=      Add a custom checkpoint.  Format: '<height>:<hash>'
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
+      --assumevalid=        Skip script and signature verification of the
+                            ancestors of this block hash during the initial
+                            sync
       --dbtype=             Database backend to use for the Block Chain (ffldb)
       --profile=            Enable HTTP profiling on given port -- NOTE port
                             must be between 1024 and 65536
@@ -111,6 +144,15 @@ Application Options:
       --nopeerbloomfilters  Disable bloom filtering support.
       --sigcachemaxsize=    The maximum number of entries in the signature
                             verification cache.
+      --utxocachemaxsize=   The maximum size in MiB of the UTXO cache (250)
+      --prune=              Delete the oldest blocks once the stored blocks
+                            exceed the specified size in MiB while always
+                            keeping the most recent 288 blocks (0 to disable,
+                            minimum 1024) -- Not compatible with --txindex,
+                            --addrindex and --cfindex
+      --compressblocks      Store new blocks compressed to reduce the disk space
+                            used by the block database -- Blocks stored before
+                            remain readable
       --blocksonly          Do not accept transactions from remote peers.
       --relaynonstd         Relay non-standard transactions regardless of the
                             default settings for the active network.
@@ -31,6 +31,7 @@ var (
 	backendLog = seelog.Disabled
 	adxrLog    = btclog.Disabled
 	amgrLog    = btclog.Disabled
+	auditLog   = btclog.Disabled
 	cmgrLog    = btclog.Disabled
 	bcdbLog    = btclog.Disabled
 	bmgrLog    = btclog.Disabled
@@ -50,6 +51,7 @@ var (
 var subsystemLoggers = map[string]btclog.Logger{
 	"ADXR": adxrLog,
 	"AMGR": amgrLog,
+	"AUDT": auditLog,
 	"CMGR": cmgrLog,
 	"BCDB": bcdbLog,
 	"BMGR": bmgrLog,
@@ -81,6 +83,9 @@ func useLogger(subsystemID string, logger btclog.Logger) {
 		amgrLog = logger
 		addrmgr.UseLogger(logger)
 
+	case "AUDT":
+		auditLog = logger
+
 	case "CMGR":
 		cmgrLog = logger
 		connmgr.UseLogger(logger)
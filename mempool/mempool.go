@@ -40,6 +40,11 @@ const (
 	// orphanExpireScanInterval is the minimum amount of time in between
 	// scans of the orphan pool to evict expired transactions.
 	orphanExpireScanInterval = time.Minute * 5
+
+	// maxRejectedTxns is the maximum number of recently rejected
+	// transactions kept in the reject cache.  The oldest rejects are
+	// evicted first once the limit is reached.
+	maxRejectedTxns = 1000
 )
 
 // Tag represents an identifier to use for tagging orphan transactions.  The
@@ -103,6 +108,13 @@ type Config struct {
 	// indexing the unconfirmed transactions in the memory pool.
 	// This can be nil if the address index is not enabled.
 	AddrIndex *indexers.AddrIndex
+
+	// SigVariantConflict defines the function to call when a transaction
+	// is rejected because the pool already holds a transaction with the
+	// same hash but different signatures.  It is called with the
+	// transaction in the pool followed by the rejected transaction.
+	// This can be nil.
+	SigVariantConflict func(poolTx, tx *provautil.Tx)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -164,6 +176,23 @@ type orphanTx struct {
 	expiration time.Time
 }
 
+// sigVariantConflict is a transaction which was rejected because the pool
+// already holds a transaction with the same hash but different signatures.
+type sigVariantConflict struct {
+	poolTx *provautil.Tx
+	tx     *provautil.Tx
+}
+
+// RejectedTx describes a transaction which was recently rejected by the memory
+// pool.
+type RejectedTx struct {
+	Hash        chainhash.Hash
+	HashWithSig chainhash.Hash
+	Code        wire.RejectCode
+	Reason      string
+	Time        time.Time
+}
+
 // TxPool is used as a source of transactions that need to be mined into blocks
 // and relayed to other peers.  It is safe for concurrent access from multiple
 // peers.
@@ -174,12 +203,26 @@ type TxPool struct {
 	mtx           sync.RWMutex
 	cfg           Config
 	pool          map[chainhash.Hash]*TxDesc
+	poolBySigHash map[chainhash.Hash]*TxDesc
 	orphans       map[chainhash.Hash]*orphanTx
 	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*provautil.Tx
 	outpoints     map[wire.OutPoint]*provautil.Tx
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 
+	// rejects holds the recently rejected transactions by hash,
+	// rejectsBySigHash the same rejects by hash including signatures and
+	// rejectsOrder the same rejects in the order they were added so the
+	// oldest can be evicted once the cache is full.
+	rejects          map[chainhash.Hash]*RejectedTx
+	rejectsBySigHash map[chainhash.Hash]*RejectedTx
+	rejectsOrder     []*RejectedTx
+
+	// sigVariantConflicts holds the signature variant conflicts detected
+	// while the mempool lock is held.  They are reported once the lock is
+	// released so the callback is free to access the pool.
+	sigVariantConflicts []sigVariantConflict
+
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
 	// the scan will only run when an orphan is added to the pool as opposed
@@ -436,6 +479,136 @@ func (mp *TxPool) IsOrphanInPool(hash *chainhash.Hash) bool {
 	return inPool
 }
 
+// addReject records the passed transaction as rejected by the memory pool with
+// the passed error in the reject cache, evicting the oldest reject when the
+// cache is full.  Errors which are not rule errors are not recorded since they
+// do not say anything about the transaction itself, and neither are duplicates
+// of transactions which are already in the main or orphan pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addReject(tx *provautil.Tx, err error) {
+	if _, ok := err.(RuleError); !ok {
+		return
+	}
+	txHash := tx.Hash()
+	if mp.isTransactionInPool(txHash) || mp.isOrphanInPool(txHash) {
+		return
+	}
+
+	if len(mp.rejectsOrder) >= maxRejectedTxns {
+		// The evicted reject is only removed from the maps when it has
+		// not been replaced by a newer reject of the same transaction.
+		oldest := mp.rejectsOrder[0]
+		mp.rejectsOrder[0] = nil
+		mp.rejectsOrder = mp.rejectsOrder[1:]
+		if mp.rejects[oldest.Hash] == oldest {
+			delete(mp.rejects, oldest.Hash)
+		}
+		if mp.rejectsBySigHash[oldest.HashWithSig] == oldest {
+			delete(mp.rejectsBySigHash, oldest.HashWithSig)
+		}
+	}
+
+	code, reason := ErrToRejectErr(err)
+	reject := &RejectedTx{
+		Hash:        *txHash,
+		HashWithSig: *tx.HashWithSig(),
+		Code:        code,
+		Reason:      reason,
+		Time:        time.Now(),
+	}
+	mp.rejects[*txHash] = reject
+	mp.rejectsBySigHash[reject.HashWithSig] = reject
+	mp.rejectsOrder = append(mp.rejectsOrder, reject)
+}
+
+// RejectedTx returns the most recent reject of the transaction with the passed
+// hash, or with the passed hash including signatures, from the cache of
+// recently rejected transactions.  It returns nil when the transaction was not
+// rejected recently.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RejectedTx(hash *chainhash.Hash) *RejectedTx {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	reject, exists := mp.rejects[*hash]
+	if !exists {
+		reject, exists = mp.rejectsBySigHash[*hash]
+		if !exists {
+			return nil
+		}
+	}
+
+	rejectCopy := *reject
+	return &rejectCopy
+}
+
+// OrphanMissingParents returns the hashes of the transactions the orphan with
+// the passed hash spends outputs of which are neither in the main chain nor in
+// the main pool.  The returned bool is false when the transaction is not in the
+// orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) OrphanMissingParents(hash *chainhash.Hash) ([]*chainhash.Hash, bool, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	otx, exists := mp.orphans[*hash]
+	if !exists {
+		return nil, false, nil
+	}
+
+	utxoView, err := mp.fetchInputUtxos(otx.tx)
+	if err != nil {
+		return nil, true, err
+	}
+	var missingParents []*chainhash.Hash
+	seen := make(map[chainhash.Hash]struct{})
+	for _, txIn := range otx.tx.MsgTx().TxIn {
+		originHash := txIn.PreviousOutPoint.Hash
+		if _, ok := seen[originHash]; ok {
+			continue
+		}
+		seen[originHash] = struct{}{}
+		entry := utxoView.LookupEntry(&originHash)
+		if entry == nil || entry.IsFullySpent() {
+			missingParents = append(missingParents, &originHash)
+		}
+	}
+	return missingParents, true, nil
+}
+
+// sigVariant returns the transaction in the main pool which has the same hash
+// as the passed transaction but different signatures, or nil when there is no
+// such transaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) sigVariant(tx *provautil.Tx) *provautil.Tx {
+	txDesc, exists := mp.pool[*tx.Hash()]
+	if !exists || txDesc.Tx.HashWithSig().IsEqual(tx.HashWithSig()) {
+		return nil
+	}
+	return txDesc.Tx
+}
+
+// SigVariant returns the transaction in the main pool which has the same hash
+// as the passed transaction but different signatures, or nil when there is no
+// such transaction.  Since the hash of a transaction does not commit to its
+// signatures, this happens when, for example, two different pairs of keys
+// sign the same 2-of-3 spend.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) SigVariant(tx *provautil.Tx) *provautil.Tx {
+	mp.mtx.RLock()
+	poolTx := mp.sigVariant(tx)
+	mp.mtx.RUnlock()
+
+	return poolTx
+}
+
 // haveTransaction returns whether or not the passed transaction already exists
 // in the main pool or in the orphan pool.
 //
@@ -486,6 +659,7 @@ func (mp *TxPool) removeTransaction(tx *provautil.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		delete(mp.poolBySigHash, *txDesc.Tx.HashWithSig())
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -543,6 +717,16 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provaut
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
 	}
 	mp.pool[*tx.Hash()] = txD
+	mp.poolBySigHash[*tx.HashWithSig()] = txD
+
+	// A previous reject of the transaction no longer applies.
+	if reject, exists := mp.rejects[*tx.Hash()]; exists {
+		delete(mp.rejects, *tx.Hash())
+		if mp.rejectsBySigHash[reject.HashWithSig] == reject {
+			delete(mp.rejectsBySigHash, reject.HashWithSig)
+		}
+	}
+	delete(mp.rejectsBySigHash, *tx.HashWithSig())
 
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
@@ -620,14 +804,66 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*provautil.Tx, error
 	return nil, fmt.Errorf("transaction is not in the pool")
 }
 
-// maybeAcceptTransaction is the internal function which implements the public
-// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// FetchTransactionByHashWithSig returns the transaction from the transaction
+// pool with the passed hash including signatures.  Like FetchTransaction, it
+// does not include orphans.
 //
-// This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchTransactionByHashWithSig(hashWithSig *chainhash.Hash) (*provautil.Tx, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	txDesc, exists := mp.poolBySigHash[*hashWithSig]
+	mp.mtx.RUnlock()
+
+	if exists {
+		return txDesc.Tx, nil
+	}
+
+	return nil, fmt.Errorf("transaction is not in the pool")
+}
+
+// MempoolAcceptResult houses the result of checking whether a transaction
+// would be accepted into the memory pool.
+type MempoolAcceptResult struct {
+	// TxFee is the fee paid by the transaction in atoms.
+	TxFee int64
+
+	// TxSize is the serialized size of the transaction in bytes.  Since
+	// Prova transactions do not have witness data, it is also their
+	// virtual size.
+	TxSize int64
+
+	// MissingParents are the hashes of the referenced transactions which
+	// are neither in the main chain nor in the pool.  When there are any,
+	// the transaction is an orphan and the other checks were not run.
+	MissingParents []*chainhash.Hash
+
+	// utxoView and bestHeight are the unspent outputs referenced by the
+	// transaction and the height of the main chain the transaction was
+	// checked against.
+	utxoView   *blockchain.UtxoViewpoint
+	bestHeight uint32
+}
+
+// checkMempoolAcceptance runs all of the checks of maybeAcceptTransaction
+// without adding the transaction to the pool.  Only the rate limiter state is
+// updated when the rate limit flag is set.
+//
+// This function MUST be called with the mempool lock held (for writes when
+// the rate limit flag is set, for reads otherwise).
+func (mp *TxPool) checkMempoolAcceptance(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool) (*MempoolAcceptResult, error) {
 	txHash := tx.Hash()
 
+	// Reject a transaction which only differs from one already in the pool
+	// by its signatures, since the two can not be told apart by their
+	// hashes.
+	if poolTx := mp.sigVariant(tx); poolTx != nil {
+		str := fmt.Sprintf("transaction %v with signatures %v "+
+			"conflicts with signature variant %v already in the "+
+			"pool", txHash, tx.HashWithSig(), poolTx.HashWithSig())
+		return nil, txRuleError(wire.RejectDuplicate, str)
+	}
+
 	// Don't accept the transaction if it already exists in the pool.  This
 	// applies to orphan transactions as well when the reject duplicate
 	// orphans flag is set.  This check is intended to be a quick check to
@@ -636,7 +872,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		mp.isOrphanInPool(txHash)) {
 
 		str := fmt.Sprintf("already have transaction %v", txHash)
-		return nil, nil, txRuleError(wire.RejectDuplicate, str)
+		return nil, txRuleError(wire.RejectDuplicate, str)
 	}
 
 	// Perform preliminary sanity checks on the transaction.  This makes
@@ -645,16 +881,16 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	err := blockchain.CheckTransactionSanity(tx)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
 	// A standalone transaction must not be a coinbase transaction.
 	if blockchain.IsCoinBase(tx) {
 		str := fmt.Sprintf("transaction %v is an individual coinbase",
 			txHash)
-		return nil, nil, txRuleError(wire.RejectInvalid, str)
+		return nil, txRuleError(wire.RejectInvalid, str)
 	}
 
 	// Don't accept transactions with a lock time after the maximum int32
@@ -664,7 +900,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	if tx.MsgTx().LockTime > math.MaxInt32 {
 		str := fmt.Sprintf("transaction %v has a lock time after "+
 			"2038 which is not accepted yet", txHash)
-		return nil, nil, txRuleError(wire.RejectNonstandard, str)
+		return nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
 	// Get the current height of the main chain.  A standalone transaction
@@ -691,7 +927,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 			}
 			str := fmt.Sprintf("transaction %v is not standard: %v",
 				txHash, err)
-			return nil, nil, txRuleError(rejectCode, str)
+			return nil, txRuleError(rejectCode, str)
 		}
 	}
 
@@ -705,7 +941,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	// which examines the actual spend data and prevents double spends.
 	err = mp.checkPoolDoubleSpend(tx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Fetch all of the unspent transaction outputs referenced by the inputs
@@ -715,9 +951,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	utxoView, err := mp.fetchInputUtxos(tx)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Set the data for the keyview from chain
@@ -732,7 +968,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	// not already fully spent.
 	txEntry := utxoView.LookupEntry(txHash)
 	if txEntry != nil && !txEntry.IsFullySpent() {
-		return nil, nil, txRuleError(wire.RejectDuplicate,
+		return nil, txRuleError(wire.RejectDuplicate,
 			"transaction already exists")
 	}
 	delete(utxoView.Entries(), *txHash)
@@ -753,7 +989,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		}
 	}
 	if len(missingParents) > 0 {
-		return missingParents, nil, nil
+		return &MempoolAcceptResult{MissingParents: missingParents}, nil
 	}
 
 	// Don't allow the transaction into the mempool unless its sequence
@@ -762,13 +998,13 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	sequenceLock, err := mp.cfg.CalcSequenceLock(tx, utxoView)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 	if !blockchain.SequenceLockActive(sequenceLock, int32(nextBlockHeight),
 		medianTimePast) {
-		return nil, nil, txRuleError(wire.RejectNonstandard,
+		return nil, txRuleError(wire.RejectNonstandard,
 			"transaction's sequence locks on inputs not met")
 	}
 
@@ -780,15 +1016,15 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		utxoView, mp.cfg.ChainParams)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
 	// CheckTransactionOutputs checks outputs for state violations.
 	err = blockchain.CheckTransactionOutputs(tx, keyView, mp.cfg.ChainParams)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Don't allow transactions with non-standard inputs if the network
@@ -805,7 +1041,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 			}
 			str := fmt.Sprintf("transaction %v has a non-standard "+
 				"input: %v", txHash, err)
-			return nil, nil, txRuleError(rejectCode, str)
+			return nil, txRuleError(rejectCode, str)
 		}
 	}
 
@@ -823,15 +1059,15 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	numSigOps, err := blockchain.CountP2SHSigOps(tx, false, utxoView)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 	numSigOps += blockchain.CountSigOps(tx)
 	if numSigOps > mp.cfg.Policy.MaxSigOpsPerTx {
 		str := fmt.Sprintf("transaction %v has too many sigops: %d > %d",
 			txHash, numSigOps, mp.cfg.Policy.MaxSigOpsPerTx)
-		return nil, nil, txRuleError(wire.RejectNonstandard, str)
+		return nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
 	// Don't allow transactions with fees too low to get into a mined block.
@@ -852,7 +1088,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
 			minFee)
-		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
 	}
 
 	// Require that free transactions have sufficient priority to be mined
@@ -866,7 +1102,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 			str := fmt.Sprintf("transaction %v has insufficient "+
 				"priority (%g <= %g)", txHash,
 				currentPriority, mining.MinHighPriority)
-			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
 		}
 	}
 
@@ -884,7 +1120,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		if mp.pennyTotal >= mp.cfg.Policy.FreeTxRelayLimit*10*1000 {
 			str := fmt.Sprintf("transaction %v has been rejected "+
 				"by the rate limiter due to low fees", txHash)
-			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
 		}
 		oldTotal := mp.pennyTotal
 
@@ -900,15 +1136,49 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		txscript.StandardVerifyFlags, mp.cfg.SigCache, mp.cfg.HashCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
+		return nil, err
+	}
+
+	return &MempoolAcceptResult{
+		TxFee:      txFee,
+		TxSize:     serializedSize,
+		utxoView:   utxoView,
+		bestHeight: bestHeight,
+	}, nil
+}
+
+// maybeAcceptTransaction is the internal function which implements the public
+// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
+// more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+	// Queue a transaction which only differs from one already in the pool
+	// by its signatures to be reported once the lock is released.  It is
+	// rejected by checkMempoolAcceptance.
+	if poolTx := mp.sigVariant(tx); poolTx != nil &&
+		mp.cfg.SigVariantConflict != nil {
+
+		mp.sigVariantConflicts = append(mp.sigVariantConflicts,
+			sigVariantConflict{poolTx: poolTx, tx: tx})
+	}
+
+	result, err := mp.checkMempoolAcceptance(tx, isNew, rateLimit,
+		rejectDupOrphans)
+	if err != nil {
 		return nil, nil, err
 	}
+	if len(result.MissingParents) > 0 {
+		return result.MissingParents, nil, nil
+	}
 
 	// Add to transaction pool.
-	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
+	txD := mp.addTransaction(result.utxoView, tx, result.bestHeight,
+		result.TxFee)
 
-	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
+	log.Debugf("Accepted transaction %v (pool size: %v)", tx.Hash(),
 		len(mp.pool))
 
 	return nil, txD, nil
@@ -929,11 +1199,51 @@ func (mp *TxPool) MaybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	// Protect concurrent access.
 	mp.mtx.Lock()
 	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	conflicts := mp.takeSigVariantConflicts()
 	mp.mtx.Unlock()
 
+	mp.notifySigVariantConflicts(conflicts)
 	return hashes, txD, err
 }
 
+// takeSigVariantConflicts returns the queued signature variant conflicts and
+// clears the queue.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) takeSigVariantConflicts() []sigVariantConflict {
+	conflicts := mp.sigVariantConflicts
+	mp.sigVariantConflicts = nil
+	return conflicts
+}
+
+// notifySigVariantConflicts reports the passed signature variant conflicts to
+// the SigVariantConflict callback.
+//
+// This function MUST NOT be called with the mempool lock held.
+func (mp *TxPool) notifySigVariantConflicts(conflicts []sigVariantConflict) {
+	for _, conflict := range conflicts {
+		mp.cfg.SigVariantConflict(conflict.poolTx, conflict.tx)
+	}
+}
+
+// CheckMempoolAcceptance checks whether the passed transaction would be
+// accepted into the memory pool by MaybeAcceptTransaction, including the
+// standardness, fee and script checks, without adding it to the pool.  The
+// transaction is treated as a new transaction which is not rate limited.
+//
+// An orphan transaction is not an error, but is reported by the missing
+// parents of the result.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckMempoolAcceptance(tx *provautil.Tx) (*MempoolAcceptResult, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	result, err := mp.checkMempoolAcceptance(tx, true, false, true)
+	mp.mtx.RUnlock()
+
+	return result, err
+}
+
 // processOrphans is the internal function which implements the public
 // ProcessOrphans.  See the comment for ProcessOrphans for more details.
 //
@@ -978,6 +1288,7 @@ func (mp *TxPool) processOrphans(acceptedTx *provautil.Tx) []*TxDesc {
 					// redeem any of its outputs can be
 					// accepted.  Remove them.
 					mp.removeOrphan(tx, true)
+					mp.addReject(tx, err)
 					break
 				}
 
@@ -1030,33 +1341,23 @@ func (mp *TxPool) processOrphans(acceptedTx *provautil.Tx) []*TxDesc {
 func (mp *TxPool) ProcessOrphans(acceptedTx *provautil.Tx) []*TxDesc {
 	mp.mtx.Lock()
 	acceptedTxns := mp.processOrphans(acceptedTx)
+	conflicts := mp.takeSigVariantConflicts()
 	mp.mtx.Unlock()
 
+	mp.notifySigVariantConflicts(conflicts)
 	return acceptedTxns
 }
 
-// ProcessTransaction is the main workhorse for handling insertion of new
-// free-standing transactions into the memory pool.  It includes functionality
-// such as rejecting duplicate transactions, ensuring transactions follow all
-// rules, orphan transaction handling, and insertion into the memory pool.
+// processTransaction is the internal function which implements the public
+// ProcessTransaction.  See the comment for ProcessTransaction for more details.
 //
-// It returns a slice of transactions added to the mempool.  When the
-// error is nil, the list will include the passed transaction itself along
-// with any additional orphan transaactions that were added as a result of
-// the passed one being accepted.
-//
-// This function is safe for concurrent access.
-func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
-	log.Tracef("Processing transaction %v", tx.Hash())
-
-	// Protect concurrent access.
-	mp.mtx.Lock()
-	defer mp.mtx.Unlock()
-
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) processTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
 		true)
 	if err != nil {
+		mp.addReject(tx, err)
 		return nil, err
 	}
 
@@ -1091,14 +1392,44 @@ func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bo
 		str := fmt.Sprintf("orphan transaction %v references "+
 			"outputs of unknown or fully-spent "+
 			"transaction %v", tx.Hash(), missingParents[0])
-		return nil, txRuleError(wire.RejectDuplicate, str)
+		err := txRuleError(wire.RejectDuplicate, str)
+		mp.addReject(tx, err)
+		return nil, err
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
 	err = mp.maybeAddOrphan(tx, tag)
+	if err != nil {
+		mp.addReject(tx, err)
+	}
 	return nil, err
 }
 
+// ProcessTransaction is the main workhorse for handling insertion of new
+// free-standing transactions into the memory pool.  It includes functionality
+// such as rejecting duplicate transactions, ensuring transactions follow all
+// rules, orphan transaction handling, and insertion into the memory pool.
+//
+// It returns a slice of transactions added to the mempool.  When the
+// error is nil, the list will include the passed transaction itself along
+// with any additional orphan transaactions that were added as a result of
+// the passed one being accepted.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
+	log.Tracef("Processing transaction %v", tx.Hash())
+
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	acceptedTxs, err := mp.processTransaction(tx, allowOrphan, rateLimit,
+		tag)
+	conflicts := mp.takeSigVariantConflicts()
+	mp.mtx.Unlock()
+
+	mp.notifySigVariantConflicts(conflicts)
+	return acceptedTxs, err
+}
+
 // Count returns the number of transactions in the main pool.  It does not
 // include the orphan pool.
 //
@@ -1223,11 +1554,14 @@ func (mp *TxPool) LastUpdated() time.Time {
 // transactions until they are mined into a block.
 func New(cfg *Config) *TxPool {
 	return &TxPool{
-		cfg:            *cfg,
-		pool:           make(map[chainhash.Hash]*TxDesc),
-		orphans:        make(map[chainhash.Hash]*orphanTx),
-		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*provautil.Tx),
-		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
-		outpoints:      make(map[wire.OutPoint]*provautil.Tx),
+		cfg:              *cfg,
+		pool:             make(map[chainhash.Hash]*TxDesc),
+		poolBySigHash:    make(map[chainhash.Hash]*TxDesc),
+		orphans:          make(map[chainhash.Hash]*orphanTx),
+		orphansByPrev:    make(map[wire.OutPoint]map[chainhash.Hash]*provautil.Tx),
+		nextExpireScan:   time.Now().Add(orphanExpireScanInterval),
+		outpoints:        make(map[wire.OutPoint]*provautil.Tx),
+		rejects:          make(map[chainhash.Hash]*RejectedTx),
+		rejectsBySigHash: make(map[chainhash.Hash]*RejectedTx),
 	}
 }
@@ -442,6 +442,15 @@ func testPoolMembership(tc *testContext, tx *provautil.Tx, inOrphanPool, inTxPoo
 			file, line, inTxPool, gotTxPool)
 	}
 
+	// The transaction must also be found in the main pool by its hash
+	// including signatures.
+	_, err := tc.harness.txPool.FetchTransactionByHashWithSig(tx.HashWithSig())
+	if gotBySigHash := err == nil; inTxPool != gotBySigHash {
+		_, file, line, _ := runtime.Caller(1)
+		tc.t.Fatalf("%s:%d -- FetchTransactionByHashWithSig: want %v, "+
+			"got %v", file, line, inTxPool, gotBySigHash)
+	}
+
 	gotHaveTx := tc.harness.txPool.HaveTransaction(txHash)
 	wantHaveTx := inOrphanPool || inTxPool
 	if wantHaveTx != gotHaveTx {
@@ -862,3 +871,277 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 	// was not moved to the transaction pool.
 	testPoolMembership(tc, doubleSpendTx, false, false)
 }
+
+// TestSigVariantConflict ensures a transaction which only differs from one in
+// the pool by its signatures is rejected and reported as a conflict after the
+// mempool lock is released.
+func TestSigVariantConflict(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	// The callback accesses the pool to ensure it is called once the
+	// mempool lock is released.
+	var conflicts [][2]*provautil.Tx
+	harness.txPool.cfg.SigVariantConflict = func(poolTx, tx *provautil.Tx) {
+		if !harness.txPool.HaveTransaction(poolTx.Hash()) {
+			t.Errorf("SigVariantConflict: pool transaction %v "+
+				"not in the pool", poolTx.Hash())
+		}
+		conflicts = append(conflicts, [2]*provautil.Tx{poolTx, tx})
+	}
+	tc := &testContext{t, harness}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 1)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	tx := chainedTxns[0]
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+
+	// Create a variant of the transaction with a different signature
+	// script, which leaves its hash unchanged.
+	variantMsgTx := tx.MsgTx().Copy()
+	sigScript := variantMsgTx.TxIn[0].SignatureScript
+	variantMsgTx.TxIn[0].SignatureScript = append([]byte{txscript.OP_0},
+		sigScript...)
+	variant := provautil.NewTx(variantMsgTx)
+	if !variant.Hash().IsEqual(tx.Hash()) {
+		t.Fatalf("variant hash %v does not match %v", variant.Hash(),
+			tx.Hash())
+	}
+
+	if poolTx := harness.txPool.SigVariant(tx); poolTx != nil {
+		t.Fatalf("SigVariant: unexpected variant %v of the pool "+
+			"transaction itself", poolTx.HashWithSig())
+	}
+	poolTx := harness.txPool.SigVariant(variant)
+	if poolTx == nil || !poolTx.HashWithSig().IsEqual(tx.HashWithSig()) {
+		t.Fatalf("SigVariant: did not return the pool transaction")
+	}
+
+	// The variant must be rejected as a duplicate and reported.
+	_, err = harness.txPool.ProcessTransaction(variant, false, false, 0)
+	if code, _ := ErrToRejectErr(err); err == nil ||
+		code != wire.RejectDuplicate {
+
+		t.Fatalf("ProcessTransaction: got error %v, want duplicate", err)
+	}
+	if len(conflicts) != 1 || conflicts[0][0] != tx ||
+		conflicts[0][1] != variant {
+
+		t.Fatalf("SigVariantConflict: got %d unexpected conflicts",
+			len(conflicts))
+	}
+	testPoolMembership(tc, tx, false, true)
+	_, err = harness.txPool.FetchTransactionByHashWithSig(variant.HashWithSig())
+	if err == nil {
+		t.Fatalf("FetchTransactionByHashWithSig: found rejected variant")
+	}
+
+	// Submitting the same transaction again is a plain duplicate which must
+	// not be reported as a conflict.
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err == nil {
+		t.Fatalf("ProcessTransaction: accepted duplicate transaction")
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("SigVariantConflict: got %d conflicts, want 1",
+			len(conflicts))
+	}
+}
+
+// TestCheckMempoolAcceptance ensures checking whether transactions would be
+// accepted reports the same results as accepting them without modifying the
+// pool.
+func TestCheckMempoolAcceptance(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// A valid transaction is accepted, but not added to the pool.
+	tx := chainedTxns[0]
+	result, err := harness.txPool.CheckMempoolAcceptance(tx)
+	if err != nil {
+		t.Fatalf("CheckMempoolAcceptance: unexpected error: %v", err)
+	}
+	if len(result.MissingParents) != 0 || result.TxFee != 0 ||
+		result.TxSize != int64(tx.MsgTx().SerializeSize()) {
+
+		t.Fatalf("CheckMempoolAcceptance: unexpected result %+v", result)
+	}
+	testPoolMembership(tc, tx, false, false)
+
+	// A transaction spending an output which is neither in the chain nor
+	// in the pool is reported as an orphan, but not added to the orphans.
+	result, err = harness.txPool.CheckMempoolAcceptance(chainedTxns[1])
+	if err != nil {
+		t.Fatalf("CheckMempoolAcceptance: unexpected error: %v", err)
+	}
+	if len(result.MissingParents) != 1 ||
+		!result.MissingParents[0].IsEqual(tx.Hash()) {
+
+		t.Fatalf("CheckMempoolAcceptance: got missing parents %v, "+
+			"want %v", result.MissingParents, tx.Hash())
+	}
+	testPoolMembership(tc, chainedTxns[1], false, false)
+
+	// Once the parent is in the pool, the child is accepted while the
+	// parent is rejected as a duplicate.
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	result, err = harness.txPool.CheckMempoolAcceptance(chainedTxns[1])
+	if err != nil || len(result.MissingParents) != 0 {
+		t.Fatalf("CheckMempoolAcceptance: unexpected result %+v, %v",
+			result, err)
+	}
+	_, err = harness.txPool.CheckMempoolAcceptance(tx)
+	if code, _ := ErrToRejectErr(err); err == nil ||
+		code != wire.RejectDuplicate {
+
+		t.Fatalf("CheckMempoolAcceptance: got error %v, want "+
+			"duplicate", err)
+	}
+
+	// A transaction with an invalid signature is rejected.
+	invalidMsgTx := chainedTxns[1].MsgTx().Copy()
+	invalidMsgTx.TxIn[0].SignatureScript = chainedTxns[0].MsgTx().
+		TxIn[0].SignatureScript
+	invalid := provautil.NewTx(invalidMsgTx)
+	if _, err = harness.txPool.CheckMempoolAcceptance(invalid); err == nil {
+		t.Fatalf("CheckMempoolAcceptance: accepted transaction with " +
+			"an invalid signature")
+	}
+	testPoolMembership(tc, invalid, false, false)
+}
+
+// TestRejectCache ensures rejected transactions are recorded in the bounded
+// reject cache and orphans report the parents they are missing.
+func TestRejectCache(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// An orphan reports the parent which is neither in the chain nor in
+	// the pool.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[2], true, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept orphan %v", err)
+	}
+	missing, isOrphan, err := harness.txPool.OrphanMissingParents(
+		chainedTxns[2].Hash())
+	if err != nil || !isOrphan || len(missing) != 1 ||
+		!missing[0].IsEqual(chainedTxns[1].Hash()) {
+
+		t.Fatalf("OrphanMissingParents: got %v, %v, %v, want %v",
+			missing, isOrphan, err, chainedTxns[1].Hash())
+	}
+
+	// A rejected orphan is recorded with the reason it was rejected for
+	// and can be looked up by either of its hashes.
+	tx := chainedTxns[1]
+	_, rejectErr := harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if rejectErr == nil {
+		t.Fatalf("ProcessTransaction: did not fail on orphan %v when "+
+			"allow orphans flag is false", tx.Hash())
+	}
+	for _, hash := range []*chainhash.Hash{tx.Hash(), tx.HashWithSig()} {
+		reject := harness.txPool.RejectedTx(hash)
+		if reject == nil {
+			t.Fatalf("RejectedTx: transaction %v was not recorded",
+				hash)
+		}
+		if reject.Hash != *tx.Hash() ||
+			reject.HashWithSig != *tx.HashWithSig() ||
+			reject.Code != wire.RejectDuplicate ||
+			reject.Reason != rejectErr.Error() {
+
+			t.Fatalf("RejectedTx: unexpected reject %+v", reject)
+		}
+	}
+
+	// Duplicates of transactions in the orphan pool are not recorded.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[2], true, false, 0)
+	if err == nil {
+		t.Fatalf("ProcessTransaction: accepted duplicate orphan")
+	}
+	if harness.txPool.RejectedTx(chainedTxns[2].Hash()) != nil {
+		t.Fatalf("RejectedTx: duplicate orphan was recorded")
+	}
+
+	// Once the transaction is accepted, it is no longer reported as
+	// rejected.
+	for _, tx := range chainedTxns[:2] {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+	}
+	testPoolMembership(tc, chainedTxns[2], false, true)
+	for _, hash := range []*chainhash.Hash{tx.Hash(), tx.HashWithSig()} {
+		if harness.txPool.RejectedTx(hash) != nil {
+			t.Fatalf("RejectedTx: accepted transaction %v reported "+
+				"as rejected", hash)
+		}
+	}
+	_, isOrphan, _ = harness.txPool.OrphanMissingParents(
+		chainedTxns[2].Hash())
+	if isOrphan {
+		t.Fatalf("OrphanMissingParents: accepted transaction reported " +
+			"as orphan")
+	}
+
+	// The cache is bounded and evicts the oldest rejects first.
+	rejected := make([]*provautil.Tx, maxRejectedTxns+1)
+	harness.txPool.mtx.Lock()
+	for i := range rejected {
+		msgTx := wire.NewMsgTx(1)
+		msgTx.LockTime = uint32(i)
+		rejected[i] = provautil.NewTx(msgTx)
+		harness.txPool.addReject(rejected[i],
+			txRuleError(wire.RejectInvalid, "invalid"))
+	}
+	numRejects := len(harness.txPool.rejects)
+	numRejectsBySigHash := len(harness.txPool.rejectsBySigHash)
+	harness.txPool.mtx.Unlock()
+	if numRejects != maxRejectedTxns ||
+		numRejectsBySigHash != maxRejectedTxns {
+
+		t.Fatalf("reject cache holds %d transactions by hash and %d "+
+			"by hash including signatures, want %d", numRejects,
+			numRejectsBySigHash, maxRejectedTxns)
+	}
+	if harness.txPool.RejectedTx(rejected[0].Hash()) != nil {
+		t.Fatalf("RejectedTx: oldest reject was not evicted")
+	}
+	if harness.txPool.RejectedTx(rejected[maxRejectedTxns].Hash()) == nil {
+		t.Fatalf("RejectedTx: newest reject was not recorded")
+	}
+}
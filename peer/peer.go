@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/wire"
@@ -28,7 +29,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.CompactBlocksVersion
 
 	// outputBufferSize is the number of elements the output channels use.
 	outputBufferSize = 50
@@ -141,6 +142,29 @@ type MessageListeners struct {
 	// message.
 	OnGetHeaders func(p *Peer, msg *wire.MsgGetHeaders)
 
+	// OnGetCFilters is invoked when a peer receives a getcfilters bitcoin
+	// message.
+	OnGetCFilters func(p *Peer, msg *wire.MsgGetCFilters)
+
+	// OnGetCFHeaders is invoked when a peer receives a getcfheaders
+	// bitcoin message.
+	OnGetCFHeaders func(p *Peer, msg *wire.MsgGetCFHeaders)
+
+	// OnGetCFCheckpt is invoked when a peer receives a getcfcheckpt
+	// bitcoin message.
+	OnGetCFCheckpt func(p *Peer, msg *wire.MsgGetCFCheckpt)
+
+	// OnCFilter is invoked when a peer receives a cfilter bitcoin message.
+	OnCFilter func(p *Peer, msg *wire.MsgCFilter)
+
+	// OnCFHeaders is invoked when a peer receives a cfheaders bitcoin
+	// message.
+	OnCFHeaders func(p *Peer, msg *wire.MsgCFHeaders)
+
+	// OnCFCheckpt is invoked when a peer receives a cfcheckpt bitcoin
+	// message.
+	OnCFCheckpt func(p *Peer, msg *wire.MsgCFCheckpt)
+
 	// OnFeeFilter is invoked when a peer receives a feefilter bitcoin message.
 	OnFeeFilter func(p *Peer, msg *wire.MsgFeeFilter)
 
@@ -172,6 +196,22 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -234,6 +274,25 @@ type Config struct {
 	// not send inv messages for transactions.
 	DisableRelayTx bool
 
+	// TransportKey is the identity key used to authenticate the local peer
+	// to the remote peer when an encrypted transport is negotiated.  This
+	// field can be omitted in which case the local peer does not
+	// authenticate itself.
+	TransportKey *btcec.PrivateKey
+
+	// RequireEncryption specifies whether the connection must be dropped
+	// when the remote peer does not support the encrypted transport.  The
+	// local peer only advertises and negotiates the encrypted transport
+	// when Services includes wire.SFNodeEncrypted.
+	RequireEncryption bool
+
+	// AuthorizePeerKey is invoked with the identity key the remote peer
+	// authenticated with during encrypted transport negotiation.  When it
+	// is set, the connection is dropped unless the remote peer supports the
+	// encrypted transport, authenticates with an identity key, and the
+	// function returns true for that key.
+	AuthorizePeerKey func(*btcec.PublicKey) bool
+
 	// Listeners houses callback functions to be invoked on receiving peer
 	// messages.
 	Listeners MessageListeners
@@ -391,6 +450,10 @@ type Peer struct {
 
 	conn net.Conn
 
+	// msgConn is used to read and write messages.  It is conn itself or the
+	// encrypted transport wrapping it once that has been negotiated.
+	msgConn io.ReadWriter
+
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
 	addr    string
@@ -406,8 +469,12 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	cmpctBlocksVersion   uint64 // compact block version from sendcmpct
+	cmpctBlocksAnnounce  bool   // peer wants cmpctblock announcements
 	versionSent          bool
 	verAckReceived       bool
+	encrypted            bool             // encrypted transport negotiated
+	authKey              *btcec.PublicKey // identity key of remote peer
 
 	knownInventory     *mruInventoryMap
 	prevGetBlocksMtx   sync.Mutex
@@ -567,6 +634,30 @@ func (p *Peer) Services() wire.ServiceFlag {
 	return services
 }
 
+// Encrypted returns whether the connection to the remote peer uses the
+// encrypted transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Encrypted() bool {
+	p.flagsMtx.Lock()
+	encrypted := p.encrypted
+	p.flagsMtx.Unlock()
+
+	return encrypted
+}
+
+// AuthKey returns the identity key the remote peer authenticated with during
+// encrypted transport negotiation, or nil when it did not authenticate.
+//
+// This function is safe for concurrent access.
+func (p *Peer) AuthKey() *btcec.PublicKey {
+	p.flagsMtx.Lock()
+	authKey := p.authKey
+	p.flagsMtx.Unlock()
+
+	return authKey
+}
+
 // UserAgent returns the user agent of the remote peer.
 //
 // This function is safe for concurrent access.
@@ -755,6 +846,32 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// SupportsCmpctBlocks returns whether the peer sent a sendcmpct message for the
+// compact block version supported by this package, which means it can be sent
+// and requested cmpctblock messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SupportsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	supported := p.cmpctBlocksVersion == wire.CmpctBlockVersion
+	p.flagsMtx.Unlock()
+
+	return supported
+}
+
+// WantsCmpctBlocks returns if the peer wants new blocks to be announced with
+// cmpctblock messages instead of inventory vectors or headers.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	wants := p.cmpctBlocksAnnounce &&
+		p.cmpctBlocksVersion == wire.CmpctBlockVersion
+	p.flagsMtx.Unlock()
+
+	return wants
+}
+
 // localVersionMsg creates a version message that can be used to send to the
 // remote peer.
 func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
@@ -1081,7 +1198,7 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage() (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageN(p.conn, p.ProtocolVersion(),
+	n, msg, buf, err := wire.ReadMessageN(p.msgConn, p.ProtocolVersion(),
 		p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
@@ -1144,7 +1261,7 @@ func (p *Peer) writeMessage(msg wire.Message) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageN(p.conn, msg, p.ProtocolVersion(),
+	n, err := wire.WriteMessageN(p.msgConn, msg, p.ProtocolVersion(),
 		p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
@@ -1228,12 +1345,18 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		pendingResponses[wire.CmdInv] = deadline
 
 	case wire.CmdGetData:
-		// Expects a block, merkleblock, tx, or notfound message.
+		// Expects a block, cmpctblock, merkleblock, tx, or notfound
+		// message.
 		pendingResponses[wire.CmdBlock] = deadline
+		pendingResponses[wire.CmdCmpctBlock] = deadline
 		pendingResponses[wire.CmdMerkleBlock] = deadline
 		pendingResponses[wire.CmdTx] = deadline
 		pendingResponses[wire.CmdNotFound] = deadline
 
+	case wire.CmdGetBlockTxn:
+		// Expects a blocktxn message.
+		pendingResponses[wire.CmdBlockTxn] = deadline
+
 	case wire.CmdGetHeaders:
 		// Expects a headers message.  Use a longer deadline since it
 		// can take a while for the remote peer to load all of the
@@ -1287,12 +1410,15 @@ out:
 				switch msgCmd := msg.message.Command(); msgCmd {
 				case wire.CmdBlock:
 					fallthrough
+				case wire.CmdCmpctBlock:
+					fallthrough
 				case wire.CmdMerkleBlock:
 					fallthrough
 				case wire.CmdTx:
 					fallthrough
 				case wire.CmdNotFound:
 					delete(pendingResponses, wire.CmdBlock)
+					delete(pendingResponses, wire.CmdCmpctBlock)
 					delete(pendingResponses, wire.CmdMerkleBlock)
 					delete(pendingResponses, wire.CmdTx)
 					delete(pendingResponses, wire.CmdNotFound)
@@ -1540,6 +1666,36 @@ out:
 				p.cfg.Listeners.OnGetHeaders(p, msg)
 			}
 
+		case *wire.MsgGetCFilters:
+			if p.cfg.Listeners.OnGetCFilters != nil {
+				p.cfg.Listeners.OnGetCFilters(p, msg)
+			}
+
+		case *wire.MsgGetCFHeaders:
+			if p.cfg.Listeners.OnGetCFHeaders != nil {
+				p.cfg.Listeners.OnGetCFHeaders(p, msg)
+			}
+
+		case *wire.MsgGetCFCheckpt:
+			if p.cfg.Listeners.OnGetCFCheckpt != nil {
+				p.cfg.Listeners.OnGetCFCheckpt(p, msg)
+			}
+
+		case *wire.MsgCFilter:
+			if p.cfg.Listeners.OnCFilter != nil {
+				p.cfg.Listeners.OnCFilter(p, msg)
+			}
+
+		case *wire.MsgCFHeaders:
+			if p.cfg.Listeners.OnCFHeaders != nil {
+				p.cfg.Listeners.OnCFHeaders(p, msg)
+			}
+
+		case *wire.MsgCFCheckpt:
+			if p.cfg.Listeners.OnCFCheckpt != nil {
+				p.cfg.Listeners.OnCFCheckpt(p, msg)
+			}
+
 		case *wire.MsgFeeFilter:
 			if p.cfg.Listeners.OnFeeFilter != nil {
 				p.cfg.Listeners.OnFeeFilter(p, msg)
@@ -1579,6 +1735,36 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgSendCmpct:
+			// Only the first sendcmpct message for a supported
+			// version determines the version used, but the
+			// announcement preference may change at any time.
+			p.flagsMtx.Lock()
+			if msg.Version == wire.CmpctBlockVersion {
+				p.cmpctBlocksVersion = msg.Version
+				p.cmpctBlocksAnnounce = msg.Announce
+			}
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1888,6 +2074,7 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 	}
 
 	p.conn = conn
+	p.msgConn = conn
 	p.timeConnected = time.Now()
 
 	if p.inbound {
@@ -2030,24 +2217,34 @@ func (p *Peer) writeLocalVersionMsg() error {
 
 // negotiateInboundProtocol waits to receive a version message from the peer
 // then sends our version message. If the events do not occur in that order then
-// it returns an error.
+// it returns an error.  The encrypted transport is negotiated afterwards when
+// both peers support it.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
 	}
 
-	return p.writeLocalVersionMsg()
+	if err := p.writeLocalVersionMsg(); err != nil {
+		return err
+	}
+
+	return p.negotiateTransport()
 }
 
 // negotiateOutboundProtocol sends our version message then waits to receive a
 // version message from the peer.  If the events do not occur in that order then
-// it returns an error.
+// it returns an error.  The encrypted transport is negotiated afterwards when
+// both peers support it.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
 		return err
 	}
 
-	return p.readRemoteVersionMsg()
+	if err := p.readRemoteVersionMsg(); err != nil {
+		return err
+	}
+
+	return p.negotiateTransport()
 }
 
 // newPeerBase returns a new base bitcoin peer based on the inbound flag.  This
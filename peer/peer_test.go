@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/peer"
@@ -312,6 +313,170 @@ func TestPeerConnection(t *testing.T) {
 	}
 }
 
+// TestPeerEncryptedTransport tests that peers which both support the encrypted
+// transport negotiate it and authenticate each other as expected.
+func TestPeerEncryptedTransport(t *testing.T) {
+	inKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	outKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	authorize := func(key *btcec.PrivateKey) func(*btcec.PublicKey) bool {
+		return func(pubKey *btcec.PublicKey) bool {
+			return pubKey.IsEqual(key.PubKey())
+		}
+	}
+
+	tests := []struct {
+		name          string
+		inServices    wire.ServiceFlag
+		outServices   wire.ServiceFlag
+		inKey         *btcec.PrivateKey
+		outKey        *btcec.PrivateKey
+		inRequire     bool
+		inAuthorize   func(*btcec.PublicKey) bool
+		outAuthorize  func(*btcec.PublicKey) bool
+		wantConnected bool
+		wantEncrypted bool
+	}{
+		{
+			name:          "mutually authenticated",
+			inServices:    wire.SFNodeEncrypted,
+			outServices:   wire.SFNodeEncrypted,
+			inKey:         inKey,
+			outKey:        outKey,
+			inAuthorize:   authorize(outKey),
+			outAuthorize:  authorize(inKey),
+			wantConnected: true,
+			wantEncrypted: true,
+		},
+		{
+			name:          "anonymous",
+			inServices:    wire.SFNodeEncrypted,
+			outServices:   wire.SFNodeEncrypted,
+			wantConnected: true,
+			wantEncrypted: true,
+		},
+		{
+			name:          "unsupported by remote",
+			inServices:    wire.SFNodeEncrypted,
+			wantConnected: true,
+		},
+		{
+			name:        "required but unsupported",
+			inServices:  wire.SFNodeEncrypted,
+			inRequire:   true,
+			outServices: 0,
+		},
+		{
+			name:        "unauthorized key",
+			inServices:  wire.SFNodeEncrypted,
+			outServices: wire.SFNodeEncrypted,
+			outKey:      otherKey,
+			inAuthorize: authorize(outKey),
+		},
+		{
+			name:        "missing key",
+			inServices:  wire.SFNodeEncrypted,
+			outServices: wire.SFNodeEncrypted,
+			inAuthorize: authorize(outKey),
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		listeners := peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		}
+		inCfg := &peer.Config{
+			Listeners:         listeners,
+			ChainParams:       &chaincfg.MainNetParams,
+			Services:          test.inServices,
+			TransportKey:      test.inKey,
+			RequireEncryption: test.inRequire,
+			AuthorizePeerKey:  test.inAuthorize,
+		}
+		outCfg := &peer.Config{
+			Listeners:        listeners,
+			ChainParams:      &chaincfg.MainNetParams,
+			Services:         test.outServices,
+			TransportKey:     test.outKey,
+			AuthorizePeerKey: test.outAuthorize,
+		}
+
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(inCfg)
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:8333")
+		if err != nil {
+			t.Errorf("%s: NewOutboundPeer: unexpected err %v",
+				test.name, err)
+			continue
+		}
+		outPeer.AssociateConnection(outConn)
+
+		if !test.wantConnected {
+			disconnected := make(chan struct{})
+			go func() {
+				inPeer.WaitForDisconnect()
+				close(disconnected)
+			}()
+			select {
+			case <-disconnected:
+			case <-time.After(time.Second):
+				t.Errorf("%s: inbound peer was not disconnected",
+					test.name)
+			}
+			inPeer.Disconnect()
+			outPeer.Disconnect()
+			outPeer.WaitForDisconnect()
+			continue
+		}
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Errorf("%s: verack timeout", test.name)
+			}
+		}
+		for _, p := range []*peer.Peer{inPeer, outPeer} {
+			if p.Encrypted() != test.wantEncrypted {
+				t.Errorf("%s: Encrypted got %v, want %v",
+					test.name, p.Encrypted(), test.wantEncrypted)
+			}
+		}
+		if test.inKey != nil && !outPeer.AuthKey().IsEqual(inKey.PubKey()) {
+			t.Errorf("%s: outbound peer has wrong AuthKey", test.name)
+		}
+		if test.outKey != nil && !inPeer.AuthKey().IsEqual(outKey.PubKey()) {
+			t.Errorf("%s: inbound peer has wrong AuthKey", test.name)
+		}
+		if test.outKey == nil && inPeer.AuthKey() != nil {
+			t.Errorf("%s: inbound peer has unexpected AuthKey",
+				test.name)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
+
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
@@ -360,6 +525,24 @@ func TestPeerListeners(t *testing.T) {
 			OnGetHeaders: func(p *peer.Peer, msg *wire.MsgGetHeaders) {
 				ok <- msg
 			},
+			OnGetCFilters: func(p *peer.Peer, msg *wire.MsgGetCFilters) {
+				ok <- msg
+			},
+			OnGetCFHeaders: func(p *peer.Peer, msg *wire.MsgGetCFHeaders) {
+				ok <- msg
+			},
+			OnGetCFCheckpt: func(p *peer.Peer, msg *wire.MsgGetCFCheckpt) {
+				ok <- msg
+			},
+			OnCFilter: func(p *peer.Peer, msg *wire.MsgCFilter) {
+				ok <- msg
+			},
+			OnCFHeaders: func(p *peer.Peer, msg *wire.MsgCFHeaders) {
+				ok <- msg
+			},
+			OnCFCheckpt: func(p *peer.Peer, msg *wire.MsgCFCheckpt) {
+				ok <- msg
+			},
 			OnFeeFilter: func(p *peer.Peer, msg *wire.MsgFeeFilter) {
 				ok <- msg
 			},
@@ -387,6 +570,18 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				ok <- msg
+			},
+			OnCmpctBlock: func(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+				ok <- msg
+			},
+			OnGetBlockTxn: func(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+				ok <- msg
+			},
+			OnBlockTxn: func(p *peer.Peer, msg *wire.MsgBlockTxn) {
+				ok <- msg
+			},
 		},
 		UserAgentName:    "peer",
 		UserAgentVersion: "1.0",
@@ -481,6 +676,36 @@ func TestPeerListeners(t *testing.T) {
 			"OnGetHeaders",
 			wire.NewMsgGetHeaders(),
 		},
+		{
+			"OnGetCFilters",
+			wire.NewMsgGetCFilters(wire.GCSFilterRegular, 0,
+				&chainhash.Hash{}),
+		},
+		{
+			"OnGetCFHeaders",
+			wire.NewMsgGetCFHeaders(wire.GCSFilterRegular, 0,
+				&chainhash.Hash{}),
+		},
+		{
+			"OnGetCFCheckpt",
+			wire.NewMsgGetCFCheckpt(wire.GCSFilterRegular,
+				&chainhash.Hash{}),
+		},
+		{
+			"OnCFilter",
+			wire.NewMsgCFilter(wire.GCSFilterRegular, &chainhash.Hash{},
+				[]byte{0x00}),
+		},
+		{
+			"OnCFHeaders",
+			wire.NewMsgCFHeaders(wire.GCSFilterRegular, &chainhash.Hash{},
+				&chainhash.Hash{}),
+		},
+		{
+			"OnCFCheckpt",
+			wire.NewMsgCFCheckpt(wire.GCSFilterRegular, &chainhash.Hash{},
+				0),
+		},
 		{
 			"OnFeeFilter",
 			wire.NewMsgFeeFilter(15000),
@@ -511,6 +736,23 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendCmpct",
+			wire.NewMsgSendCmpct(true, wire.CmpctBlockVersion),
+		},
+		{
+			"OnCmpctBlock",
+			wire.NewMsgCmpctBlock(wire.NewMsgBlock(wire.NewBlockHeader(
+				&chainhash.Hash{}, &chainhash.Hash{}, 1, 1)), 1),
+		},
+		{
+			"OnGetBlockTxn",
+			wire.NewMsgGetBlockTxn(&chainhash.Hash{}, []uint32{1}),
+		},
+		{
+			"OnBlockTxn",
+			wire.NewMsgBlockTxn(&chainhash.Hash{}),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -0,0 +1,363 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// encFrameHeaderSize is the size of the little-endian ciphertext length
+	// which precedes every encrypted frame.
+	encFrameHeaderSize = 4
+
+	// maxEncFramePlaintext is the maximum number of plaintext bytes sealed
+	// into a single encrypted frame.  Larger writes are split into multiple
+	// frames.
+	maxEncFramePlaintext = wire.MessageHeaderSize + wire.MaxMessagePayload
+)
+
+// Labels used to derive the per-session secrets from the ECDH shared secret.
+var (
+	encInitiatorKeyLabel = []byte("prova transport initiator key")
+	encResponderKeyLabel = []byte("prova transport responder key")
+	encSessionIDLabel    = []byte("prova transport session id")
+	encAuthLabel         = []byte("prova transport auth")
+)
+
+var (
+	// ErrEncryptionRequired is returned during protocol negotiation when the
+	// local peer requires an encrypted transport and the remote peer does
+	// not support it.
+	ErrEncryptionRequired = errors.New("remote peer does not support " +
+		"encrypted transport")
+
+	// ErrPeerNotAuthorized is returned during protocol negotiation when the
+	// remote peer did not prove possession of an authorized key.
+	ErrPeerNotAuthorized = errors.New("remote peer is not authorized")
+)
+
+// encryptedConn wraps a net.Conn so that everything written to it is sealed
+// with AES-256-GCM and everything read from it is authenticated and decrypted.
+// Each direction uses its own key and a message counter as the nonce, so frames
+// which are replayed, reordered or dropped cause reads to fail.
+type encryptedConn struct {
+	net.Conn
+
+	readMtx   sync.Mutex
+	recvAEAD  cipher.AEAD
+	recvNonce uint64
+	readBuf   []byte
+
+	writeMtx  sync.Mutex
+	sendAEAD  cipher.AEAD
+	sendNonce uint64
+}
+
+// Ensure encryptedConn implements the net.Conn interface.
+var _ net.Conn = (*encryptedConn)(nil)
+
+// encNonce returns the 96-bit GCM nonce for the passed frame counter.
+func encNonce(counter uint64) []byte {
+	var nonce [12]byte
+	binary.LittleEndian.PutUint64(nonce[:], counter)
+	return nonce[:]
+}
+
+// Read reads decrypted data from the connection.  This is part of the net.Conn
+// interface implementation.
+func (c *encryptedConn) Read(b []byte) (int, error) {
+	c.readMtx.Lock()
+	defer c.readMtx.Unlock()
+
+	if len(c.readBuf) == 0 {
+		var hdr [encFrameHeaderSize]byte
+		if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+			return 0, err
+		}
+		frameLen := binary.LittleEndian.Uint32(hdr[:])
+		maxFrameLen := uint32(maxEncFramePlaintext + c.recvAEAD.Overhead())
+		if frameLen > maxFrameLen {
+			return 0, fmt.Errorf("encrypted frame length %d exceeds "+
+				"max of %d", frameLen, maxFrameLen)
+		}
+		frame := make([]byte, frameLen)
+		if _, err := io.ReadFull(c.Conn, frame); err != nil {
+			return 0, err
+		}
+		plaintext, err := c.recvAEAD.Open(frame[:0],
+			encNonce(c.recvNonce), frame, nil)
+		if err != nil {
+			return 0, errors.New("failed to authenticate encrypted " +
+				"frame")
+		}
+		c.recvNonce++
+		c.readBuf = plaintext
+	}
+
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypts and writes data to the connection.  This is part of the
+// net.Conn interface implementation.
+func (c *encryptedConn) Write(b []byte) (int, error) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxEncFramePlaintext {
+			chunk = chunk[:maxEncFramePlaintext]
+		}
+		frame := make([]byte, encFrameHeaderSize, encFrameHeaderSize+
+			len(chunk)+c.sendAEAD.Overhead())
+		frame = c.sendAEAD.Seal(frame, encNonce(c.sendNonce), chunk, nil)
+		binary.LittleEndian.PutUint32(frame,
+			uint32(len(frame)-encFrameHeaderSize))
+		if _, err := c.Conn.Write(frame); err != nil {
+			return written, err
+		}
+		c.sendNonce++
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// encSession houses the secrets derived from the encinit exchange.
+type encSession struct {
+	sendKey   []byte
+	recvKey   []byte
+	sessionID []byte
+}
+
+// deriveEncSecret derives a 32-byte secret for the passed label from the ECDH
+// shared secret and the transcript of both ephemeral keys.
+func deriveEncSecret(sharedSecret, transcript, label []byte) []byte {
+	mac := hmac.New(sha256.New, sharedSecret)
+	mac.Write(transcript)
+	mac.Write(label)
+	return mac.Sum(nil)
+}
+
+// newEncSession derives the session secrets from the local ephemeral private
+// key and the remote ephemeral public key.  The initiator is the peer that
+// made the outbound connection.  Binding both ephemeral keys, in initiator
+// then responder order, into every derived secret ensures both peers agree on
+// the exchange that took place.
+func newEncSession(localKey *btcec.PrivateKey, remoteKey *btcec.PublicKey,
+	initiator bool) *encSession {
+
+	sharedSecret := btcec.GenerateSharedSecret(localKey, remoteKey)
+
+	localPub := localKey.PubKey().SerializeCompressed()
+	remotePub := remoteKey.SerializeCompressed()
+	transcript := append(append([]byte{}, remotePub...), localPub...)
+	if initiator {
+		transcript = append(append([]byte{}, localPub...), remotePub...)
+	}
+
+	initiatorKey := deriveEncSecret(sharedSecret, transcript,
+		encInitiatorKeyLabel)
+	responderKey := deriveEncSecret(sharedSecret, transcript,
+		encResponderKeyLabel)
+	session := &encSession{
+		sessionID: deriveEncSecret(sharedSecret, transcript,
+			encSessionIDLabel),
+	}
+	if initiator {
+		session.sendKey, session.recvKey = initiatorKey, responderKey
+	} else {
+		session.sendKey, session.recvKey = responderKey, initiatorKey
+	}
+	return session
+}
+
+// authHash returns the hash signed by a peer to prove possession of its
+// identity key.  The role of the signer is included so a signature can not be
+// reflected back to the peer that produced it.
+func (s *encSession) authHash(initiator bool) []byte {
+	role := byte(0)
+	if initiator {
+		role = 1
+	}
+	h := sha256.New()
+	h.Write(encAuthLabel)
+	h.Write(s.sessionID)
+	h.Write([]byte{role})
+	return h.Sum(nil)
+}
+
+// newEncryptedConn wraps the passed connection with the session keys.
+func newEncryptedConn(conn net.Conn, session *encSession) (*encryptedConn, error) {
+	sendBlock, err := aes.NewCipher(session.sendKey)
+	if err != nil {
+		return nil, err
+	}
+	sendAEAD, err := cipher.NewGCM(sendBlock)
+	if err != nil {
+		return nil, err
+	}
+	recvBlock, err := aes.NewCipher(session.recvKey)
+	if err != nil {
+		return nil, err
+	}
+	recvAEAD, err := cipher.NewGCM(recvBlock)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedConn{
+		Conn:     conn,
+		sendAEAD: sendAEAD,
+		recvAEAD: recvAEAD,
+	}, nil
+}
+
+// transportRequired returns whether the local peer requires the remote peer
+// to negotiate an encrypted transport.
+func (p *Peer) transportRequired() bool {
+	return p.cfg.RequireEncryption || p.cfg.AuthorizePeerKey != nil
+}
+
+// exchangeMessage sends the passed message and reads the reply from the remote
+// peer.  The outbound peer sends first and the inbound peer replies, so the
+// exchange also works over connections which do not buffer writes.
+func (p *Peer) exchangeMessage(msg wire.Message) (wire.Message, error) {
+	if !p.inbound {
+		if err := p.writeMessage(msg); err != nil {
+			return nil, err
+		}
+	}
+	reply, _, err := p.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	if p.inbound {
+		if err := p.writeMessage(msg); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+// negotiateTransport upgrades the connection to an encrypted transport when
+// both peers advertised the SFNodeEncrypted service in their version messages.
+// It must only be called once the version exchange has completed and before
+// any other messages have been sent.  Since the service is advertised in the
+// unauthenticated version messages, the connection is only protected against a
+// downgrade to plaintext when the transport is required.
+//
+// After the encinit exchange, both peers send an encauth message over the
+// encrypted transport which proves possession of their identity key, if any.
+// When the local peer is configured to authorize peer keys, the remote peer
+// must prove possession of an authorized key or an error is returned.
+func (p *Peer) negotiateTransport() error {
+	const sfEncrypted = wire.SFNodeEncrypted
+	localSupported := p.cfg.Services&sfEncrypted == sfEncrypted
+	remoteSupported := p.Services()&sfEncrypted == sfEncrypted
+	if !localSupported || !remoteSupported {
+		if p.transportRequired() {
+			return ErrEncryptionRequired
+		}
+		return nil
+	}
+
+	// Exchange ephemeral keys.
+	ephemeralKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return err
+	}
+	var localEphemeral [wire.EncInitKeySize]byte
+	copy(localEphemeral[:], ephemeralKey.PubKey().SerializeCompressed())
+	msg, err := p.exchangeMessage(wire.NewMsgEncInit(localEphemeral))
+	if err != nil {
+		return err
+	}
+	encInit, ok := msg.(*wire.MsgEncInit)
+	if !ok {
+		return fmt.Errorf("expected encinit message, got %s",
+			msg.Command())
+	}
+	remoteEphemeral, err := btcec.ParsePubKey(encInit.EphemeralKey[:],
+		btcec.S256())
+	if err != nil {
+		return fmt.Errorf("invalid encinit ephemeral key: %v", err)
+	}
+
+	// Switch to the encrypted transport.  Nothing else is reading or
+	// writing messages until negotiation completes.
+	session := newEncSession(ephemeralKey, remoteEphemeral, !p.inbound)
+	encConn, err := newEncryptedConn(p.conn, session)
+	if err != nil {
+		return err
+	}
+	p.msgConn = encConn
+
+	// Exchange proofs of possession of the identity keys.  A peer without
+	// an identity key sends an empty encauth message.
+	authMsg := wire.NewMsgEncAuth(nil, nil)
+	if p.cfg.TransportKey != nil {
+		sig, err := p.cfg.TransportKey.Sign(session.authHash(!p.inbound))
+		if err != nil {
+			return err
+		}
+		authMsg.PubKey = p.cfg.TransportKey.PubKey().SerializeCompressed()
+		authMsg.Signature = sig.Serialize()
+	}
+	msg, err = p.exchangeMessage(authMsg)
+	if err != nil {
+		return err
+	}
+	remoteAuth, ok := msg.(*wire.MsgEncAuth)
+	if !ok {
+		return fmt.Errorf("expected encauth message, got %s",
+			msg.Command())
+	}
+
+	// Verify the remote identity key, if one was provided.
+	var remoteKey *btcec.PublicKey
+	if len(remoteAuth.PubKey) != 0 {
+		remoteKey, err = btcec.ParsePubKey(remoteAuth.PubKey, btcec.S256())
+		if err != nil {
+			return fmt.Errorf("invalid encauth public key: %v", err)
+		}
+		sig, err := btcec.ParseDERSignature(remoteAuth.Signature,
+			btcec.S256())
+		if err != nil {
+			return fmt.Errorf("invalid encauth signature: %v", err)
+		}
+		if !sig.Verify(session.authHash(p.inbound), remoteKey) {
+			return errors.New("encauth signature does not match " +
+				"public key")
+		}
+	}
+	if p.cfg.AuthorizePeerKey != nil {
+		if remoteKey == nil || !p.cfg.AuthorizePeerKey(remoteKey) {
+			return ErrPeerNotAuthorized
+		}
+	}
+
+	p.flagsMtx.Lock()
+	p.encrypted = true
+	p.authKey = remoteKey
+	p.flagsMtx.Unlock()
+	log.Debugf("Negotiated encrypted transport with peer %s", p)
+	return nil
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TxProof houses a proof that one or more transactions are included in a
+// block which can be verified against the header of the block alone.
+//
+// The merkle root in a block header is the hash of the root of a merkle tree
+// over the hashes of the transactions, which exclude signatures, concatenated
+// with the root of a merkle tree over their hashes including signatures.  A
+// proof therefore consists of a merkle block with a partial merkle tree over
+// the transaction hashes along with a partial merkle tree over the hashes
+// including signatures which matches the same transactions.
+type TxProof struct {
+	wire.MsgMerkleBlock
+	SigHashes []*chainhash.Hash
+	SigFlags  []byte
+}
+
+// partialMerkleTree returns the hashes and flags of a partial merkle tree over
+// the passed hashes which matches the hashes whose matched bit is set.
+func partialMerkleTree(allHashes []*chainhash.Hash, matchedBits []byte) ([]*chainhash.Hash, []byte) {
+	mBlock := merkleBlock{
+		numTx:       uint32(len(allHashes)),
+		allHashes:   allHashes,
+		matchedBits: matchedBits,
+	}
+
+	// Calculate the number of merkle branches (height) in the tree.
+	height := uint32(0)
+	for mBlock.calcTreeWidth(height) > 1 {
+		height++
+	}
+
+	// Build the depth-first partial merkle tree.
+	mBlock.traverseAndBuild(height, 0)
+
+	flags := make([]byte, (len(mBlock.bits)+7)/8)
+	for i := uint32(0); i < uint32(len(mBlock.bits)); i++ {
+		flags[i/8] |= mBlock.bits[i] << (i % 8)
+	}
+	return mBlock.finalHashes, flags
+}
+
+// NewTxProof returns a proof that the transactions identified by the passed
+// hashes, which may either be their hashes or their hashes including
+// signatures, are included in the passed block.  An error is returned when any
+// of the transactions is not in the block.
+func NewTxProof(block *provautil.Block, txHashes []*chainhash.Hash) (*TxProof, error) {
+	if len(txHashes) == 0 {
+		return nil, errors.New("no transactions to prove")
+	}
+	wanted := make(map[chainhash.Hash]struct{}, len(txHashes))
+	for _, txHash := range txHashes {
+		wanted[*txHash] = struct{}{}
+	}
+
+	transactions := block.Transactions()
+	numTx := len(transactions)
+	hashes := make([]*chainhash.Hash, 0, numTx)
+	sigHashes := make([]*chainhash.Hash, 0, numTx)
+	matchedBits := make([]byte, 0, numTx)
+	for _, tx := range transactions {
+		var matched byte
+		for _, hash := range []*chainhash.Hash{tx.Hash(), tx.HashWithSig()} {
+			if _, ok := wanted[*hash]; ok {
+				delete(wanted, *hash)
+				matched = 0x01
+			}
+		}
+		hashes = append(hashes, tx.Hash())
+		sigHashes = append(sigHashes, tx.HashWithSig())
+		matchedBits = append(matchedBits, matched)
+	}
+	for txHash := range wanted {
+		return nil, fmt.Errorf("transaction %v is not in block %v",
+			txHash, block.Hash())
+	}
+
+	proof := TxProof{
+		MsgMerkleBlock: wire.MsgMerkleBlock{
+			Header:       block.MsgBlock().Header,
+			Transactions: uint32(numTx),
+		},
+	}
+	proof.Hashes, proof.Flags = partialMerkleTree(hashes, matchedBits)
+	proof.SigHashes, proof.SigFlags = partialMerkleTree(sigHashes,
+		matchedBits)
+	return &proof, nil
+}
+
+// maxSigFlags returns the maximum number of flag bytes of the partial merkle
+// tree over the hashes including signatures.  A partial merkle tree has at
+// most one flag bit per node.
+func (p *TxProof) maxSigFlags() uint32 {
+	return (2*p.Transactions + 7) / 8
+}
+
+// Serialize encodes the proof to w.  The merkle block is encoded as it is on
+// the wire, which is followed by the hashes and flags of the partial merkle
+// tree over the hashes including signatures.
+func (p *TxProof) Serialize(w io.Writer) error {
+	err := p.MsgMerkleBlock.BtcEncode(w, wire.ProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(p.SigHashes)) > uint64(p.Transactions) {
+		return fmt.Errorf("too many signature hashes for proof [count "+
+			"%v, max %v]", len(p.SigHashes), p.Transactions)
+	}
+	err = wire.WriteVarInt(w, 0, uint64(len(p.SigHashes)))
+	if err != nil {
+		return err
+	}
+	for _, hash := range p.SigHashes {
+		if _, err := w.Write(hash[:]); err != nil {
+			return err
+		}
+	}
+	return wire.WriteVarBytes(w, 0, p.SigFlags)
+}
+
+// Deserialize decodes a proof from r into the receiver using the format that
+// is produced by Serialize.
+func (p *TxProof) Deserialize(r io.Reader) error {
+	err := p.MsgMerkleBlock.BtcDecode(r, wire.ProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > uint64(p.Transactions) {
+		return fmt.Errorf("too many signature hashes for proof [count "+
+			"%v, max %v]", count, p.Transactions)
+	}
+	hashes := make([]chainhash.Hash, count)
+	p.SigHashes = make([]*chainhash.Hash, 0, count)
+	for i := range hashes {
+		if _, err := io.ReadFull(r, hashes[i][:]); err != nil {
+			return err
+		}
+		p.SigHashes = append(p.SigHashes, &hashes[i])
+	}
+
+	p.SigFlags, err = wire.ReadVarBytes(r, 0, p.maxSigFlags(),
+		"proof signature flags size")
+	return err
+}
+
+// merkleTreeExtractor is used to house intermediate information needed to
+// calculate the root of a partial merkle tree and extract the hashes it
+// matches.
+type merkleTreeExtractor struct {
+	numTx          uint32
+	hashes         []*chainhash.Hash
+	flags          []byte
+	bitsUsed       uint32
+	hashesUsed     uint32
+	matchedHashes  []*chainhash.Hash
+	matchedIndexes []uint32
+}
+
+// calcTreeWidth calculates and returns the the number of nodes (width) or a
+// merkle tree at the given depth-first height.
+func (m *merkleTreeExtractor) calcTreeWidth(height uint32) uint32 {
+	return (m.numTx + (1 << height) - 1) >> height
+}
+
+// traverseAndExtract calculates the hash of the sub-tree at the given
+// depth-first height and node position using a recursive depth-first approach
+// which mirrors traverseAndBuild.  As it consumes the flags and hashes, it
+// also saves the matched leaf hashes along with their indexes.
+func (m *merkleTreeExtractor) traverseAndExtract(height, pos uint32) (*chainhash.Hash, error) {
+	if m.bitsUsed >= uint32(len(m.flags))*8 {
+		return nil, errors.New("partial merkle tree overflowed flags")
+	}
+	isParent := (m.flags[m.bitsUsed/8] >> (m.bitsUsed % 8)) & 0x01
+	m.bitsUsed++
+
+	// When the node is a leaf node or not a parent of a matched node, its
+	// hash is part of the proof.
+	if height == 0 || isParent == 0x00 {
+		if m.hashesUsed >= uint32(len(m.hashes)) {
+			return nil, errors.New("partial merkle tree overflowed " +
+				"hashes")
+		}
+		hash := m.hashes[m.hashesUsed]
+		m.hashesUsed++
+		if height == 0 && isParent == 0x01 {
+			m.matchedHashes = append(m.matchedHashes, hash)
+			m.matchedIndexes = append(m.matchedIndexes, pos)
+		}
+		return hash, nil
+	}
+
+	// Descend into the left child and then the right child when there is
+	// one.  Identical children would allow the same transactions to be
+	// proven at different positions, so they are rejected.
+	left, err := m.traverseAndExtract(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	right := left
+	if pos*2+1 < m.calcTreeWidth(height-1) {
+		right, err = m.traverseAndExtract(height-1, pos*2+1)
+		if err != nil {
+			return nil, err
+		}
+		if right.IsEqual(left) {
+			return nil, errors.New("partial merkle tree has " +
+				"identical children")
+		}
+	}
+	return blockchain.HashMerkleBranches(left, right), nil
+}
+
+// extract returns the root of the partial merkle tree and ensures all of its
+// hashes and flags were consumed.
+func (m *merkleTreeExtractor) extract() (*chainhash.Hash, error) {
+	if m.numTx == 0 {
+		return nil, errors.New("proof does not contain any transactions")
+	}
+	if uint32(len(m.hashes)) > m.numTx {
+		return nil, errors.New("partial merkle tree has more hashes " +
+			"than transactions")
+	}
+
+	height := uint32(0)
+	for m.calcTreeWidth(height) > 1 {
+		height++
+	}
+	root, err := m.traverseAndExtract(height, 0)
+	if err != nil {
+		return nil, err
+	}
+	if m.hashesUsed != uint32(len(m.hashes)) {
+		return nil, errors.New("partial merkle tree has unused hashes")
+	}
+	if (m.bitsUsed+7)/8 != uint32(len(m.flags)) {
+		return nil, errors.New("partial merkle tree has unused flags")
+	}
+	return root, nil
+}
+
+// Verify checks the proof against the merkle root in its block header.  It
+// returns the hashes of the proven transactions along with their hashes
+// including signatures, in the order the transactions appear in the block.
+func (p *TxProof) Verify() ([]*chainhash.Hash, []*chainhash.Hash, error) {
+	tree := merkleTreeExtractor{
+		numTx:  p.Transactions,
+		hashes: p.Hashes,
+		flags:  p.Flags,
+	}
+	root, err := tree.extract()
+	if err != nil {
+		return nil, nil, err
+	}
+	sigTree := merkleTreeExtractor{
+		numTx:  p.Transactions,
+		hashes: p.SigHashes,
+		flags:  p.SigFlags,
+	}
+	sigRoot, err := sigTree.extract()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Both trees must match the same transactions.
+	if len(tree.matchedIndexes) != len(sigTree.matchedIndexes) {
+		return nil, nil, errors.New("partial merkle trees match a " +
+			"different number of transactions")
+	}
+	for i, index := range tree.matchedIndexes {
+		if sigTree.matchedIndexes[i] != index {
+			return nil, nil, errors.New("partial merkle trees match " +
+				"different transactions")
+		}
+	}
+
+	merkleRoot := blockchain.HashMerkleBranches(root, sigRoot)
+	if !p.Header.MerkleRoot.IsEqual(merkleRoot) {
+		str := fmt.Sprintf("proof merkle root %v does not match %v "+
+			"in block header", merkleRoot, p.Header.MerkleRoot)
+		return nil, nil, errors.New(str)
+	}
+	return tree.matchedHashes, sigTree.matchedHashes, nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bloom_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/bloom"
+	"github.com/bitgo/prova/wire"
+)
+
+// proofTestBlock returns a block with the passed number of transactions and a
+// valid merkle root.
+func proofTestBlock(numTx int) *provautil.Block {
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{Version: 1})
+	for i := 0; i < numTx; i++ {
+		tx := wire.NewMsgTx(1)
+		prevOut := wire.NewOutPoint(&chainhash.Hash{0x01}, uint32(i))
+		tx.AddTxIn(wire.NewTxIn(prevOut, []byte{byte(i), 0x01}))
+		tx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		provautil.NewBlock(msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return provautil.NewBlock(msgBlock)
+}
+
+// TestTxProof ensures transaction proofs are created, serialized and verified
+// against the merkle root as expected.
+func TestTxProof(t *testing.T) {
+	tests := []struct {
+		numTx   int
+		indexes []int
+	}{
+		{numTx: 1, indexes: []int{0}},
+		{numTx: 2, indexes: []int{1}},
+		{numTx: 3, indexes: []int{2}},
+		{numTx: 5, indexes: []int{0, 3}},
+		{numTx: 7, indexes: []int{1, 4, 6}},
+		{numTx: 8, indexes: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+
+	for i, test := range tests {
+		block := proofTestBlock(test.numTx)
+		txns := block.Transactions()
+
+		// Identify every other transaction by its hash including
+		// signatures.
+		txHashes := make([]*chainhash.Hash, 0, len(test.indexes))
+		for j, index := range test.indexes {
+			txHash := txns[index].Hash()
+			if j%2 == 1 {
+				txHash = txns[index].HashWithSig()
+			}
+			txHashes = append(txHashes, txHash)
+		}
+		proof, err := bloom.NewTxProof(block, txHashes)
+		if err != nil {
+			t.Errorf("NewTxProof #%d: unexpected error: %v", i, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := proof.Serialize(&buf); err != nil {
+			t.Errorf("Serialize #%d: unexpected error: %v", i, err)
+			continue
+		}
+		var decoded bloom.TxProof
+		if err := decoded.Deserialize(&buf); err != nil {
+			t.Errorf("Deserialize #%d: unexpected error: %v", i, err)
+			continue
+		}
+
+		hashes, sigHashes, err := decoded.Verify()
+		if err != nil {
+			t.Errorf("Verify #%d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(hashes) != len(test.indexes) ||
+			len(sigHashes) != len(test.indexes) {
+
+			t.Errorf("Verify #%d: got %d hashes and %d signature "+
+				"hashes, want %d", i, len(hashes), len(sigHashes),
+				len(test.indexes))
+			continue
+		}
+		for j, index := range test.indexes {
+			if !hashes[j].IsEqual(txns[index].Hash()) ||
+				!sigHashes[j].IsEqual(txns[index].HashWithSig()) {
+
+				t.Errorf("Verify #%d: mismatched transaction %d",
+					i, index)
+			}
+		}
+
+		// The proof must not verify against a different merkle root.
+		decoded.Header.MerkleRoot = chainhash.Hash{0x01}
+		if _, _, err := decoded.Verify(); err == nil {
+			t.Errorf("Verify #%d: expected error for wrong merkle "+
+				"root", i)
+		}
+	}
+}
+
+// TestTxProofErrors ensures invalid proofs and requests are rejected.
+func TestTxProofErrors(t *testing.T) {
+	block := proofTestBlock(4)
+	txns := block.Transactions()
+
+	// Transactions which are not in the block can not be proven.
+	_, err := bloom.NewTxProof(block, []*chainhash.Hash{{0x02}})
+	if err == nil {
+		t.Fatalf("NewTxProof: expected error for unknown transaction")
+	}
+	if _, err := bloom.NewTxProof(block, nil); err == nil {
+		t.Fatalf("NewTxProof: expected error for no transactions")
+	}
+
+	// A proof whose trees match different transactions is invalid even
+	// though both trees are valid on their own.
+	proof, err := bloom.NewTxProof(block, []*chainhash.Hash{txns[1].Hash()})
+	if err != nil {
+		t.Fatalf("NewTxProof: unexpected error: %v", err)
+	}
+	other, err := bloom.NewTxProof(block, []*chainhash.Hash{txns[2].Hash()})
+	if err != nil {
+		t.Fatalf("NewTxProof: unexpected error: %v", err)
+	}
+	mixed := *proof
+	mixed.SigHashes = other.SigHashes
+	mixed.SigFlags = other.SigFlags
+	if _, _, err := mixed.Verify(); err == nil {
+		t.Fatalf("Verify: expected error for mismatched trees")
+	}
+
+	// A proof with a replaced signature hash must not verify.
+	tampered := *proof
+	tampered.SigHashes = append([]*chainhash.Hash(nil), proof.SigHashes...)
+	tampered.SigHashes[0] = &chainhash.Hash{0x03}
+	if _, _, err := tampered.Verify(); err == nil {
+		t.Fatalf("Verify: expected error for tampered signature hash")
+	}
+
+	// Truncated proofs must fail to decode.
+	var buf bytes.Buffer
+	if err := proof.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: unexpected error: %v", err)
+	}
+	serialized := buf.Bytes()
+	var decoded bloom.TxProof
+	err = decoded.Deserialize(bytes.NewReader(serialized[:len(serialized)-1]))
+	if err == nil {
+		t.Fatalf("Deserialize: expected error for truncated proof")
+	}
+}
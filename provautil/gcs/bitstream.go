@@ -0,0 +1,76 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gcs
+
+import "io"
+
+// bitWriter writes individual bits, most significant bit first, to a byte
+// slice.
+type bitWriter struct {
+	bytes []byte
+	next  uint8
+}
+
+// writeBit appends a single bit to the stream.
+func (w *bitWriter) writeBit(bit bool) {
+	if w.next == 0 {
+		w.bytes = append(w.bytes, 0)
+		w.next = 8
+	}
+	w.next--
+	if bit {
+		w.bytes[len(w.bytes)-1] |= 1 << w.next
+	}
+}
+
+// writeBits appends the low count bits of data to the stream, most
+// significant bit first.
+func (w *bitWriter) writeBits(data uint64, count uint8) {
+	for count > 0 {
+		count--
+		w.writeBit(data&(1<<count) != 0)
+	}
+}
+
+// bitReader reads individual bits, most significant bit first, from a byte
+// slice.
+type bitReader struct {
+	bytes []byte
+	next  uint8
+}
+
+// readBit reads a single bit from the stream.  io.EOF is returned when the
+// stream is exhausted.
+func (r *bitReader) readBit() (bool, error) {
+	if len(r.bytes) == 0 {
+		return false, io.EOF
+	}
+	if r.next == 0 {
+		r.next = 8
+	}
+	r.next--
+	bit := r.bytes[0]&(1<<r.next) != 0
+	if r.next == 0 {
+		r.bytes = r.bytes[1:]
+	}
+	return bit, nil
+}
+
+// readBits reads count bits from the stream and returns them as the low bits
+// of the result.
+func (r *bitReader) readBits(count uint8) (uint64, error) {
+	var data uint64
+	for i := uint8(0); i < count; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		data <<= 1
+		if bit {
+			data |= 1
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package builder builds the compact block filters of BIP0158 for Prova blocks.
+
+The regular filter of a block contains every output script created in the
+block and every output script spent by it.  Since Prova addresses refer to
+ASP keys by their key ids, the filter also contains an item for every key id
+in those scripts, which is created by KeyIDItem, so a wallet can watch all
+addresses which use a key without knowing every address.
+
+Admin operations are data carrier outputs, which are included in the filter
+along with the key ids of ASP key operations.  Every admin transaction both
+spends and creates the thread script of its admin thread, so matching the
+thread script finds every block which changes the admin state of the thread.
+*/
+package builder
+
+import (
+	"bytes"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/gcs"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// DeriveKey returns the key used to hash the items of the filter of the block
+// with the passed hash, which is the first gcs.KeySize bytes of the hash.
+func DeriveKey(blockHash *chainhash.Hash) [gcs.KeySize]byte {
+	var key [gcs.KeySize]byte
+	copy(key[:], blockHash[:gcs.KeySize])
+	return key
+}
+
+// KeyIDItem returns the filter item for the passed ASP key id.
+func KeyIDItem(keyID btcec.KeyID) []byte {
+	item := make([]byte, btcec.KeyIDSize)
+	keyID.ToAddressFormat(item)
+	return item
+}
+
+// scriptItems returns the filter items of the passed output script, which are
+// the script itself along with the key ids it refers to.
+func scriptItems(pkScript []byte) [][]byte {
+	if len(pkScript) == 0 {
+		return nil
+	}
+	items := [][]byte{pkScript}
+
+	pops, err := txscript.ParseScript(pkScript)
+	if err != nil {
+		return items
+	}
+	switch txscript.TypeOfScript(pops) {
+	case txscript.ProvaTy, txscript.GeneralProvaTy:
+		keyIDs, err := txscript.ExtractKeyIDs(pops)
+		if err != nil {
+			return items
+		}
+		for _, keyID := range keyIDs {
+			items = append(items, KeyIDItem(keyID))
+		}
+	}
+	return items
+}
+
+// adminItems returns the key id items of the ASP key operations in the passed
+// transaction.  Other admin operations are covered by their output scripts.
+func adminItems(tx *wire.MsgTx) [][]byte {
+	threadInt, adminOutputs := txscript.GetAdminDetailsMsgTx(tx)
+	if provautil.ThreadID(threadInt) != provautil.ProvisionThread {
+		return nil
+	}
+
+	var items [][]byte
+	for _, pops := range adminOutputs {
+		if !txscript.IsValidAdminOp(pops, provautil.ProvisionThread) {
+			continue
+		}
+		_, keySetType, _, keyID := txscript.ExtractAdminOpData(pops)
+		if keySetType == btcec.ASPKeySet {
+			items = append(items, KeyIDItem(keyID))
+		}
+	}
+	return items
+}
+
+// BuildBasicFilter builds the regular filter of the passed block.  The passed
+// scripts must be the output scripts spent by the inputs of the block, which
+// are not part of the block itself.
+func BuildBasicFilter(block *wire.MsgBlock, prevOutScripts [][]byte) (*gcs.Filter, error) {
+	blockHash := block.BlockHash()
+	var items [][]byte
+	for _, tx := range block.Transactions {
+		for _, txOut := range tx.TxOut {
+			items = append(items, scriptItems(txOut.PkScript)...)
+		}
+		items = append(items, adminItems(tx)...)
+	}
+	for _, pkScript := range prevOutScripts {
+		items = append(items, scriptItems(pkScript)...)
+	}
+
+	return gcs.BuildGCSFilter(gcs.DefaultP, gcs.DefaultM,
+		DeriveKey(&blockHash), items)
+}
+
+// GetFilterHash returns the hash of the passed filter, which is the double
+// SHA256 of its serialization.
+func GetFilterHash(filter *gcs.Filter) (chainhash.Hash, error) {
+	filterData, err := filter.NBytes()
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return chainhash.DoubleHashH(filterData), nil
+}
+
+// MakeHeaderForFilter returns the filter header which commits to the passed
+// filter and the passed header of the filter of the previous block.
+func MakeHeaderForFilter(filter *gcs.Filter, prevHeader chainhash.Hash) (chainhash.Hash, error) {
+	filterHash, err := GetFilterHash(filter)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return MakeHeaderForFilterHash(filterHash, prevHeader), nil
+}
+
+// MakeHeaderForFilterHash returns the filter header which commits to the
+// filter with the passed hash and the passed header of the filter of the
+// previous block.
+func MakeHeaderForFilterHash(filterHash, prevHeader chainhash.Hash) chainhash.Hash {
+	var buf bytes.Buffer
+	buf.Grow(2 * chainhash.HashSize)
+	buf.Write(filterHash[:])
+	buf.Write(prevHeader[:])
+	return chainhash.DoubleHashH(buf.Bytes())
+}
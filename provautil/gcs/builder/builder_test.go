@@ -0,0 +1,146 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package builder_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/gcs/builder"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// provaScript returns the output script of a Prova address with the passed
+// key ids.
+func provaScript(t *testing.T, pkHashByte byte, keyIDs ...btcec.KeyID) []byte {
+	pkHash := bytes.Repeat([]byte{pkHashByte}, 20)
+	addr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	return pkScript
+}
+
+// TestBuildBasicFilter ensures the regular filter of a block contains the
+// created and spent output scripts, the key ids they refer to and the key ids
+// of ASP key operations.
+func TestBuildBasicFilter(t *testing.T) {
+	outScript := provaScript(t, 0x01, 1, 2)
+	spentScript := provaScript(t, 0x02, 3, 4)
+
+	// Admin transaction which provisions ASP key id 5.
+	threadScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(provautil.ProvisionThread)).
+		AddOp(txscript.OP_CHECKTHREAD).Script()
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	data := make([]byte, 1+btcec.PubKeyBytesLenCompressed+btcec.KeyIDSize)
+	data[0] = txscript.AdminOpASPKeyAdd
+	copy(data[1:], privKey.PubKey().SerializeCompressed())
+	btcec.KeyID(5).ToAddressFormat(data[1+btcec.PubKeyBytesLenCompressed:])
+	aspScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData(data).Script()
+	if err != nil {
+		t.Fatalf("unable to create admin script: %v", err)
+	}
+	adminTx := wire.NewMsgTx(1)
+	adminTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, 1),
+		nil))
+	adminTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	adminTx.AddTxOut(wire.NewTxOut(0, aspScript))
+
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), []byte{0x01, 0x01}))
+	coinbase.AddTxOut(wire.NewTxOut(1000, outScript))
+
+	block := wire.NewMsgBlock(&wire.BlockHeader{Version: 1, Height: 1})
+	block.AddTransaction(coinbase)
+	block.AddTransaction(adminTx)
+	prevOutScripts := [][]byte{spentScript, threadScript}
+
+	filter, err := builder.BuildBasicFilter(block, prevOutScripts)
+	if err != nil {
+		t.Fatalf("BuildBasicFilter: unexpected error: %v", err)
+	}
+	blockHash := block.BlockHash()
+	key := builder.DeriveKey(&blockHash)
+
+	tests := []struct {
+		name  string
+		item  []byte
+		match bool
+	}{
+		{"output script", outScript, true},
+		{"spent script", spentScript, true},
+		{"thread script", threadScript, true},
+		{"admin operation", aspScript, true},
+		{"output key id", builder.KeyIDItem(1), true},
+		{"spent key id", builder.KeyIDItem(4), true},
+		{"provisioned key id", builder.KeyIDItem(5), true},
+		{"unrelated key id", builder.KeyIDItem(6), false},
+		{"unrelated script", provaScript(t, 0x03, 1, 2), false},
+	}
+	for _, test := range tests {
+		match, err := filter.Match(key, test.item)
+		if err != nil {
+			t.Errorf("Match %s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if match != test.match {
+			t.Errorf("Match %s: got %v, want %v", test.name, match,
+				test.match)
+		}
+	}
+}
+
+// TestMakeHeaderForFilter ensures filter headers commit to the filter and the
+// previous filter header.
+func TestMakeHeaderForFilter(t *testing.T) {
+	block := wire.NewMsgBlock(&wire.BlockHeader{Version: 1})
+	filter, err := builder.BuildBasicFilter(block, nil)
+	if err != nil {
+		t.Fatalf("BuildBasicFilter: unexpected error: %v", err)
+	}
+
+	// The serialization of an empty filter is a single zero byte.
+	filterHash, err := builder.GetFilterHash(filter)
+	if err != nil {
+		t.Fatalf("GetFilterHash: unexpected error: %v", err)
+	}
+	if want := chainhash.DoubleHashH([]byte{0x00}); filterHash != want {
+		t.Fatalf("GetFilterHash: got %v, want %v", filterHash, want)
+	}
+
+	prevHeader := chainhash.Hash{0x01}
+	header, err := builder.MakeHeaderForFilter(filter, prevHeader)
+	if err != nil {
+		t.Fatalf("MakeHeaderForFilter: unexpected error: %v", err)
+	}
+	want := chainhash.DoubleHashH(append(filterHash[:], prevHeader[:]...))
+	if header != want {
+		t.Fatalf("MakeHeaderForFilter: got %v, want %v", header, want)
+	}
+	if header == builder.MakeHeaderForFilterHash(filterHash, chainhash.Hash{}) {
+		t.Fatalf("MakeHeaderForFilterHash: header does not commit to " +
+			"the previous header")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package gcs implements Golomb-coded sets as used by the compact block filters
+of BIP0158.
+
+A Golomb-coded set is a probabilistic structure similar to a bloom filter.
+Every item is hashed with SipHash-2-4 to a value in the range [0, N*M), where
+N is the number of items, and the sorted differences between the values are
+encoded with Golomb-Rice coding using the parameter P.  Matching an item which
+is not in the set has a false positive rate of 1/M.
+*/
+package gcs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// KeySize is the size of the key used to hash the items of a filter.
+	KeySize = 16
+
+	// DefaultP is the Golomb-Rice coding parameter of BIP0158 filters.
+	DefaultP = 19
+
+	// DefaultM is the inverse of the false positive rate of BIP0158
+	// filters.
+	DefaultM = 784931
+
+	// MaxItems is the maximum number of items in a filter, which limits
+	// the size of the range the items are hashed to.
+	MaxItems = 1<<32 - 1
+)
+
+var (
+	// ErrNTooBig is returned when a filter is built with more items than
+	// MaxItems.
+	ErrNTooBig = errors.New("number of items exceeds the maximum")
+
+	// ErrPTooBig is returned when the Golomb-Rice coding parameter exceeds
+	// the size of the hashed values.
+	ErrPTooBig = errors.New("coding parameter exceeds 32 bits")
+)
+
+// mulHi64 returns the high 64 bits of the 128-bit product of x and y.
+func mulHi64(x, y uint64) uint64 {
+	const mask32 = 1<<32 - 1
+	x0, x1 := x&mask32, x>>32
+	y0, y1 := y&mask32, y>>32
+	w0 := x0 * y0
+	t := x1*y0 + w0>>32
+	w1 := t&mask32 + x0*y1
+	return x1*y1 + t>>32 + w1>>32
+}
+
+// hashToRange hashes the passed item with the passed key and maps the result
+// uniformly onto the range [0, modulus) without a division.
+func hashToRange(key [KeySize]byte, item []byte, modulus uint64) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	return mulHi64(chainhash.SipHash24(k0, k1, item), modulus)
+}
+
+// Filter describes a Golomb-coded set along with the parameters it was built
+// with.
+type Filter struct {
+	n          uint32
+	p          uint8
+	modulusNM  uint64
+	filterData []byte
+}
+
+// BuildGCSFilter builds a filter with the parameters P and M over the passed
+// items, which are hashed using the passed key.  Duplicate items are only
+// included once.
+func BuildGCSFilter(P uint8, M uint64, key [KeySize]byte, data [][]byte) (*Filter, error) {
+	if uint64(len(data)) > MaxItems {
+		return nil, ErrNTooBig
+	}
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+
+	// Remove duplicate items so they do not inflate the number of items
+	// the range is scaled by.
+	seen := make(map[string]struct{}, len(data))
+	items := make([][]byte, 0, len(data))
+	for _, item := range data {
+		if _, ok := seen[string(item)]; ok {
+			continue
+		}
+		seen[string(item)] = struct{}{}
+		items = append(items, item)
+	}
+
+	f := Filter{
+		n:         uint32(len(items)),
+		p:         P,
+		modulusNM: uint64(len(items)) * M,
+	}
+	values := make([]uint64, 0, len(items))
+	for _, item := range items {
+		values = append(values, hashToRange(key, item, f.modulusNM))
+	}
+	sort.Sort(uint64Slice(values))
+
+	// Encode the difference between each value and the previous one with
+	// the quotient in unary followed by the remainder in P bits.
+	var w bitWriter
+	var lastValue uint64
+	for _, value := range values {
+		delta := value - lastValue
+		lastValue = value
+		for quotient := delta >> P; quotient > 0; quotient-- {
+			w.writeBit(true)
+		}
+		w.writeBit(false)
+		w.writeBits(delta, P)
+	}
+	f.filterData = w.bytes
+	return &f, nil
+}
+
+// FromNBytes deserializes a filter with the parameters P and M from the
+// format produced by NBytes.
+func FromNBytes(P uint8, M uint64, d []byte) (*Filter, error) {
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+	r := bytes.NewReader(d)
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxItems {
+		return nil, ErrNTooBig
+	}
+	filterData := d[len(d)-r.Len():]
+	if n == 0 && len(filterData) != 0 {
+		return nil, fmt.Errorf("empty filter has %d bytes of data",
+			len(filterData))
+	}
+
+	return &Filter{
+		n:          uint32(n),
+		p:          P,
+		modulusNM:  n * M,
+		filterData: filterData,
+	}, nil
+}
+
+// N returns the number of items in the filter.
+func (f *Filter) N() uint32 {
+	return f.n
+}
+
+// P returns the Golomb-Rice coding parameter of the filter.
+func (f *Filter) P() uint8 {
+	return f.p
+}
+
+// NBytes returns the serialized filter, which is the number of items encoded
+// as a variable length integer followed by the Golomb-Rice coded data.
+func (f *Filter) NBytes() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(wire.VarIntSerializeSize(uint64(f.n)) + len(f.filterData))
+	if err := wire.WriteVarInt(&buf, 0, uint64(f.n)); err != nil {
+		return nil, err
+	}
+	buf.Write(f.filterData)
+	return buf.Bytes(), nil
+}
+
+// readValue decodes the next difference from the passed reader and adds it to
+// the passed value.
+func (f *Filter) readValue(r *bitReader, lastValue uint64) (uint64, error) {
+	var quotient uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		quotient++
+	}
+	remainder, err := r.readBits(f.p)
+	if err != nil {
+		return 0, err
+	}
+	return lastValue + quotient<<f.p + remainder, nil
+}
+
+// Match returns whether the passed item, which is hashed using the passed key,
+// is likely in the filter.
+func (f *Filter) Match(key [KeySize]byte, data []byte) (bool, error) {
+	return f.MatchAny(key, [][]byte{data})
+}
+
+// MatchAny returns whether any of the passed items, which are hashed using the
+// passed key, is likely in the filter.  It is more efficient than matching the
+// items one at a time since the filter is only decoded once.
+func (f *Filter) MatchAny(key [KeySize]byte, data [][]byte) (bool, error) {
+	if f.n == 0 || len(data) == 0 {
+		return false, nil
+	}
+
+	targets := make([]uint64, 0, len(data))
+	for _, item := range data {
+		targets = append(targets, hashToRange(key, item, f.modulusNM))
+	}
+	sort.Sort(uint64Slice(targets))
+
+	// Walk the sorted values of the filter and the targets together.
+	r := bitReader{bytes: f.filterData}
+	var value uint64
+	for i := uint32(0); i < f.n; i++ {
+		var err error
+		value, err = f.readValue(&r, value)
+		if err == io.EOF {
+			return false, errors.New("filter data is truncated")
+		}
+		if err != nil {
+			return false, err
+		}
+		for len(targets) > 0 && targets[0] < value {
+			targets = targets[1:]
+		}
+		if len(targets) == 0 {
+			return false, nil
+		}
+		if targets[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uint64Slice implements sort.Interface to allow a slice of uint64 values to
+// be sorted.
+type uint64Slice []uint64
+
+// Len returns the number of values in the slice.  It is part of the
+// sort.Interface implementation.
+func (s uint64Slice) Len() int {
+	return len(s)
+}
+
+// Less returns whether the value with index i should sort before the value
+// with index j.  It is part of the sort.Interface implementation.
+func (s uint64Slice) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+// Swap swaps the values at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s uint64Slice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
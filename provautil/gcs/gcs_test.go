@@ -0,0 +1,178 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gcs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil/gcs"
+)
+
+// testItems returns count distinct items starting with the passed offset.
+func testItems(offset, count int) [][]byte {
+	items := make([][]byte, 0, count)
+	for i := offset; i < offset+count; i++ {
+		item := make([]byte, 8)
+		binary.BigEndian.PutUint64(item, uint64(i))
+		items = append(items, item)
+	}
+	return items
+}
+
+// TestGCSFilterVector ensures filters are encoded as specified by the BIP0158
+// test vector for the genesis block of the bitcoin test network.
+func TestGCSFilterVector(t *testing.T) {
+	blockHash, err := chainhash.NewHashFromStr("000000000933ea01ad0ee98420" +
+		"9779baaec3ced90fa3f408719526f8d77f4943")
+	if err != nil {
+		t.Fatalf("NewHashFromStr: unexpected error: %v", err)
+	}
+	var key [gcs.KeySize]byte
+	copy(key[:], blockHash[:])
+	pkScript, err := hex.DecodeString("4104678afdb0fe5548271967f1a67130b7" +
+		"105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec" +
+		"112de5c384df7ba0b8d578a4c702b6bf11d5fac")
+	if err != nil {
+		t.Fatalf("DecodeString: unexpected error: %v", err)
+	}
+
+	filter, err := gcs.BuildGCSFilter(gcs.DefaultP, gcs.DefaultM, key,
+		[][]byte{pkScript})
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: unexpected error: %v", err)
+	}
+	serialized, err := filter.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: unexpected error: %v", err)
+	}
+	if want := "019dfca8"; hex.EncodeToString(serialized) != want {
+		t.Fatalf("NBytes: got %x, want %s", serialized, want)
+	}
+}
+
+// TestGCSFilter ensures filters match their items, rarely match other items
+// and survive serialization.
+func TestGCSFilter(t *testing.T) {
+	key := [gcs.KeySize]byte{0x01, 0x02, 0x03}
+	items := testItems(0, 1000)
+
+	// Duplicate items must only be counted once.
+	filter, err := gcs.BuildGCSFilter(gcs.DefaultP, gcs.DefaultM, key,
+		append(items, items[:10]...))
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: unexpected error: %v", err)
+	}
+	if filter.N() != uint32(len(items)) {
+		t.Fatalf("N: got %d, want %d", filter.N(), len(items))
+	}
+
+	serialized, err := filter.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: unexpected error: %v", err)
+	}
+	decoded, err := gcs.FromNBytes(gcs.DefaultP, gcs.DefaultM, serialized)
+	if err != nil {
+		t.Fatalf("FromNBytes: unexpected error: %v", err)
+	}
+	reserialized, err := decoded.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: unexpected error: %v", err)
+	}
+	if !bytes.Equal(serialized, reserialized) {
+		t.Fatalf("NBytes: decoded filter serializes differently")
+	}
+
+	for i, item := range items {
+		match, err := decoded.Match(key, item)
+		if err != nil {
+			t.Fatalf("Match: unexpected error: %v", err)
+		}
+		if !match {
+			t.Fatalf("Match: item %d is not matched", i)
+		}
+	}
+
+	// With a false positive rate of 1/DefaultM, none of the other items
+	// should match in practice.
+	others := testItems(len(items), 1000)
+	match, err := decoded.MatchAny(key, others)
+	if err != nil {
+		t.Fatalf("MatchAny: unexpected error: %v", err)
+	}
+	if match {
+		t.Fatalf("MatchAny: unexpected match of other items")
+	}
+	match, err = decoded.MatchAny(key, append(others, items[500]))
+	if err != nil {
+		t.Fatalf("MatchAny: unexpected error: %v", err)
+	}
+	if !match {
+		t.Fatalf("MatchAny: item is not matched")
+	}
+
+	// The same items hashed with a different key must not match.
+	otherKey := [gcs.KeySize]byte{0x04}
+	match, err = decoded.MatchAny(otherKey, items[:100])
+	if err != nil {
+		t.Fatalf("MatchAny: unexpected error: %v", err)
+	}
+	if match {
+		t.Fatalf("MatchAny: unexpected match with a different key")
+	}
+}
+
+// TestGCSFilterEdgeCases ensures empty and malformed filters are handled.
+func TestGCSFilterEdgeCases(t *testing.T) {
+	key := [gcs.KeySize]byte{}
+
+	// An empty filter serializes to a single zero count and never
+	// matches.
+	filter, err := gcs.BuildGCSFilter(gcs.DefaultP, gcs.DefaultM, key, nil)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: unexpected error: %v", err)
+	}
+	serialized, err := filter.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: unexpected error: %v", err)
+	}
+	if !bytes.Equal(serialized, []byte{0x00}) {
+		t.Fatalf("NBytes: got %x, want 00", serialized)
+	}
+	match, err := filter.Match(key, []byte{0x01})
+	if err != nil || match {
+		t.Fatalf("Match: got %v (err %v), want no match", match, err)
+	}
+
+	if _, err := gcs.BuildGCSFilter(33, gcs.DefaultM, key, nil); err != gcs.ErrPTooBig {
+		t.Fatalf("BuildGCSFilter: got %v, want %v", err, gcs.ErrPTooBig)
+	}
+	if _, err := gcs.FromNBytes(gcs.DefaultP, gcs.DefaultM, nil); err == nil {
+		t.Fatalf("FromNBytes: expected error for missing count")
+	}
+
+	// A truncated filter must fail to match rather than silently report
+	// no match.
+	items := testItems(0, 100)
+	filter, err = gcs.BuildGCSFilter(gcs.DefaultP, gcs.DefaultM, key, items)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: unexpected error: %v", err)
+	}
+	serialized, err = filter.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: unexpected error: %v", err)
+	}
+	truncated, err := gcs.FromNBytes(gcs.DefaultP, gcs.DefaultM,
+		serialized[:len(serialized)/2])
+	if err != nil {
+		t.Fatalf("FromNBytes: unexpected error: %v", err)
+	}
+	if _, err := truncated.MatchAny(key, testItems(1000, 100)); err == nil {
+		t.Fatalf("MatchAny: expected error for truncated filter")
+	}
+}
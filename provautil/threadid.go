@@ -5,6 +5,8 @@
 package provautil
 
 import (
+	"fmt"
+
 	"github.com/bitgo/prova/wire"
 )
 
@@ -14,6 +16,20 @@ const IssueThread = ThreadID(2)
 
 type ThreadID uint8
 
+// String returns the name of the admin thread.
+func (threadID ThreadID) String() string {
+	switch threadID {
+	case RootThread:
+		return "root"
+	case ProvisionThread:
+		return "provision"
+	case IssueThread:
+		return "issue"
+	default:
+		return fmt.Sprintf("unknown thread %d", uint8(threadID))
+	}
+}
+
 func CopyThreadTips(threadTips map[ThreadID]*wire.OutPoint) map[ThreadID]*wire.OutPoint {
 	threadTipsCopy := make(map[ThreadID]*wire.OutPoint)
 	for threadId, outPoint := range threadTips {
@@ -0,0 +1,254 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// rpcAuthUser describes a set of RPC credentials along with the methods a
+// client that authenticated with them is allowed to call.
+type rpcAuthUser struct {
+	// name identifies the credentials in log messages.  It is never the
+	// secret part of the credentials.
+	name string
+
+	// authsha is the SHA256 of the full HTTP Authorization header value
+	// that must be supplied to authenticate as this user.
+	authsha [sha256.Size]byte
+
+	// isAdmin specifies whether the user may call every method.  When it
+	// is false, the user may only call the methods matching methods.
+	isAdmin bool
+
+	// methods is the set of method patterns the user is allowed to call.
+	// The patterns are matched with path.Match, so they may use the '*'
+	// and '?' wildcards, for example "get*".
+	methods []string
+}
+
+// isAuthorized returns whether the user is allowed to call the passed method.
+func (u *rpcAuthUser) isAuthorized(method string) bool {
+	if u.isAdmin {
+		return true
+	}
+	for _, pattern := range u.methods {
+		// The patterns are validated when they are parsed, so errors
+		// can't happen here.
+		if matched, _ := path.Match(pattern, method); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// basicAuthSHA returns the SHA256 of the HTTP Basic Authorization header value
+// for the passed username and password.
+func basicAuthSHA(user, pass string) [sha256.Size]byte {
+	login := user + ":" + pass
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	return sha256.Sum256([]byte(auth))
+}
+
+// bearerAuthSHA returns the SHA256 of the HTTP Bearer Authorization header
+// value for the passed API token.
+func bearerAuthSHA(token string) [sha256.Size]byte {
+	return sha256.Sum256([]byte("Bearer " + token))
+}
+
+// newAdminAuthUser returns the credentials for the admin user which is allowed
+// to call every method.
+func newAdminAuthUser(user, pass string) *rpcAuthUser {
+	return &rpcAuthUser{
+		name:    user,
+		authsha: basicAuthSHA(user, pass),
+		isAdmin: true,
+	}
+}
+
+// newLimitAuthUser returns the credentials for the limited user which is only
+// allowed to call the methods in rpcLimited.
+func newLimitAuthUser(user, pass string) *rpcAuthUser {
+	methods := make([]string, 0, len(rpcLimited))
+	for method := range rpcLimited {
+		methods = append(methods, method)
+	}
+	return &rpcAuthUser{
+		name:    user,
+		authsha: basicAuthSHA(user, pass),
+		methods: methods,
+	}
+}
+
+// parseMethodPatterns parses a comma separated list of method patterns and
+// ensures each of them is a valid pattern.
+func parseMethodPatterns(patterns string) ([]string, error) {
+	var methods []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid method pattern %q",
+				pattern)
+		}
+		methods = append(methods, pattern)
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no method patterns specified")
+	}
+	return methods, nil
+}
+
+// splitAuthSpec splits an authorization specification of the form
+// name:secret:methods into its parts.  The secret may itself contain colons
+// since the name and methods are split off the ends.
+func splitAuthSpec(spec string) (string, string, string, error) {
+	first := strings.Index(spec, ":")
+	last := strings.LastIndex(spec, ":")
+	if first == -1 || first == last {
+		return "", "", "", fmt.Errorf("%q is not of the form "+
+			"name:secret:method[,method...]", spec)
+	}
+	name, secret, methods := spec[:first], spec[first+1:last], spec[last+1:]
+	if name == "" || secret == "" {
+		return "", "", "", fmt.Errorf("%q has an empty name or secret",
+			spec)
+	}
+	return name, secret, methods, nil
+}
+
+// parseRPCAuthUser parses a user specification of the form
+// user:pass:method[,method...] as used by the --rpcauthuser option.  The user
+// authenticates with HTTP Basic authentication, or the websocket authenticate
+// command, using the given username and password.
+func parseRPCAuthUser(spec string) (*rpcAuthUser, error) {
+	user, pass, patterns, err := splitAuthSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := parseMethodPatterns(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %v", user, err)
+	}
+	return &rpcAuthUser{
+		name:    user,
+		authsha: basicAuthSHA(user, pass),
+		methods: methods,
+	}, nil
+}
+
+// parseRPCAuthToken parses an API token specification of the form
+// name:token:method[,method...] as used by the --rpcauthtoken option.  The
+// client authenticates by sending the token in an HTTP Bearer Authorization
+// header.  The name is only used to identify the token in log messages.
+func parseRPCAuthToken(spec string) (*rpcAuthUser, error) {
+	name, token, patterns, err := splitAuthSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := parseMethodPatterns(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("token %s: %v", name, err)
+	}
+	return &rpcAuthUser{
+		name:    name,
+		authsha: bearerAuthSHA(token),
+		methods: methods,
+	}, nil
+}
+
+// parseRPCAuthUsers parses the passed --rpcauthuser and --rpcauthtoken
+// specifications.  Every name must be unique and must not be the same as any
+// of the passed reserved names, which are the admin and limited usernames.
+func parseRPCAuthUsers(userSpecs, tokenSpecs []string, reserved ...string) ([]*rpcAuthUser, error) {
+	names := make(map[string]struct{})
+	for _, name := range reserved {
+		if name != "" {
+			names[name] = struct{}{}
+		}
+	}
+
+	users := make([]*rpcAuthUser, 0, len(userSpecs)+len(tokenSpecs))
+	add := func(user *rpcAuthUser) error {
+		if _, ok := names[user.name]; ok {
+			return fmt.Errorf("duplicate name %q", user.name)
+		}
+		names[user.name] = struct{}{}
+		users = append(users, user)
+		return nil
+	}
+	for _, spec := range userSpecs {
+		user, err := parseRPCAuthUser(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(user); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range tokenSpecs {
+		user, err := parseRPCAuthToken(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(user); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// lookupAuthUser returns the user whose credentials produce the passed
+// Authorization header hash, or nil when there is no such user.
+//
+// Every user is compared so the time taken does not depend on which user, if
+// any, matched.
+func lookupAuthUser(users []*rpcAuthUser, authsha [sha256.Size]byte) *rpcAuthUser {
+	var match *rpcAuthUser
+	for _, user := range users {
+		cmp := subtle.ConstantTimeCompare(authsha[:], user.authsha[:])
+		if cmp == 1 && match == nil {
+			match = user
+		}
+	}
+	return match
+}
+
+// isPrivilegedMethod returns whether calls to the passed method are recorded
+// in the audit log.  Every method that is not available to the limited user is
+// considered privileged since those are the methods which are able to change
+// the state of the server.
+func isPrivilegedMethod(method string) bool {
+	_, ok := rpcLimited[method]
+	return !ok
+}
+
+// authorizeCall returns whether the passed user may call the passed method.
+// Calls to privileged methods, whether or not they are allowed, are recorded
+// in the audit log along with the user and remote address that made them.
+func authorizeCall(user *rpcAuthUser, remoteAddr, method string) bool {
+	authorized := user != nil && user.isAuthorized(method)
+	if isPrivilegedMethod(method) {
+		name := "<unauthenticated>"
+		if user != nil {
+			name = user.name
+		}
+		if authorized {
+			auditLog.Infof("%s (%s) called %s", name, remoteAddr,
+				method)
+		} else {
+			auditLog.Warnf("%s (%s) denied %s", name, remoteAddr,
+				method)
+		}
+	}
+	return authorized
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+// TestParseRPCAuthUsers ensures the --rpcauthuser and --rpcauthtoken
+// specifications are parsed and validated as expected.
+func TestParseRPCAuthUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   []string
+		tokens  []string
+		wantErr bool
+	}{
+		{
+			name:   "user and token",
+			users:  []string{"signer:pa:ss:setvalidatekeys"},
+			tokens: []string{"monitor:abc123:get*,help"},
+		},
+		{
+			name:    "missing methods",
+			users:   []string{"signer:pass"},
+			wantErr: true,
+		},
+		{
+			name:    "empty methods",
+			tokens:  []string{"monitor:abc123: , "},
+			wantErr: true,
+		},
+		{
+			name:    "empty secret",
+			users:   []string{"signer::get*"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			tokens:  []string{"monitor:abc123:get["},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			users:   []string{"monitor:pass:get*"},
+			tokens:  []string{"monitor:abc123:get*"},
+			wantErr: true,
+		},
+		{
+			name:    "reserved name",
+			users:   []string{"admin:pass:get*"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		users, err := parseRPCAuthUsers(test.users, test.tokens, "admin")
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error",
+					test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(users) != len(test.users)+len(test.tokens) {
+			t.Errorf("%s: got %d users, want %d", test.name,
+				len(users), len(test.users)+len(test.tokens))
+		}
+	}
+}
+
+// TestRPCAuthUserAuthorization ensures credentials are looked up by their
+// Authorization header and only authorize the expected methods.
+func TestRPCAuthUserAuthorization(t *testing.T) {
+	users, err := parseRPCAuthUsers(
+		[]string{"signer:secret:setvalidatekeys"},
+		[]string{"monitor:abc123:get*"})
+	if err != nil {
+		t.Fatalf("parseRPCAuthUsers: unexpected error: %v", err)
+	}
+	users = append(users, newAdminAuthUser("admin", "adminpass"),
+		newLimitAuthUser("limit", "limitpass"))
+
+	tests := []struct {
+		name    string
+		authsha [32]byte
+		user    string
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "basic auth user",
+			authsha: basicAuthSHA("signer", "secret"),
+			user:    "signer",
+			allowed: []string{"setvalidatekeys"},
+			denied:  []string{"getblock", "stop"},
+		},
+		{
+			name:    "bearer token",
+			authsha: bearerAuthSHA("abc123"),
+			user:    "monitor",
+			allowed: []string{"getblock", "getinfo"},
+			denied:  []string{"setvalidatekeys", "stop", "help"},
+		},
+		{
+			name:    "admin",
+			authsha: basicAuthSHA("admin", "adminpass"),
+			user:    "admin",
+			allowed: []string{"setvalidatekeys", "stop", "getblock"},
+		},
+		{
+			name:    "limited user",
+			authsha: basicAuthSHA("limit", "limitpass"),
+			user:    "limit",
+			allowed: []string{"getblock", "help"},
+			denied:  []string{"setvalidatekeys", "stop"},
+		},
+		{
+			name:    "token sent as basic auth",
+			authsha: basicAuthSHA("monitor", "abc123"),
+		},
+	}
+
+	for _, test := range tests {
+		user := lookupAuthUser(users, test.authsha)
+		if test.user == "" {
+			if user != nil {
+				t.Errorf("%s: unexpected match of user %s",
+					test.name, user.name)
+			}
+			continue
+		}
+		if user == nil || user.name != test.user {
+			t.Errorf("%s: did not match user %s", test.name,
+				test.user)
+			continue
+		}
+		for _, method := range test.allowed {
+			if !authorizeCall(user, "127.0.0.1", method) {
+				t.Errorf("%s: %s unexpectedly denied",
+					test.name, method)
+			}
+		}
+		for _, method := range test.denied {
+			if authorizeCall(user, "127.0.0.1", method) {
+				t.Errorf("%s: %s unexpectedly allowed",
+					test.name, method)
+			}
+		}
+	}
+
+	if authorizeCall(nil, "127.0.0.1", "getblock") {
+		t.Errorf("unauthenticated call unexpectedly allowed")
+	}
+}
@@ -9,14 +9,13 @@ package main
 import (
 	"bytes"
 	"crypto/sha256"
-	"crypto/subtle"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/indexers"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
@@ -25,8 +24,10 @@ import (
 	"github.com/bitgo/prova/mempool"
 	"github.com/bitgo/prova/mining"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/bloom"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
+	"github.com/btcsuite/golangcrypto/ripemd160"
 	"github.com/btcsuite/websocket"
 	"io"
 	"io/ioutil"
@@ -35,6 +36,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -65,6 +67,10 @@ const (
 
 	// maxProtocolVersion is the max protocol version the server supports.
 	maxProtocolVersion = 70002
+
+	// maxAdminTxProofsRange is the maximum number of blocks which can be
+	// scanned for admin transactions by a single getadmintxproofs request.
+	maxAdminTxProofsRange = 2000
 )
 
 var (
@@ -121,10 +127,16 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"createrawtransaction":  handleCreateRawTransaction,
 	"debuglevel":            handleDebugLevel,
 	"decoderawtransaction":  handleDecodeRawTransaction,
+	"decodescript":          handleDecodeScript,
 	"generate":              handleGenerate,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
+	"getaddressbalance":     handleGetAddressBalance,
+	"getaddressdeltas":      handleGetAddressDeltas,
+	"getaddressmempool":     handleGetAddressMempool,
 	"getaddresstxids":       handleGetAddressTxIds,
+	"getaddressutxos":       handleGetAddressUtxos,
 	"getadmininfo":          handleGetAdminInfo,
+	"getadmintxproofs":      handleGetAdminTxProofs,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
 	"getblock":              handleGetBlock,
@@ -132,6 +144,8 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getblockhash":          handleGetBlockHash,
 	"getblockheader":        handleGetBlockHeader,
 	"getblocktemplate":      handleGetBlockTemplate,
+	"getcfilter":            handleGetCFilter,
+	"getcfilterheader":      handleGetCFilterHeader,
 	"getconnectioncount":    handleGetConnectionCount,
 	"getcurrentnet":         handleGetCurrentNet,
 	"getdifficulty":         handleGetDifficulty,
@@ -147,6 +161,8 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getrawmempool":         handleGetRawMempool,
 	"getrawtransaction":     handleGetRawTransaction,
 	"gettxout":              handleGetTxOut,
+	"gettxoutproof":         handleGetTxOutProof,
+	"gettxstatus":           handleGetTxStatus,
 	"help":                  handleHelp,
 	"node":                  handleNode,
 	"ping":                  handlePing,
@@ -156,8 +172,11 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"setvalidatekeys":       handleSetValidateKeys,
 	"stop":                  handleStop,
 	"submitblock":           handleSubmitBlock,
+	"testmempoolaccept":     handleTestMempoolAccept,
+	"tracetxinput":          handleTraceTxInput,
 	"validateaddress":       handleValidateAddress,
 	"verifychain":           handleVerifyChain,
+	"verifytxoutproof":      handleVerifyTxOutProof,
 }
 
 // list of commands that we recognize, but for which there is no support because
@@ -240,13 +259,20 @@ var rpcLimited = map[string]struct{}{
 	"createrawtransaction":  {},
 	"decoderawtransaction":  {},
 	"decodescript":          {},
+	"getaddressbalance":     {},
+	"getaddressdeltas":      {},
+	"getaddressmempool":     {},
 	"getaddresstxids":       {},
+	"getaddressutxos":       {},
 	"getadmininfo":          {},
+	"getadmintxproofs":      {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
 	"getblockcount":         {},
 	"getblockhash":          {},
+	"getcfilter":            {},
+	"getcfilterheader":      {},
 	"getcurrentnet":         {},
 	"getdifficulty":         {},
 	"getheaders":            {},
@@ -256,11 +282,16 @@ var rpcLimited = map[string]struct{}{
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
 	"gettxout":              {},
+	"gettxoutproof":         {},
+	"gettxstatus":           {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"testmempoolaccept":     {},
+	"tracetxinput":          {},
 	"validateaddress":       {},
 	"verifymessage":         {},
+	"verifytxoutproof":      {},
 }
 
 // builderScript is a convenience function which is used for hard-coded scripts
@@ -716,12 +747,13 @@ func createTxRawResult(chainParams *chaincfg.Params, mtx *wire.MsgTx,
 	}
 
 	txReply := &btcjson.TxRawResult{
-		Hex:      mtxHex,
-		Txid:     txHash,
-		Vin:      createVinList(mtx),
-		Vout:     createVoutList(mtx, chainParams, nil),
-		Version:  mtx.Version,
-		LockTime: mtx.LockTime,
+		Hex:         mtxHex,
+		Txid:        txHash,
+		HashWithSig: mtx.TxHashWithSig().String(),
+		Vin:         createVinList(mtx),
+		Vout:        createVoutList(mtx, chainParams, nil),
+		Version:     mtx.Version,
+		LockTime:    mtx.LockTime,
 	}
 
 	if blkHeader != nil {
@@ -759,15 +791,115 @@ func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 
 	// Create and return the result.
 	txReply := btcjson.TxRawDecodeResult{
-		Txid:     mtx.TxHash().String(),
-		Version:  mtx.Version,
-		Locktime: mtx.LockTime,
-		Vin:      createVinList(&mtx),
-		Vout:     createVoutList(&mtx, s.server.chainParams, nil),
+		Txid:        mtx.TxHash().String(),
+		HashWithSig: mtx.TxHashWithSig().String(),
+		Version:     mtx.Version,
+		Locktime:    mtx.LockTime,
+		Vin:         createVinList(&mtx),
+		Vout:        createVoutList(&mtx, s.server.chainParams, nil),
 	}
 	return txReply, nil
 }
 
+// handleDecodeScript handles decodescript commands.
+func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DecodeScriptCmd)
+
+	// Convert the hex script to bytes.
+	hexStr := c.HexScript
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	script, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+
+	// The disassembled string will contain [error] inline if the script
+	// doesn't fully parse, so ignore the error here.
+	disbuf, _ := txscript.DisasmString(script)
+
+	// Get information about the script.
+	// Ignore the error here since an error means the script couldn't parse
+	// and there is no additional information about it anyways.
+	scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(script,
+		s.server.chainParams)
+	addresses := make([]string, len(addrs))
+	for i, addr := range addrs {
+		addresses[i] = addr.EncodeAddress()
+	}
+
+	reply := btcjson.DecodeScriptResult{
+		Asm:       disbuf,
+		Type:      scriptClass.String(),
+		Addresses: addresses,
+		P2sh:      hex.EncodeToString(provautil.Hash160(script)),
+	}
+
+	switch scriptClass {
+	case txscript.ProvaTy, txscript.GeneralProvaTy:
+		// Resolve the KeyIDs of the script against the ASP keys which
+		// are currently registered.
+		numSigs, keyHashes, keyIDs, err := txscript.ExtractProvaSigners(script)
+		if err != nil {
+			break
+		}
+		reqSigs = numSigs
+		reply.PubKeyHashes = make([]string, len(keyHashes))
+		for i, keyHash := range keyHashes {
+			reply.PubKeyHashes[i] = hex.EncodeToString(keyHash)
+		}
+		aspKeyIdMap := s.chain.KeyIDs()
+		reply.KeyIDs = make([]btcjson.KeyIDResult, len(keyIDs))
+		for i, keyID := range keyIDs {
+			result := btcjson.KeyIDResult{
+				KeyID:  uint32(keyID),
+				Status: "unregistered/revoked",
+			}
+			if pubKey, ok := aspKeyIdMap[keyID]; ok {
+				result.PubKey = hex.EncodeToString(pubKey.SerializeCompressed())
+				result.Status = "registered"
+			}
+			reply.KeyIDs[i] = result
+		}
+
+	case txscript.ProvaAdminTy:
+		// Admin thread scripts are signed by the keys of the admin key
+		// set which corresponds to the thread.
+		pops, err := txscript.ParseScript(script)
+		if err != nil {
+			break
+		}
+		threadID, err := txscript.ExtractThreadID(pops)
+		if err != nil {
+			break
+		}
+		reqSigs = 2
+		reply.Thread = threadID.String()
+		keySet := s.chain.AdminKeySets()[btcec.KeySetType(threadID)]
+		reply.PubKeyHashes = make([]string, len(keySet))
+		for i, pubKey := range keySet {
+			keyHash := provautil.Hash160(pubKey.SerializeCompressed())
+			reply.PubKeyHashes[i] = hex.EncodeToString(keyHash)
+		}
+
+	case txscript.NullDataTy:
+		// Show the admin operation carried by the script, if any.
+		pops, err := txscript.ParseScript(script)
+		if err != nil {
+			break
+		}
+		if txscript.IsValidAdminOp(pops, provautil.RootThread) ||
+			txscript.IsValidAdminOp(pops, provautil.ProvisionThread) {
+
+			reply.AdminOp = txscript.AdminOpString(script)
+		}
+	}
+	reply.ReqSigs = int32(reqSigs)
+
+	return reply, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -1028,6 +1160,384 @@ func handleGetAddressTxIds(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return reply, nil
 }
 
+// addressQuery identifies the outputs an address command is asked about.  An
+// address is either a Prova address, which matches the outputs paying to it,
+// or a hex-encoded key hash, which matches the outputs paying to any Prova
+// address with the key hash.
+type addressQuery struct {
+	addr     provautil.Address
+	pkScript []byte
+	keyHash  []byte
+}
+
+// decodeAddressQueries decodes the addresses passed to an address command.
+func decodeAddressQueries(addresses []string, params *chaincfg.Params) ([]addressQuery, error) {
+	if len(addresses) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "No addresses provided",
+		}
+	}
+
+	queries := make([]addressQuery, 0, len(addresses))
+	for _, address := range addresses {
+		addr, err := provautil.DecodeAddress(address, params)
+		if err == nil {
+			pkScript, err := txscript.PayToAddrScript(addr)
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidAddressOrKey,
+					Message: "Invalid address or key: " + err.Error(),
+				}
+			}
+			queries = append(queries, addressQuery{
+				addr:     addr,
+				pkScript: pkScript,
+			})
+			continue
+		}
+
+		keyHash, hexErr := hex.DecodeString(address)
+		if hexErr != nil || len(keyHash) != ripemd160.Size {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + err.Error(),
+			}
+		}
+		queries = append(queries, addressQuery{keyHash: keyHash})
+	}
+	return queries, nil
+}
+
+// matches returns whether the passed public key script pays to the address of
+// the query.
+func (q *addressQuery) matches(pkScript []byte, params *chaincfg.Params) bool {
+	if q.addr != nil {
+		return bytes.Equal(pkScript, q.pkScript)
+	}
+	_, addrs, _, _ := txscript.ExtractPkScriptAddrs(pkScript, params)
+	for _, addr := range addrs {
+		if _, ok := addr.(*provautil.AddressProva); ok &&
+			bytes.Equal(addr.ScriptAddress(), q.keyHash) {
+
+			return true
+		}
+	}
+	return false
+}
+
+// pkScriptAddress returns the encoded address the passed public key script pays
+// to, or an empty string when it does not pay to an address.
+func pkScriptAddress(pkScript []byte, params *chaincfg.Params) string {
+	_, addrs, _, _ := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0].EncodeAddress()
+}
+
+// fetchAddressOutputs returns the outputs in the main chain which pay to any of
+// the passed addresses, including the spent ones, ordered by the order they
+// were created in.  Outputs matched by more than one address are only
+// returned once.
+func (s *rpcServer) fetchAddressOutputs(addresses []string) ([]indexers.AddrOutput, error) {
+	// Respond with an error if the address index is not enabled.
+	addrUtxoIndex := s.server.addrUtxoIndex
+	if addrUtxoIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Address index must be enabled (--addrindex)",
+		}
+	}
+
+	queries, err := decodeAddressQueries(addresses, s.server.chainParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []indexers.AddrOutput
+	seen := make(map[wire.OutPoint]struct{})
+	for i := range queries {
+		var queryOutputs []indexers.AddrOutput
+		var err error
+		if queries[i].addr != nil {
+			queryOutputs, err = addrUtxoIndex.OutputsForAddress(
+				queries[i].addr)
+		} else {
+			queryOutputs, err = addrUtxoIndex.OutputsForKeyHash(
+				queries[i].keyHash)
+		}
+		if err != nil {
+			context := "Failed to load address utxo index entries"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		for _, output := range queryOutputs {
+			if _, ok := seen[output.OutPoint]; ok {
+				continue
+			}
+			seen[output.OutPoint] = struct{}{}
+			outputs = append(outputs, output)
+		}
+	}
+	if len(queries) > 1 {
+		sort.Sort(addrOutputsByHeight(outputs))
+	}
+	return outputs, nil
+}
+
+// addrOutputsByHeight implements sort.Interface to allow a slice of address
+// outputs to be sorted by the order they were created in the main chain.
+type addrOutputsByHeight []indexers.AddrOutput
+
+// Len returns the number of outputs in the slice.  It is part of the
+// sort.Interface implementation.
+func (s addrOutputsByHeight) Len() int {
+	return len(s)
+}
+
+// Swap swaps the outputs at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s addrOutputsByHeight) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the output with index i was created before the output
+// with index j.  It is part of the sort.Interface implementation.
+func (s addrOutputsByHeight) Less(i, j int) bool {
+	if s[i].BlockHeight != s[j].BlockHeight {
+		return s[i].BlockHeight < s[j].BlockHeight
+	}
+	if s[i].TxIndex != s[j].TxIndex {
+		return s[i].TxIndex < s[j].TxIndex
+	}
+	return s[i].OutPoint.Index < s[j].OutPoint.Index
+}
+
+// addrDeltasByHeight implements sort.Interface to allow a slice of address
+// deltas to be sorted by the order they happened in the main chain.
+type addrDeltasByHeight []btcjson.AddressDeltaResult
+
+// Len returns the number of deltas in the slice.  It is part of the
+// sort.Interface implementation.
+func (s addrDeltasByHeight) Len() int {
+	return len(s)
+}
+
+// Swap swaps the deltas at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s addrDeltasByHeight) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the delta with index i happened before the delta with
+// index j.  Within a transaction, spent outputs come before created ones.  It
+// is part of the sort.Interface implementation.
+func (s addrDeltasByHeight) Less(i, j int) bool {
+	if s[i].Height != s[j].Height {
+		return s[i].Height < s[j].Height
+	}
+	if s[i].BlockIndex != s[j].BlockIndex {
+		return s[i].BlockIndex < s[j].BlockIndex
+	}
+	if (s[i].Atoms < 0) != (s[j].Atoms < 0) {
+		return s[i].Atoms < 0
+	}
+	return s[i].Index < s[j].Index
+}
+
+// handleGetAddressBalance implements the getaddressbalance command.
+func handleGetAddressBalance(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressBalanceCmd)
+
+	outputs, err := s.fetchAddressOutputs(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.GetAddressBalanceResult
+	for _, output := range outputs {
+		result.Received += output.Amount
+		if !output.Spent {
+			result.Balance += output.Amount
+		}
+	}
+	return &result, nil
+}
+
+// handleGetAddressDeltas implements the getaddressdeltas command.
+func handleGetAddressDeltas(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressDeltasCmd)
+
+	start := c.Request.Start
+	end := uint32(1<<32 - 1)
+	if c.Request.End > 0 {
+		end = c.Request.End
+	}
+	if start > end {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "End height must not be less than the start height.",
+		}
+	}
+
+	outputs, err := s.fetchAddressOutputs(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each output credits its address when it is created and debits it
+	// when it is spent.
+	params := s.server.chainParams
+	deltas := make([]btcjson.AddressDeltaResult, 0, len(outputs))
+	for _, output := range outputs {
+		address := pkScriptAddress(output.PkScript, params)
+		if output.BlockHeight >= start && output.BlockHeight <= end {
+			deltas = append(deltas, btcjson.AddressDeltaResult{
+				Atoms:      output.Amount,
+				Txid:       output.OutPoint.Hash.String(),
+				Index:      output.OutPoint.Index,
+				BlockIndex: output.TxIndex,
+				Height:     output.BlockHeight,
+				Address:    address,
+			})
+		}
+		if output.Spent && output.SpendHeight >= start &&
+			output.SpendHeight <= end {
+
+			deltas = append(deltas, btcjson.AddressDeltaResult{
+				Atoms:      -output.Amount,
+				Txid:       output.SpendHash.String(),
+				Index:      output.SpendIndex,
+				BlockIndex: output.SpendTxIndex,
+				Height:     output.SpendHeight,
+				Address:    address,
+			})
+		}
+	}
+	sort.Sort(addrDeltasByHeight(deltas))
+	return deltas, nil
+}
+
+// handleGetAddressMempool implements the getaddressmempool command.
+func handleGetAddressMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressMempoolCmd)
+
+	// Respond with an error if the address index is not enabled.
+	addrIndex := s.server.addrIndex
+	if addrIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Address index must be enabled (--addrindex)",
+		}
+	}
+
+	params := s.server.chainParams
+	queries, err := decodeAddressQueries(c.Request.Addresses, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gather the unconfirmed transactions involving any of the addresses
+	// along with the time they were added to the memory pool.
+	var txns []*provautil.Tx
+	seen := make(map[chainhash.Hash]struct{})
+	for i := range queries {
+		var queryTxns []*provautil.Tx
+		if queries[i].addr != nil {
+			queryTxns = addrIndex.UnconfirmedTxnsForAddress(
+				queries[i].addr)
+		} else {
+			queryTxns = addrIndex.UnconfirmedTxnsForKeyHash(
+				queries[i].keyHash)
+		}
+		for _, tx := range queryTxns {
+			if _, ok := seen[*tx.Hash()]; ok {
+				continue
+			}
+			seen[*tx.Hash()] = struct{}{}
+			txns = append(txns, tx)
+		}
+	}
+	added := make(map[chainhash.Hash]time.Time, len(txns))
+	for _, txD := range s.server.txMemPool.TxDescs() {
+		if _, ok := seen[*txD.Tx.Hash()]; ok {
+			added[*txD.Tx.Hash()] = txD.Added
+		}
+	}
+
+	// Each transaction debits the addresses of the outputs it spends and
+	// credits the addresses of the outputs it creates.
+	matchesAny := func(pkScript []byte) bool {
+		for i := range queries {
+			if queries[i].matches(pkScript, params) {
+				return true
+			}
+		}
+		return false
+	}
+	deltas := make([]btcjson.AddressMempoolDeltaResult, 0, len(txns))
+	for _, tx := range txns {
+		txid := tx.Hash().String()
+		timestamp := added[*tx.Hash()].Unix()
+		for txInIdx, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			pkScript, amount, err := s.fetchPrevOutput(&prevOut)
+			if err != nil || !matchesAny(pkScript) {
+				continue
+			}
+			deltas = append(deltas, btcjson.AddressMempoolDeltaResult{
+				Address:   pkScriptAddress(pkScript, params),
+				Txid:      txid,
+				Index:     uint32(txInIdx),
+				Atoms:     -amount,
+				Timestamp: timestamp,
+				PrevTxid:  prevOut.Hash.String(),
+				PrevOut:   &prevOut.Index,
+			})
+		}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if !matchesAny(txOut.PkScript) {
+				continue
+			}
+			deltas = append(deltas, btcjson.AddressMempoolDeltaResult{
+				Address:   pkScriptAddress(txOut.PkScript, params),
+				Txid:      txid,
+				Index:     uint32(txOutIdx),
+				Atoms:     txOut.Value,
+				Timestamp: timestamp,
+			})
+		}
+	}
+	return deltas, nil
+}
+
+// handleGetAddressUtxos implements the getaddressutxos command.
+func handleGetAddressUtxos(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressUtxosCmd)
+
+	outputs, err := s.fetchAddressOutputs(c.Request.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	params := s.server.chainParams
+	utxos := make([]btcjson.AddressUtxoResult, 0, len(outputs))
+	for _, output := range outputs {
+		if output.Spent {
+			continue
+		}
+		utxos = append(utxos, btcjson.AddressUtxoResult{
+			Address:     pkScriptAddress(output.PkScript, params),
+			Txid:        output.OutPoint.Hash.String(),
+			OutputIndex: output.OutPoint.Index,
+			Script:      hex.EncodeToString(output.PkScript),
+			Atoms:       output.Amount,
+			Height:      output.BlockHeight,
+		})
+	}
+	return utxos, nil
+}
+
 // handleGetAdminInfo implements the getadmininfo command.
 func handleGetAdminInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.chain.BestSnapshot()
@@ -1077,6 +1587,73 @@ func handleGetAdminInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return result, nil
 }
 
+// handleGetAdminTxProofs implements the getadmintxproofs command.
+func handleGetAdminTxProofs(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAdminTxProofsCmd)
+
+	best := s.chain.BestSnapshot()
+	if c.StartHeight > c.EndHeight || c.EndHeight > best.Height {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid block height range",
+		}
+	}
+	if c.EndHeight-c.StartHeight >= maxAdminTxProofsRange {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Block height range exceeds maximum "+
+				"of %d blocks", maxAdminTxProofsRange),
+		}
+	}
+
+	// Prove the admin transactions of every block in the range which
+	// contains any.  The coinbase is never an admin transaction.
+	results := make([]btcjson.GetAdminTxProofsResult, 0)
+	for height := c.StartHeight; height <= c.EndHeight; height++ {
+		block, err := s.chain.BlockByHeight(height)
+		if err != nil {
+			context := "Failed to fetch block"
+			return nil, internalRPCError(err.Error(), context)
+		}
+
+		var txHashes []*chainhash.Hash
+		var txns []string
+		for _, tx := range block.Transactions()[1:] {
+			threadInt, _ := txscript.GetAdminDetails(tx)
+			if threadInt < 0 {
+				continue
+			}
+			txHex, err := messageToHex(tx.MsgTx())
+			if err != nil {
+				return nil, err
+			}
+			txHashes = append(txHashes, tx.Hash())
+			txns = append(txns, txHex)
+		}
+		if len(txHashes) == 0 {
+			continue
+		}
+
+		proof, err := bloom.NewTxProof(block, txHashes)
+		if err != nil {
+			context := "Failed to create proof"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		var buf bytes.Buffer
+		if err := proof.Serialize(&buf); err != nil {
+			context := "Failed to serialize proof"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		results = append(results, btcjson.GetAdminTxProofsResult{
+			Height:       height,
+			Hash:         block.Hash().String(),
+			Proof:        hex.EncodeToString(buf.Bytes()),
+			Transactions: txns,
+		})
+	}
+	return results, nil
+}
+
 // handleGetBestBlock implements the getbestblock command.
 func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// All other "get block" commands give either the height, the
@@ -1132,6 +1709,13 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return err
 	})
 	if err != nil {
+		// Distinguish blocks whose data was pruned from unknown ones.
+		if pruned, _ := s.chain.IsBlockPruned(hash); pruned {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "Block not available (pruned data)",
+			}
+		}
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCBlockNotFound,
 			Message: "Block not found",
@@ -1988,6 +2572,8 @@ func chainErrToGBTErrString(err error) string {
 		return "bad-size-value"
 	case blockchain.ErrInvalidValidateKey:
 		return "invalid-validate-key"
+	case blockchain.ErrRevokedValidateKey:
+		return "revoked-validate-key"
 	case blockchain.ErrFeeTooHigh:
 		return "bad-txns-highfee"
 	}
@@ -2087,18 +2673,81 @@ func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	}
 }
 
-// handleGetConnectionCount implements the getconnectioncount command.
-func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return s.server.ConnectedCount(), nil
-}
+// fetchCommittedFilter returns the filter header and the serialized filter of
+// the passed type for the block with the passed hash from the committed filter
+// index.
+func fetchCommittedFilter(s *rpcServer, blockHash string, filterType uint8) (*chainhash.Hash, []byte, error) {
+	// Respond with an error if the committed filter index is not enabled.
+	cfIndex := s.server.cfIndex
+	if cfIndex == nil {
+		return nil, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Committed filter index must be enabled (--cfindex)",
+		}
+	}
+	if wire.FilterType(filterType) != wire.GCSFilterRegular {
+		return nil, nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Unsupported filter type %d",
+				filterType),
+		}
+	}
 
-// handleGetCurrentNet implements the getcurrentnet command.
-func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return s.server.chainParams.Net, nil
+	hash, err := chainhash.NewHashFromStr(blockHash)
+	if err != nil {
+		return nil, nil, rpcDecodeHexError(blockHash)
+	}
+	header, err := cfIndex.FilterHeaderByBlockHash(hash)
+	if err != nil {
+		context := "Failed to fetch filter header"
+		return nil, nil, internalRPCError(err.Error(), context)
+	}
+	if header == nil {
+		return nil, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+	filter, err := cfIndex.FilterByBlockHash(hash)
+	if err != nil {
+		context := "Failed to fetch filter"
+		return nil, nil, internalRPCError(err.Error(), context)
+	}
+	return header, filter, nil
 }
 
-// handleGetDifficulty implements the getdifficulty command.
-func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+// handleGetCFilter implements the getcfilter command.
+func handleGetCFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetCFilterCmd)
+	_, filter, err := fetchCommittedFilter(s, c.Hash, *c.FilterType)
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(filter), nil
+}
+
+// handleGetCFilterHeader implements the getcfilterheader command.
+func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetCFilterHeaderCmd)
+	header, _, err := fetchCommittedFilter(s, c.Hash, *c.FilterType)
+	if err != nil {
+		return nil, err
+	}
+	return header.String(), nil
+}
+
+// handleGetConnectionCount implements the getconnectioncount command.
+func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.server.ConnectedCount(), nil
+}
+
+// handleGetCurrentNet implements the getcurrentnet command.
+func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.server.chainParams.Net, nil
+}
+
+// handleGetDifficulty implements the getdifficulty command.
+func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.chain.BestSnapshot()
 	return getDifficultyRatio(best.Bits), nil
 }
@@ -2407,15 +3056,49 @@ func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return hashStrings, nil
 }
 
+// resolveTxHash returns the hash of the transaction identified by the passed
+// hash, which may either be its hash or its hash including signatures.  The
+// memory pool is searched first, followed by the transaction index when it is
+// enabled.  The passed hash is returned unchanged when no transaction is known
+// by it as a hash including signatures.
+func (s *rpcServer) resolveTxHash(hash *chainhash.Hash) (*chainhash.Hash, error) {
+	mp := s.server.txMemPool
+	if mp.HaveTransaction(hash) {
+		return hash, nil
+	}
+	if tx, err := mp.FetchTransactionByHashWithSig(hash); err == nil {
+		return tx.Hash(), nil
+	}
+
+	txIndex := s.server.txIndex
+	if txIndex == nil {
+		return hash, nil
+	}
+	txHash, err := txIndex.TxHashByHashWithSig(hash)
+	if err != nil {
+		context := "Failed to retrieve transaction hash"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if txHash == nil {
+		return hash, nil
+	}
+	return txHash, nil
+}
+
 // handleGetRawTransaction implements the getrawtransaction command.
 func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawTransactionCmd)
 
-	// Convert the provided transaction hash hex to a Hash.
+	// Convert the provided transaction hash hex to a Hash.  Either the hash
+	// of the transaction or its hash including signatures may be provided.
 	txHash, err := chainhash.NewHashFromStr(c.Txid)
 	if err != nil {
 		return nil, rpcDecodeHexError(c.Txid)
 	}
+	txHash, err = s.resolveTxHash(txHash)
+	if err != nil {
+		return nil, err
+	}
 
 	verbose := false
 	if c.Verbose != nil {
@@ -2531,11 +3214,16 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
 
-	// Convert the provided transaction hash hex to a Hash.
+	// Convert the provided transaction hash hex to a Hash.  Either the hash
+	// of the transaction or its hash including signatures may be provided.
 	txHash, err := chainhash.NewHashFromStr(c.Txid)
 	if err != nil {
 		return nil, rpcDecodeHexError(c.Txid)
 	}
+	txHash, err = s.resolveTxHash(txHash)
+	if err != nil {
+		return nil, err
+	}
 
 	// If requested and the tx is available in the mempool try to fetch it
 	// from there, otherwise attempt to fetch from the block database.
@@ -2636,6 +3324,208 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
+// fetchTxBlock returns the main chain block which contains the transaction
+// identified by the passed hash, which may either be its hash or its hash
+// including signatures.  The transaction index is used when it is enabled,
+// otherwise the transaction must have unspent outputs.
+func (s *rpcServer) fetchTxBlock(hash *chainhash.Hash) (*provautil.Block, error) {
+	txHash, err := s.resolveTxHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if txIndex := s.server.txIndex; txIndex != nil {
+		blockRegion, err := txIndex.TxBlockRegion(txHash)
+		if err != nil {
+			context := "Failed to retrieve transaction location"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if blockRegion != nil {
+			block, err := s.chain.BlockByHash(blockRegion.Hash)
+			if err != nil {
+				context := "Failed to retrieve block"
+				return nil, internalRPCError(err.Error(), context)
+			}
+			return block, nil
+		}
+	}
+
+	entry, err := s.chain.FetchUtxoEntry(txHash)
+	if err != nil {
+		context := "Failed to retrieve utxo entry"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if entry == nil || entry.IsFullySpent() {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Transaction not yet in block or no unspent " +
+				"outputs and no transaction index",
+		}
+	}
+	block, err := s.chain.BlockByHeight(entry.BlockHeight())
+	if err != nil {
+		context := "Failed to retrieve block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return block, nil
+}
+
+// handleGetTxStatus handles gettxstatus commands.
+func handleGetTxStatus(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxStatusCmd)
+
+	// Convert the provided transaction hash hex to a Hash.  Either the hash
+	// of the transaction or its hash including signatures may be provided.
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+	txHash, err = s.resolveTxHash(txHash)
+	if err != nil {
+		return nil, err
+	}
+	result := &btcjson.GetTxStatusResult{Txid: txHash.String()}
+
+	// The transaction is either in the main pool or waiting for its parents
+	// in the orphan pool.
+	mp := s.server.txMemPool
+	if tx, err := mp.FetchTransaction(txHash); err == nil {
+		result.HashWithSig = tx.HashWithSig().String()
+		result.Status = "mempool"
+		return result, nil
+	}
+	missingParents, isOrphan, err := mp.OrphanMissingParents(txHash)
+	if err != nil {
+		context := "Failed to retrieve missing parents"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if isOrphan {
+		result.Status = "orphan"
+		result.MissingParents = make([]string, len(missingParents))
+		for i, hash := range missingParents {
+			result.MissingParents[i] = hash.String()
+		}
+		return result, nil
+	}
+
+	// Look up the block containing the transaction using the transaction
+	// index when it is enabled, otherwise the transaction must have unspent
+	// outputs.
+	var blkHash *chainhash.Hash
+	var blkHeight uint32
+	if txIndex := s.server.txIndex; txIndex != nil {
+		blockRegion, err := txIndex.TxBlockRegion(txHash)
+		if err != nil {
+			context := "Failed to retrieve transaction location"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if blockRegion != nil {
+			blkHash = blockRegion.Hash
+			blkHeight, err = s.chain.BlockHeightByHash(blkHash)
+			if err != nil {
+				context := "Failed to retrieve block height"
+				return nil, internalRPCError(err.Error(), context)
+			}
+		}
+	}
+	if blkHash == nil {
+		entry, err := s.chain.FetchUtxoEntry(txHash)
+		if err != nil {
+			context := "Failed to retrieve utxo entry"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if entry != nil && !entry.IsFullySpent() {
+			blkHeight = entry.BlockHeight()
+			blkHash, err = s.chain.BlockHashByHeight(blkHeight)
+			if err != nil {
+				context := "Failed to retrieve block hash"
+				return nil, internalRPCError(err.Error(), context)
+			}
+		}
+	}
+	if blkHash != nil {
+		best := s.chain.BestSnapshot()
+		result.Status = "confirmed"
+		result.BlockHash = blkHash.String()
+		result.BlockHeight = blkHeight
+		result.Confirmations = int64(1 + best.Height - blkHeight)
+		return result, nil
+	}
+
+	// Transactions rejected by the memory pool are remembered for a while,
+	// regardless of whether they were submitted by a peer or via RPC.
+	if reject := mp.RejectedTx(txHash); reject != nil {
+		result.Txid = reject.Hash.String()
+		result.HashWithSig = reject.HashWithSig.String()
+		result.Status = "rejected"
+		result.RejectCode = uint8(reject.Code)
+		result.RejectReason = reject.Reason
+		result.RejectTime = reject.Time.Unix()
+		return result, nil
+	}
+
+	result.Status = "unknown"
+	return result, nil
+}
+
+// handleGetTxOutProof handles gettxoutproof commands.
+func handleGetTxOutProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutProofCmd)
+
+	if len(c.TxIDs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "No transaction hashes provided",
+		}
+	}
+	txHashes := make([]*chainhash.Hash, 0, len(c.TxIDs))
+	for _, txID := range c.TxIDs {
+		txHash, err := chainhash.NewHashFromStr(txID)
+		if err != nil {
+			return nil, rpcDecodeHexError(txID)
+		}
+		txHashes = append(txHashes, txHash)
+	}
+
+	// Load the block from the main chain when its hash is provided,
+	// otherwise locate the block which contains the first transaction.
+	var block *provautil.Block
+	if c.BlockHash != nil {
+		blockHash, err := chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		block, err = s.chain.BlockByHash(blockHash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
+	} else {
+		var err error
+		block, err = s.fetchTxBlock(txHashes[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	proof, err := bloom.NewTxProof(block, txHashes)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Not all transactions found in specified or " +
+				"retrieved block",
+		}
+	}
+	var buf bytes.Buffer
+	if err := proof.Serialize(&buf); err != nil {
+		context := "Failed to serialize proof"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.HelpCmd)
@@ -3117,6 +4007,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		result := &srtList[i]
 		result.Hex = hexTxns[i]
 		result.Txid = mtx.TxHash().String()
+		result.HashWithSig = mtx.TxHashWithSig().String()
 		result.Vin, err = createVinListPrevOut(s, mtx, chainParams,
 			vinExtra, filterAddrMap)
 		if err != nil {
@@ -3359,6 +4250,213 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// handleTestMempoolAccept implements the testmempoolaccept command.
+func handleTestMempoolAccept(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TestMempoolAcceptCmd)
+
+	// Deserialize all of the transactions before checking any of them.
+	txns := make([]*provautil.Tx, 0, len(c.RawTxns))
+	for _, hexStr := range c.RawTxns {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, provautil.NewTx(&msgTx))
+	}
+
+	// Check each transaction against the current pool without adding it.
+	// Since none of the transactions are added, a transaction spending the
+	// outputs of another one of the list is reported as missing inputs.
+	results := make([]btcjson.TestMempoolAcceptResult, len(txns))
+	for i, tx := range txns {
+		result := btcjson.TestMempoolAcceptResult{
+			Txid:        tx.Hash().String(),
+			HashWithSig: tx.HashWithSig().String(),
+		}
+		acceptResult, err := s.server.txMemPool.CheckMempoolAcceptance(tx)
+		switch {
+		case err != nil:
+			if _, ok := err.(mempool.RuleError); !ok {
+				errStr := fmt.Sprintf("Failed to check transaction "+
+					"%v: %v", tx.Hash(), err)
+				return nil, internalRPCError(errStr, "")
+			}
+			code, reason := mempool.ErrToRejectErr(err)
+			result.RejectCode = uint8(code)
+			result.RejectReason = reason
+
+		case len(acceptResult.MissingParents) > 0:
+			result.RejectCode = uint8(wire.RejectInvalid)
+			result.RejectReason = fmt.Sprintf("missing inputs from "+
+				"transactions %v", acceptResult.MissingParents)
+
+		default:
+			result.Allowed = true
+			result.Fee = provautil.Amount(acceptResult.TxFee).ToRMG()
+			result.VSize = acceptResult.TxSize
+		}
+		results[i] = result
+	}
+
+	return results, nil
+}
+
+// handleTraceTxInput implements the tracetxinput command.
+func handleTraceTxInput(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TraceTxInputCmd)
+
+	// Deserialize the transaction.
+	hexStr := c.HexTx
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var mtx wire.MsgTx
+	err = mtx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+	if int(c.Index) >= len(mtx.TxIn) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Input index %d does not exist for "+
+				"transaction with %d inputs", c.Index, len(mtx.TxIn)),
+		}
+	}
+
+	// Use the provided previous output script and amount, otherwise look
+	// the previous output up in the mempool and the main chain.
+	var pkScript []byte
+	var amount int64
+	if c.PrevScript != nil {
+		pkScript, err = hex.DecodeString(*c.PrevScript)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.PrevScript)
+		}
+		if c.Amount != nil {
+			amt, err := provautil.NewAmount(*c.Amount)
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidParameter,
+					Message: "Invalid amount: " + err.Error(),
+				}
+			}
+			amount = int64(amt)
+		}
+	} else {
+		prevOut := &mtx.TxIn[c.Index].PreviousOutPoint
+		pkScript, amount, err = s.fetchPrevOutput(prevOut)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Execute the scripts with the KeyIDs and admin keys of the current
+	// main chain tip.
+	keyView := blockchain.NewKeyViewpoint()
+	keyView.SetKeyIDs(s.chain.KeyIDs())
+	keyView.SetKeys(s.chain.AdminKeySets())
+	trace, err := blockchain.TraceInput(&mtx, int(c.Index), pkScript, amount,
+		keyView, txscript.StandardVerifyFlags)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Unable to execute scripts: " + err.Error(),
+		}
+	}
+
+	result := btcjson.TraceTxInputResult{
+		ScriptSig: hex.EncodeToString(mtx.TxIn[c.Index].SignatureScript),
+		PkScript:  hex.EncodeToString(pkScript),
+		Executed:  hex.EncodeToString(trace.PkScript),
+		Steps:     make([]btcjson.TraceStepResult, len(trace.Steps)),
+		Valid:     trace.Err == nil,
+	}
+	if trace.Err != nil {
+		result.Error = trace.Err.Error()
+	}
+	for i, step := range trace.Steps {
+		stepResult := btcjson.TraceStepResult{
+			Script:        step.ScriptIdx,
+			Offset:        step.ScriptOff,
+			Opcode:        step.Opcode,
+			Stack:         encodeStack(step.Stack),
+			AltStack:      encodeStack(step.AltStack),
+			StackAfter:    encodeStack(step.StackAfter),
+			AltStackAfter: encodeStack(step.AltStackAfter),
+		}
+		for _, match := range step.SigMatches {
+			matchResult := btcjson.TraceSigMatchResult{
+				PubKey:  hex.EncodeToString(match.PubKey),
+				KeyHash: hex.EncodeToString(match.KeyHash),
+				Valid:   match.Valid,
+			}
+			if keyID, ok := trace.KeyID(match.KeyHash); ok {
+				id := uint32(keyID)
+				matchResult.KeyID = &id
+			}
+			stepResult.SigMatches = append(stepResult.SigMatches,
+				matchResult)
+		}
+		result.Steps[i] = stepResult
+	}
+	return result, nil
+}
+
+// encodeStack returns the hex-encoded items of the passed stack.
+func encodeStack(stack [][]byte) []string {
+	items := make([]string, len(stack))
+	for i, item := range stack {
+		items[i] = hex.EncodeToString(item)
+	}
+	return items
+}
+
+// fetchPrevOutput returns the public key script and amount of the passed
+// unspent output from the mempool or the main chain.
+func (s *rpcServer) fetchPrevOutput(outPoint *wire.OutPoint) ([]byte, int64, error) {
+	if tx, err := s.server.txMemPool.FetchTransaction(&outPoint.Hash); err == nil {
+		mtx := tx.MsgTx()
+		if outPoint.Index >= uint32(len(mtx.TxOut)) {
+			return nil, 0, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidTxVout,
+				Message: "Output index number (vout) does not " +
+					"exist for transaction.",
+			}
+		}
+		txOut := mtx.TxOut[outPoint.Index]
+		return txOut.PkScript, txOut.Value, nil
+	}
+
+	entry, err := s.chain.FetchUtxoEntry(&outPoint.Hash)
+	if err != nil || entry == nil || entry.IsOutputSpent(outPoint.Index) {
+		return nil, 0, &btcjson.RPCError{
+			Code: btcjson.ErrRPCNoTxInfo,
+			Message: fmt.Sprintf("No unspent output %v available, "+
+				"provide the previous script and amount", outPoint),
+		}
+	}
+	return entry.PkScriptByIndex(outPoint.Index),
+		entry.AmountByIndex(outPoint.Index), nil
+}
+
 // handleValidateAddress implements the validateaddress command.
 func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.ValidateAddressCmd)
@@ -3427,6 +4525,55 @@ func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return err == nil, nil
 }
 
+// handleVerifyTxOutProof implements the verifytxoutproof command.
+func handleVerifyTxOutProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.VerifyTxOutProofCmd)
+
+	proofBytes, err := hex.DecodeString(c.Proof)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Proof)
+	}
+	var proof bloom.TxProof
+	if err := proof.Deserialize(bytes.NewReader(proofBytes)); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Proof decode failed: " + err.Error(),
+		}
+	}
+
+	hashes, sigHashes, err := proof.Verify()
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid proof: " + err.Error(),
+		}
+	}
+
+	// The proven transactions are only confirmed when the block is in the
+	// main chain.
+	blockHash := proof.Header.BlockHash()
+	inMainChain, err := s.chain.MainChainHasBlock(&blockHash)
+	if err != nil {
+		context := "Failed to look up block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if !inMainChain {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Block not found in chain",
+		}
+	}
+
+	results := make([]btcjson.VerifyTxOutProofResult, 0, len(hashes))
+	for i, hash := range hashes {
+		results = append(results, btcjson.VerifyTxOutProofResult{
+			Txid:        hash.String(),
+			HashWithSig: sigHashes[i].String(),
+		})
+	}
+	return results, nil
+}
+
 // rpcServer holds the items the rpc server may need to access (config,
 // shutdown, main server, etc.)
 type rpcServer struct {
@@ -3435,8 +4582,7 @@ type rpcServer struct {
 	generator              *mining.BlkTmplGenerator
 	server                 *server
 	chain                  *blockchain.BlockChain
-	authsha                [sha256.Size]byte
-	limitauthsha           [sha256.Size]byte
+	authUsers              []*rpcAuthUser
 	ntfnMgr                *wsNotificationManager
 	numClients             int32
 	statusLines            map[int]string
@@ -3447,6 +4593,11 @@ type rpcServer struct {
 	helpCacher             *helpCacher
 	requestProcessShutdown chan struct{}
 	quit                   chan int
+
+	// batchRequestSem limits the number of requests from HTTP batches
+	// which are serviced concurrently across all HTTP batches.  Websocket
+	// clients are limited by their own semaphores.
+	batchRequestSem semaphore
 }
 
 // httpStatusLine returns a response Status-Line (RFC 2616 Section 6.1)
@@ -3567,47 +4718,36 @@ func (s *rpcServer) decrementClients() {
 	atomic.AddInt32(&s.numClients, -1)
 }
 
-// checkAuth checks the HTTP Basic authentication supplied by a wallet
-// or RPC client in the HTTP request r.  If the supplied authentication
-// does not match the username and password expected, a non-nil error is
-// returned.
+// checkAuth checks the HTTP Basic or Bearer authentication supplied by a
+// wallet or RPC client in the HTTP request r.  If the supplied authentication
+// does not match any of the configured users or API tokens, a non-nil error
+// is returned.
 //
 // This check is time-constant.
 //
-// The first bool return value signifies auth success (true if successful) and
-// the second bool return value specifies whether the user can change the state
-// of the server (true) or whether the user is limited (false). The second is
-// always false if the first is.
-func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error) {
+// The bool return value signifies auth success (true if successful) and the
+// returned user, which is nil on failure, specifies which methods the client
+// may call.
+func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, *rpcAuthUser, error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			rpcsLog.Warnf("RPC authentication failure from %s",
 				r.RemoteAddr)
-			return false, false, errors.New("auth failure")
+			return false, nil, errors.New("auth failure")
 		}
 
-		return false, false, nil
+		return false, nil, nil
 	}
 
 	authsha := sha256.Sum256([]byte(authhdr[0]))
-
-	// Check for limited auth first as in environments with limited users, those
-	// are probably expected to have a higher volume of calls
-	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
-	if limitcmp == 1 {
-		return true, false, nil
+	if user := lookupAuthUser(s.authUsers, authsha); user != nil {
+		return true, user, nil
 	}
 
-	// Check for admin-level auth
-	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
-	if cmp == 1 {
-		return true, true, nil
-	}
-
-	// Request's auth doesn't match either user
+	// Request's auth doesn't match any user
 	rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
-	return false, false, errors.New("auth failure")
+	return false, nil, errors.New("auth failure")
 }
 
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
@@ -3692,8 +4832,173 @@ func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, erro
 	return btcjson.MarshalResponse(id, result, jsonErr)
 }
 
+// isNotification returns whether the passed JSON-RPC request is a notification
+// that must not be responded to.
+//
+// The JSON-RPC 1.0 spec defines that notifications must have their "id" set to
+// null and states that notifications do not have a response.
+//
+// A JSON-RPC 2.0 notification is a request with "json-rpc":"2.0", and without
+// an "id" member. The specification states that notifications must not be
+// responded to. JSON-RPC 2.0 permits the null value as a valid request id,
+// therefore such requests are not notifications.
+//
+// Bitcoin Core serves requests with "id":null or even an absent "id", and
+// responds to such requests with "id":null in the response.
+//
+// Btcd does not respond to any request without and "id" or "id":null,
+// regardless the indicated JSON-RPC protocol version unless RPC quirks are
+// enabled. With RPC quirks enabled, such requests will be responded to if the
+// reqeust does not indicate JSON-RPC version.
+//
+// RPC quirks can be enabled by the user to avoid compatibility issues with
+// software relying on Core's behavior.
+func isNotification(request *btcjson.Request) bool {
+	return request.ID == nil && !(cfg.RPCQuirks && request.Jsonrpc == "")
+}
+
+// limitedUserError returns the RPC error used to reply to a limited user that
+// requests a method it is not authorized to call.
+func limitedUserError() *btcjson.RPCError {
+	return &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInvalidParams.Code,
+		Message: "limited user not authorized for this method",
+	}
+}
+
+// processRequest checks that the caller is authorized for the passed JSON-RPC
+// request, parses it into a known concrete command and runs the appropriate
+// handler.  The returned error, if any, is suitable for use in replies.
+func (s *rpcServer) processRequest(request *btcjson.Request, user *rpcAuthUser, remoteAddr string, closeChan <-chan struct{}) (interface{}, error) {
+	// Check if the user is limited and set error if method unauthorized.
+	if !authorizeCall(user, remoteAddr, request.Method) {
+		return nil, limitedUserError()
+	}
+
+	// Attempt to parse the JSON-RPC request into a known concrete command.
+	parsedCmd := parseCmd(request)
+	if parsedCmd.err != nil {
+		return nil, parsedCmd.err
+	}
+	return s.standardCmdResult(parsedCmd, closeChan)
+}
+
+// processSingleRequest parses the passed raw body as a single JSON-RPC request,
+// runs it and returns the marshalled reply.  A nil reply is returned when the
+// request is a notification or the reply could not be marshalled.
+func (s *rpcServer) processSingleRequest(body []byte, user *rpcAuthUser, remoteAddr string, closeChan <-chan struct{}) []byte {
+	// Attempt to parse the raw body into a JSON-RPC request.
+	var responseID interface{}
+	var jsonErr error
+	var result interface{}
+	var request btcjson.Request
+	if err := json.Unmarshal(body, &request); err != nil {
+		jsonErr = &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+	}
+	if jsonErr == nil {
+		if isNotification(&request) {
+			return nil
+		}
+
+		// The parse was at least successful enough to have an ID so
+		// set it for the response.
+		responseID = request.ID
+		result, jsonErr = s.processRequest(&request, user, remoteAddr,
+			closeChan)
+	}
+
+	// Marshal the response.
+	msg, err := createMarshalledReply(responseID, result, jsonErr)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		return nil
+	}
+	return msg
+}
+
+// processBatchRequest parses the passed raw body as a batch of JSON-RPC
+// requests, runs them and returns the marshalled batch reply.  The requests
+// are run concurrently under the server's batch request semaphore, which is
+// shared by all HTTP batches, and each one is subject to the same
+// authorization rules as a standalone request.  A nil reply is returned when
+// every request in the batch is a notification.
+func (s *rpcServer) processBatchRequest(body []byte, user *rpcAuthUser, remoteAddr string, closeChan <-chan struct{}) []byte {
+	var rawRequests []json.RawMessage
+	if err := json.Unmarshal(body, &rawRequests); err != nil {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+		return batchFailureReply(jsonErr)
+	}
+
+	// An empty batch is an invalid request which is replied to with a
+	// single response rather than an empty array.
+	if len(rawRequests) == 0 {
+		return batchFailureReply(btcjson.ErrRPCInvalidRequest)
+	}
+
+	replies := make([][]byte, len(rawRequests))
+	var wg sync.WaitGroup
+	for i, rawRequest := range rawRequests {
+		var request btcjson.Request
+		if err := json.Unmarshal(rawRequest, &request); err != nil {
+			jsonErr := &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidRequest.Code,
+				Message: "Failed to parse request: " + err.Error(),
+			}
+			reply, err := createMarshalledReply(nil, nil, jsonErr)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal parse failure "+
+					"reply: %v", err)
+				continue
+			}
+			replies[i] = reply
+			continue
+		}
+		if isNotification(&request) {
+			continue
+		}
+
+		s.batchRequestSem.acquire()
+		wg.Add(1)
+		go func(i int, request *btcjson.Request) {
+			defer wg.Done()
+			defer s.batchRequestSem.release()
+
+			result, jsonErr := s.processRequest(request, user,
+				remoteAddr, closeChan)
+			reply, err := createMarshalledReply(request.ID, result,
+				jsonErr)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal reply for <%s> "+
+					"command: %v", request.Method, err)
+				return
+			}
+			replies[i] = reply
+		}(i, &request)
+	}
+	wg.Wait()
+
+	return btcjson.MarshalBatchResponse(replies)
+}
+
+// batchFailureReply returns the marshalled reply for a batch request that
+// failed as a whole, or nil if the reply could not be marshalled.
+func batchFailureReply(jsonErr *btcjson.RPCError) []byte {
+	msg, err := createMarshalledReply(nil, nil, jsonErr)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		return nil
+	}
+	return msg
+}
+
 // jsonRPCRead handles reading and responding to RPC messages.
-func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
+func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, user *rpcAuthUser) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
@@ -3733,80 +5038,26 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	defer buf.Flush()
 	conn.SetReadDeadline(timeZeroVal)
 
-	// Attempt to parse the raw body into a JSON-RPC request.
-	var responseID interface{}
-	var jsonErr error
-	var result interface{}
-	var request btcjson.Request
-	if err := json.Unmarshal(body, &request); err != nil {
-		jsonErr = &btcjson.RPCError{
-			Code:    btcjson.ErrRPCParse.Code,
-			Message: "Failed to parse request: " + err.Error(),
-		}
-	}
-	if jsonErr == nil {
-		// The JSON-RPC 1.0 spec defines that notifications must have their "id"
-		// set to null and states that notifications do not have a response.
-		//
-		// A JSON-RPC 2.0 notification is a request with "json-rpc":"2.0", and
-		// without an "id" member. The specification states that notifications
-		// must not be responded to. JSON-RPC 2.0 permits the null value as a
-		// valid request id, therefore such requests are not notifications.
-		//
-		// Bitcoin Core serves requests with "id":null or even an absent "id",
-		// and responds to such requests with "id":null in the response.
-		//
-		// Btcd does not respond to any request without and "id" or "id":null,
-		// regardless the indicated JSON-RPC protocol version unless RPC quirks
-		// are enabled. With RPC quirks enabled, such requests will be responded
-		// to if the reqeust does not indicate JSON-RPC version.
-		//
-		// RPC quirks can be enabled by the user to avoid compatibility issues
-		// with software relying on Core's behavior.
-		if request.ID == nil && !(cfg.RPCQuirks && request.Jsonrpc == "") {
-			return
-		}
-
-		// The parse was at least successful enough to have an ID so
-		// set it for the response.
-		responseID = request.ID
-
-		// Setup a close notifier.  Since the connection is hijacked,
-		// the CloseNotifer on the ResponseWriter is not available.
-		closeChan := make(chan struct{}, 1)
-		go func() {
-			_, err := conn.Read(make([]byte, 1))
-			if err != nil {
-				close(closeChan)
-			}
-		}()
-
-		// Check if the user is limited and set error if method unauthorized
-		if !isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr = &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
-			}
+	// Setup a close notifier.  Since the connection is hijacked, the
+	// CloseNotifer on the ResponseWriter is not available.
+	closeChan := make(chan struct{}, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		if err != nil {
+			close(closeChan)
 		}
+	}()
 
-		if jsonErr == nil {
-			// Attempt to parse the JSON-RPC request into a known concrete
-			// command.
-			parsedCmd := parseCmd(&request)
-			if parsedCmd.err != nil {
-				jsonErr = parsedCmd.err
-			} else {
-				result, jsonErr = s.standardCmdResult(parsedCmd, closeChan)
-			}
-		}
+	// Batched requests are encoded as a JSON array and are replied to with
+	// a JSON array of responses.  Otherwise, handle the body as a single
+	// JSON-RPC request.
+	var msg []byte
+	if btcjson.IsBatchRequest(body) {
+		msg = s.processBatchRequest(body, user, r.RemoteAddr, closeChan)
+	} else {
+		msg = s.processSingleRequest(body, user, r.RemoteAddr, closeChan)
 	}
-
-	// Marshal the response.
-	msg, err := createMarshalledReply(responseID, result, jsonErr)
-	if err != nil {
-		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+	if msg == nil {
 		return
 	}
 
@@ -3860,19 +5111,19 @@ func (s *rpcServer) Start() {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		_, user, err := s.checkAuth(r, true)
 		if err != nil {
 			jsonAuthFail(w)
 			return
 		}
 
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		s.jsonRPCRead(w, r, user)
 	})
 
 	// Websocket endpoint.
 	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
+		authenticated, user, err := s.checkAuth(r, false)
 		if err != nil {
 			jsonAuthFail(w)
 			return
@@ -3889,7 +5140,7 @@ func (s *rpcServer) Start() {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, user)
 	})
 
 	for _, listener := range s.listeners {
@@ -3940,17 +5191,17 @@ func newRPCServer(listenAddrs []string, generator *mining.BlkTmplGenerator, s *s
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
 		quit: make(chan int),
+		batchRequestSem:        makeSemaphore(cfg.RPCMaxConcurrentReqs),
 	}
 	if cfg.RPCUser != "" && cfg.RPCPass != "" {
-		login := cfg.RPCUser + ":" + cfg.RPCPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.authsha = sha256.Sum256([]byte(auth))
+		rpc.authUsers = append(rpc.authUsers,
+			newAdminAuthUser(cfg.RPCUser, cfg.RPCPass))
 	}
 	if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
-		login := cfg.RPCLimitUser + ":" + cfg.RPCLimitPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.limitauthsha = sha256.Sum256([]byte(auth))
+		rpc.authUsers = append(rpc.authUsers,
+			newLimitAuthUser(cfg.RPCLimitUser, cfg.RPCLimitPass))
 	}
+	rpc.authUsers = append(rpc.authUsers, cfg.rpcAuthUsers...)
 	rpc.ntfnMgr = newWsNotificationManager(&rpc)
 
 	// Setup TLS if not disabled.
@@ -0,0 +1,119 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// TestProcessBatchRequest ensures batched requests are replied to with the
+// responses of the requests which are not notifications, that invalid and
+// unknown requests are replied to with errors, and that the requests of
+// concurrent batches stay within the concurrency limit of the server.
+func TestProcessBatchRequest(t *testing.T) {
+	if cfg == nil {
+		cfg = &config{}
+		defer func() { cfg = nil }()
+	}
+
+	// Replace the handler of getblockcount with one which tracks the
+	// number of concurrently running requests.
+	const maxConcurrentReqs = 2
+	var numRunning, maxRunning int32
+	origHandler := rpcHandlers["getblockcount"]
+	rpcHandlers["getblockcount"] = func(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+		n := atomic.AddInt32(&numRunning, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&numRunning, -1)
+		return int64(1), nil
+	}
+	defer func() { rpcHandlers["getblockcount"] = origHandler }()
+
+	s := &rpcServer{batchRequestSem: makeSemaphore(maxConcurrentReqs)}
+	user := newAdminAuthUser("user", "pass")
+
+	// The batch contains successful requests, a notification, a request
+	// for an unknown method and an element which is not a request.
+	body := []byte(`[` +
+		`{"jsonrpc":"1.0","method":"getblockcount","params":[],"id":1},` +
+		`{"jsonrpc":"1.0","method":"getblockcount","params":[]},` +
+		`{"jsonrpc":"1.0","method":"nosuchmethod","params":[],"id":2},` +
+		`5,` +
+		`{"jsonrpc":"1.0","method":"getblockcount","params":[],"id":3},` +
+		`{"jsonrpc":"1.0","method":"getblockcount","params":[],"id":4}` +
+		`]`)
+
+	// Process several batches concurrently.
+	const numBatches = 3
+	replies := make([][]byte, numBatches)
+	var wg sync.WaitGroup
+	for i := 0; i < numBatches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replies[i] = s.processBatchRequest(body, user,
+				"127.0.0.1", nil)
+		}(i)
+	}
+	wg.Wait()
+
+	if max := atomic.LoadInt32(&maxRunning); max > maxConcurrentReqs {
+		t.Fatalf("got %d concurrent requests, want at most %d", max,
+			maxConcurrentReqs)
+	}
+	for i, reply := range replies {
+		responses, err := btcjson.UnmarshalBatchResponse(reply)
+		if err != nil {
+			t.Fatalf("batch %d: unexpected error: %v", i, err)
+		}
+		if len(responses) != 5 {
+			t.Fatalf("batch %d: got %d responses, want 5", i,
+				len(responses))
+		}
+		var numResults, numErrors int
+		for _, response := range responses {
+			if response.Error != nil {
+				numErrors++
+				continue
+			}
+			if string(response.Result) != "1" {
+				t.Fatalf("batch %d: unexpected result %s", i,
+					response.Result)
+			}
+			numResults++
+		}
+		if numResults != 3 || numErrors != 2 {
+			t.Fatalf("batch %d: got %d results and %d errors, "+
+				"want 3 and 2", i, numResults, numErrors)
+		}
+	}
+
+	// A batch of notifications is not replied to, while an empty batch is
+	// replied to with a single error.
+	notifications := []byte(`[` +
+		`{"jsonrpc":"1.0","method":"getblockcount","params":[]}` +
+		`]`)
+	if reply := s.processBatchRequest(notifications, user, "127.0.0.1",
+		nil); reply != nil {
+
+		t.Fatalf("unexpected reply %s to batch of notifications", reply)
+	}
+	if btcjson.IsBatchRequest(s.processBatchRequest([]byte(`[]`), user,
+		"127.0.0.1", nil)) {
+
+		t.Fatal("empty batch replied to with a batch response")
+	}
+}
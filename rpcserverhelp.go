@@ -94,11 +94,12 @@ var helpDescsEnUS = map[string]string{
 	"vout-scriptPubKey": "The public key script used to pay coins as a JSON object",
 
 	// TxRawDecodeResult help.
-	"txrawdecoderesult-txid":     "The hash of the transaction",
-	"txrawdecoderesult-version":  "The transaction version",
-	"txrawdecoderesult-locktime": "The transaction lock time",
-	"txrawdecoderesult-vin":      "The transaction inputs as JSON objects",
-	"txrawdecoderesult-vout":     "The transaction outputs as JSON objects",
+	"txrawdecoderesult-txid":        "The hash of the transaction",
+	"txrawdecoderesult-hashwithsig": "The hash of the transaction including its signatures",
+	"txrawdecoderesult-version":     "The transaction version",
+	"txrawdecoderesult-locktime":    "The transaction lock time",
+	"txrawdecoderesult-vin":         "The transaction inputs as JSON objects",
+	"txrawdecoderesult-vout":        "The transaction outputs as JSON objects",
 
 	// DecodeRawTransactionCmd help.
 	"decoderawtransaction--synopsis": "Returns a JSON object representing the provided serialized, hex-encoded transaction.",
@@ -109,11 +110,20 @@ var helpDescsEnUS = map[string]string{
 	"setvalidatekeys-privkeys":  "Hex-encoded 32 byte private keys",
 
 	// DecodeScriptResult help.
-	"decodescriptresult-asm":       "Disassembly of the script",
-	"decodescriptresult-reqSigs":   "The number of required signatures",
-	"decodescriptresult-type":      "The type of the script (e.g. 'pubkeyhash')",
-	"decodescriptresult-addresses": "The bitcoin addresses associated with this script",
-	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions",
+	"decodescriptresult-asm":          "Disassembly of the script",
+	"decodescriptresult-reqSigs":      "The number of required signatures",
+	"decodescriptresult-type":         "The type of the script (e.g. 'safe_multisig')",
+	"decodescriptresult-addresses":    "The Prova addresses associated with this script",
+	"decodescriptresult-p2sh":         "The script hash for use in pay-to-script-hash transactions",
+	"decodescriptresult-thread":       "The admin thread of the script (e.g. 'root')",
+	"decodescriptresult-pubkeyhashes": "The hex-encoded public key hashes which are able to sign for this script",
+	"decodescriptresult-keyids":       "The KeyIDs of the script and the ASP public keys registered for them",
+	"decodescriptresult-adminOp":      "The admin operation of the script",
+
+	// KeyIDResult help.
+	"keyidresult-keyid":  "The KeyID",
+	"keyidresult-pubkey": "The hex-encoded ASP public key registered for the KeyID",
+	"keyidresult-status": "Whether the KeyID is 'registered' or 'unregistered/revoked'",
 
 	// DecodeScriptCmd help.
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
@@ -143,6 +153,63 @@ var helpDescsEnUS = map[string]string{
 	"getaddednodeinfo--condition1": "dns=true",
 	"getaddednodeinfo--result0":    "List of added peers",
 
+	// GetAddressBalanceCmd help.
+	"getaddressbalance--synopsis": "Returns the balance of the passed addresses along with the total amount they have received.\n" +
+		"Addresses are either Prova addresses or hex-encoded key hashes, which match every Prova address with the key hash.\n" +
+		"Usage of this RPC requires the optional --addrindex flag to be activated.",
+	"getaddressbalance-request": "AddressRequest object containing the addresses",
+
+	// GetAddressBalanceResult help.
+	"getaddressbalanceresult-balance":  "The total amount of the unspent outputs paying to the addresses in atoms",
+	"getaddressbalanceresult-received": "The total amount of all outputs ever paid to the addresses in atoms",
+
+	// GetAddressDeltasCmd help.
+	"getaddressdeltas--synopsis": "Returns the changes of the balance of the passed addresses in the main chain, ordered by height.\n" +
+		"Each output paying to one of the addresses is a credit and each input spending one is a debit.\n" +
+		"Usage of this RPC requires the optional --addrindex flag to be activated.",
+	"getaddressdeltas-request":  "AddressTxRequest object containing addresses, start block and end block",
+	"getaddressdeltas--result0": "The balance changes",
+
+	// AddressDeltaResult help.
+	"addressdeltaresult-atoms":      "The change of the balance in atoms (negative for spent outputs)",
+	"addressdeltaresult-txid":       "The hash of the transaction",
+	"addressdeltaresult-index":      "The index of the output for credits, or the index of the input for debits",
+	"addressdeltaresult-blockindex": "The index of the transaction in its block",
+	"addressdeltaresult-height":     "The height of the block which contains the transaction",
+	"addressdeltaresult-address":    "The address the output pays to",
+
+	// GetAddressMempoolCmd help.
+	"getaddressmempool--synopsis": "Returns the changes of the balance of the passed addresses by the transactions in the memory pool.\n" +
+		"Usage of this RPC requires the optional --addrindex flag to be activated.",
+	"getaddressmempool-request":  "AddressRequest object containing the addresses",
+	"getaddressmempool--result0": "The balance changes",
+
+	// AddressMempoolDeltaResult help.
+	"addressmempooldeltaresult-address":   "The address the output pays to",
+	"addressmempooldeltaresult-txid":      "The hash of the transaction",
+	"addressmempooldeltaresult-index":     "The index of the output for credits, or the index of the input for debits",
+	"addressmempooldeltaresult-atoms":     "The change of the balance in atoms (negative for spent outputs)",
+	"addressmempooldeltaresult-timestamp": "The time the transaction was added to the memory pool in seconds since 1 Jan 1970 GMT",
+	"addressmempooldeltaresult-prevtxid":  "The hash of the transaction of the spent output (only for debits)",
+	"addressmempooldeltaresult-prevout":   "The index of the spent output (only for debits)",
+
+	// GetAddressUtxosCmd help.
+	"getaddressutxos--synopsis": "Returns the unspent outputs paying to the passed addresses in the main chain, ordered by height.\n" +
+		"Usage of this RPC requires the optional --addrindex flag to be activated.",
+	"getaddressutxos-request":  "AddressRequest object containing the addresses",
+	"getaddressutxos--result0": "The unspent outputs",
+
+	// AddressUtxoResult help.
+	"addressutxoresult-address":     "The address the output pays to",
+	"addressutxoresult-txid":        "The hash of the transaction",
+	"addressutxoresult-outputIndex": "The index of the output",
+	"addressutxoresult-script":      "The hex-encoded public key script of the output",
+	"addressutxoresult-atoms":       "The amount of the output in atoms",
+	"addressutxoresult-height":      "The height of the block which contains the transaction",
+
+	// AddressRequest help.
+	"addressrequest-addresses": "The addresses to search for",
+
 	// GetAddressTxIds help.
 	"getaddresstxids--synopsis": "Returns transaction-ids involving the passed address.\n" +
 		"Usage of this RPC requires the optional --addrindex flag to be activated, otherwise all responses will simply return with an error stating the address index has not yet been built.\n" +
@@ -187,6 +254,18 @@ var helpDescsEnUS = map[string]string{
 	// GetAdminInfoCmd help.
 	"getadmininfo--synopsis": "Returns general admin data: thread tips, keys, issuance.",
 
+	// GetAdminTxProofsResult help.
+	"getadmintxproofsresult-height":       "The height of the block",
+	"getadmintxproofsresult-hash":         "The hash of the block",
+	"getadmintxproofsresult-proof":        "The hex-encoded proof that the admin transactions are included in the block, as returned by gettxoutproof",
+	"getadmintxproofsresult-transactions": "The hex-encoded admin transactions in the order they appear in the block",
+
+	// GetAdminTxProofsCmd help.
+	"getadmintxproofs--synopsis": "Returns the admin transactions in a range of main chain blocks along with proofs of their inclusion.\n" +
+		"Only blocks which contain admin transactions are returned, which allows light clients to track the admin key sets.",
+	"getadmintxproofs-startheight": "The height of the first block to scan",
+	"getadmintxproofs-endheight":   "The height of the last block to scan",
+
 	// GetBestBlockHashCmd help.
 	"getbestblockhash--synopsis": "Returns the hash of the of the best (most recent) block in the longest block chain.",
 	"getbestblockhash--result0":  "The hex-encoded block hash",
@@ -203,6 +282,7 @@ var helpDescsEnUS = map[string]string{
 	// TxRawResult help.
 	"txrawresult-hex":           "Hex-encoded transaction",
 	"txrawresult-txid":          "The hash of the transaction",
+	"txrawresult-hashwithsig":   "The hash of the transaction including its signatures",
 	"txrawresult-version":       "The transaction version",
 	"txrawresult-locktime":      "The transaction lock time",
 	"txrawresult-vin":           "The transaction inputs as JSON objects",
@@ -215,6 +295,7 @@ var helpDescsEnUS = map[string]string{
 	// SearchRawTransactionsResult help.
 	"searchrawtransactionsresult-hex":           "Hex-encoded transaction",
 	"searchrawtransactionsresult-txid":          "The hash of the transaction",
+	"searchrawtransactionsresult-hashwithsig":   "The hash of the transaction including its signatures",
 	"searchrawtransactionsresult-version":       "The transaction version",
 	"searchrawtransactionsresult-locktime":      "The transaction lock time",
 	"searchrawtransactionsresult-vin":           "The transaction inputs as JSON objects",
@@ -329,6 +410,18 @@ var helpDescsEnUS = map[string]string{
 	"getblocktemplate--condition2": "mode=proposal, accepted",
 	"getblocktemplate--result1":    "An error string which represents why the proposal was rejected or nothing if accepted",
 
+	// GetCFilterCmd help.
+	"getcfilter--synopsis":  "Returns the committed filter (BIP0158) of a block from the committed filter index.",
+	"getcfilter-hash":       "The hash of the block",
+	"getcfilter-filtertype": "The type of the filter, where 0 is the regular filter",
+	"getcfilter--result0":   "The hex-encoded serialized filter",
+
+	// GetCFilterHeaderCmd help.
+	"getcfilterheader--synopsis":  "Returns the filter header (BIP0157) of the committed filter of a block from the committed filter index.",
+	"getcfilterheader-hash":       "The hash of the block",
+	"getcfilterheader-filtertype": "The type of the filter, where 0 is the regular filter",
+	"getcfilterheader--result0":   "The hex-encoded filter header",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -469,7 +562,7 @@ var helpDescsEnUS = map[string]string{
 
 	// GetRawTransactionCmd help.
 	"getrawtransaction--synopsis":   "Returns information about a transaction given its hash.",
-	"getrawtransaction-txid":        "The hash of the transaction",
+	"getrawtransaction-txid":        "The hash of the transaction, with or without its signatures",
 	"getrawtransaction-verbose":     "Specifies the transaction is returned as a JSON object instead of a hex-encoded string",
 	"getrawtransaction--condition0": "verbose=false",
 	"getrawtransaction--condition1": "verbose=true",
@@ -485,10 +578,35 @@ var helpDescsEnUS = map[string]string{
 
 	// GetTxOutCmd help.
 	"gettxout--synopsis":      "Returns information about an unspent transaction output..",
-	"gettxout-txid":           "The hash of the transaction",
+	"gettxout-txid":           "The hash of the transaction, with or without its signatures",
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutProofCmd help.
+	"gettxoutproof--synopsis": "Returns a hex-encoded proof that one or more transactions were included in a block.\n" +
+		"The proof commits to both the hashes of the transactions and their hashes including signatures, and can be verified against the block header alone.\n" +
+		"Unless the block hash is specified, the transaction index must be enabled or the first transaction must have unspent outputs.",
+	"gettxoutproof-txids":     "The hashes of the transactions to prove, with or without their signatures",
+	"gettxoutproof-blockhash": "The hash of the block which contains the transactions",
+	"gettxoutproof--result0":  "The hex-encoded proof",
+
+	// GetTxStatusCmd help.
+	"gettxstatus--synopsis": "Returns the status of a transaction: whether it is in the memory pool, waiting for its parents in the orphan pool, was recently rejected, is confirmed in the main chain, or is unknown.\n" +
+		"Confirmed transactions are found using the transaction index when it is enabled, otherwise the transaction must have unspent outputs.",
+	"gettxstatus-txid": "The hash of the transaction, with or without its signatures",
+
+	// GetTxStatusResult help.
+	"gettxstatusresult-txid":           "The hash of the transaction",
+	"gettxstatusresult-hashwithsig":    "The hash of the transaction including its signatures (only when it is in the memory pool or was rejected)",
+	"gettxstatusresult-status":         "The status of the transaction (mempool, orphan, rejected, confirmed or unknown)",
+	"gettxstatusresult-missingparents": "The hashes of the transactions the orphan spends outputs of which are not known yet (only for orphans)",
+	"gettxstatusresult-rejectcode":     "The reject code of the transaction (only when it was rejected)",
+	"gettxstatusresult-rejectreason":   "The reason the transaction was rejected",
+	"gettxstatusresult-rejecttime":     "The time the transaction was rejected in seconds since 1 Jan 1970 GMT",
+	"gettxstatusresult-blockhash":      "The hash of the block which contains the transaction (only when it is confirmed)",
+	"gettxstatusresult-blockheight":    "The height of the block which contains the transaction",
+	"gettxstatusresult-confirmations":  "The number of confirmations of the transaction",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -544,6 +662,53 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// TestMempoolAcceptCmd help.
+	"testmempoolaccept--synopsis": "Checks whether serialized, hex-encoded transactions would be accepted into the memory pool without adding or relaying them.\n" +
+		"The checks include the Prova output rules, the maximum fee, standardness and script verification.\n" +
+		"Each transaction is checked on its own, so a transaction spending the outputs of another one of the list is rejected for missing inputs.",
+	"testmempoolaccept-rawtxns": "Serialized, hex-encoded transactions",
+
+	// TestMempoolAcceptResult help.
+	"testmempoolacceptresult-txid":         "The hash of the transaction",
+	"testmempoolacceptresult-hashwithsig":  "The hash of the transaction including its signatures",
+	"testmempoolacceptresult-allowed":      "Whether or not the transaction would be accepted into the memory pool",
+	"testmempoolacceptresult-rejectcode":   "The reject code of the transaction (only when it would be rejected)",
+	"testmempoolacceptresult-rejectreason": "The reason the transaction would be rejected",
+	"testmempoolacceptresult-fee":          "The fee paid by the transaction in RMG (only when it would be accepted)",
+	"testmempoolacceptresult-vsize":        "The virtual size of the transaction in bytes (only when it would be accepted)",
+
+	// TraceTxInputCmd help.
+	"tracetxinput--synopsis": "Executes the scripts spending a transaction input step by step and returns the state of the script engine after each opcode.\n" +
+		"KeyIDs and admin threads are resolved using the ASP keys and admin keys at the current tip of the main chain.",
+	"tracetxinput-hextx":      "Serialized, hex-encoded transaction",
+	"tracetxinput-index":      "The index of the input to trace",
+	"tracetxinput-prevscript": "The hex-encoded public key script of the output spent by the input (default: looked up in the mempool and the unspent outputs of the main chain)",
+	"tracetxinput-amount":     "The amount of the output spent by the input in RMG (only used with prevscript)",
+
+	// TraceTxInputResult help.
+	"tracetxinputresult-scriptsig": "The hex-encoded signature script of the input",
+	"tracetxinputresult-pkscript":  "The hex-encoded public key script of the spent output",
+	"tracetxinputresult-executed":  "The hex-encoded public key script which was executed after replacing KeyIDs and admin threads with key hashes",
+	"tracetxinputresult-steps":     "The executed opcodes",
+	"tracetxinputresult-valid":     "Whether or not the scripts executed successfully",
+	"tracetxinputresult-error":     "The error the execution failed with",
+
+	// TraceStepResult help.
+	"tracestepresult-script":        "The index of the script (0 for the signature script, 1 for the public key script)",
+	"tracestepresult-offset":        "The offset of the opcode in the script",
+	"tracestepresult-opcode":        "The disassembled opcode",
+	"tracestepresult-stack":         "The hex-encoded data stack before the opcode was executed",
+	"tracestepresult-altstack":      "The hex-encoded alt stack before the opcode was executed",
+	"tracestepresult-stackafter":    "The hex-encoded data stack after the opcode was executed",
+	"tracestepresult-altstackafter": "The hex-encoded alt stack after the opcode was executed",
+	"tracestepresult-sigmatches":    "The signatures checked by OP_CHECKSAFEMULTISIG and OP_CHECKTHREAD",
+
+	// TraceSigMatchResult help.
+	"tracesigmatchresult-pubkey":  "The hex-encoded public key provided with the signature",
+	"tracesigmatchresult-keyhash": "The hex-encoded key hash of the script the public key matched (empty if none)",
+	"tracesigmatchresult-keyid":   "The KeyID the matched key hash was resolved from",
+	"tracesigmatchresult-valid":   "Whether or not the signature is valid",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid": "Whether or not the address is valid",
 	"validateaddresschainresult-address": "The bitcoin address (only when isvalid is true)",
@@ -569,6 +734,15 @@ var helpDescsEnUS = map[string]string{
 	"verifymessage-message":   "The signed message",
 	"verifymessage--result0":  "Whether or not the signature verified",
 
+	// VerifyTxOutProofCmd help.
+	"verifytxoutproof--synopsis": "Verifies a proof created by gettxoutproof against the merkle root of its block header and returns the proven transactions.\n" +
+		"An error is returned if the proof is invalid or the block is not in the main chain.",
+	"verifytxoutproof-proof": "The hex-encoded proof created by gettxoutproof",
+
+	// VerifyTxOutProofResult help.
+	"verifytxoutproofresult-txid":        "The hash of the transaction",
+	"verifytxoutproofresult-hashwithsig": "The hash of the transaction including its signatures",
+
 	// -------- Websocket-specific help --------
 
 	// Session help.
@@ -582,7 +756,7 @@ var helpDescsEnUS = map[string]string{
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
 
 	// NotifyNewTransactionsCmd help.
-	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
+	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool, and a txsigvariant notification when a transaction which only differs from one in the mempool by its signatures is received or mined.",
 	"notifynewtransactions-verbose":   "Specifies which type of notification to receive. If verbose is true, then the caller receives txacceptedverbose, otherwise the caller receives txaccepted",
 
 	// StopNotifyNewTransactionsCmd help.
@@ -646,8 +820,13 @@ var rpcResultTypes = map[string][]interface{}{
 	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
 	"generate":              {(*[]string)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getaddressbalance":     {(*btcjson.GetAddressBalanceResult)(nil)},
+	"getaddressdeltas":      {(*[]btcjson.AddressDeltaResult)(nil)},
+	"getaddressmempool":     {(*[]btcjson.AddressMempoolDeltaResult)(nil)},
 	"getaddresstxids":       {(*[]string)(nil)},
+	"getaddressutxos":       {(*[]btcjson.AddressUtxoResult)(nil)},
 	"getadmininfo":          {(*btcjson.GetAdminInfoResult)(nil)},
+	"getadmintxproofs":      {(*[]btcjson.GetAdminTxProofsResult)(nil)},
 	"getbestblock":          {(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":      {(*string)(nil)},
 	"getblock":              {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
@@ -655,6 +834,8 @@ var rpcResultTypes = map[string][]interface{}{
 	"getblockhash":          {(*string)(nil)},
 	"getblockheader":        {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
 	"getblocktemplate":      {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getcfilter":            {(*string)(nil)},
+	"getcfilterheader":      {(*string)(nil)},
 	"getconnectioncount":    {(*int32)(nil)},
 	"getcurrentnet":         {(*uint32)(nil)},
 	"getdifficulty":         {(*float64)(nil)},
@@ -670,6 +851,8 @@ var rpcResultTypes = map[string][]interface{}{
 	"getrawmempool":         {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":     {(*string)(nil), (*btcjson.TxRawResult)(nil)},
 	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
+	"gettxoutproof":         {(*string)(nil)},
+	"gettxstatus":           {(*btcjson.GetTxStatusResult)(nil)},
 	"node":                  nil,
 	"help":                  {(*string)(nil), (*string)(nil)},
 	"ping":                  nil,
@@ -679,9 +862,12 @@ var rpcResultTypes = map[string][]interface{}{
 	"setvalidatekeys":       nil,
 	"stop":                  {(*string)(nil)},
 	"submitblock":           {nil, (*string)(nil)},
+	"testmempoolaccept":     {(*[]btcjson.TestMempoolAcceptResult)(nil)},
+	"tracetxinput":          {(*btcjson.TraceTxInputResult)(nil)},
 	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
 	"verifychain":           {(*bool)(nil)},
 	"verifymessage":         {(*bool)(nil)},
+	"verifytxoutproof":      {(*[]btcjson.VerifyTxOutProofResult)(nil)},
 
 	// Websocket commands.
 	"loadtxfilter":              nil,
@@ -9,9 +9,6 @@ package main
 import (
 	"bytes"
 	"container/list"
-	"crypto/sha256"
-	"crypto/subtle"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -84,7 +81,7 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 // server handler which runs each new connection in a new goroutine thereby
 // satisfying the requirement.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	authenticated bool, user *rpcAuthUser) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
@@ -103,7 +100,7 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 	// Create a new websocket client to handle the new websocket connection
 	// and wait for it to shutdown.  Once it has shutdown (and hence
 	// disconnected), remove it and any notifications it registered for.
-	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin)
+	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, user)
 	if err != nil {
 		rpcsLog.Errorf("Failed to serve client %s: %v", remoteAddr, err)
 		conn.Close()
@@ -246,6 +243,26 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *provautil.Tx, isNew bool) {
 	}
 }
 
+// NotifySigVariant passes a transaction which only differs from the one in
+// the memory pool by its signatures to the notification manager.  The block
+// is nil unless the transaction was confirmed by it.
+func (m *wsNotificationManager) NotifySigVariant(poolTx, tx *provautil.Tx, block *provautil.Block) {
+	n := &notificationSigVariant{
+		poolTx: poolTx,
+		tx:     tx,
+		block:  block,
+	}
+
+	// As NotifySigVariant will be called by mempool and the block manager
+	// and the RPC server may no longer be running, use a select statement
+	// to unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
 // Notification types
 type notificationBlockConnected provautil.Block
 type notificationBlockDisconnected provautil.Block
@@ -253,6 +270,11 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *provautil.Tx
 }
+type notificationSigVariant struct {
+	poolTx *provautil.Tx
+	tx     *provautil.Tx
+	block  *provautil.Block
+}
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -341,6 +363,11 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationSigVariant:
+				if len(txNotifications) != 0 {
+					m.notifySigVariant(txNotifications, n)
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -793,6 +820,28 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// notifySigVariant notifies websocket clients that have registered for new
+// transaction updates when a transaction which only differs from the one in
+// the memory pool by its signatures is received or confirmed by a block.
+func (*wsNotificationManager) notifySigVariant(clients map[chan struct{}]*wsClient, n *notificationSigVariant) {
+	var blockHash *string
+	if n.block != nil {
+		blockHash = btcjson.String(n.block.Hash().String())
+	}
+	ntfn := btcjson.NewTxSigVariantNtfn(n.tx.Hash().String(),
+		n.poolTx.HashWithSig().String(), n.tx.HashWithSig().String(),
+		blockHash)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal signature variant "+
+			"notification: %v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -1174,9 +1223,10 @@ type wsClient struct {
 	// and therefore is allowed to communicated over the websocket.
 	authenticated bool
 
-	// isAdmin specifies whether a client may change the state of the server;
-	// false means its access is only to the limited set of RPC calls.
-	isAdmin bool
+	// user is the set of credentials the client authenticated with and
+	// determines which RPC calls it may make.  It is nil until the client
+	// has been authenticated.
+	user *rpcAuthUser
 
 	// sessionID is a random ID generated for each client when connected.
 	// These IDs may be queried by a client using the session RPC.  A change
@@ -1233,6 +1283,19 @@ out:
 			break out
 		}
 
+		// Batched requests are only accepted from authenticated clients
+		// since the first request of an unauthenticated client must be
+		// a standalone authenticate request.
+		if btcjson.IsBatchRequest(msg) {
+			if !c.authenticated {
+				rpcsLog.Warnf("Unauthenticated websocket batch " +
+					"request received")
+				break out
+			}
+			c.serviceBatchRequest(msg)
+			continue
+		}
+
 		var request btcjson.Request
 		err = json.Unmarshal(msg, &request)
 		if err != nil {
@@ -1254,25 +1317,9 @@ out:
 			continue
 		}
 
-		// The JSON-RPC 1.0 spec defines that notifications must have their "id"
-		// set to null and states that notifications do not have a response.
-		//
-		// A JSON-RPC 2.0 notification is a request with "json-rpc":"2.0", and
-		// without an "id" member. The specification states that notifications
-		// must not be responded to. JSON-RPC 2.0 permits the null value as a
-		// valid request id, therefore such requests are not notifications.
-		//
-		// Bitcoin Core serves requests with "id":null or even an absent "id",
-		// and responds to such requests with "id":null in the response.
-		//
-		// Btcd does not respond to any request without and "id" or "id":null,
-		// regardless the indicated JSON-RPC protocol version unless RPC quirks
-		// are enabled. With RPC quirks enabled, such requests will be responded
-		// to if the reqeust does not indicate JSON-RPC version.
-		//
-		// RPC quirks can be enabled by the user to avoid compatibility issues
-		// with software relying on Core's behavior.
-		if request.ID == nil && !(cfg.RPCQuirks && request.Jsonrpc == "") {
+		// Notifications must not be responded to.  See isNotification
+		// for details.
+		if isNotification(&request) {
 			if !c.authenticated {
 				break out
 			}
@@ -1312,17 +1359,15 @@ out:
 			break out
 		case !c.authenticated:
 			// Check credentials.
-			login := authCmd.Username + ":" + authCmd.Passphrase
-			auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-			authSha := sha256.Sum256([]byte(auth))
-			cmp := subtle.ConstantTimeCompare(authSha[:], c.server.authsha[:])
-			limitcmp := subtle.ConstantTimeCompare(authSha[:], c.server.limitauthsha[:])
-			if cmp != 1 && limitcmp != 1 {
+			authSha := basicAuthSHA(authCmd.Username,
+				authCmd.Passphrase)
+			user := lookupAuthUser(c.server.authUsers, authSha)
+			if user == nil {
 				rpcsLog.Warnf("Auth failure.")
 				break out
 			}
 			c.authenticated = true
-			c.isAdmin = cmp == 1
+			c.user = user
 
 			// Marshal and send response.
 			reply, err := createMarshalledReply(cmd.id, nil, nil)
@@ -1337,22 +1382,17 @@ out:
 
 		// Check if the client is using limited RPC credentials and
 		// error when not authorized to call this RPC.
-		if !c.isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr := &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
-				// Marshal and send response.
-				reply, err := createMarshalledReply(request.ID, nil, jsonErr)
-				if err != nil {
-					rpcsLog.Errorf("Failed to marshal parse failure "+
-						"reply: %v", err)
-					continue
-				}
-				c.SendMessage(reply, nil)
+		if !authorizeCall(c.user, c.addr, request.Method) {
+			// Marshal and send response.
+			reply, err := createMarshalledReply(request.ID, nil,
+				limitedUserError())
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal parse failure "+
+					"reply: %v", err)
 				continue
 			}
+			c.SendMessage(reply, nil)
+			continue
 		}
 
 		// Asynchronously handle the request.  A semaphore is used to
@@ -1392,6 +1432,16 @@ out:
 // appropriate RPC handler.  The response is marshalled and sent to the
 // websocket client.
 func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
+	reply := c.marshalledReply(r)
+	if reply == nil {
+		return
+	}
+	c.SendMessage(reply, nil)
+}
+
+// marshalledReply executes the appropriate RPC handler for a parsed RPC request
+// and returns the marshalled response, or nil if it could not be marshalled.
+func (c *wsClient) marshalledReply(r *parsedRPCCmd) []byte {
 	var (
 		result interface{}
 		err    error
@@ -1409,9 +1459,99 @@ func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal reply for <%s> "+
 			"command: %v", r.method, err)
+		return nil
+	}
+	return reply
+}
+
+// serviceBatchRequest services a batch of RPC requests sent by an
+// authenticated websocket client.  Each request in the batch is subject to the
+// same authorization rules as a standalone request and is run under the
+// client's concurrent request semaphore.  Once every request has been serviced,
+// the responses are sent to the client as a single batch response.
+//
+// This function blocks until the semaphore has been acquired for every request
+// in the batch, but does not wait for them to complete.
+func (c *wsClient) serviceBatchRequest(msg []byte) {
+	var rawRequests []json.RawMessage
+	if err := json.Unmarshal(msg, &rawRequests); err != nil {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+		if reply := batchFailureReply(jsonErr); reply != nil {
+			c.SendMessage(reply, nil)
+		}
 		return
 	}
-	c.SendMessage(reply, nil)
+
+	// An empty batch is an invalid request which is replied to with a
+	// single response rather than an empty array.
+	if len(rawRequests) == 0 {
+		reply := batchFailureReply(btcjson.ErrRPCInvalidRequest)
+		if reply != nil {
+			c.SendMessage(reply, nil)
+		}
+		return
+	}
+
+	replies := make([][]byte, len(rawRequests))
+	var wg sync.WaitGroup
+	for i, rawRequest := range rawRequests {
+		var request btcjson.Request
+		if err := json.Unmarshal(rawRequest, &request); err != nil {
+			jsonErr := &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidRequest.Code,
+				Message: "Failed to parse request: " + err.Error(),
+			}
+			replies[i] = batchFailureReply(jsonErr)
+			continue
+		}
+		if isNotification(&request) {
+			continue
+		}
+
+		// Authentication is per connection, so authenticate requests
+		// are rejected in batches.
+		cmd := parseCmd(&request)
+		if cmd.err == nil {
+			if _, ok := cmd.cmd.(*btcjson.AuthenticateCmd); ok {
+				cmd.err = &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidRequest.Code,
+					Message: "authenticate may not be batched",
+				}
+			} else if !authorizeCall(c.user, c.addr, request.Method) {
+				cmd.err = limitedUserError()
+			}
+		}
+		if cmd.err != nil {
+			reply, err := createMarshalledReply(cmd.id, nil, cmd.err)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal parse failure "+
+					"reply: %v", err)
+				continue
+			}
+			replies[i] = reply
+			continue
+		}
+		rpcsLog.Debugf("Received batched command <%s> from %s",
+			cmd.method, c.addr)
+
+		c.serviceRequestSem.acquire()
+		wg.Add(1)
+		go func(i int, cmd *parsedRPCCmd) {
+			replies[i] = c.marshalledReply(cmd)
+			c.serviceRequestSem.release()
+			wg.Done()
+		}(i, cmd)
+	}
+
+	go func() {
+		wg.Wait()
+		if reply := btcjson.MarshalBatchResponse(replies); reply != nil {
+			c.SendMessage(reply, nil)
+		}
+	}()
 }
 
 // notificationQueueHandler handles the queuing of outgoing notifications for
@@ -1619,7 +1759,7 @@ func (c *wsClient) WaitForShutdown() {
 // incoming and outgoing messages in separate goroutines complete with queuing
 // and asynchrous handling for long-running operations.
 func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
-	remoteAddr string, authenticated bool, isAdmin bool) (*wsClient, error) {
+	remoteAddr string, authenticated bool, user *rpcAuthUser) (*wsClient, error) {
 
 	sessionID, err := wire.RandomUint64()
 	if err != nil {
@@ -1630,7 +1770,7 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 		conn:              conn,
 		addr:              remoteAddr,
 		authenticated:     authenticated,
-		isAdmin:           isAdmin,
+		user:              user,
 		sessionID:         sessionID,
 		server:            server,
 		addrRequests:      make(map[string]struct{}),
@@ -24,6 +24,7 @@ import (
 	"github.com/bitgo/prova/addrmgr"
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/blockchain/indexers"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/connmgr"
@@ -197,8 +198,10 @@ type server struct {
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
+	txIndex       *indexers.TxIndex
+	addrIndex     *indexers.AddrIndex
+	addrUtxoIndex *indexers.AddrUtxoIndex
+	cfIndex       *indexers.CfIndex
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
@@ -251,6 +254,38 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, uint32, error) {
 	return best.Hash, best.Height, nil
 }
 
+// authorizePeerKey returns whether the remote peer may stay connected after
+// authenticating with the given key over the encrypted transport.  The key
+// must be one of the configured peer auth keys or, when enabled, a key in the
+// current validate key set.
+func (sp *serverPeer) authorizePeerKey(key *btcec.PublicKey) bool {
+	for _, authKey := range cfg.peerAuthKeys {
+		if key.IsEqual(authKey) {
+			return true
+		}
+	}
+	if cfg.PeerAuthValidateKeys {
+		adminKeySets := sp.server.blockManager.chain.AdminKeySets()
+		if adminKeySets[btcec.ValidateKeySet].Pos(key) != -1 {
+			return true
+		}
+	}
+	srvrLog.Infof("Rejecting peer %s: key %x is not authorized", sp,
+		key.SerializeCompressed())
+	return false
+}
+
+// isValidatorPeer returns whether the remote peer authenticated over the
+// encrypted transport with a key in the current validate key set.
+func (sp *serverPeer) isValidatorPeer() bool {
+	key := sp.AuthKey()
+	if key == nil {
+		return false
+	}
+	adminKeySets := sp.server.blockManager.chain.AdminKeySets()
+	return adminKeySets[btcec.ValidateKeySet].Pos(key) != -1
+}
+
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
 func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
@@ -492,6 +527,46 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	<-sp.blockProcessed
 }
 
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// It blocks until the block has been reconstructed and fully processed, or
+// until the missing transactions have been requested.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	sp.server.blockManager.QueueCmpctBlock(msg, sp)
+	<-sp.blockProcessed
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message.
+// It responds with the requested transactions of a block that was previously
+// sent to the peer as a cmpctblock message.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	blk, err := sp.server.blockManager.chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch block %v requested by "+
+			"getblocktxn from %s: %v", msg.BlockHash, sp, err)
+		return
+	}
+
+	txns := blk.MsgBlock().Transactions
+	blockTxn := wire.NewMsgBlockTxn(&msg.BlockHash)
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txns) {
+			sp.addBanScore(100, 0, fmt.Sprintf("getblocktxn index "+
+				"%d out of range for block %v", index,
+				msg.BlockHash))
+			return
+		}
+		blockTxn.AddTransaction(txns[index])
+	}
+	sp.QueueMessage(blockTxn, nil)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  It
+// blocks until the block the transactions complete has been fully processed.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	sp.server.blockManager.QueueBlockTxn(msg, sp)
+	<-sp.blockProcessed
+}
+
 // OnInv is invoked when a peer receives an inv bitcoin message and is
 // used to examine the inventory being advertised by the remote peer and react
 // accordingly.  We pass the message down to blockmanager which will call
@@ -529,6 +604,15 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	}
 }
 
+// OnHeaders is invoked when a peer receives a headers bitcoin message.  The
+// headers are passed to the block manager which checks the signer of each
+// announced block before requesting it.
+func (sp *serverPeer) OnHeaders(_ *peer.Peer, msg *wire.MsgHeaders) {
+	if len(msg.Headers) > 0 {
+		sp.server.blockManager.QueueHeaders(msg, sp)
+	}
+}
+
 // handleGetData is invoked when a peer receives a getdata bitcoin message and
 // is used to deliver block and transaction information.
 func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
@@ -567,6 +651,8 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan)
+		case wire.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeFilteredBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan)
 		default:
@@ -770,6 +856,203 @@ func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
 	sp.QueueMessage(&wire.MsgHeaders{Headers: blockHeaders}, nil)
 }
 
+// cfStopHeight returns the height of the passed stop hash of a committed
+// filter request when the server maintains the requested filter type and the
+// stop hash is in the main chain.  The boolean is false otherwise, in which
+// case the request is ignored.
+func (sp *serverPeer) cfStopHeight(cmd string, filterType wire.FilterType,
+	stopHash *chainhash.Hash) (uint32, bool) {
+
+	if sp.server.cfIndex == nil || filterType != wire.GCSFilterRegular {
+		peerLog.Debugf("Ignoring %s request with filter type %d from %v",
+			cmd, filterType, sp)
+		return 0, false
+	}
+
+	chain := sp.server.blockManager.chain
+	exists, err := chain.MainChainHasBlock(stopHash)
+	if err != nil || !exists {
+		peerLog.Debugf("Ignoring %s request with unknown stop hash %v "+
+			"from %v", cmd, stopHash, sp)
+		return 0, false
+	}
+	stopHeight, err := chain.BlockHeightByHash(stopHash)
+	if err != nil {
+		peerLog.Errorf("%s: failed to fetch height of stop hash %v: %v",
+			cmd, stopHash, err)
+		return 0, false
+	}
+	return stopHeight, true
+}
+
+// cfHashRange returns the hashes of the main chain blocks from the passed
+// start height through the passed stop height of a committed filter request.
+// The boolean is false when the range is invalid or exceeds the passed maximum
+// number of blocks, in which case the request is ignored.
+func (sp *serverPeer) cfHashRange(cmd string, startHeight, stopHeight,
+	maxRange uint32) ([]chainhash.Hash, bool) {
+
+	if startHeight > stopHeight || stopHeight-startHeight >= maxRange {
+		peerLog.Debugf("Ignoring %s request with invalid range %d-%d "+
+			"from %v", cmd, startHeight, stopHeight, sp)
+		return nil, false
+	}
+	hashes, err := sp.server.blockManager.chain.HeightRange(startHeight,
+		stopHeight+1)
+	if err != nil {
+		peerLog.Errorf("%s: failed to fetch hashes: %v", cmd, err)
+		return nil, false
+	}
+	return hashes, true
+}
+
+// OnGetCFilters is invoked when a peer receives a getcfilters bitcoin message.
+// It responds with a cfilter message for every block in the requested range.
+func (sp *serverPeer) OnGetCFilters(_ *peer.Peer, msg *wire.MsgGetCFilters) {
+	// Ignore getcfilters requests if not in sync.
+	if !sp.server.blockManager.IsCurrent() {
+		return
+	}
+
+	stopHeight, ok := sp.cfStopHeight(msg.Command(), msg.FilterType,
+		&msg.StopHash)
+	if !ok {
+		return
+	}
+	hashes, ok := sp.cfHashRange(msg.Command(), msg.StartHeight,
+		stopHeight, wire.MaxGetCFiltersReqRange)
+	if !ok {
+		return
+	}
+
+	filters, err := sp.server.cfIndex.FiltersByBlockHashes(hashes)
+	if err != nil {
+		peerLog.Errorf("OnGetCFilters: failed to fetch filters: %v", err)
+		return
+	}
+	for i, filter := range filters {
+		if filter == nil {
+			peerLog.Warnf("OnGetCFilters: no filter for block %v",
+				hashes[i])
+			return
+		}
+		sp.QueueMessage(wire.NewMsgCFilter(msg.FilterType, &hashes[i],
+			filter), nil)
+	}
+}
+
+// OnGetCFHeaders is invoked when a peer receives a getcfheaders bitcoin
+// message.  It responds with the filter hashes of the blocks in the requested
+// range along with the filter header which precedes them.
+func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *wire.MsgGetCFHeaders) {
+	// Ignore getcfheaders requests if not in sync.
+	if !sp.server.blockManager.IsCurrent() {
+		return
+	}
+
+	stopHeight, ok := sp.cfStopHeight(msg.Command(), msg.FilterType,
+		&msg.StopHash)
+	if !ok {
+		return
+	}
+	hashes, ok := sp.cfHashRange(msg.Command(), msg.StartHeight,
+		stopHeight, wire.MaxCFHeadersPerMsg)
+	if !ok {
+		return
+	}
+
+	// The filter header which precedes the range is the header of the
+	// filter of the block before the start, or zero for the genesis block.
+	var prevFilterHeader chainhash.Hash
+	if msg.StartHeight > 0 {
+		prevHash, err := sp.server.blockManager.chain.BlockHashByHeight(
+			msg.StartHeight - 1)
+		if err != nil {
+			peerLog.Errorf("OnGetCFHeaders: failed to fetch hash: %v",
+				err)
+			return
+		}
+		header, err := sp.server.cfIndex.FilterHeaderByBlockHash(prevHash)
+		if err != nil || header == nil {
+			peerLog.Errorf("OnGetCFHeaders: failed to fetch filter "+
+				"header of block %v: %v", prevHash, err)
+			return
+		}
+		prevFilterHeader = *header
+	}
+
+	filters, err := sp.server.cfIndex.FiltersByBlockHashes(hashes)
+	if err != nil {
+		peerLog.Errorf("OnGetCFHeaders: failed to fetch filters: %v", err)
+		return
+	}
+	cfHeadersMsg := wire.NewMsgCFHeaders(msg.FilterType, &msg.StopHash,
+		&prevFilterHeader)
+	for i, filter := range filters {
+		if filter == nil {
+			peerLog.Warnf("OnGetCFHeaders: no filter for block %v",
+				hashes[i])
+			return
+		}
+		filterHash := chainhash.DoubleHashH(filter)
+		if err := cfHeadersMsg.AddCFHash(&filterHash); err != nil {
+			peerLog.Errorf("OnGetCFHeaders: %v", err)
+			return
+		}
+	}
+	sp.QueueMessage(cfHeadersMsg, nil)
+}
+
+// OnGetCFCheckpt is invoked when a peer receives a getcfcheckpt bitcoin
+// message.  It responds with the filter headers of every wire.CFCheckptInterval
+// blocks up to the stop hash.
+func (sp *serverPeer) OnGetCFCheckpt(_ *peer.Peer, msg *wire.MsgGetCFCheckpt) {
+	// Ignore getcfcheckpt requests if not in sync.
+	if !sp.server.blockManager.IsCurrent() {
+		return
+	}
+
+	stopHeight, ok := sp.cfStopHeight(msg.Command(), msg.FilterType,
+		&msg.StopHash)
+	if !ok {
+		return
+	}
+
+	chain := sp.server.blockManager.chain
+	numCheckpoints := stopHeight / wire.CFCheckptInterval
+	hashes := make([]chainhash.Hash, 0, numCheckpoints)
+	for i := uint32(1); i <= numCheckpoints; i++ {
+		hash, err := chain.BlockHashByHeight(i * wire.CFCheckptInterval)
+		if err != nil {
+			peerLog.Errorf("OnGetCFCheckpt: failed to fetch hash: %v",
+				err)
+			return
+		}
+		hashes = append(hashes, *hash)
+	}
+
+	headers, err := sp.server.cfIndex.FilterHeadersByBlockHashes(hashes)
+	if err != nil {
+		peerLog.Errorf("OnGetCFCheckpt: failed to fetch filter headers: "+
+			"%v", err)
+		return
+	}
+	checkptMsg := wire.NewMsgCFCheckpt(msg.FilterType, &msg.StopHash,
+		len(headers))
+	for i, header := range headers {
+		if header == nil {
+			peerLog.Warnf("OnGetCFCheckpt: no filter for block %v",
+				hashes[i])
+			return
+		}
+		if err := checkptMsg.AddCFHeader(header); err != nil {
+			peerLog.Errorf("OnGetCFCheckpt: %v", err)
+			return
+		}
+	}
+	sp.QueueMessage(checkptMsg, nil)
+}
+
 // enforceNodeBloomFlag disconnects the peer if the server is not configured to
 // allow bloom filters.  Additionally, if the peer has negotiated to a protocol
 // version  that is high enough to observe the bloom filter service support bit,
@@ -1043,6 +1326,27 @@ func (s *server) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {
 	}
 }
 
+// notifySigVariant logs a transaction which only differs from the one in the
+// memory pool by its signatures and notifies websocket clients about it.  The
+// block is nil unless the transaction was confirmed by it, in which case the
+// transaction in the memory pool is about to be replaced by the one that was
+// actually confirmed.
+func (s *server) notifySigVariant(poolTx, tx *provautil.Tx, block *provautil.Block) {
+	if block != nil {
+		srvrLog.Infof("Block %v confirmed transaction %v with signatures "+
+			"%v instead of %v from the memory pool", block.Hash(),
+			tx.Hash(), tx.HashWithSig(), poolTx.HashWithSig())
+	} else {
+		srvrLog.Infof("Rejected transaction %v with signatures %v which "+
+			"conflicts with %v in the memory pool", tx.Hash(),
+			tx.HashWithSig(), poolTx.HashWithSig())
+	}
+
+	if s.rpcServer != nil {
+		s.rpcServer.ntfnMgr.NotifySigVariant(poolTx, tx, block)
+	}
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
@@ -1134,6 +1438,44 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  A full block is sent instead when the peer has not
+// negotiated compact blocks.  An error is returned if the block hash is not
+// known.
+func (s *server) pushCmpctBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+	if !sp.SupportsCmpctBlocks() {
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan)
+	}
+
+	blk, err := sp.server.blockManager.chain.BlockByHash(hash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	cmpctBlock := wire.NewMsgCmpctBlock(blk.MsgBlock(), nonce)
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	sp.QueueMessage(cmpctBlock, doneChan)
+	return nil
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
@@ -1335,23 +1677,52 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	// The cmpctblock message for a relayed block is created on demand and
+	// shared by all peers which prefer compact blocks.
+	var cmpctBlock *wire.MsgCmpctBlock
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
 		}
 
+		// If the inventory is a block and the peer prefers compact
+		// blocks, generate and send a cmpctblock message instead of an
+		// inventory message.
+		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsCmpctBlocks() {
+			block, ok := msg.data.(*provautil.Block)
+			if !ok {
+				peerLog.Warnf("Underlying data for cmpctblock" +
+					" is not a block")
+				return
+			}
+			if cmpctBlock == nil {
+				nonce, err := wire.RandomUint64()
+				if err != nil {
+					peerLog.Errorf("Failed to generate "+
+						"cmpctblock nonce: %v", err)
+					return
+				}
+				cmpctBlock = wire.NewMsgCmpctBlock(
+					block.MsgBlock(), nonce)
+			}
+			sp.AddKnownInventory(msg.invVect)
+			sp.QueueMessage(cmpctBlock, nil)
+			return
+		}
+
 		// If the inventory is a block and the peer prefers headers,
 		// generate and send a headers message instead of an inventory
 		// message.
 		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
-			blockHeader, ok := msg.data.(wire.BlockHeader)
+			block, ok := msg.data.(*provautil.Block)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
-					" is not a block header")
+					" is not a block")
 				return
 			}
 			msgHeaders := wire.NewMsgHeaders()
-			if err := msgHeaders.AddBlockHeader(&blockHeader); err != nil {
+			blockHeader := &block.MsgBlock().Header
+			if err := msgHeaders.AddBlockHeader(blockHeader); err != nil {
 				peerLog.Errorf("Failed to add block"+
 					" header: %v", err)
 				return
@@ -1449,6 +1820,8 @@ type removeNodeMsg struct {
 	reply chan error
 }
 
+type reauthorizePeersMsg struct{}
+
 // handleQuery is the central handler for all queries and commands from other
 // goroutines related to peer state.
 func (s *server) handleQuery(state *peerState, querymsg interface{}) {
@@ -1558,6 +1931,17 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		}
 
 		msg.reply <- errors.New("peer not found")
+
+	// Disconnect the peers which authenticated with a key that is no longer
+	// authorized.  Peers which have not completed the transport negotiation
+	// are checked against the current keys once they do.
+	case reauthorizePeersMsg:
+		state.forAllPeers(func(sp *serverPeer) {
+			key := sp.AuthKey()
+			if key != nil && !sp.authorizePeerKey(key) {
+				sp.Disconnect()
+			}
+		})
 	}
 }
 
@@ -1587,24 +1971,36 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
+	var authorizePeerKey func(*btcec.PublicKey) bool
+	if len(cfg.peerAuthKeys) > 0 || cfg.PeerAuthValidateKeys {
+		authorizePeerKey = sp.authorizePeerKey
+	}
+
 	return &peer.Config{
 		Listeners: peer.MessageListeners{
-			OnVersion:     sp.OnVersion,
-			OnMemPool:     sp.OnMemPool,
-			OnTx:          sp.OnTx,
-			OnBlock:       sp.OnBlock,
-			OnInv:         sp.OnInv,
-			OnGetData:     sp.OnGetData,
-			OnGetBlocks:   sp.OnGetBlocks,
-			OnGetHeaders:  sp.OnGetHeaders,
-			OnFeeFilter:   sp.OnFeeFilter,
-			OnFilterAdd:   sp.OnFilterAdd,
-			OnFilterClear: sp.OnFilterClear,
-			OnFilterLoad:  sp.OnFilterLoad,
-			OnGetAddr:     sp.OnGetAddr,
-			OnAddr:        sp.OnAddr,
-			OnRead:        sp.OnRead,
-			OnWrite:       sp.OnWrite,
+			OnVersion:      sp.OnVersion,
+			OnMemPool:      sp.OnMemPool,
+			OnTx:           sp.OnTx,
+			OnBlock:        sp.OnBlock,
+			OnInv:          sp.OnInv,
+			OnHeaders:      sp.OnHeaders,
+			OnCmpctBlock:   sp.OnCmpctBlock,
+			OnGetBlockTxn:  sp.OnGetBlockTxn,
+			OnBlockTxn:     sp.OnBlockTxn,
+			OnGetData:      sp.OnGetData,
+			OnGetBlocks:    sp.OnGetBlocks,
+			OnGetHeaders:   sp.OnGetHeaders,
+			OnGetCFilters:  sp.OnGetCFilters,
+			OnGetCFHeaders: sp.OnGetCFHeaders,
+			OnGetCFCheckpt: sp.OnGetCFCheckpt,
+			OnFeeFilter:    sp.OnFeeFilter,
+			OnFilterAdd:    sp.OnFilterAdd,
+			OnFilterClear:  sp.OnFilterClear,
+			OnFilterLoad:   sp.OnFilterLoad,
+			OnGetAddr:      sp.OnGetAddr,
+			OnAddr:         sp.OnAddr,
+			OnRead:         sp.OnRead,
+			OnWrite:        sp.OnWrite,
 
 			// Note: The reference client currently bans peers that send alerts
 			// not signed with its key.  We could verify against their key, but
@@ -1612,15 +2008,18 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			// other implementations' alert messages, we will not relay theirs.
 			OnAlert: nil,
 		},
-		NewestBlock:      sp.newestBlock,
-		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
-		Proxy:            cfg.Proxy,
-		UserAgentName:    userAgentName,
-		UserAgentVersion: userAgentVersion,
-		ChainParams:      sp.server.chainParams,
-		Services:         sp.server.services,
-		DisableRelayTx:   cfg.BlocksOnly,
-		ProtocolVersion:  wire.FeeFilterVersion,
+		NewestBlock:       sp.newestBlock,
+		HostToNetAddress:  sp.server.addrManager.HostToNetAddress,
+		Proxy:             cfg.Proxy,
+		UserAgentName:     userAgentName,
+		UserAgentVersion:  userAgentVersion,
+		ChainParams:       sp.server.chainParams,
+		Services:          sp.server.services,
+		DisableRelayTx:    cfg.BlocksOnly,
+		ProtocolVersion:   wire.CompactBlocksVersion,
+		TransportKey:      cfg.peerKey,
+		RequireEncryption: cfg.RequireEncryption,
+		AuthorizePeerKey:  authorizePeerKey,
 	}
 }
 
@@ -1862,6 +2261,17 @@ func (s *server) DisconnectNodeByID(id int32) error {
 	return <-replyChan
 }
 
+// ReauthorizePeers disconnects the peers which authenticated over the encrypted
+// transport with a key which is no longer authorized, such as a validate key
+// which has been revoked since they connected.  The connection manager is
+// informed of the disconnections as for any other peer which disconnects.
+func (s *server) ReauthorizePeers() {
+	if len(cfg.peerAuthKeys) == 0 && !cfg.PeerAuthValidateKeys {
+		return
+	}
+	s.query <- reauthorizePeersMsg{}
+}
+
 // RemoveNodeByAddr removes a peer from the list of persistent peers if
 // present. An error will be returned if the peer was not found.
 func (s *server) RemoveNodeByAddr(addr string) error {
@@ -2204,6 +2614,21 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if cfg.NoPeerBloomFilters {
 		services &^= wire.SFNodeBloom
 	}
+	if cfg.PeerEncryption {
+		services |= wire.SFNodeEncrypted
+	}
+	if cfg.CfIndex {
+		services |= wire.SFNodeCF
+	}
+	// Pruned nodes can not serve the full chain.  This applies to databases
+	// which have been pruned even when pruning is no longer enabled.
+	isPruned, err := blockchain.IsPrunedDB(db)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Prune != 0 || isPruned {
+		services &^= wire.SFNodeNetwork
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
 
@@ -2351,19 +2776,21 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
 	}
 
-	// Create the transaction and address indexes if needed.
+	// Create the transaction, address and committed filter indexes if
+	// needed.
 	//
 	// CAUTION: the txindex needs to be first in the indexes array because
-	// the addrindex uses data from the txindex during catchup.  If the
-	// addrindex is run first, it may not have the transactions from the
-	// current block indexed.
+	// the addrindex and cfindex use data from the txindex during catchup.
+	// If they are run first, the txindex may not have the transactions
+	// from the current block indexed.
 	var indexes []indexers.Indexer
-	if cfg.TxIndex || cfg.AddrIndex {
-		// Enable transaction index if address index is enabled since it
-		// requires it.
+	if cfg.TxIndex || cfg.AddrIndex || cfg.CfIndex {
+		// Enable transaction index if the address or committed filter
+		// index is enabled since they require it.
 		if !cfg.TxIndex {
 			indxLog.Infof("Transaction index enabled because it " +
-				"is required by the address index")
+				"is required by the address or committed filter " +
+				"index")
 			cfg.TxIndex = true
 		} else {
 			indxLog.Info("Transaction index is enabled")
@@ -2375,7 +2802,13 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if cfg.AddrIndex {
 		indxLog.Info("Address index is enabled")
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
-		indexes = append(indexes, s.addrIndex)
+		s.addrUtxoIndex = indexers.NewAddrUtxoIndex(db, chainParams)
+		indexes = append(indexes, s.addrIndex, s.addrUtxoIndex)
+	}
+	if cfg.CfIndex {
+		indxLog.Info("Committed filter index is enabled")
+		s.cfIndex = indexers.NewCfIndex(db)
+		indexes = append(indexes, s.cfIndex)
 	}
 
 	// Create an index manager if any of the optional indexes are enabled.
@@ -2416,6 +2849,9 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		CalcSequenceLock: func(tx *provautil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
 			return bm.chain.CalcSequenceLock(tx, view, true)
 		},
+		SigVariantConflict: func(poolTx, tx *provautil.Tx) {
+			s.notifySigVariant(poolTx, tx, nil)
+		},
 	}
 	s.txMemPool = mempool.New(&txC)
 
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestNewPeerConfigRequireEncryption ensures the peer configuration created
+// with --requireencryption drops connections to peers which do not negotiate
+// the encrypted transport.
+func TestNewPeerConfigRequireEncryption(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{PeerEncryption: true, RequireEncryption: true}
+	defer func() { cfg = origCfg }()
+
+	params := &chaincfg.RegressionNetParams
+	sp := &serverPeer{server: &server{
+		chainParams: params,
+		services:    wire.SFNodeNetwork | wire.SFNodeEncrypted,
+	}}
+	peerCfg := newPeerConfig(sp)
+	if !peerCfg.RequireEncryption {
+		t.Fatal("peer config does not require encryption")
+	}
+
+	// Use the transport settings of the server peer configuration without
+	// the callbacks which need a running server.
+	peerCfg.Listeners = peer.MessageListeners{}
+	peerCfg.NewestBlock = nil
+	peerCfg.HostToNetAddress = nil
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: unexpected error: %v", err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	remoteConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	defer remoteConn.Close()
+	conn, ok := <-accepted
+	if !ok {
+		t.Fatal("failed to accept connection")
+	}
+
+	inPeer := peer.NewInboundPeer(peerCfg)
+	inPeer.AssociateConnection(conn)
+	defer inPeer.WaitForDisconnect()
+	defer inPeer.Disconnect()
+
+	// Act as a remote peer which does not support the encrypted transport.
+	remoteAddr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	version := wire.NewMsgVersion(remoteAddr, remoteAddr, 1, 0)
+	err = wire.WriteMessage(remoteConn, version, wire.ProtocolVersion,
+		params.Net)
+	if err != nil {
+		t.Fatalf("WriteMessage: unexpected error: %v", err)
+	}
+
+	disconnected := make(chan struct{})
+	go func() {
+		inPeer.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("peer which does not support the encrypted transport " +
+			"was not disconnected")
+	}
+}
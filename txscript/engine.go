@@ -106,6 +106,8 @@ type Engine struct {
 	bip16           bool     // treat execution as pay-to-script-hash
 	savedFirstStack [][]byte // stack from first script for bip16 scripts
 	inputAmount     int64
+	traceSigs       bool       // record signature matches while tracing
+	sigMatches      []SigMatch // signature matches of the traced opcode
 }
 
 // hasFlag returns whether the script engine instance has the passed flag set.
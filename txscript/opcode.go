@@ -2256,6 +2256,7 @@ func opcodeCheckSafeMultiSig(op *parsedOpcode, vm *Engine) error {
 		// Check hash of key in scriptSig against all key hashes in scriptPub
 		// If we don't find one that matches, script fails.
 		found := false
+		var matchedKeyHash []byte
 		for idx, keyHash := range keyHashes {
 			if matchedKeyHashes[idx] {
 				// Make sure we don't re-match the same key
@@ -2264,10 +2265,16 @@ func opcodeCheckSafeMultiSig(op *parsedOpcode, vm *Engine) error {
 			if bytes.Equal(hash160, keyHash) {
 				found = true
 				matchedKeyHashes[idx] = true
+				matchedKeyHash = keyHash
 				break
 			}
 		}
 		if !found {
+			// A signature which was already checked against the
+			// key hash it matched is not recorded again.
+			if !sigInfo.parsed {
+				vm.traceSigMatch(pubKey, nil, false)
+			}
 			success = false
 			break
 		}
@@ -2299,12 +2306,14 @@ func opcodeCheckSafeMultiSig(op *parsedOpcode, vm *Engine) error {
 			}
 			sigInfo.parsed = true
 			if err != nil {
+				vm.traceSigMatch(pubKey, matchedKeyHash, false)
 				continue
 			}
 			sigInfo.parsedSignature = parsedSig
 		} else {
 			// Skip to the next pubkey if the signature is integervalid.
 			if sigInfo.parsedSignature == nil {
+				vm.traceSigMatch(pubKey, matchedKeyHash, false)
 				continue
 			}
 
@@ -2343,6 +2352,7 @@ func opcodeCheckSafeMultiSig(op *parsedOpcode, vm *Engine) error {
 		} else {
 			valid = parsedSig.Verify(hash, parsedPubKey)
 		}
+		vm.traceSigMatch(pubKey, matchedKeyHash, valid)
 
 		if valid {
 			// PubKey verified, move on to the next signature.
@@ -548,3 +548,33 @@ func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (Script
 
 	return scriptClass, addrs, requiredSigs, nil
 }
+
+// ExtractProvaSigners returns the number of required signatures, the public key
+// hashes and the KeyIDs of the signers of the passed Prova PkScript.  An error
+// is returned when the script is not a Prova script.
+func ExtractProvaSigners(pkScript []byte) (int, [][]byte, []btcec.KeyID, error) {
+	pops, err := ParseScript(pkScript)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if !isGeneralProva(pops) {
+		return 0, nil, nil, fmt.Errorf("script is not a prova script")
+	}
+
+	// The structure has been checked by isGeneralProva, so the key hashes
+	// are the 20 byte pushes followed by the KeyIDs.
+	var keyHashes [][]byte
+	var keyIDs []btcec.KeyID
+	for _, pop := range pops[1 : len(pops)-2] {
+		if len(pop.data) == 20 {
+			keyHashes = append(keyHashes, pop.data)
+		} else if isUint32(pop.opcode) {
+			keyID, err := asInt32(pop)
+			if err != nil {
+				return 0, nil, nil, err
+			}
+			keyIDs = append(keyIDs, btcec.KeyID(keyID))
+		}
+	}
+	return asSmallInt(pops[0].opcode), keyHashes, keyIDs, nil
+}
@@ -121,6 +121,70 @@ func TestExtractPkScriptAddrs(t *testing.T) {
 	}
 }
 
+// TestExtractProvaSigners ensures the required signatures, key hashes and
+// KeyIDs are extracted from Prova scripts as intended.
+func TestExtractProvaSigners(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		script    []byte
+		reqSigs   int
+		keyHashes [][]byte
+		keyIDs    []btcec.KeyID
+		isErr     bool
+	}{
+		{
+			name: "standard prova",
+			script: decodeHex("521435dbbf04bca061e49dace08f858d87" +
+				"75c0a57c8e030000015153ba"),
+			reqSigs:   2,
+			keyHashes: [][]byte{decodeHex("35dbbf04bca061e49dace08f858d8775c0a57c8e")},
+			keyIDs:    []btcec.KeyID{0x10000, 1},
+		},
+		{
+			name: "general prova with two key hashes",
+			script: mustParseShortForm("3 DATA_20 0x" +
+				"35dbbf04bca061e49dace08f858d8775c0a57c8e DATA_20 0x" +
+				"0102030405060708090a0b0c0d0e0f1011121314 1 2 3 5 " +
+				"CHECKSAFEMULTISIG"),
+			reqSigs: 3,
+			keyHashes: [][]byte{
+				decodeHex("35dbbf04bca061e49dace08f858d8775c0a57c8e"),
+				decodeHex("0102030405060708090a0b0c0d0e0f1011121314"),
+			},
+			keyIDs: []btcec.KeyID{1, 2, 3},
+		},
+		{
+			name:   "admin thread script",
+			script: mustParseShortForm("0 CHECKTHREAD"),
+			isErr:  true,
+		},
+		{
+			name:   "script that does not parse",
+			script: []byte{OP_DATA_45},
+			isErr:  true,
+		},
+	}
+
+	for i, test := range tests {
+		reqSigs, keyHashes, keyIDs, err := ExtractProvaSigners(test.script)
+		if (err != nil) != test.isErr {
+			t.Errorf("ExtractProvaSigners #%d (%s) unexpected error: "+
+				"%v", i, test.name, err)
+			continue
+		}
+		if reqSigs != test.reqSigs ||
+			!reflect.DeepEqual(keyHashes, test.keyHashes) ||
+			!reflect.DeepEqual(keyIDs, test.keyIDs) {
+
+			t.Errorf("ExtractProvaSigners #%d (%s) got %d %x %v, "+
+				"want %d %x %v", i, test.name, reqSigs, keyHashes,
+				keyIDs, test.reqSigs, test.keyHashes, test.keyIDs)
+		}
+	}
+}
+
 // TestIsValidAdminOp tests the IsValidAdminOp function.
 func TestIsValidAdminOp(t *testing.T) {
 	// Create some dummy admin op output.
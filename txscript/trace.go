@@ -0,0 +1,100 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+// SigMatch describes how a signature of an OP_CHECKSAFEMULTISIG or
+// OP_CHECKTHREAD was checked.
+type SigMatch struct {
+	// PubKey is the public key provided along with the signature.
+	PubKey []byte
+
+	// KeyHash is the key hash of the script the public key was matched
+	// against.  It is nil when the public key does not match any of the
+	// key hashes which were not matched by a previous signature.
+	KeyHash []byte
+
+	// Valid is whether the signature is valid for the public key.
+	Valid bool
+}
+
+// TraceStep houses the state of the script engine before and after the
+// execution of a single opcode.
+type TraceStep struct {
+	// ScriptIdx and ScriptOff are the index of the script and the offset of
+	// the opcode in the script.
+	ScriptIdx int
+	ScriptOff int
+
+	// Opcode is the disassembly of the executed opcode.
+	Opcode string
+
+	// Stack and AltStack are the data and alt stacks before the opcode was
+	// executed.  StackAfter and AltStackAfter are the stacks afterwards.
+	Stack         [][]byte
+	AltStack      [][]byte
+	StackAfter    [][]byte
+	AltStackAfter [][]byte
+
+	// SigMatches are the signatures checked by the opcode, in the order
+	// they were checked.
+	SigMatches []SigMatch
+}
+
+// Trace executes all scripts in the script engine the same way as Execute
+// while recording each executed opcode, the state of the stacks before and
+// after the opcode, and the public keys each signature of OP_CHECKSAFEMULTISIG
+// and OP_CHECKTHREAD was matched against.
+//
+// The returned error is the one Execute would have returned.  When it is not
+// nil, the last step is the opcode which failed, if any.
+func (vm *Engine) Trace() ([]TraceStep, error) {
+	vm.traceSigs = true
+	defer func() {
+		vm.traceSigs = false
+		vm.sigMatches = nil
+	}()
+
+	var steps []TraceStep
+	done := false
+	for !done {
+		if err := vm.validPC(); err != nil {
+			return steps, err
+		}
+		pop := &vm.scripts[vm.scriptIdx][vm.scriptOff]
+		step := TraceStep{
+			ScriptIdx: vm.scriptIdx,
+			ScriptOff: vm.scriptOff,
+			Opcode:    pop.print(false),
+			Stack:     vm.GetStack(),
+			AltStack:  vm.GetAltStack(),
+		}
+
+		vm.sigMatches = nil
+		var err error
+		done, err = vm.Step()
+		step.StackAfter = vm.GetStack()
+		step.AltStackAfter = vm.GetAltStack()
+		step.SigMatches = vm.sigMatches
+		steps = append(steps, step)
+		if err != nil {
+			return steps, err
+		}
+	}
+
+	return steps, vm.CheckErrorCondition(true)
+}
+
+// traceSigMatch records how a signature was checked when the engine is being
+// traced.
+func (vm *Engine) traceSigMatch(pubKey, keyHash []byte, valid bool) {
+	if !vm.traceSigs {
+		return
+	}
+	vm.sigMatches = append(vm.sigMatches, SigMatch{
+		PubKey:  pubKey,
+		KeyHash: keyHash,
+		Valid:   valid,
+	})
+}
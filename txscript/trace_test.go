@@ -0,0 +1,135 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestTrace ensures the trace of a thread spend records every executed opcode
+// along with the stacks, and the key hashes the signatures were matched
+// against.
+func TestTrace(t *testing.T) {
+	t.Parallel()
+
+	key1, _ := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("2b8c52b77"+
+		"b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"))
+	key2, _ := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("eaf02ca34"+
+		"8c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"))
+	key3, _ := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("0101010101"+
+		"010101010101010101010101010101010101010101010101010101"))
+	keyHash1 := provautil.Hash160(key1.PubKey().SerializeCompressed())
+	keyHash2 := provautil.Hash160(key2.PubKey().SerializeCompressed())
+
+	// The admin thread script as it is executed after the thread has been
+	// replaced by the hashes of the admin keys.
+	pkScript, err := ThreadPkScript([][]byte{keyHash1, keyHash2})
+	if err != nil {
+		t.Fatalf("ThreadPkScript: unexpected error: %v", err)
+	}
+	threadScript, err := ProvaThreadScript(provautil.RootThread)
+	if err != nil {
+		t.Fatalf("ProvaThreadScript: unexpected error: %v", err)
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, threadScript))
+
+	// trace signs the transaction with the passed keys and traces the
+	// execution of the scripts.
+	trace := func(keys ...*btcec.PrivateKey) ([]TraceStep, error) {
+		sigScript, err := SignTxOutput(&chaincfg.RegressionNetParams, tx,
+			0, 0, threadScript, SigHashAll,
+			KeyClosure(func(provautil.Address) ([]PrivateKey, error) {
+				privKeys := make([]PrivateKey, len(keys))
+				for i, key := range keys {
+					privKeys[i] = PrivateKey{key, true}
+				}
+				return privKeys, nil
+			}), nil)
+		if err != nil {
+			t.Fatalf("SignTxOutput: unexpected error: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		vm, err := NewEngine(pkScript, tx, 0, ScriptBip16|
+			ScriptVerifyDERSignatures, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("NewEngine: unexpected error: %v", err)
+		}
+		return vm.Trace()
+	}
+
+	// The spend signed by both admin keys succeeds.  Each opcode of the
+	// signature script and the public key script is traced.
+	steps, err := trace(key1, key2)
+	if err != nil {
+		t.Fatalf("Trace: unexpected error: %v", err)
+	}
+	if len(steps) != 4+5 {
+		t.Fatalf("Trace: got %d steps, want %d", len(steps), 4+5)
+	}
+	for i, step := range steps[:4] {
+		if step.ScriptIdx != 0 || step.ScriptOff != i {
+			t.Fatalf("Trace: step %d is at %d:%d", i, step.ScriptIdx,
+				step.ScriptOff)
+		}
+	}
+	last := steps[len(steps)-1]
+	if last.ScriptIdx != 1 || last.Opcode != "OP_CHECKTHREAD" {
+		t.Fatalf("Trace: unexpected last step %d:%s", last.ScriptIdx,
+			last.Opcode)
+	}
+	if len(last.Stack) != 4+5-1 ||
+		!reflect.DeepEqual(last.StackAfter, [][]byte{{0x01}}) {
+
+		t.Fatalf("Trace: unexpected stacks %x -> %x", last.Stack,
+			last.StackAfter)
+	}
+	for i, step := range steps[1:] {
+		if !reflect.DeepEqual(step.Stack, steps[i].StackAfter) {
+			t.Fatalf("Trace: stack of step %d is %x, want %x", i+1,
+				step.Stack, steps[i].StackAfter)
+		}
+	}
+
+	// The signatures are checked from the top of the stack.
+	wantMatches := []SigMatch{
+		{PubKey: key2.PubKey().SerializeCompressed(), KeyHash: keyHash2,
+			Valid: true},
+		{PubKey: key1.PubKey().SerializeCompressed(), KeyHash: keyHash1,
+			Valid: true},
+	}
+	if !reflect.DeepEqual(last.SigMatches, wantMatches) {
+		t.Fatalf("Trace: got signature matches %+v, want %+v",
+			last.SigMatches, wantMatches)
+	}
+
+	// A spend signed by a key which is not an admin key fails and the
+	// unknown key is reported without a matching key hash.
+	steps, err = trace(key1, key3)
+	if !IsErrorCode(err, ErrEvalFalse) {
+		t.Fatalf("Trace: unexpected error: %v", err)
+	}
+	last = steps[len(steps)-1]
+	if len(last.SigMatches) != 1 || last.SigMatches[0].KeyHash != nil ||
+		last.SigMatches[0].Valid || !bytes.Equal(last.SigMatches[0].PubKey,
+		key3.PubKey().SerializeCompressed()) {
+
+		t.Fatalf("Trace: unexpected signature matches %+v",
+			last.SigMatches)
+	}
+}
@@ -70,6 +70,24 @@ func TestMessage(t *testing.T) {
 	bh := NewBlockHeader(&chainhash.Hash{}, &chainhash.Hash{}, 0, 0)
 	msgMerkleBlock := NewMsgMerkleBlock(bh)
 	msgReject := NewMsgReject("block", RejectDuplicate, "duplicate block")
+	msgEncInit := NewMsgEncInit([EncInitKeySize]byte{0x02})
+	msgEncAuth := NewMsgEncAuth([]byte{0x02, 0x03}, []byte{0x30})
+	msgSendCmpct := NewMsgSendCmpct(true, CmpctBlockVersion)
+	msgCmpctBlock := NewMsgCmpctBlock(&MsgBlock{
+		Header:       *bh,
+		Transactions: []*MsgTx{NewMsgTx(1), NewMsgTx(2)},
+	}, 123123)
+	msgGetBlockTxn := NewMsgGetBlockTxn(&chainhash.Hash{}, []uint32{1, 3})
+	msgBlockTxn := NewMsgBlockTxn(&chainhash.Hash{})
+	msgBlockTxn.AddTransaction(NewMsgTx(1))
+	msgGetCFilters := NewMsgGetCFilters(GCSFilterRegular, 0, &chainhash.Hash{})
+	msgGetCFHeaders := NewMsgGetCFHeaders(GCSFilterRegular, 0, &chainhash.Hash{})
+	msgGetCFCheckpt := NewMsgGetCFCheckpt(GCSFilterRegular, &chainhash.Hash{})
+	msgCFilter := NewMsgCFilter(GCSFilterRegular, &chainhash.Hash{},
+		[]byte{0x01})
+	msgCFHeaders := NewMsgCFHeaders(GCSFilterRegular, &chainhash.Hash{},
+		&chainhash.Hash{})
+	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -99,6 +117,18 @@ func TestMessage(t *testing.T) {
 		{msgFilterLoad, msgFilterLoad, pver, MainNet, 35},
 		{msgMerkleBlock, msgMerkleBlock, pver, MainNet, 239},
 		{msgReject, msgReject, pver, MainNet, 79},
+		{msgEncInit, msgEncInit, pver, MainNet, 57},
+		{msgEncAuth, msgEncAuth, pver, MainNet, 29},
+		{msgSendCmpct, msgSendCmpct, pver, MainNet, 33},
+		{msgCmpctBlock, msgCmpctBlock, pver, MainNet, 260},
+		{msgGetBlockTxn, msgGetBlockTxn, pver, MainNet, 59},
+		{msgBlockTxn, msgBlockTxn, pver, MainNet, 67},
+		{msgGetCFilters, msgGetCFilters, pver, MainNet, 61},
+		{msgGetCFHeaders, msgGetCFHeaders, pver, MainNet, 61},
+		{msgGetCFCheckpt, msgGetCFCheckpt, pver, MainNet, 57},
+		{msgCFilter, msgCFilter, pver, MainNet, 59},
+		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
+		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
 	}
 
 	t.Logf("Running %d tests", len(tests))
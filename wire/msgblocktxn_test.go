@@ -0,0 +1,49 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxn tests the MsgBlockTxn API and wire encode and decode.
+func TestBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+
+	hash := blockOne.BlockHash()
+	msg := NewMsgBlockTxn(&hash)
+	msg.AddTransaction(blockOne.Transactions[0])
+
+	// Ensure the command is expected value.
+	wantCmd := "blocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	var readmsg MsgBlockTxn
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// The message must be rejected before the compact blocks version.
+	oldPver := CompactBlocksVersion - 1
+	if err := msg.BtcEncode(&buf, oldPver); err == nil {
+		t.Errorf("BtcEncode: did not fail for protocol version %d",
+			oldPver)
+	}
+}
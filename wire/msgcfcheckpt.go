@@ -0,0 +1,129 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+const (
+	// CFCheckptInterval is the gap (in number of blocks) between each
+	// filter header checkpoint.
+	CFCheckptInterval = 1000
+
+	// maxCFHeadersLen is the maximum number of filter headers that can be
+	// in a single cfcheckpt message, which is bound by the maximum size of
+	// a message.
+	maxCFHeadersLen = (MaxMessagePayload - 1 - chainhash.HashSize -
+		MaxVarIntPayload) / chainhash.HashSize
+)
+
+// MsgCFCheckpt implements the Message interface and represents a bitcoin
+// cfcheckpt message.  It is used to deliver the committed filter headers at
+// every CFCheckptInterval blocks in response to a getcfcheckpt
+// (MsgGetCFCheckpt) message.
+type MsgCFCheckpt struct {
+	FilterType    FilterType
+	StopHash      chainhash.Hash
+	FilterHeaders []*chainhash.Hash
+}
+
+// AddCFHeader adds a new committed filter header to the message.
+func (msg *MsgCFCheckpt) AddCFHeader(header *chainhash.Hash) error {
+	if len(msg.FilterHeaders) == cap(msg.FilterHeaders) {
+		str := fmt.Sprintf("FilterHeaders has insufficient capacity "+
+			"for additional header: len = %d", len(msg.FilterHeaders))
+		return messageError("MsgCFCheckpt.AddCFHeader", str)
+	}
+
+	msg.FilterHeaders = append(msg.FilterHeaders, header)
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFCheckpt) BtcDecode(r io.Reader, pver uint32) error {
+	err := readElements(r, &msg.FilterType, &msg.StopHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to decode more filter headers than could possibly fit into
+	// a message.
+	if count > maxCFHeadersLen {
+		str := fmt.Sprintf("too many filter headers for message "+
+			"[count %v, max %v]", count, maxCFHeadersLen)
+		return messageError("MsgCFCheckpt.BtcDecode", str)
+	}
+
+	// Create a contiguous slice of hashes to deserialize into in order to
+	// reduce the number of allocations.
+	hashes := make([]chainhash.Hash, count)
+	msg.FilterHeaders = make([]*chainhash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		hash := &hashes[i]
+		if err := readElement(r, hash); err != nil {
+			return err
+		}
+		msg.FilterHeaders = append(msg.FilterHeaders, hash)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFCheckpt) BtcEncode(w io.Writer, pver uint32) error {
+	err := writeElements(w, msg.FilterType, &msg.StopHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.FilterHeaders)))
+	if err != nil {
+		return err
+	}
+	for _, header := range msg.FilterHeaders {
+		if err := writeElement(w, header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFCheckpt) Command() string {
+	return CmdCFCheckpt
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFCheckpt) MaxPayloadLength(pver uint32) uint32 {
+	// The number of filter headers grows with the chain, so the message
+	// is only bound by the maximum message size.
+	return MaxMessagePayload
+}
+
+// NewMsgCFCheckpt returns a new bitcoin cfcheckpt message that conforms to the
+// Message interface.  See MsgCFCheckpt for details.  The message has capacity
+// for the passed number of filter headers.
+func NewMsgCFCheckpt(filterType FilterType, stopHash *chainhash.Hash,
+	headersCount int) *MsgCFCheckpt {
+	return &MsgCFCheckpt{
+		FilterType:    filterType,
+		StopHash:      *stopHash,
+		FilterHeaders: make([]*chainhash.Hash, 0, headersCount),
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestCFCheckpt tests the MsgCFCheckpt API and wire encode and decode.
+func TestCFCheckpt(t *testing.T) {
+	pver := ProtocolVersion
+
+	stopHash := chainhash.Hash{0x01}
+	msg := NewMsgCFCheckpt(GCSFilterRegular, &stopHash, 2)
+
+	// Ensure the command is expected value.
+	wantCmd := "cfcheckpt"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCFCheckpt: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(MaxMessagePayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Headers can only be added up to the capacity of the message.
+	headers := []chainhash.Hash{{0x02}, {0x03}}
+	for i := range headers {
+		if err := msg.AddCFHeader(&headers[i]); err != nil {
+			t.Fatalf("AddCFHeader: unexpected error: %v", err)
+		}
+	}
+	if err := msg.AddCFHeader(&headers[0]); err == nil {
+		t.Errorf("AddCFHeader: did not fail beyond capacity")
+	}
+
+	// Encode the message to wire format.
+	wantBuf := append([]byte{0x00}, stopHash[:]...) // Filter type, hash
+	wantBuf = append(wantBuf, 0x02)                 // Number of headers
+	wantBuf = append(wantBuf, headers[0][:]...)
+	wantBuf = append(wantBuf, headers[1][:]...)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	// Decode the message from wire format.
+	var readmsg MsgCFCheckpt
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Messages which claim more headers than fit into a message must fail
+	// to decode.
+	tooMany := append([]byte{0x00}, stopHash[:]...)
+	tooMany = append(tooMany, 0xfe, 0x00, 0x00, 0x00, 0x01) // 2^24 headers
+	if err := readmsg.BtcDecode(bytes.NewReader(tooMany), pver); err == nil {
+		t.Errorf("BtcDecode: did not fail for too many headers")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// MaxCFHeadersPerMsg is the maximum number of committed filter hashes that can
+// be in a single cfheaders message.
+const MaxCFHeadersPerMsg = 2000
+
+// MsgCFHeaders implements the Message interface and represents a bitcoin
+// cfheaders message.  It is used to deliver the hashes of committed filters in
+// response to a getcfheaders (MsgGetCFHeaders) message.  The filter headers of
+// the blocks can be calculated from the hashes starting with the filter header
+// of the block before the first one, PrevFilterHeader.
+type MsgCFHeaders struct {
+	FilterType       FilterType
+	StopHash         chainhash.Hash
+	PrevFilterHeader chainhash.Hash
+	FilterHashes     []*chainhash.Hash
+}
+
+// AddCFHash adds a new filter hash to the message.
+func (msg *MsgCFHeaders) AddCFHash(hash *chainhash.Hash) error {
+	if len(msg.FilterHashes)+1 > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many block headers in message [max %v]",
+			MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.AddCFHash", str)
+	}
+
+	msg.FilterHashes = append(msg.FilterHashes, hash)
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) BtcDecode(r io.Reader, pver uint32) error {
+	err := readElements(r, &msg.FilterType, &msg.StopHash,
+		&msg.PrevFilterHeader)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max committed filter hashes per message.
+	if count > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many committed filter hashes for "+
+			"message [count %v, max %v]", count, MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.BtcDecode", str)
+	}
+
+	// Create a contiguous slice of hashes to deserialize into in order to
+	// reduce the number of allocations.
+	hashes := make([]chainhash.Hash, count)
+	msg.FilterHashes = make([]*chainhash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		hash := &hashes[i]
+		if err := readElement(r, hash); err != nil {
+			return err
+		}
+		msg.FilterHashes = append(msg.FilterHashes, hash)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) BtcEncode(w io.Writer, pver uint32) error {
+	count := len(msg.FilterHashes)
+	if count > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many committed filter hashes for "+
+			"message [count %v, max %v]", count, MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.BtcEncode", str)
+	}
+
+	err := writeElements(w, msg.FilterType, &msg.StopHash,
+		&msg.PrevFilterHeader)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	for _, hash := range msg.FilterHashes {
+		if err := writeElement(w, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFHeaders) Command() string {
+	return CmdCFHeaders
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type 1 byte + stop hash + previous filter header + num
+	// hashes (varInt) + max hashes.
+	return 1 + chainhash.HashSize + chainhash.HashSize +
+		MaxVarIntPayload + (MaxCFHeadersPerMsg * chainhash.HashSize)
+}
+
+// NewMsgCFHeaders returns a new bitcoin cfheaders message that conforms to the
+// Message interface.  See MsgCFHeaders for details.
+func NewMsgCFHeaders(filterType FilterType, stopHash,
+	prevFilterHeader *chainhash.Hash) *MsgCFHeaders {
+	return &MsgCFHeaders{
+		FilterType:       filterType,
+		StopHash:         *stopHash,
+		PrevFilterHeader: *prevFilterHeader,
+		FilterHashes: make([]*chainhash.Hash, 0,
+			MaxCFHeadersPerMsg),
+	}
+}
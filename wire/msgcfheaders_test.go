@@ -0,0 +1,89 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestCFHeaders tests the MsgCFHeaders API and wire encode and decode.
+func TestCFHeaders(t *testing.T) {
+	pver := ProtocolVersion
+
+	stopHash := chainhash.Hash{0x01}
+	prevHeader := chainhash.Hash{0x02}
+	msg := NewMsgCFHeaders(GCSFilterRegular, &stopHash, &prevHeader)
+
+	// Ensure the command is expected value.
+	wantCmd := "cfheaders"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCFHeaders: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(1 + 32 + 32 + 9 + MaxCFHeadersPerMsg*32)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	filterHash := chainhash.Hash{0x03}
+	if err := msg.AddCFHash(&filterHash); err != nil {
+		t.Fatalf("AddCFHash: unexpected error: %v", err)
+	}
+
+	// Encode the message to wire format.
+	wantBuf := []byte{0x00} // Filter type
+	wantBuf = append(wantBuf, stopHash[:]...)
+	wantBuf = append(wantBuf, prevHeader[:]...)
+	wantBuf = append(wantBuf, 0x01) // Number of hashes
+	wantBuf = append(wantBuf, filterHash[:]...)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	// Decode the message from wire format.
+	var readmsg MsgCFHeaders
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(readmsg.FilterHashes, msg.FilterHashes) ||
+		readmsg.StopHash != msg.StopHash ||
+		readmsg.PrevFilterHeader != msg.PrevFilterHeader {
+
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Adding more than the maximum number of hashes must fail.
+	for i := 1; i < MaxCFHeadersPerMsg; i++ {
+		if err := msg.AddCFHash(&filterHash); err != nil {
+			t.Fatalf("AddCFHash: unexpected error: %v", err)
+		}
+	}
+	if err := msg.AddCFHash(&filterHash); err == nil {
+		t.Errorf("AddCFHash: did not fail for too many hashes")
+	}
+
+	// Messages which claim too many hashes must fail to decode.
+	tooMany := append([]byte{0x00}, make([]byte, 64)...)
+	tooMany = append(tooMany, 0xfd, 0xd1, 0x07) // 2001 hashes
+	if err := readmsg.BtcDecode(bytes.NewReader(tooMany), pver); err == nil {
+		t.Errorf("BtcDecode: did not fail for too many hashes")
+	}
+}
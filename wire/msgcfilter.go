@@ -0,0 +1,93 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// FilterType is used to represent a filter type.
+type FilterType uint8
+
+const (
+	// GCSFilterRegular is the regular filter type of BIP0158, which in
+	// Prova also contains the ASP key ids of the scripts in a block.
+	GCSFilterRegular FilterType = iota
+)
+
+const (
+	// MaxCFilterDataSize is the maximum byte size of a committed filter.
+	// The maximum size is currently defined as 256KiB.
+	MaxCFilterDataSize = 256 * 1024
+)
+
+// MsgCFilter implements the Message interface and represents a bitcoin cfilter
+// message.  It is used to deliver a committed filter in response to a
+// getcfilters (MsgGetCFilters) message.
+type MsgCFilter struct {
+	FilterType FilterType
+	BlockHash  chainhash.Hash
+	Data       []byte
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFilter) BtcDecode(r io.Reader, pver uint32) error {
+	err := readElements(r, &msg.FilterType, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	msg.Data, err = ReadVarBytes(r, pver, MaxCFilterDataSize,
+		"cfilter data")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFilter) BtcEncode(w io.Writer, pver uint32) error {
+	size := len(msg.Data)
+	if size > MaxCFilterDataSize {
+		str := fmt.Sprintf("cfilter size too large for message "+
+			"[size %v, max %v]", size, MaxCFilterDataSize)
+		return messageError("MsgCFilter.BtcEncode", str)
+	}
+
+	err := writeElements(w, msg.FilterType, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	return WriteVarBytes(w, pver, msg.Data)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFilter) Command() string {
+	return CmdCFilter
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFilter) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type 1 byte + block hash + max data size with its length.
+	return 1 + chainhash.HashSize +
+		uint32(VarIntSerializeSize(MaxCFilterDataSize)) +
+		MaxCFilterDataSize
+}
+
+// NewMsgCFilter returns a new bitcoin cfilter message that conforms to the
+// Message interface.  See MsgCFilter for details.
+func NewMsgCFilter(filterType FilterType, blockHash *chainhash.Hash,
+	data []byte) *MsgCFilter {
+	return &MsgCFilter{
+		FilterType: filterType,
+		BlockHash:  *blockHash,
+		Data:       data,
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+const (
+	// ShortTxIDSize is the number of bytes of a short transaction id in a
+	// cmpctblock message.
+	ShortTxIDSize = 6
+
+	// shortTxIDMask masks a SipHash value down to a short transaction id.
+	shortTxIDMask = 1<<(8*ShortTxIDSize) - 1
+)
+
+// PrefilledTx is a transaction which is sent in full as part of a cmpctblock
+// message along with its index in the block.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message.  It is used to relay a block as its header along with
+// short ids of its transactions, so the receiving peer can reconstruct the
+// block from the transactions it already has, such as those in its memory
+// pool.  Transactions the receiving peer is unlikely to have, such as the
+// coinbase, are sent in full as prefilled transactions.
+//
+// The short id of a transaction is calculated from the hash of the transaction
+// including its signatures.  See ShortTxID.
+//
+// The prefilled transaction indexes are differentially encoded on the wire as
+// described by BIP0152, but are absolute block indexes in PrefilledTxns.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgCmpctBlock struct {
+	Header        BlockHeader
+	Nonce         uint64
+	ShortIDs      []uint64
+	PrefilledTxns []PrefilledTx
+}
+
+// readDiffIndex reads a differentially encoded index which follows the passed
+// previous index, or -1 for the first index, and ensures it is in range.
+func readDiffIndex(r io.Reader, pver uint32, prev int64, funcName string) (uint32, error) {
+	diff, err := ReadVarInt(r, pver)
+	if err != nil {
+		return 0, err
+	}
+	if diff >= maxTxPerBlock {
+		str := fmt.Sprintf("index offset %d exceeds max of %d", diff,
+			maxTxPerBlock)
+		return 0, messageError(funcName, str)
+	}
+	index := prev + 1 + int64(diff)
+	if index >= maxTxPerBlock {
+		str := fmt.Sprintf("index %d exceeds max of %d", index,
+			maxTxPerBlock)
+		return 0, messageError(funcName, str)
+	}
+	return uint32(index), nil
+}
+
+// writeDiffIndex writes the passed index differentially encoded against the
+// passed previous index, or -1 for the first index.  The indexes must be
+// strictly increasing.
+func writeDiffIndex(w io.Writer, pver uint32, prev int64, index uint32, funcName string) error {
+	if int64(index) <= prev {
+		str := fmt.Sprintf("index %d does not follow %d", index, prev)
+		return messageError(funcName, str)
+	}
+	return WriteVarInt(w, pver, uint64(int64(index)-prev-1))
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Prevent more short ids than could possibly fit into a block.
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	msg.ShortIDs = make([]uint64, 0, count)
+	var buf [8]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf[:ShortTxIDSize]); err != nil {
+			return err
+		}
+		msg.ShortIDs = append(msg.ShortIDs, littleEndian.Uint64(buf[:]))
+	}
+
+	count, err = ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock-uint64(len(msg.ShortIDs)) {
+		str := fmt.Sprintf("too many prefilled transactions for "+
+			"message [count %d, max %d]", count,
+			maxTxPerBlock-uint64(len(msg.ShortIDs)))
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	msg.PrefilledTxns = make([]PrefilledTx, 0, count)
+	prev := int64(-1)
+	for i := uint64(0); i < count; i++ {
+		index, err := readDiffIndex(r, pver, prev,
+			"MsgCmpctBlock.BtcDecode")
+		if err != nil {
+			return err
+		}
+		tx := MsgTx{}
+		if err := tx.BtcDecode(r, pver); err != nil {
+			return err
+		}
+		msg.PrefilledTxns = append(msg.PrefilledTxns,
+			PrefilledTx{Index: index, Tx: &tx})
+		prev = int64(index)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var buf [8]byte
+	for _, shortID := range msg.ShortIDs {
+		littleEndian.PutUint64(buf[:], shortID)
+		if _, err := w.Write(buf[:ShortTxIDSize]); err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxns)))
+	if err != nil {
+		return err
+	}
+	prev := int64(-1)
+	for _, prefilled := range msg.PrefilledTxns {
+		err := writeDiffIndex(w, pver, prev, prefilled.Index,
+			"MsgCmpctBlock.BtcEncode")
+		if err != nil {
+			return err
+		}
+		if err := prefilled.Tx.BtcEncode(w, pver); err != nil {
+			return err
+		}
+		prev = int64(prefilled.Index)
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// A compact block is never larger than the block it represents.
+	return MaxBlockPayload
+}
+
+// BlockHash computes the block identifier hash for the block the compact
+// block represents.
+func (msg *MsgCmpctBlock) BlockHash() chainhash.Hash {
+	return msg.Header.BlockHash()
+}
+
+// TxCount returns the number of transactions in the block the compact block
+// represents.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxns)
+}
+
+// shortIDKeys returns the SipHash keys used to calculate the short transaction
+// ids for the compact block.  They are the first two little-endian 64-bit
+// integers of the single SHA256 of the serialized header and nonce.
+func (msg *MsgCmpctBlock) shortIDKeys() (uint64, uint64) {
+	var buf bytes.Buffer
+	_ = writeBlockHeader(&buf, 0, &msg.Header)
+	_ = writeElement(&buf, msg.Nonce)
+	hash := sha256.Sum256(buf.Bytes())
+	return littleEndian.Uint64(hash[0:8]), littleEndian.Uint64(hash[8:16])
+}
+
+// ShortTxID returns the short transaction id of the transaction with the
+// passed hash for the compact block.  The hash must be the hash of the
+// transaction including its signatures, as returned by MsgTx.TxHashWithSig, so
+// the short id identifies the exact transaction that is in the block.
+func (msg *MsgCmpctBlock) ShortTxID(txHashWithSig *chainhash.Hash) uint64 {
+	k0, k1 := msg.shortIDKeys()
+	return chainhash.SipHash24(k0, k1, txHashWithSig[:]) & shortTxIDMask
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message that conforms to
+// the Message interface and represents the passed block.  The coinbase
+// transaction is prefilled and all other transactions are represented by
+// their short ids.  See MsgCmpctBlock for details.
+func NewMsgCmpctBlock(block *MsgBlock, nonce uint64) *MsgCmpctBlock {
+	msg := &MsgCmpctBlock{
+		Header: block.Header,
+		Nonce:  nonce,
+	}
+	if len(block.Transactions) == 0 {
+		return msg
+	}
+
+	msg.PrefilledTxns = []PrefilledTx{{Index: 0, Tx: block.Transactions[0]}}
+	msg.ShortIDs = make([]uint64, 0, len(block.Transactions)-1)
+	k0, k1 := msg.shortIDKeys()
+	for _, tx := range block.Transactions[1:] {
+		hash := tx.TxHashWithSig()
+		msg.ShortIDs = append(msg.ShortIDs,
+			chainhash.SipHash24(k0, k1, hash[:])&shortTxIDMask)
+	}
+	return msg
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestCmpctBlock tests the MsgCmpctBlock API and wire encode and decode.
+func TestCmpctBlock(t *testing.T) {
+	pver := ProtocolVersion
+
+	block := blockOne
+	tx := blockOne.Transactions[0].Copy()
+	tx.LockTime = 1
+	block.Transactions = append([]*MsgTx{}, blockOne.Transactions[0], tx)
+	msg := NewMsgCmpctBlock(&block, 0x1122334455667788)
+
+	// Ensure the command is expected value.
+	wantCmd := "cmpctblock"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCmpctBlock: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// The coinbase must be prefilled and every other transaction must be
+	// represented by its short id.
+	if len(msg.PrefilledTxns) != 1 || msg.PrefilledTxns[0].Index != 0 ||
+		msg.PrefilledTxns[0].Tx != block.Transactions[0] {
+		t.Fatalf("NewMsgCmpctBlock: wrong prefilled transactions - "+
+			"got %v", spew.Sdump(msg.PrefilledTxns))
+	}
+	hash := tx.TxHashWithSig()
+	if len(msg.ShortIDs) != 1 || msg.ShortIDs[0] != msg.ShortTxID(&hash) {
+		t.Fatalf("NewMsgCmpctBlock: wrong short ids - got %v",
+			msg.ShortIDs)
+	}
+	if msg.ShortIDs[0]>>(8*ShortTxIDSize) != 0 {
+		t.Errorf("ShortTxID: %x is larger than %d bytes",
+			msg.ShortIDs[0], ShortTxIDSize)
+	}
+	if msg.TxCount() != len(block.Transactions) {
+		t.Errorf("TxCount: got %d, want %d", msg.TxCount(),
+			len(block.Transactions))
+	}
+	if msg.BlockHash() != block.BlockHash() {
+		t.Errorf("BlockHash: got %v, want %v", msg.BlockHash(),
+			block.BlockHash())
+	}
+
+	// Encode and decode the message.
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	var readmsg MsgCmpctBlock
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Prefilled transaction indexes must be strictly increasing.
+	msg.PrefilledTxns = append(msg.PrefilledTxns, msg.PrefilledTxns[0])
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Errorf("BtcEncode: did not fail for duplicate prefilled " +
+			"transaction index")
+	}
+
+	// The message must be rejected before the compact blocks version.
+	oldPver := CompactBlocksVersion - 1
+	if err := msg.BtcEncode(&buf, oldPver); err == nil {
+		t.Errorf("BtcEncode: did not fail for protocol version %d",
+			oldPver)
+	}
+}
+
+// TestCmpctBlockShortIDSigs ensures transactions which only differ in their
+// signatures, and therefore have the same hash, have different short ids.
+func TestCmpctBlockShortIDSigs(t *testing.T) {
+	tx1 := blockOne.Transactions[0].Copy()
+	tx1.TxIn[0].SignatureScript = []byte{0x01}
+	tx2 := blockOne.Transactions[0].Copy()
+	tx2.TxIn[0].SignatureScript = []byte{0x02}
+	if tx1.TxHash() != tx2.TxHash() {
+		t.Fatalf("transactions with different signatures have " +
+			"different hashes")
+	}
+
+	msg := NewMsgCmpctBlock(&MsgBlock{
+		Header:       blockOne.Header,
+		Transactions: []*MsgTx{blockOne.Transactions[0], tx1, tx2},
+	}, 0)
+	if msg.ShortIDs[0] == msg.ShortIDs[1] {
+		t.Errorf("transactions with different signatures have the " +
+			"same short id")
+	}
+}
+
+// TestCmpctBlockWireErrors performs negative tests against wire decode of
+// MsgCmpctBlock to confirm error paths work correctly.
+func TestCmpctBlockWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+
+	var buf bytes.Buffer
+	if err := writeBlockHeader(&buf, pver, &blockOne.Header); err != nil {
+		t.Fatalf("writeBlockHeader error %v", err)
+	}
+	if err := writeElement(&buf, uint64(0)); err != nil {
+		t.Fatalf("writeElement error %v", err)
+	}
+	prefix := buf.Bytes()
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{
+			"too many short ids",
+			append(append([]byte{}, prefix...), 0xfe, 0xff, 0xff,
+				0xff, 0x7f),
+		},
+		{
+			"prefilled index out of range",
+			append(append([]byte{}, prefix...), 0x00, 0x01, 0xfe,
+				0xff, 0xff, 0xff, 0x7f),
+		},
+	}
+
+	for _, test := range tests {
+		var msg MsgCmpctBlock
+		err := msg.BtcDecode(bytes.NewReader(test.buf), pver)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: wrong error - got %v, want MessageError",
+				test.name, err)
+		}
+	}
+}
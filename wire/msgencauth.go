@@ -0,0 +1,91 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// MaxEncAuthKeySize is the maximum size of the identity public key
+	// carried by an encauth message.
+	MaxEncAuthKeySize = 33
+
+	// MaxEncAuthSigSize is the maximum size of the DER encoded signature
+	// carried by an encauth message.
+	MaxEncAuthSigSize = 72
+)
+
+// MsgEncAuth implements the Message interface and represents a Prova encauth
+// message.  It is the first message sent over an encrypted transport and
+// proves that the sender possesses the private key for PubKey by signing the
+// session identifier both peers derived from the encinit exchange.
+//
+// A peer that has no identity key sends an encauth message with an empty
+// PubKey and Signature.
+type MsgEncAuth struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgEncAuth) BtcDecode(r io.Reader, pver uint32) error {
+	var err error
+	msg.PubKey, err = ReadVarBytes(r, pver, MaxEncAuthKeySize,
+		"encauth public key")
+	if err != nil {
+		return err
+	}
+
+	msg.Signature, err = ReadVarBytes(r, pver, MaxEncAuthSigSize,
+		"encauth signature")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgEncAuth) BtcEncode(w io.Writer, pver uint32) error {
+	if len(msg.PubKey) > MaxEncAuthKeySize {
+		str := fmt.Sprintf("public key too long [len %v, max %v]",
+			len(msg.PubKey), MaxEncAuthKeySize)
+		return messageError("MsgEncAuth.BtcEncode", str)
+	}
+	if len(msg.Signature) > MaxEncAuthSigSize {
+		str := fmt.Sprintf("signature too long [len %v, max %v]",
+			len(msg.Signature), MaxEncAuthSigSize)
+		return messageError("MsgEncAuth.BtcEncode", str)
+	}
+
+	if err := WriteVarBytes(w, pver, msg.PubKey); err != nil {
+		return err
+	}
+	return WriteVarBytes(w, pver, msg.Signature)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgEncAuth) Command() string {
+	return CmdEncAuth
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgEncAuth) MaxPayloadLength(pver uint32) uint32 {
+	return uint32(VarIntSerializeSize(MaxEncAuthKeySize)) +
+		MaxEncAuthKeySize +
+		uint32(VarIntSerializeSize(MaxEncAuthSigSize)) +
+		MaxEncAuthSigSize
+}
+
+// NewMsgEncAuth returns a new Prova encauth message that conforms to the
+// Message interface.  See MsgEncAuth for details.
+func NewMsgEncAuth(pubKey, signature []byte) *MsgEncAuth {
+	return &MsgEncAuth{
+		PubKey:    pubKey,
+		Signature: signature,
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestEncAuth tests the MsgEncAuth API.
+func TestEncAuth(t *testing.T) {
+	pver := ProtocolVersion
+
+	// Ensure the command is expected value.
+	msg := NewMsgEncAuth(nil, nil)
+	wantCmd := "encauth"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgEncAuth: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(107)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+}
+
+// TestEncAuthWire tests the MsgEncAuth wire encode and decode.
+func TestEncAuthWire(t *testing.T) {
+	tests := []struct {
+		in  *MsgEncAuth // Message to encode
+		out *MsgEncAuth // Expected decoded message
+		buf []byte      // Wire encoding
+	}{
+		// No identity key.
+		{
+			NewMsgEncAuth(nil, nil),
+			NewMsgEncAuth([]byte{}, []byte{}),
+			[]byte{0x00, 0x00},
+		},
+
+		// Identity key and signature.
+		{
+			NewMsgEncAuth([]byte{0x02, 0x01}, []byte{0x30, 0x02}),
+			NewMsgEncAuth([]byte{0x02, 0x01}, []byte{0x30, 0x02}),
+			[]byte{0x02, 0x02, 0x01, 0x02, 0x30, 0x02},
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgEncAuth
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.BtcDecode(rbuf, ProtocolVersion)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.out) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestEncAuthWireErrors performs negative tests against wire encode and decode
+// of MsgEncAuth to confirm oversized fields are rejected.
+func TestEncAuthWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+
+	tooLong := make([]byte, MaxEncAuthSigSize+1)
+	tests := []*MsgEncAuth{
+		NewMsgEncAuth(tooLong[:MaxEncAuthKeySize+1], nil),
+		NewMsgEncAuth(nil, tooLong),
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, msg := range tests {
+		var buf bytes.Buffer
+		err := msg.BtcEncode(&buf, pver)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want "+
+				"MessageError", i, err)
+		}
+
+		// Force the oversized fields onto the wire and ensure they are
+		// rejected when decoding.
+		buf.Reset()
+		WriteVarBytes(&buf, pver, msg.PubKey)
+		WriteVarBytes(&buf, pver, msg.Signature)
+		var readmsg MsgEncAuth
+		err = readmsg.BtcDecode(&buf, pver)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want "+
+				"MessageError", i, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"io"
+)
+
+// EncInitKeySize is the size of the compressed secp256k1 ephemeral public key
+// carried by an encinit message.
+const EncInitKeySize = 33
+
+// MsgEncInit implements the Message interface and represents a Prova encinit
+// message.  It is sent by both peers directly after the version exchange when
+// they both advertise the SFNodeEncrypted service and carries the ephemeral
+// public key used to derive the session keys for the encrypted transport.
+type MsgEncInit struct {
+	EphemeralKey [EncInitKeySize]byte
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgEncInit) BtcDecode(r io.Reader, pver uint32) error {
+	_, err := io.ReadFull(r, msg.EphemeralKey[:])
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgEncInit) BtcEncode(w io.Writer, pver uint32) error {
+	_, err := w.Write(msg.EphemeralKey[:])
+	return err
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgEncInit) Command() string {
+	return CmdEncInit
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgEncInit) MaxPayloadLength(pver uint32) uint32 {
+	return EncInitKeySize
+}
+
+// NewMsgEncInit returns a new Prova encinit message that conforms to the
+// Message interface.  See MsgEncInit for details.
+func NewMsgEncInit(ephemeralKey [EncInitKeySize]byte) *MsgEncInit {
+	return &MsgEncInit{
+		EphemeralKey: ephemeralKey,
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestEncInit tests the MsgEncInit API and wire encode and decode.
+func TestEncInit(t *testing.T) {
+	pver := ProtocolVersion
+
+	var key [EncInitKeySize]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	msg := NewMsgEncInit(key)
+	if msg.EphemeralKey != key {
+		t.Errorf("NewMsgEncInit: wrong key - got %x, want %x",
+			msg.EphemeralKey, key)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "encinit"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgEncInit: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(33)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Encode the message to wire format.
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), key[:]) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(key[:]))
+	}
+
+	// Decode the message from wire format.
+	var readmsg MsgEncInit
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Decoding a short key must fail.
+	err := readmsg.BtcDecode(bytes.NewReader(key[:10]), pver)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("BtcDecode: wrong error for short key - got %v, "+
+			"want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a bitcoin
+// getblocktxn message.  It is used to request the transactions of a block,
+// previously announced with a cmpctblock message, which the requesting peer
+// was not able to find when reconstructing the block.
+//
+// The indexes are differentially encoded on the wire as described by BIP0152,
+// but are absolute block indexes in Indexes.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgGetBlockTxn struct {
+	BlockHash chainhash.Hash
+	Indexes   []uint32
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Prevent more indexes than could possibly fit into a block.
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	msg.Indexes = make([]uint32, 0, count)
+	prev := int64(-1)
+	for i := uint64(0); i < count; i++ {
+		index, err := readDiffIndex(r, pver, prev,
+			"MsgGetBlockTxn.BtcDecode")
+		if err != nil {
+			return err
+		}
+		msg.Indexes = append(msg.Indexes, index)
+		prev = int64(index)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.Indexes)))
+	if err != nil {
+		return err
+	}
+	prev := int64(-1)
+	for _, index := range msg.Indexes {
+		err := writeDiffIndex(w, pver, prev, index,
+			"MsgGetBlockTxn.BtcEncode")
+		if err != nil {
+			return err
+		}
+		prev = int64(index)
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes (varInt) + max allowed indexes, each of
+	// which is a varInt.
+	return chainhash.HashSize + MaxVarIntPayload +
+		(maxTxPerBlock * MaxVarIntPayload)
+}
+
+// NewMsgGetBlockTxn returns a new bitcoin getblocktxn message that conforms to
+// the Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *chainhash.Hash, indexes []uint32) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   indexes,
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxn tests the MsgGetBlockTxn API and wire encode and decode.
+func TestGetBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+
+	hash := chainhash.Hash{0x01}
+	msg := NewMsgGetBlockTxn(&hash, []uint32{1, 2, 300})
+
+	// Ensure the command is expected value.
+	wantCmd := "getblocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgGetBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// The indexes are differentially encoded.
+	wantBuf := append(append([]byte{}, hash[:]...),
+		0x03,             // Varint for number of indexes
+		0x01,             // Index 1
+		0x00,             // Index 2
+		0xfd, 0x29, 0x01, // Index 300
+	)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	var readmsg MsgGetBlockTxn
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Indexes must be strictly increasing.
+	msg.Indexes = []uint32{2, 1}
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Errorf("BtcEncode: did not fail for decreasing indexes")
+	}
+
+	// Decoding an index which could not be in a block must fail.
+	badBuf := append(append([]byte{}, hash[:]...), 0x02, 0x00, 0xfe,
+		0xff, 0xff, 0xff, 0xff)
+	err := readmsg.BtcDecode(bytes.NewReader(badBuf), pver)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for out of range index - "+
+			"got %v, want MessageError", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// MsgGetCFCheckpt implements the Message interface and represents a bitcoin
+// getcfcheckpt message.  It is used to request the committed filter headers at
+// every CFCheckptInterval blocks up to the block with StopHash, which are
+// delivered in a cfcheckpt (MsgCFCheckpt) message.
+type MsgGetCFCheckpt struct {
+	FilterType FilterType
+	StopHash   chainhash.Hash
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFCheckpt) BtcDecode(r io.Reader, pver uint32) error {
+	return readElements(r, &msg.FilterType, &msg.StopHash)
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFCheckpt) BtcEncode(w io.Writer, pver uint32) error {
+	return writeElements(w, msg.FilterType, &msg.StopHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFCheckpt) Command() string {
+	return CmdGetCFCheckpt
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFCheckpt) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type 1 byte + stop hash.
+	return 1 + chainhash.HashSize
+}
+
+// NewMsgGetCFCheckpt returns a new bitcoin getcfcheckpt message that conforms
+// to the Message interface.  See MsgGetCFCheckpt for details.
+func NewMsgGetCFCheckpt(filterType FilterType,
+	stopHash *chainhash.Hash) *MsgGetCFCheckpt {
+	return &MsgGetCFCheckpt{
+		FilterType: filterType,
+		StopHash:   *stopHash,
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// MsgGetCFHeaders implements the Message interface and represents a bitcoin
+// getcfheaders message.  It is used to request the hashes of the committed
+// filters for a range of blocks, from the block at StartHeight up to and
+// including the block with StopHash, which are delivered in a cfheaders
+// (MsgCFHeaders) message.
+type MsgGetCFHeaders struct {
+	FilterType  FilterType
+	StartHeight uint32
+	StopHash    chainhash.Hash
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) BtcDecode(r io.Reader, pver uint32) error {
+	return readElements(r, &msg.FilterType, &msg.StartHeight,
+		&msg.StopHash)
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) BtcEncode(w io.Writer, pver uint32) error {
+	return writeElements(w, msg.FilterType, msg.StartHeight,
+		&msg.StopHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Command() string {
+	return CmdGetCFHeaders
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type 1 byte + start height 4 bytes + stop hash.
+	return 1 + 4 + chainhash.HashSize
+}
+
+// NewMsgGetCFHeaders returns a new bitcoin getcfheaders message that conforms
+// to the Message interface.  See MsgGetCFHeaders for details.
+func NewMsgGetCFHeaders(filterType FilterType, startHeight uint32,
+	stopHash *chainhash.Hash) *MsgGetCFHeaders {
+	return &MsgGetCFHeaders{
+		FilterType:  filterType,
+		StartHeight: startHeight,
+		StopHash:    *stopHash,
+	}
+}
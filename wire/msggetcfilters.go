@@ -0,0 +1,63 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// MaxGetCFiltersReqRange is the maximum number of filters that may be
+// requested in a getcfilters message.
+const MaxGetCFiltersReqRange = 1000
+
+// MsgGetCFilters implements the Message interface and represents a bitcoin
+// getcfilters message.  It is used to request committed filters for a range of
+// blocks, from the block at StartHeight up to and including the block with
+// StopHash, which are delivered in cfilter (MsgCFilter) messages.
+type MsgGetCFilters struct {
+	FilterType  FilterType
+	StartHeight uint32
+	StopHash    chainhash.Hash
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFilters) BtcDecode(r io.Reader, pver uint32) error {
+	return readElements(r, &msg.FilterType, &msg.StartHeight,
+		&msg.StopHash)
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFilters) BtcEncode(w io.Writer, pver uint32) error {
+	return writeElements(w, msg.FilterType, msg.StartHeight,
+		&msg.StopHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFilters) Command() string {
+	return CmdGetCFilters
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFilters) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type 1 byte + start height 4 bytes + stop hash.
+	return 1 + 4 + chainhash.HashSize
+}
+
+// NewMsgGetCFilters returns a new bitcoin getcfilters message that conforms to
+// the Message interface.  See MsgGetCFilters for details.
+func NewMsgGetCFilters(filterType FilterType, startHeight uint32,
+	stopHash *chainhash.Hash) *MsgGetCFilters {
+	return &MsgGetCFilters{
+		FilterType:  filterType,
+		StartHeight: startHeight,
+		StopHash:    *stopHash,
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetCFilters tests the MsgGetCFilters API and wire encode and decode.
+func TestGetCFilters(t *testing.T) {
+	pver := ProtocolVersion
+
+	stopHash := chainhash.Hash{0x01, 0x02}
+	msg := NewMsgGetCFilters(GCSFilterRegular, 0x0102, &stopHash)
+
+	// Ensure the command is expected value.
+	wantCmd := "getcfilters"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgGetCFilters: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(37)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Encode the message to wire format.
+	wantBuf := []byte{
+		0x00,                   // Filter type
+		0x02, 0x01, 0x00, 0x00, // Start height
+	}
+	wantBuf = append(wantBuf, stopHash[:]...)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	// Decode the message from wire format.
+	var readmsg MsgGetCFilters
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Truncated messages must fail to decode.
+	err := readmsg.BtcDecode(bytes.NewReader(wantBuf[:len(wantBuf)-1]), pver)
+	if err == nil {
+		t.Errorf("BtcDecode: did not fail for truncated message")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// CmpctBlockVersion is the compact block version supported by this package.
+// Version 1 short transaction ids are calculated from the hash of the
+// transaction including its signatures (MsgTx.TxHashWithSig), since the hash
+// without signatures (MsgTx.TxHash) does not identify which signatures were
+// included in a block.
+const CmpctBlockVersion uint64 = 1
+
+// MsgSendCmpct implements the Message interface and represents a bitcoin
+// sendcmpct message.  It is used to signal that the sending peer supports
+// compact blocks of the specified version and, when Announce is set, that it
+// prefers new blocks to be announced with cmpctblock messages instead of inv
+// or headers messages.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgSendCmpct struct {
+	Announce bool
+	Version  uint64
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcDecode", str)
+	}
+
+	return readElements(r, &msg.Announce, &msg.Version)
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcEncode", str)
+	}
+
+	return writeElements(w, msg.Announce, msg.Version)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	// Announce flag 1 byte + version 8 bytes.
+	return 9
+}
+
+// NewMsgSendCmpct returns a new bitcoin sendcmpct message that conforms to the
+// Message interface.  See MsgSendCmpct for details.
+func NewMsgSendCmpct(announce bool, version uint64) *MsgSendCmpct {
+	return &MsgSendCmpct{
+		Announce: announce,
+		Version:  version,
+	}
+}
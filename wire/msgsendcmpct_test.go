@@ -0,0 +1,75 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendCmpct tests the MsgSendCmpct API and wire encode and decode.
+func TestSendCmpct(t *testing.T) {
+	pver := ProtocolVersion
+
+	msg := NewMsgSendCmpct(true, CmpctBlockVersion)
+	if !msg.Announce || msg.Version != CmpctBlockVersion {
+		t.Errorf("NewMsgSendCmpct: wrong fields - got %v", spew.Sdump(msg))
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "sendcmpct"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgSendCmpct: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(9)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Encode the message to wire format.
+	wantBuf := []byte{
+		0x01,                                           // Announce
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Version
+	}
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	// Decode the message from wire format.
+	var readmsg MsgSendCmpct
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readmsg),
+			spew.Sdump(msg))
+	}
+
+	// The message must be rejected before the compact blocks version.
+	oldPver := CompactBlocksVersion - 1
+	if err := msg.BtcEncode(&buf, oldPver); err == nil {
+		t.Errorf("BtcEncode: did not fail for protocol version %d",
+			oldPver)
+	}
+	err := readmsg.BtcDecode(bytes.NewReader(wantBuf), oldPver)
+	if err == nil {
+		t.Errorf("BtcDecode: did not fail for protocol version %d",
+			oldPver)
+	}
+}
@@ -13,7 +13,7 @@ import (
 
 const (
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 70013
+	ProtocolVersion uint32 = 70014
 
 	// MultipleAddressVersion is the protocol version which added multiple
 	// addresses per message (pver >= MultipleAddressVersion).
@@ -51,6 +51,10 @@ const (
 	// FeeFilterVersion is the protocol version which added a new
 	// feefilter message.
 	FeeFilterVersion uint32 = 70013
+
+	// CompactBlocksVersion is the protocol version which added the
+	// sendcmpct, cmpctblock, getblocktxn and blocktxn messages.
+	CompactBlocksVersion uint32 = 70014
 )
 
 // ServiceFlag identifies services supported by a bitcoin peer.
@@ -67,13 +71,25 @@ const (
 	// SFNodeBloom is a flag used to indiciate a peer supports bloom
 	// filtering.
 	SFNodeBloom
+
+	// SFNodeEncrypted is a flag used to indicate a peer supports the
+	// encrypted and authenticated transport negotiated with the encinit
+	// and encauth messages.
+	SFNodeEncrypted
+
+	// SFNodeCF is a flag used to indicate a peer supports committed
+	// filters (BIP0157) through the getcfilters, getcfheaders and
+	// getcfcheckpt commands.
+	SFNodeCF
 )
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeGetUTXO: "SFNodeGetUTXO",
-	SFNodeBloom:   "SFNodeBloom",
+	SFNodeNetwork:   "SFNodeNetwork",
+	SFNodeGetUTXO:   "SFNodeGetUTXO",
+	SFNodeBloom:     "SFNodeBloom",
+	SFNodeEncrypted: "SFNodeEncrypted",
+	SFNodeCF:        "SFNodeCF",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -82,6 +98,8 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeNetwork,
 	SFNodeGetUTXO,
 	SFNodeBloom,
+	SFNodeEncrypted,
+	SFNodeCF,
 }
 
 // String returns the ServiceFlag in human-readable form.